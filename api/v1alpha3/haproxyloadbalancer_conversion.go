@@ -17,20 +17,52 @@ limitations under the License.
 package v1alpha3
 
 import (
+	apiconversion "k8s.io/apimachinery/pkg/conversion"
 	infrav1alpha4 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
 	"sigs.k8s.io/controller-runtime/pkg/conversion"
 )
 
 // ConvertTo converts this HAProxyLoadBalancer to the Hub version (v1alpha4).
 func (src *HAProxyLoadBalancer) ConvertTo(dstRaw conversion.Hub) error { // nolint
 	dst := dstRaw.(*infrav1alpha4.HAProxyLoadBalancer)
-	return Convert_v1alpha3_HAProxyLoadBalancer_To_v1alpha4_HAProxyLoadBalancer(src, dst, nil)
+	if err := Convert_v1alpha3_HAProxyLoadBalancer_To_v1alpha4_HAProxyLoadBalancer(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Manually restore data.
+	restored := &infrav1alpha4.HAProxyLoadBalancer{}
+	if ok, err := utilconversion.UnmarshalData(src, restored); err != nil || !ok {
+		return err
+	}
+	restoreVirtualMachineCloneSpec(&restored.Spec.VirtualMachineConfiguration, &dst.Spec.VirtualMachineConfiguration)
+	dst.Spec.APIServerPort = restored.Spec.APIServerPort
+	dst.Spec.Frontends = restored.Spec.Frontends
+	dst.Spec.Replicas = restored.Spec.Replicas
+	dst.Spec.VirtualIP = restored.Spec.VirtualIP
+	dst.Spec.VirtualRouterID = restored.Spec.VirtualRouterID
+	dst.Spec.ConfigurationTemplate = restored.Spec.ConfigurationTemplate
+	dst.Status.Replicas = restored.Status.Replicas
+	dst.Status.CertificateAuthorityExpiry = restored.Status.CertificateAuthorityExpiry
+	dst.Status.ClientCertificateExpiry = restored.Status.ClientCertificateExpiry
+	dst.Status.Backends = restored.Status.Backends
+	dst.Status.BackendServers = restored.Status.BackendServers
+	dst.Status.Conditions = restored.Status.Conditions
+	return nil
 }
 
 // ConvertFrom converts from the Hub version (v1alpha4) to this HAProxyLoadBalancer.
 func (dst *HAProxyLoadBalancer) ConvertFrom(srcRaw conversion.Hub) error { // nolint
 	src := srcRaw.(*infrav1alpha4.HAProxyLoadBalancer)
-	return Convert_v1alpha4_HAProxyLoadBalancer_To_v1alpha3_HAProxyLoadBalancer(src, dst, nil)
+	if err := Convert_v1alpha4_HAProxyLoadBalancer_To_v1alpha3_HAProxyLoadBalancer(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Preserve Hub data on down-conversion.
+	if err := utilconversion.MarshalData(src, dst); err != nil {
+		return err
+	}
+	return nil
 }
 
 // ConvertTo converts this HAProxyLoadBalancerList to the Hub version (v1alpha4).
@@ -44,3 +76,11 @@ func (dst *HAProxyLoadBalancerList) ConvertFrom(srcRaw conversion.Hub) error { /
 	src := srcRaw.(*infrav1alpha4.HAProxyLoadBalancerList)
 	return Convert_v1alpha4_HAProxyLoadBalancerList_To_v1alpha3_HAProxyLoadBalancerList(src, dst, nil)
 }
+
+func Convert_v1alpha4_HAProxyLoadBalancerSpec_To_v1alpha3_HAProxyLoadBalancerSpec(in *infrav1alpha4.HAProxyLoadBalancerSpec, out *HAProxyLoadBalancerSpec, s apiconversion.Scope) error { // nolint
+	return autoConvert_v1alpha4_HAProxyLoadBalancerSpec_To_v1alpha3_HAProxyLoadBalancerSpec(in, out, s)
+}
+
+func Convert_v1alpha4_HAProxyLoadBalancerStatus_To_v1alpha3_HAProxyLoadBalancerStatus(in *infrav1alpha4.HAProxyLoadBalancerStatus, out *HAProxyLoadBalancerStatus, s apiconversion.Scope) error { // nolint
+	return autoConvert_v1alpha4_HAProxyLoadBalancerStatus_To_v1alpha3_HAProxyLoadBalancerStatus(in, out, s)
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	apiconversion "k8s.io/apimachinery/pkg/conversion"
+	infrav1alpha4 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+)
+
+func Convert_v1alpha4_VirtualMachineCloneSpec_To_v1alpha3_VirtualMachineCloneSpec(in *infrav1alpha4.VirtualMachineCloneSpec, out *VirtualMachineCloneSpec, s apiconversion.Scope) error { // nolint
+	return autoConvert_v1alpha4_VirtualMachineCloneSpec_To_v1alpha3_VirtualMachineCloneSpec(in, out, s)
+}
+
+func Convert_v1alpha4_NetworkDeviceSpec_To_v1alpha3_NetworkDeviceSpec(in *infrav1alpha4.NetworkDeviceSpec, out *NetworkDeviceSpec, s apiconversion.Scope) error { // nolint
+	return autoConvert_v1alpha4_NetworkDeviceSpec_To_v1alpha3_NetworkDeviceSpec(in, out, s)
+}
+
+func Convert_v1alpha4_NetworkSpec_To_v1alpha3_NetworkSpec(in *infrav1alpha4.NetworkSpec, out *NetworkSpec, s apiconversion.Scope) error { // nolint
+	return autoConvert_v1alpha4_NetworkSpec_To_v1alpha3_NetworkSpec(in, out, s)
+}
+
+// restoreVirtualMachineCloneSpec restores the fields of the clone spec which
+// do not exist in v1alpha3 from the data preserved on down-conversion.
+func restoreVirtualMachineCloneSpec(restored, dst *infrav1alpha4.VirtualMachineCloneSpec) {
+	dst.ContentLibrary = restored.ContentLibrary
+	dst.TemplateDisks = restored.TemplateDisks
+	dst.AdditionalDisks = restored.AdditionalDisks
+	dst.TagIDs = restored.TagIDs
+	dst.MachineNameAttribute = restored.MachineNameAttribute
+	dst.Customization = restored.Customization
+	dst.OS = restored.OS
+	dst.Network.Bonds = restored.Network.Bonds
+	dst.Network.VLANs = restored.Network.VLANs
+	dst.Network.Bridges = restored.Network.Bridges
+	for i := range dst.Network.Devices {
+		if i < len(restored.Network.Devices) {
+			dst.Network.Devices[i].IPPoolRef = restored.Network.Devices[i].IPPoolRef
+		}
+	}
+}
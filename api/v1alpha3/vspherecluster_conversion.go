@@ -38,6 +38,7 @@ func (src *VSphereCluster) ConvertTo(dstRaw conversion.Hub) error { // nolint
 	if restored.Spec.IdentityRef != nil {
 		dst.Spec.IdentityRef = restored.Spec.IdentityRef
 	}
+	dst.Spec.VMAntiAffinity = restored.Spec.VMAntiAffinity
 	return nil
 }
 
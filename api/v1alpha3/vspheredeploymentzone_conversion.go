@@ -0,0 +1,26 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	apiconversion "k8s.io/apimachinery/pkg/conversion"
+	infrav1alpha4 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+)
+
+func Convert_v1alpha4_VSphereDeploymentZoneSpec_To_v1alpha3_VSphereDeploymentZoneSpec(in *infrav1alpha4.VSphereDeploymentZoneSpec, out *VSphereDeploymentZoneSpec, s apiconversion.Scope) error { // nolint
+	return autoConvert_v1alpha4_VSphereDeploymentZoneSpec_To_v1alpha3_VSphereDeploymentZoneSpec(in, out, s)
+}
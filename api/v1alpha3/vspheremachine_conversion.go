@@ -18,19 +18,38 @@ package v1alpha3
 
 import (
 	infrav1alpha4 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
 	"sigs.k8s.io/controller-runtime/pkg/conversion"
 )
 
 // ConvertTo converts this VSphereMachine to the Hub version (v1alpha4).
 func (src *VSphereMachine) ConvertTo(dstRaw conversion.Hub) error { // nolint
 	dst := dstRaw.(*infrav1alpha4.VSphereMachine)
-	return Convert_v1alpha3_VSphereMachine_To_v1alpha4_VSphereMachine(src, dst, nil)
+	if err := Convert_v1alpha3_VSphereMachine_To_v1alpha4_VSphereMachine(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Manually restore data.
+	restored := &infrav1alpha4.VSphereMachine{}
+	if ok, err := utilconversion.UnmarshalData(src, restored); err != nil || !ok {
+		return err
+	}
+	restoreVirtualMachineCloneSpec(&restored.Spec.VirtualMachineCloneSpec, &dst.Spec.VirtualMachineCloneSpec)
+	return nil
 }
 
 // ConvertFrom converts from the Hub version (v1alpha4) to this VSphereMachine.
 func (dst *VSphereMachine) ConvertFrom(srcRaw conversion.Hub) error { // nolint
 	src := srcRaw.(*infrav1alpha4.VSphereMachine)
-	return Convert_v1alpha4_VSphereMachine_To_v1alpha3_VSphereMachine(src, dst, nil)
+	if err := Convert_v1alpha4_VSphereMachine_To_v1alpha3_VSphereMachine(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Preserve Hub data on down-conversion.
+	if err := utilconversion.MarshalData(src, dst); err != nil {
+		return err
+	}
+	return nil
 }
 
 // ConvertTo converts this VSphereMachineList to the Hub version (v1alpha4).
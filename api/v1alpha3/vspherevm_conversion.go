@@ -18,19 +18,38 @@ package v1alpha3
 
 import (
 	infrav1alpha4 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
 	"sigs.k8s.io/controller-runtime/pkg/conversion"
 )
 
 // ConvertTo converts this VSphereVM to the Hub version (v1alpha4).
 func (src *VSphereVM) ConvertTo(dstRaw conversion.Hub) error { // nolint
 	dst := dstRaw.(*infrav1alpha4.VSphereVM)
-	return Convert_v1alpha3_VSphereVM_To_v1alpha4_VSphereVM(src, dst, nil)
+	if err := Convert_v1alpha3_VSphereVM_To_v1alpha4_VSphereVM(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Manually restore data.
+	restored := &infrav1alpha4.VSphereVM{}
+	if ok, err := utilconversion.UnmarshalData(src, restored); err != nil || !ok {
+		return err
+	}
+	restoreVirtualMachineCloneSpec(&restored.Spec.VirtualMachineCloneSpec, &dst.Spec.VirtualMachineCloneSpec)
+	return nil
 }
 
 // ConvertFrom converts from the Hub version (v1alpha4) to this VSphereVM.
 func (dst *VSphereVM) ConvertFrom(srcRaw conversion.Hub) error { // nolint
 	src := srcRaw.(*infrav1alpha4.VSphereVM)
-	return Convert_v1alpha4_VSphereVM_To_v1alpha3_VSphereVM(src, dst, nil)
+	if err := Convert_v1alpha4_VSphereVM_To_v1alpha3_VSphereVM(src, dst, nil); err != nil {
+		return err
+	}
+
+	// Preserve Hub data on down-conversion.
+	if err := utilconversion.MarshalData(src, dst); err != nil {
+		return err
+	}
+	return nil
 }
 
 // ConvertTo converts this VSphereVMList to the Hub version (v1alpha4).
@@ -174,11 +174,6 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.FailureDomainHostGroup)(nil), (*FailureDomainHostGroup)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_FailureDomainHostGroup_To_v1alpha3_FailureDomainHostGroup(a.(*v1alpha4.FailureDomainHostGroup), b.(*FailureDomainHostGroup), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*HAProxyLoadBalancer)(nil), (*v1alpha4.HAProxyLoadBalancer)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_HAProxyLoadBalancer_To_v1alpha4_HAProxyLoadBalancer(a.(*HAProxyLoadBalancer), b.(*v1alpha4.HAProxyLoadBalancer), scope)
 	}); err != nil {
@@ -204,21 +199,11 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.HAProxyLoadBalancerSpec)(nil), (*HAProxyLoadBalancerSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_HAProxyLoadBalancerSpec_To_v1alpha3_HAProxyLoadBalancerSpec(a.(*v1alpha4.HAProxyLoadBalancerSpec), b.(*HAProxyLoadBalancerSpec), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*HAProxyLoadBalancerStatus)(nil), (*v1alpha4.HAProxyLoadBalancerStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_HAProxyLoadBalancerStatus_To_v1alpha4_HAProxyLoadBalancerStatus(a.(*HAProxyLoadBalancerStatus), b.(*v1alpha4.HAProxyLoadBalancerStatus), scope)
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.HAProxyLoadBalancerStatus)(nil), (*HAProxyLoadBalancerStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_HAProxyLoadBalancerStatus_To_v1alpha3_HAProxyLoadBalancerStatus(a.(*v1alpha4.HAProxyLoadBalancerStatus), b.(*HAProxyLoadBalancerStatus), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*Network)(nil), (*v1alpha4.Network)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_Network_To_v1alpha4_Network(a.(*Network), b.(*v1alpha4.Network), scope)
 	}); err != nil {
@@ -234,11 +219,6 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.NetworkDeviceSpec)(nil), (*NetworkDeviceSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_NetworkDeviceSpec_To_v1alpha3_NetworkDeviceSpec(a.(*v1alpha4.NetworkDeviceSpec), b.(*NetworkDeviceSpec), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*NetworkRouteSpec)(nil), (*v1alpha4.NetworkRouteSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_NetworkRouteSpec_To_v1alpha4_NetworkRouteSpec(a.(*NetworkRouteSpec), b.(*v1alpha4.NetworkRouteSpec), scope)
 	}); err != nil {
@@ -254,11 +234,6 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.NetworkSpec)(nil), (*NetworkSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_NetworkSpec_To_v1alpha3_NetworkSpec(a.(*v1alpha4.NetworkSpec), b.(*NetworkSpec), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*NetworkStatus)(nil), (*v1alpha4.NetworkStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_NetworkStatus_To_v1alpha4_NetworkStatus(a.(*NetworkStatus), b.(*v1alpha4.NetworkStatus), scope)
 	}); err != nil {
@@ -409,11 +384,6 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.VSphereDeploymentZoneSpec)(nil), (*VSphereDeploymentZoneSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_VSphereDeploymentZoneSpec_To_v1alpha3_VSphereDeploymentZoneSpec(a.(*v1alpha4.VSphereDeploymentZoneSpec), b.(*VSphereDeploymentZoneSpec), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*VSphereDeploymentZoneStatus)(nil), (*v1alpha4.VSphereDeploymentZoneStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_VSphereDeploymentZoneStatus_To_v1alpha4_VSphereDeploymentZoneStatus(a.(*VSphereDeploymentZoneStatus), b.(*v1alpha4.VSphereDeploymentZoneStatus), scope)
 	}); err != nil {
@@ -599,8 +569,28 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.VirtualMachineCloneSpec)(nil), (*VirtualMachineCloneSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_VirtualMachineCloneSpec_To_v1alpha3_VirtualMachineCloneSpec(a.(*v1alpha4.VirtualMachineCloneSpec), b.(*VirtualMachineCloneSpec), scope)
+	if err := s.AddConversionFunc((*v1alpha4.FailureDomainHostGroup)(nil), (*FailureDomainHostGroup)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_FailureDomainHostGroup_To_v1alpha3_FailureDomainHostGroup(a.(*v1alpha4.FailureDomainHostGroup), b.(*FailureDomainHostGroup), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha4.HAProxyLoadBalancerSpec)(nil), (*HAProxyLoadBalancerSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_HAProxyLoadBalancerSpec_To_v1alpha3_HAProxyLoadBalancerSpec(a.(*v1alpha4.HAProxyLoadBalancerSpec), b.(*HAProxyLoadBalancerSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha4.HAProxyLoadBalancerStatus)(nil), (*HAProxyLoadBalancerStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_HAProxyLoadBalancerStatus_To_v1alpha3_HAProxyLoadBalancerStatus(a.(*v1alpha4.HAProxyLoadBalancerStatus), b.(*HAProxyLoadBalancerStatus), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha4.NetworkDeviceSpec)(nil), (*NetworkDeviceSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_NetworkDeviceSpec_To_v1alpha3_NetworkDeviceSpec(a.(*v1alpha4.NetworkDeviceSpec), b.(*NetworkDeviceSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha4.NetworkSpec)(nil), (*NetworkSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_NetworkSpec_To_v1alpha3_NetworkSpec(a.(*v1alpha4.NetworkSpec), b.(*NetworkSpec), scope)
 	}); err != nil {
 		return err
 	}
@@ -609,6 +599,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddConversionFunc((*v1alpha4.VSphereDeploymentZoneSpec)(nil), (*VSphereDeploymentZoneSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_VSphereDeploymentZoneSpec_To_v1alpha3_VSphereDeploymentZoneSpec(a.(*v1alpha4.VSphereDeploymentZoneSpec), b.(*VSphereDeploymentZoneSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha4.VirtualMachineCloneSpec)(nil), (*VirtualMachineCloneSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_VirtualMachineCloneSpec_To_v1alpha3_VirtualMachineCloneSpec(a.(*v1alpha4.VirtualMachineCloneSpec), b.(*VirtualMachineCloneSpec), scope)
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -994,14 +994,10 @@ func Convert_v1alpha3_FailureDomainHostGroup_To_v1alpha4_FailureDomainHostGroup(
 func autoConvert_v1alpha4_FailureDomainHostGroup_To_v1alpha3_FailureDomainHostGroup(in *v1alpha4.FailureDomainHostGroup, out *FailureDomainHostGroup, s conversion.Scope) error {
 	out.Name = in.Name
 	out.AutoConfigure = (*bool)(unsafe.Pointer(in.AutoConfigure))
+	// WARNING: in.VMGroupName requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_FailureDomainHostGroup_To_v1alpha3_FailureDomainHostGroup is an autogenerated conversion function.
-func Convert_v1alpha4_FailureDomainHostGroup_To_v1alpha3_FailureDomainHostGroup(in *v1alpha4.FailureDomainHostGroup, out *FailureDomainHostGroup, s conversion.Scope) error {
-	return autoConvert_v1alpha4_FailureDomainHostGroup_To_v1alpha3_FailureDomainHostGroup(in, out, s)
-}
-
 func autoConvert_v1alpha3_HAProxyLoadBalancer_To_v1alpha4_HAProxyLoadBalancer(in *HAProxyLoadBalancer, out *v1alpha4.HAProxyLoadBalancer, s conversion.Scope) error {
 	out.ObjectMeta = in.ObjectMeta
 	if err := Convert_v1alpha3_HAProxyLoadBalancerSpec_To_v1alpha4_HAProxyLoadBalancerSpec(&in.Spec, &out.Spec, s); err != nil {
@@ -1036,7 +1032,17 @@ func Convert_v1alpha4_HAProxyLoadBalancer_To_v1alpha3_HAProxyLoadBalancer(in *v1
 
 func autoConvert_v1alpha3_HAProxyLoadBalancerList_To_v1alpha4_HAProxyLoadBalancerList(in *HAProxyLoadBalancerList, out *v1alpha4.HAProxyLoadBalancerList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]v1alpha4.HAProxyLoadBalancer)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1alpha4.HAProxyLoadBalancer, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha3_HAProxyLoadBalancer_To_v1alpha4_HAProxyLoadBalancer(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -1047,7 +1053,17 @@ func Convert_v1alpha3_HAProxyLoadBalancerList_To_v1alpha4_HAProxyLoadBalancerLis
 
 func autoConvert_v1alpha4_HAProxyLoadBalancerList_To_v1alpha3_HAProxyLoadBalancerList(in *v1alpha4.HAProxyLoadBalancerList, out *HAProxyLoadBalancerList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]HAProxyLoadBalancer)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]HAProxyLoadBalancer, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha4_HAProxyLoadBalancer_To_v1alpha3_HAProxyLoadBalancer(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -1074,14 +1090,15 @@ func autoConvert_v1alpha4_HAProxyLoadBalancerSpec_To_v1alpha3_HAProxyLoadBalance
 		return err
 	}
 	out.User = (*SSHUser)(unsafe.Pointer(in.User))
+	// WARNING: in.APIServerPort requires manual conversion: does not exist in peer-type
+	// WARNING: in.Frontends requires manual conversion: does not exist in peer-type
+	// WARNING: in.Replicas requires manual conversion: does not exist in peer-type
+	// WARNING: in.VirtualIP requires manual conversion: does not exist in peer-type
+	// WARNING: in.VirtualRouterID requires manual conversion: does not exist in peer-type
+	// WARNING: in.ConfigurationTemplate requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_HAProxyLoadBalancerSpec_To_v1alpha3_HAProxyLoadBalancerSpec is an autogenerated conversion function.
-func Convert_v1alpha4_HAProxyLoadBalancerSpec_To_v1alpha3_HAProxyLoadBalancerSpec(in *v1alpha4.HAProxyLoadBalancerSpec, out *HAProxyLoadBalancerSpec, s conversion.Scope) error {
-	return autoConvert_v1alpha4_HAProxyLoadBalancerSpec_To_v1alpha3_HAProxyLoadBalancerSpec(in, out, s)
-}
-
 func autoConvert_v1alpha3_HAProxyLoadBalancerStatus_To_v1alpha4_HAProxyLoadBalancerStatus(in *HAProxyLoadBalancerStatus, out *v1alpha4.HAProxyLoadBalancerStatus, s conversion.Scope) error {
 	out.Ready = in.Ready
 	out.Address = in.Address
@@ -1096,14 +1113,15 @@ func Convert_v1alpha3_HAProxyLoadBalancerStatus_To_v1alpha4_HAProxyLoadBalancerS
 func autoConvert_v1alpha4_HAProxyLoadBalancerStatus_To_v1alpha3_HAProxyLoadBalancerStatus(in *v1alpha4.HAProxyLoadBalancerStatus, out *HAProxyLoadBalancerStatus, s conversion.Scope) error {
 	out.Ready = in.Ready
 	out.Address = in.Address
+	// WARNING: in.Replicas requires manual conversion: does not exist in peer-type
+	// WARNING: in.CertificateAuthorityExpiry requires manual conversion: does not exist in peer-type
+	// WARNING: in.ClientCertificateExpiry requires manual conversion: does not exist in peer-type
+	// WARNING: in.Backends requires manual conversion: does not exist in peer-type
+	// WARNING: in.BackendServers requires manual conversion: does not exist in peer-type
+	// WARNING: in.Conditions requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_HAProxyLoadBalancerStatus_To_v1alpha3_HAProxyLoadBalancerStatus is an autogenerated conversion function.
-func Convert_v1alpha4_HAProxyLoadBalancerStatus_To_v1alpha3_HAProxyLoadBalancerStatus(in *v1alpha4.HAProxyLoadBalancerStatus, out *HAProxyLoadBalancerStatus, s conversion.Scope) error {
-	return autoConvert_v1alpha4_HAProxyLoadBalancerStatus_To_v1alpha3_HAProxyLoadBalancerStatus(in, out, s)
-}
-
 func autoConvert_v1alpha3_Network_To_v1alpha4_Network(in *Network, out *v1alpha4.Network, s conversion.Scope) error {
 	out.NetworkName = in.NetworkName
 	out.DHCP4 = (*bool)(unsafe.Pointer(in.DHCP4))
@@ -1162,14 +1180,10 @@ func autoConvert_v1alpha4_NetworkDeviceSpec_To_v1alpha3_NetworkDeviceSpec(in *v1
 	out.Nameservers = *(*[]string)(unsafe.Pointer(&in.Nameservers))
 	out.Routes = *(*[]NetworkRouteSpec)(unsafe.Pointer(&in.Routes))
 	out.SearchDomains = *(*[]string)(unsafe.Pointer(&in.SearchDomains))
+	// WARNING: in.IPPoolRef requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_NetworkDeviceSpec_To_v1alpha3_NetworkDeviceSpec is an autogenerated conversion function.
-func Convert_v1alpha4_NetworkDeviceSpec_To_v1alpha3_NetworkDeviceSpec(in *v1alpha4.NetworkDeviceSpec, out *NetworkDeviceSpec, s conversion.Scope) error {
-	return autoConvert_v1alpha4_NetworkDeviceSpec_To_v1alpha3_NetworkDeviceSpec(in, out, s)
-}
-
 func autoConvert_v1alpha3_NetworkRouteSpec_To_v1alpha4_NetworkRouteSpec(in *NetworkRouteSpec, out *v1alpha4.NetworkRouteSpec, s conversion.Scope) error {
 	out.To = in.To
 	out.Via = in.Via
@@ -1195,7 +1209,17 @@ func Convert_v1alpha4_NetworkRouteSpec_To_v1alpha3_NetworkRouteSpec(in *v1alpha4
 }
 
 func autoConvert_v1alpha3_NetworkSpec_To_v1alpha4_NetworkSpec(in *NetworkSpec, out *v1alpha4.NetworkSpec, s conversion.Scope) error {
-	out.Devices = *(*[]v1alpha4.NetworkDeviceSpec)(unsafe.Pointer(&in.Devices))
+	if in.Devices != nil {
+		in, out := &in.Devices, &out.Devices
+		*out = make([]v1alpha4.NetworkDeviceSpec, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha3_NetworkDeviceSpec_To_v1alpha4_NetworkDeviceSpec(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Devices = nil
+	}
 	out.Routes = *(*[]v1alpha4.NetworkRouteSpec)(unsafe.Pointer(&in.Routes))
 	out.PreferredAPIServerCIDR = in.PreferredAPIServerCIDR
 	return nil
@@ -1207,17 +1231,25 @@ func Convert_v1alpha3_NetworkSpec_To_v1alpha4_NetworkSpec(in *NetworkSpec, out *
 }
 
 func autoConvert_v1alpha4_NetworkSpec_To_v1alpha3_NetworkSpec(in *v1alpha4.NetworkSpec, out *NetworkSpec, s conversion.Scope) error {
-	out.Devices = *(*[]NetworkDeviceSpec)(unsafe.Pointer(&in.Devices))
+	if in.Devices != nil {
+		in, out := &in.Devices, &out.Devices
+		*out = make([]NetworkDeviceSpec, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha4_NetworkDeviceSpec_To_v1alpha3_NetworkDeviceSpec(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Devices = nil
+	}
 	out.Routes = *(*[]NetworkRouteSpec)(unsafe.Pointer(&in.Routes))
 	out.PreferredAPIServerCIDR = in.PreferredAPIServerCIDR
+	// WARNING: in.Bonds requires manual conversion: does not exist in peer-type
+	// WARNING: in.VLANs requires manual conversion: does not exist in peer-type
+	// WARNING: in.Bridges requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_NetworkSpec_To_v1alpha3_NetworkSpec is an autogenerated conversion function.
-func Convert_v1alpha4_NetworkSpec_To_v1alpha3_NetworkSpec(in *v1alpha4.NetworkSpec, out *NetworkSpec, s conversion.Scope) error {
-	return autoConvert_v1alpha4_NetworkSpec_To_v1alpha3_NetworkSpec(in, out, s)
-}
-
 func autoConvert_v1alpha3_NetworkStatus_To_v1alpha4_NetworkStatus(in *NetworkStatus, out *v1alpha4.NetworkStatus, s conversion.Scope) error {
 	out.Connected = in.Connected
 	out.IPAddrs = *(*[]string)(unsafe.Pointer(&in.IPAddrs))
@@ -1295,7 +1327,15 @@ func Convert_v1alpha4_SSHUser_To_v1alpha3_SSHUser(in *v1alpha4.SSHUser, out *SSH
 func autoConvert_v1alpha3_Topology_To_v1alpha4_Topology(in *Topology, out *v1alpha4.Topology, s conversion.Scope) error {
 	out.Datacenter = in.Datacenter
 	out.ComputeCluster = (*string)(unsafe.Pointer(in.ComputeCluster))
-	out.HostGroup = (*v1alpha4.FailureDomainHostGroup)(unsafe.Pointer(in.HostGroup))
+	if in.HostGroup != nil {
+		in, out := &in.HostGroup, &out.HostGroup
+		*out = new(v1alpha4.FailureDomainHostGroup)
+		if err := Convert_v1alpha3_FailureDomainHostGroup_To_v1alpha4_FailureDomainHostGroup(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.HostGroup = nil
+	}
 	return nil
 }
 
@@ -1307,7 +1347,15 @@ func Convert_v1alpha3_Topology_To_v1alpha4_Topology(in *Topology, out *v1alpha4.
 func autoConvert_v1alpha4_Topology_To_v1alpha3_Topology(in *v1alpha4.Topology, out *Topology, s conversion.Scope) error {
 	out.Datacenter = in.Datacenter
 	out.ComputeCluster = (*string)(unsafe.Pointer(in.ComputeCluster))
-	out.HostGroup = (*FailureDomainHostGroup)(unsafe.Pointer(in.HostGroup))
+	if in.HostGroup != nil {
+		in, out := &in.HostGroup, &out.HostGroup
+		*out = new(FailureDomainHostGroup)
+		if err := Convert_v1alpha4_FailureDomainHostGroup_To_v1alpha3_FailureDomainHostGroup(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.HostGroup = nil
+	}
 	return nil
 }
 
@@ -1540,6 +1588,7 @@ func autoConvert_v1alpha4_VSphereClusterSpec_To_v1alpha3_VSphereClusterSpec(in *
 	}
 	out.LoadBalancerRef = (*v1.ObjectReference)(unsafe.Pointer(in.LoadBalancerRef))
 	out.IdentityRef = (*VSphereIdentityReference)(unsafe.Pointer(in.IdentityRef))
+	// WARNING: in.VMAntiAffinity requires manual conversion: does not exist in peer-type
 	return nil
 }
 
@@ -1601,7 +1650,17 @@ func Convert_v1alpha4_VSphereDeploymentZone_To_v1alpha3_VSphereDeploymentZone(in
 
 func autoConvert_v1alpha3_VSphereDeploymentZoneList_To_v1alpha4_VSphereDeploymentZoneList(in *VSphereDeploymentZoneList, out *v1alpha4.VSphereDeploymentZoneList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]v1alpha4.VSphereDeploymentZone)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1alpha4.VSphereDeploymentZone, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha3_VSphereDeploymentZone_To_v1alpha4_VSphereDeploymentZone(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -1612,7 +1671,17 @@ func Convert_v1alpha3_VSphereDeploymentZoneList_To_v1alpha4_VSphereDeploymentZon
 
 func autoConvert_v1alpha4_VSphereDeploymentZoneList_To_v1alpha3_VSphereDeploymentZoneList(in *v1alpha4.VSphereDeploymentZoneList, out *VSphereDeploymentZoneList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]VSphereDeploymentZone)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VSphereDeploymentZone, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha4_VSphereDeploymentZone_To_v1alpha3_VSphereDeploymentZone(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -1643,14 +1712,10 @@ func autoConvert_v1alpha4_VSphereDeploymentZoneSpec_To_v1alpha3_VSphereDeploymen
 	if err := Convert_v1alpha4_PlacementConstraint_To_v1alpha3_PlacementConstraint(&in.PlacementConstaint, &out.PlacementConstaint, s); err != nil {
 		return err
 	}
+	// WARNING: in.Thumbprint requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_VSphereDeploymentZoneSpec_To_v1alpha3_VSphereDeploymentZoneSpec is an autogenerated conversion function.
-func Convert_v1alpha4_VSphereDeploymentZoneSpec_To_v1alpha3_VSphereDeploymentZoneSpec(in *v1alpha4.VSphereDeploymentZoneSpec, out *VSphereDeploymentZoneSpec, s conversion.Scope) error {
-	return autoConvert_v1alpha4_VSphereDeploymentZoneSpec_To_v1alpha3_VSphereDeploymentZoneSpec(in, out, s)
-}
-
 func autoConvert_v1alpha3_VSphereDeploymentZoneStatus_To_v1alpha4_VSphereDeploymentZoneStatus(in *VSphereDeploymentZoneStatus, out *v1alpha4.VSphereDeploymentZoneStatus, s conversion.Scope) error {
 	out.Ready = (*bool)(unsafe.Pointer(in.Ready))
 	out.Conditions = *(*apiv1alpha4.Conditions)(unsafe.Pointer(&in.Conditions))
@@ -1701,7 +1766,17 @@ func Convert_v1alpha4_VSphereFailureDomain_To_v1alpha3_VSphereFailureDomain(in *
 
 func autoConvert_v1alpha3_VSphereFailureDomainList_To_v1alpha4_VSphereFailureDomainList(in *VSphereFailureDomainList, out *v1alpha4.VSphereFailureDomainList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]v1alpha4.VSphereFailureDomain)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1alpha4.VSphereFailureDomain, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha3_VSphereFailureDomain_To_v1alpha4_VSphereFailureDomain(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -1712,7 +1787,17 @@ func Convert_v1alpha3_VSphereFailureDomainList_To_v1alpha4_VSphereFailureDomainL
 
 func autoConvert_v1alpha4_VSphereFailureDomainList_To_v1alpha3_VSphereFailureDomainList(in *v1alpha4.VSphereFailureDomainList, out *VSphereFailureDomainList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]VSphereFailureDomain)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VSphereFailureDomain, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha4_VSphereFailureDomain_To_v1alpha3_VSphereFailureDomain(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -1813,7 +1898,17 @@ func Convert_v1alpha4_VSphereMachine_To_v1alpha3_VSphereMachine(in *v1alpha4.VSp
 
 func autoConvert_v1alpha3_VSphereMachineList_To_v1alpha4_VSphereMachineList(in *VSphereMachineList, out *v1alpha4.VSphereMachineList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]v1alpha4.VSphereMachine)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1alpha4.VSphereMachine, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha3_VSphereMachine_To_v1alpha4_VSphereMachine(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -1824,7 +1919,17 @@ func Convert_v1alpha3_VSphereMachineList_To_v1alpha4_VSphereMachineList(in *VSph
 
 func autoConvert_v1alpha4_VSphereMachineList_To_v1alpha3_VSphereMachineList(in *v1alpha4.VSphereMachineList, out *VSphereMachineList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]VSphereMachine)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VSphereMachine, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha4_VSphereMachine_To_v1alpha3_VSphereMachine(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -1919,7 +2024,17 @@ func Convert_v1alpha4_VSphereMachineTemplate_To_v1alpha3_VSphereMachineTemplate(
 
 func autoConvert_v1alpha3_VSphereMachineTemplateList_To_v1alpha4_VSphereMachineTemplateList(in *VSphereMachineTemplateList, out *v1alpha4.VSphereMachineTemplateList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]v1alpha4.VSphereMachineTemplate)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1alpha4.VSphereMachineTemplate, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha3_VSphereMachineTemplate_To_v1alpha4_VSphereMachineTemplate(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -1930,7 +2045,17 @@ func Convert_v1alpha3_VSphereMachineTemplateList_To_v1alpha4_VSphereMachineTempl
 
 func autoConvert_v1alpha4_VSphereMachineTemplateList_To_v1alpha3_VSphereMachineTemplateList(in *v1alpha4.VSphereMachineTemplateList, out *VSphereMachineTemplateList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]VSphereMachineTemplate)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VSphereMachineTemplate, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha4_VSphereMachineTemplate_To_v1alpha3_VSphereMachineTemplate(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -2021,7 +2146,17 @@ func Convert_v1alpha4_VSphereVM_To_v1alpha3_VSphereVM(in *v1alpha4.VSphereVM, ou
 
 func autoConvert_v1alpha3_VSphereVMList_To_v1alpha4_VSphereVMList(in *VSphereVMList, out *v1alpha4.VSphereVMList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]v1alpha4.VSphereVM)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1alpha4.VSphereVM, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha3_VSphereVM_To_v1alpha4_VSphereVM(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -2032,7 +2167,17 @@ func Convert_v1alpha3_VSphereVMList_To_v1alpha4_VSphereVMList(in *VSphereVMList,
 
 func autoConvert_v1alpha4_VSphereVMList_To_v1alpha3_VSphereVMList(in *v1alpha4.VSphereVMList, out *VSphereVMList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]VSphereVM)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VSphereVM, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha4_VSphereVM_To_v1alpha3_VSphereVM(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -2160,6 +2305,7 @@ func Convert_v1alpha3_VirtualMachineCloneSpec_To_v1alpha4_VirtualMachineCloneSpe
 
 func autoConvert_v1alpha4_VirtualMachineCloneSpec_To_v1alpha3_VirtualMachineCloneSpec(in *v1alpha4.VirtualMachineCloneSpec, out *VirtualMachineCloneSpec, s conversion.Scope) error {
 	out.Template = in.Template
+	// WARNING: in.ContentLibrary requires manual conversion: does not exist in peer-type
 	out.CloneMode = CloneMode(in.CloneMode)
 	out.Snapshot = in.Snapshot
 	out.Server = in.Server
@@ -2177,10 +2323,11 @@ func autoConvert_v1alpha4_VirtualMachineCloneSpec_To_v1alpha3_VirtualMachineClon
 	out.MemoryMiB = in.MemoryMiB
 	out.DiskGiB = in.DiskGiB
 	out.CustomVMXKeys = *(*map[string]string)(unsafe.Pointer(&in.CustomVMXKeys))
+	// WARNING: in.TemplateDisks requires manual conversion: does not exist in peer-type
+	// WARNING: in.AdditionalDisks requires manual conversion: does not exist in peer-type
+	// WARNING: in.TagIDs requires manual conversion: does not exist in peer-type
+	// WARNING: in.MachineNameAttribute requires manual conversion: does not exist in peer-type
+	// WARNING: in.Customization requires manual conversion: does not exist in peer-type
+	// WARNING: in.OS requires manual conversion: does not exist in peer-type
 	return nil
 }
-
-// Convert_v1alpha4_VirtualMachineCloneSpec_To_v1alpha3_VirtualMachineCloneSpec is an autogenerated conversion function.
-func Convert_v1alpha4_VirtualMachineCloneSpec_To_v1alpha3_VirtualMachineCloneSpec(in *v1alpha4.VirtualMachineCloneSpec, out *VirtualMachineCloneSpec, s conversion.Scope) error {
-	return autoConvert_v1alpha4_VirtualMachineCloneSpec_To_v1alpha3_VirtualMachineCloneSpec(in, out, s)
-}
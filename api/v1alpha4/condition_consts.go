@@ -101,6 +101,35 @@ const (
 	WaitingForNetworkAddressesReason = "WaitingForNetworkAddresses"
 )
 
+// Conditions and Reasons related to the DRS anti-affinity rules of VSphereVMs.
+
+const (
+	// AntiAffinityRuleConfiguredCondition documents the membership of a VSphereVM in the DRS anti-affinity rule
+	// of its control plane or MachineDeployment.
+	AntiAffinityRuleConfiguredCondition clusterv1.ConditionType = "AntiAffinityRuleConfigured"
+
+	// AntiAffinityRuleFailedReason (Severity=Warning) documents a VSphereVM controller detecting an error while
+	// configuring the anti-affinity rule; the VM is provisioned nevertheless and the operation is re-tried
+	// on the next reconcile.
+	AntiAffinityRuleFailedReason = "AntiAffinityRuleFailed"
+)
+
+// Conditions and Reasons related to the guest customization of VSphereVMs.
+
+const (
+	// GuestCustomizationSucceededCondition documents the completion of the guest customization of a VSphereVM
+	// whose guest is customized with a vSphere guest customization spec.
+	GuestCustomizationSucceededCondition clusterv1.ConditionType = "GuestCustomizationSucceeded"
+
+	// GuestCustomizationPendingReason (Severity=Info) documents a VSphereVM waiting for the guest customization
+	// to complete after the VM is powered on.
+	GuestCustomizationPendingReason = "GuestCustomizationPending"
+
+	// GuestCustomizationFailedReason (Severity=Error) documents a VSphereVM whose guest customization failed;
+	// the guest is not customized again, so a user intervention is required to fix the problem.
+	GuestCustomizationFailedReason = "GuestCustomizationFailed"
+)
+
 // Conditions and Reasons related to utilizing a VSphereIdentity to make connections to a VCenter. Can currently be used by VSphereCluster and VSphereVM
 
 const (
@@ -124,3 +153,136 @@ const (
 	// SecretAlreadyInUseReason is used when another VSphereClusterIdentity is using the secret
 	SecretAlreadyInUseReason = "SecretInUse"
 )
+
+// Conditions and Reasons related to the VSphereDeploymentZone object.
+
+const (
+	// VSphereFailureDomainValidatedCondition documents whether the failure domain for the deployment zone
+	// is configured correctly in vCenter.
+	VSphereFailureDomainValidatedCondition clusterv1.ConditionType = "VSphereFailureDomainValidated"
+
+	// VSphereFailureDomainNotFoundReason (Severity=Error) documents that the VSphereFailureDomain referenced by
+	// a VSphereDeploymentZone does not exist.
+	VSphereFailureDomainNotFoundReason = "VSphereFailureDomainNotFound"
+
+	// DatacenterNotFoundReason (Severity=Error) documents that the datacenter of a failure domain topology
+	// could not be found in vCenter.
+	DatacenterNotFoundReason = "DatacenterNotFound"
+
+	// ComputeClusterNotFoundReason (Severity=Error) documents that the compute cluster of a failure domain
+	// topology could not be found in vCenter.
+	ComputeClusterNotFoundReason = "ComputeClusterNotFound"
+
+	// HostGroupNotFoundReason (Severity=Error) documents that the host group of a failure domain topology
+	// could not be found in the compute cluster.
+	HostGroupNotFoundReason = "HostGroupNotFound"
+
+	// VMGroupNotFoundReason (Severity=Error) documents that the VM group of a failure domain topology
+	// could not be found in the compute cluster.
+	VMGroupNotFoundReason = "VMGroupNotFound"
+
+	// FailureDomainConfigurationFailedReason (Severity=Error) documents that the tags, groups or rules
+	// of a failure domain with auto-configuration enabled could not be created in vCenter.
+	FailureDomainConfigurationFailedReason = "FailureDomainConfigurationFailed"
+
+	// PlacementConstraintMetCondition documents whether the placement constraint of a VSphereDeploymentZone
+	// is configured correctly in vCenter.
+	PlacementConstraintMetCondition clusterv1.ConditionType = "PlacementConstraintMet"
+
+	// ResourcePoolNotFoundReason (Severity=Error) documents that the resource pool of a placement constraint
+	// could not be found in vCenter.
+	ResourcePoolNotFoundReason = "ResourcePoolNotFound"
+
+	// DatastoreNotFoundReason (Severity=Error) documents that the datastore of a placement constraint
+	// could not be found in vCenter.
+	DatastoreNotFoundReason = "DatastoreNotFound"
+
+	// FolderNotFoundReason (Severity=Error) documents that the folder of a placement constraint
+	// could not be found in vCenter.
+	FolderNotFoundReason = "FolderNotFound"
+
+	// NetworkNotFoundReason (Severity=Error) documents that one of the networks of a placement constraint
+	// could not be found in vCenter.
+	NetworkNotFoundReason = "NetworkNotFound"
+)
+
+// Conditions and Reasons related to the failure domains of a VSphereCluster object.
+
+const (
+	// FailureDomainsAvailableCondition documents whether the VSphereDeploymentZones matching the
+	// server of a VSphereCluster are ready to be used as failure domains.
+	FailureDomainsAvailableCondition clusterv1.ConditionType = "FailureDomainsAvailable"
+
+	// WaitingForFailureDomainStatusReason (Severity=Info) documents that some of the VSphereDeploymentZones
+	// matching the server of a VSphereCluster have not reported their status yet.
+	WaitingForFailureDomainStatusReason = "WaitingForFailureDomainStatus"
+
+	// FailureDomainsSkippedReason (Severity=Warning) documents that some of the VSphereDeploymentZones
+	// matching the server of a VSphereCluster are not ready and were not published as failure domains.
+	FailureDomainsSkippedReason = "FailureDomainsSkipped"
+)
+
+// Conditions and Reasons related to the VSphereIPPool object.
+
+const (
+	// IPAddressesAvailableCondition documents whether the VSphereIPPool allocated an address to all the
+	// network devices referencing it.
+	IPAddressesAvailableCondition clusterv1.ConditionType = "IPAddressesAvailable"
+
+	// InvalidIPPoolReason (Severity=Error) documents that the CIDR, the ranges or the gateway of a
+	// VSphereIPPool are invalid.
+	InvalidIPPoolReason = "InvalidIPPool"
+
+	// IPPoolExhaustedReason (Severity=Warning) documents that a VSphereIPPool has no address left to
+	// allocate to the network devices referencing it.
+	IPPoolExhaustedReason = "IPPoolExhausted"
+
+	// IPAddressConflictReason (Severity=Warning) documents that an address allocated from a VSphereIPPool
+	// to a provisioned VSphereVM is used by another VSphereVM as well.
+	IPAddressConflictReason = "IPAddressConflict"
+)
+
+// Conditions and Reasons for the HAProxyLoadBalancer object.
+//
+// NOTE: HAProxyLoadBalancer wraps the VSphereVMs of its replicas, so the VMProvisionedCondition aggregates the
+// Ready conditions of the VSphereVMs.
+
+const (
+	// DataplaneAPIAvailableCondition documents whether the controller can reach the dataplane API of all the
+	// replicas of an HAProxyLoadBalancer.
+	DataplaneAPIAvailableCondition clusterv1.ConditionType = "DataplaneAPIAvailable"
+
+	// DataplaneAPIUnreachableReason (Severity=Warning) documents an HAProxyLoadBalancer controller failing to
+	// reach the dataplane API of some replicas; those kind of errors are usually transient and the operation
+	// is automatically re-tried by the controller.
+	DataplaneAPIUnreachableReason = "DataplaneAPIUnreachable"
+
+	// LoadBalancerConfiguredCondition documents whether the configuration of all the replicas of an
+	// HAProxyLoadBalancer matches its spec and the control plane machines.
+	LoadBalancerConfiguredCondition clusterv1.ConditionType = "LoadBalancerConfigured"
+
+	// WaitingForDataplaneAPIReason (Severity=Info) documents an HAProxyLoadBalancer waiting for the dataplane
+	// API of some replicas to be reachable before configuring them.
+	WaitingForDataplaneAPIReason = "WaitingForDataplaneAPI"
+
+	// LoadBalancerConfigurationFailedReason (Severity=Warning) documents an HAProxyLoadBalancer controller
+	// failing to update or commit the configuration of some replicas; the operation is automatically
+	// re-tried by the controller.
+	LoadBalancerConfigurationFailedReason = "LoadBalancerConfigurationFailed"
+
+	// BackendsAvailableCondition documents whether an HAProxyLoadBalancer has control plane machines to
+	// forward the API server connections to.
+	BackendsAvailableCondition clusterv1.ConditionType = "BackendsAvailable"
+
+	// NoBackendsReason (Severity=Warning) documents an HAProxyLoadBalancer with no control plane machine
+	// having an address to forward the API server connections to.
+	NoBackendsReason = "NoBackends"
+
+	// BackendsUnhealthyReason (Severity=Warning) documents an HAProxyLoadBalancer with control plane machines
+	// whose API server fails the health checks of HAProxy.
+	BackendsUnhealthyReason = "BackendsUnhealthy"
+
+	// BackendStatsUnavailableReason documents an HAProxyLoadBalancer controller failing to get the stats of
+	// the backend servers from all the replicas, so the health of the control plane machines is unknown.
+	BackendStatsUnavailableReason = "BackendStatsUnavailable"
+)
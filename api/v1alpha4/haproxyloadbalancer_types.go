@@ -18,6 +18,7 @@ package v1alpha4
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
 const (
@@ -25,6 +26,14 @@ const (
 	// resources associated with an HAProxyLoadBalancer before removing
 	// it from the API server.
 	HAProxyLoadBalancerFinalizer = "haproxyloadbalancer.infrastructure.cluster.x-k8s.io"
+
+	// HAProxyConfigurationTemplateLabel is the label of the ConfigMaps holding
+	// HAProxy configuration templates, which are validated at admission.
+	HAProxyConfigurationTemplateLabel = "haproxyloadbalancer.infrastructure.cluster.x-k8s.io/configuration-template"
+
+	// DefaultHAProxyConfigurationTemplateKey is the key of the ConfigMap data
+	// holding an HAProxy configuration template when none is specified.
+	DefaultHAProxyConfigurationTemplateKey = "haproxy.cfg"
 )
 
 // HAProxyLoadBalancerSpec defines the desired state of HAProxyLoadBalancer.
@@ -37,6 +46,104 @@ type HAProxyLoadBalancerSpec struct {
 	// deployed VM.
 	// +optional
 	User *SSHUser `json:"user,omitempty"`
+
+	// APIServerPort is the port on which the load balancer serves the API
+	// server of the control plane machines, which must also serve it on
+	// this port.
+	// Defaults to 6443.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	APIServerPort *int32 `json:"apiServerPort,omitempty"`
+
+	// Frontends are additional TCP frontends of the load balancer, e.g. for
+	// konnectivity or for an ingress controller exposed with a NodePort
+	// service.
+	// +optional
+	Frontends []HAProxyFrontend `json:"frontends,omitempty"`
+
+	// Replicas is the number of load balancer VMs. More than one replica
+	// requires a VirtualIP, which keepalived moves between the replicas.
+	// Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// VirtualIP is the IP address shared by the replicas with VRRP, which is
+	// the address of the load balancer. It cannot be modified once set. When
+	// it is set on a load balancer created without it, only the replicas
+	// created afterwards share it, and it becomes the address of the load
+	// balancer once one of them has an address.
+	// +optional
+	VirtualIP string `json:"virtualIP,omitempty"`
+
+	// VirtualRouterID is the VRRP virtual router ID of the replicas, which
+	// must be unique among the load balancers of the network.
+	// Defaults to 51.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=255
+	// +optional
+	VirtualRouterID *int32 `json:"virtualRouterID,omitempty"`
+
+	// ConfigurationTemplate references a ConfigMap holding the Go template of
+	// the HAProxy configuration, which replaces the default template. It is
+	// rendered with the same data as the default template when load balancer
+	// VMs are bootstrapped, and pushed to the running VMs when it changes.
+	// The ConfigMap must be labeled with
+	// haproxyloadbalancer.infrastructure.cluster.x-k8s.io/configuration-template.
+	// The template must define the kube_api_frontend section, with a bind
+	// named lb, and the kube_api_backend section, which the controller
+	// updates through the dataplane API.
+	// +optional
+	ConfigurationTemplate *HAProxyConfigurationTemplateReference `json:"configurationTemplate,omitempty"`
+}
+
+// HAProxyConfigurationTemplateReference references the key of a ConfigMap
+// holding an HAProxy configuration template.
+type HAProxyConfigurationTemplateReference struct {
+	// Name is the name of the ConfigMap, in the namespace of the load
+	// balancer.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Key is the key of the ConfigMap data holding the template.
+	// Defaults to "haproxy.cfg".
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// HAProxyFrontend is a TCP frontend of the load balancer, which forwards the
+// connections to the machines of the cluster.
+type HAProxyFrontend struct {
+	// Name is the name of the frontend, which is unique among the frontends
+	// of the load balancer.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Port is the port on which the frontend accepts connections.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+
+	// Backend describes the machines the connections are forwarded to.
+	Backend HAProxyBackend `json:"backend"`
+}
+
+// HAProxyBackend describes the machines the connections accepted by a
+// frontend are forwarded to.
+type HAProxyBackend struct {
+	// Port is the port of the machines the connections are forwarded to.
+	// Defaults to the port of the frontend.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// MachineSelector selects the Machines of the cluster the connections
+	// are forwarded to by their labels.
+	// Defaults to the control plane machines.
+	// +optional
+	MachineSelector *metav1.LabelSelector `json:"machineSelector,omitempty"`
 }
 
 // HAProxyLoadBalancerStatus defines the observed state of HAProxyLoadBalancer.
@@ -58,6 +165,96 @@ type HAProxyLoadBalancerStatus struct {
 	//
 	// +optional
 	Address string `json:"address,omitempty"`
+
+	// Replicas are the observed states of the load balancer VMs.
+	// +optional
+	Replicas []HAProxyLoadBalancerReplicaStatus `json:"replicas,omitempty"`
+
+	// CertificateAuthorityExpiry is when the certificate signing the
+	// certificates of the dataplane API expires. It is renewed ahead of
+	// expiry.
+	// +optional
+	CertificateAuthorityExpiry *metav1.Time `json:"certificateAuthorityExpiry,omitempty"`
+
+	// ClientCertificateExpiry is when the certificate the controller uses to
+	// access the dataplane API expires. It is renewed ahead of expiry.
+	// +optional
+	ClientCertificateExpiry *metav1.Time `json:"clientCertificateExpiry,omitempty"`
+
+	// Backends is the number of control plane machines the API server
+	// connections are forwarded to.
+	// +optional
+	Backends int32 `json:"backends,omitempty"`
+
+	// BackendServers are the health of the control plane machines the API
+	// server connections are forwarded to, as reported by HAProxy.
+	// +optional
+	BackendServers []HAProxyBackendServerStatus `json:"backendServers,omitempty"`
+
+	// Conditions defines current service state of the HAProxyLoadBalancer.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+// HAProxyLoadBalancerReplicaStatus is the observed state of a load balancer
+// VM.
+type HAProxyLoadBalancerReplicaStatus struct {
+	// Name is the name of the VSphereVM of the replica.
+	Name string `json:"name"`
+
+	// Address is the IP address of the replica, on which its dataplane API
+	// is served.
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// Keepalived is whether the replica was bootstrapped with keepalived,
+	// which makes it share the virtual IP of the load balancer. The replicas
+	// created before the virtual IP was set do not share it.
+	// +optional
+	Keepalived bool `json:"keepalived,omitempty"`
+
+	// TransactionID is the ID of the dataplane API transaction in which the
+	// controller is updating the configuration of the replica. It is
+	// persisted so an interrupted update is resumed without closing the
+	// transactions of other dataplane API users.
+	// +optional
+	TransactionID string `json:"transactionID,omitempty"`
+
+	// ConfigurationVersion is the version of the HAProxy configuration last
+	// applied to the replica by the controller.
+	// +optional
+	ConfigurationVersion int32 `json:"configurationVersion,omitempty"`
+
+	// Frontends are the names of the additional TCP frontends the controller
+	// created in the configuration of the replica. Only these frontends are
+	// deleted when they are removed from the spec.
+	// +optional
+	Frontends []string `json:"frontends,omitempty"`
+}
+
+// HAProxyBackendServerStatus is the health of a control plane machine the API
+// server connections are forwarded to.
+type HAProxyBackendServerStatus struct {
+	// Name is the name of the server, which is the name of the node.
+	Name string `json:"name"`
+
+	// State is the state of the server reported by HAProxy, ex. UP or DOWN.
+	// +optional
+	State string `json:"state,omitempty"`
+
+	// LastCheck is the result of the last health check of the server, ex.
+	// L7OK or L4CON.
+	// +optional
+	LastCheck string `json:"lastCheck,omitempty"`
+
+	// LastCheckDescription is a human readable description of the result of
+	// the last health check of the server.
+	// +optional
+	LastCheckDescription string `json:"lastCheckDescription,omitempty"`
+
+	// LastTransitionTime is the last time the state of the server changed.
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -75,6 +272,14 @@ type HAProxyLoadBalancer struct {
 	Status HAProxyLoadBalancerStatus `json:"status,omitempty"`
 }
 
+func (h *HAProxyLoadBalancer) GetConditions() clusterv1.Conditions {
+	return h.Status.Conditions
+}
+
+func (h *HAProxyLoadBalancer) SetConditions(conditions clusterv1.Conditions) {
+	h.Status.Conditions = conditions
+}
+
 // +kubebuilder:object:root=true
 
 // HAProxyLoadBalancerList contains a list of HAProxyLoadBalancer
@@ -17,11 +17,138 @@ limitations under the License.
 package v1alpha4
 
 import (
+	"fmt"
+	"net"
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+const (
+	// defaultHAProxyAPIServerPort is the port on which the load balancer
+	// serves the API server when spec.apiServerPort is not set.
+	defaultHAProxyAPIServerPort = 6443
+)
+
+// haproxyReservedPorts are the ports the load balancer uses for its health
+// check, its statistics and its dataplane API.
+var haproxyReservedPorts = map[int32]string{
+	8081: "healthz",
+	8404: "stats",
+	5556: "dataplane API",
+}
+
 func (r *HAProxyLoadBalancer) SetupWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
 }
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha4-haproxyloadbalancer,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=haproxyloadbalancers,versions=v1alpha4,name=validation.haproxyloadbalancer.infrastructure.x-k8s.io,sideEffects=None,admissionReviewVersions=v1beta1
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *HAProxyLoadBalancer) ValidateCreate() error {
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, r.validateFrontends()...)
+	allErrs = append(allErrs, r.validateVirtualIP()...)
+	return aggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, allErrs)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *HAProxyLoadBalancer) ValidateUpdate(old runtime.Object) error {
+	oldHAProxyLoadBalancer := old.(*HAProxyLoadBalancer)
+
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, r.validateFrontends()...)
+	allErrs = append(allErrs, r.validateVirtualIP()...)
+
+	// The API server port is part of the control plane endpoint of the
+	// cluster, which is not updated.
+	if r.apiServerPort() != oldHAProxyLoadBalancer.apiServerPort() {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "apiServerPort"), "cannot be modified"))
+	}
+
+	// The keepalived configuration is part of the bootstrap data of the
+	// replicas, so the virtual IP can only be set on a load balancer created
+	// without one, for the replicas created afterwards to share it.
+	if oldHAProxyLoadBalancer.Spec.VirtualIP != "" {
+		if r.Spec.VirtualIP != oldHAProxyLoadBalancer.Spec.VirtualIP {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "virtualIP"), "cannot be modified once set"))
+		}
+		if !reflect.DeepEqual(r.Spec.VirtualRouterID, oldHAProxyLoadBalancer.Spec.VirtualRouterID) {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "virtualRouterID"), "cannot be modified once the virtual IP is set"))
+		}
+	}
+
+	return aggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, allErrs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *HAProxyLoadBalancer) ValidateDelete() error {
+	return nil
+}
+
+func (r *HAProxyLoadBalancer) validateVirtualIP() field.ErrorList {
+	var allErrs field.ErrorList
+
+	if r.Spec.VirtualIP == "" {
+		if r.Spec.Replicas != nil && *r.Spec.Replicas > 1 {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec", "virtualIP"), "is required by more than one replica"))
+		}
+		return allErrs
+	}
+	if net.ParseIP(r.Spec.VirtualIP) == nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "virtualIP"), r.Spec.VirtualIP, "must be an IPv4 or IPv6 address"))
+	}
+	return allErrs
+}
+
+func (r *HAProxyLoadBalancer) validateFrontends() field.ErrorList {
+	var allErrs field.ErrorList
+
+	apiServerPort := r.apiServerPort()
+	if name, ok := haproxyReservedPorts[apiServerPort]; ok {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "apiServerPort"), apiServerPort, fmt.Sprintf("port is used by the %s frontend", name)))
+	}
+
+	names := map[string]struct{}{}
+	ports := map[int32]struct{}{}
+	for i, frontend := range r.Spec.Frontends {
+		fldPath := field.NewPath("spec", "frontends").Index(i)
+		if _, ok := names[frontend.Name]; ok {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Child("name"), frontend.Name))
+		}
+		names[frontend.Name] = struct{}{}
+
+		switch name, reserved := haproxyReservedPorts[frontend.Port]; {
+		case reserved:
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), frontend.Port, fmt.Sprintf("port is used by the %s frontend", name)))
+		case frontend.Port == apiServerPort:
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), frontend.Port, "port is used by the API server frontend"))
+		}
+		if _, ok := ports[frontend.Port]; ok {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Child("port"), frontend.Port))
+		}
+		ports[frontend.Port] = struct{}{}
+
+		if frontend.Backend.MachineSelector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(frontend.Backend.MachineSelector); err != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("backend", "machineSelector"), frontend.Backend.MachineSelector, err.Error()))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// apiServerPort returns the port on which the load balancer serves the API
+// server.
+func (r *HAProxyLoadBalancer) apiServerPort() int32 {
+	if r.Spec.APIServerPort != nil {
+		return *r.Spec.APIServerPort
+	}
+	return defaultHAProxyAPIServerPort
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha4
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+//nolint
+func TestHAProxyLoadBalancer_ValidateCreate(t *testing.T) {
+
+	g := NewWithT(t)
+	tests := []struct {
+		name                string
+		haproxyLoadBalancer *HAProxyLoadBalancer
+		wantErr             bool
+	}{
+		{
+			name:                "default API server port",
+			haproxyLoadBalancer: createHAProxyLoadBalancer(nil),
+			wantErr:             false,
+		},
+		{
+			name:                "API server port used by the stats frontend",
+			haproxyLoadBalancer: createHAProxyLoadBalancer(pointer.Int32Ptr(8404)),
+			wantErr:             true,
+		},
+		{
+			name: "konnectivity and ingress frontends",
+			haproxyLoadBalancer: createHAProxyLoadBalancer(pointer.Int32Ptr(443),
+				HAProxyFrontend{Name: "konnectivity", Port: 8132},
+				HAProxyFrontend{Name: "ingress", Port: 80, Backend: HAProxyBackend{
+					Port:            pointer.Int32Ptr(30080),
+					MachineSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"ingress": "true"}},
+				}}),
+			wantErr: false,
+		},
+		{
+			name: "frontends with the same name",
+			haproxyLoadBalancer: createHAProxyLoadBalancer(nil,
+				HAProxyFrontend{Name: "ingress", Port: 80},
+				HAProxyFrontend{Name: "ingress", Port: 443}),
+			wantErr: true,
+		},
+		{
+			name: "frontends with the same port",
+			haproxyLoadBalancer: createHAProxyLoadBalancer(nil,
+				HAProxyFrontend{Name: "http", Port: 80},
+				HAProxyFrontend{Name: "ingress", Port: 80}),
+			wantErr: true,
+		},
+		{
+			name: "frontend on the API server port",
+			haproxyLoadBalancer: createHAProxyLoadBalancer(pointer.Int32Ptr(443),
+				HAProxyFrontend{Name: "ingress", Port: 443}),
+			wantErr: true,
+		},
+		{
+			name: "frontend on the dataplane API port",
+			haproxyLoadBalancer: createHAProxyLoadBalancer(nil,
+				HAProxyFrontend{Name: "dataplane", Port: 5556}),
+			wantErr: true,
+		},
+		{
+			name: "frontend with an invalid machine selector",
+			haproxyLoadBalancer: createHAProxyLoadBalancer(nil,
+				HAProxyFrontend{Name: "ingress", Port: 80, Backend: HAProxyBackend{
+					MachineSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "ingress", Operator: "Matches"}}},
+				}}),
+			wantErr: true,
+		},
+		{
+			name:                "replicas sharing a virtual IP",
+			haproxyLoadBalancer: withReplicas(createHAProxyLoadBalancer(nil), 3, "192.168.0.10"),
+			wantErr:             false,
+		},
+		{
+			name:                "replicas without a virtual IP",
+			haproxyLoadBalancer: withReplicas(createHAProxyLoadBalancer(nil), 3, ""),
+			wantErr:             true,
+		},
+		{
+			name:                "IPv6 virtual IP",
+			haproxyLoadBalancer: withReplicas(createHAProxyLoadBalancer(nil), 2, "fd00::10"),
+			wantErr:             false,
+		},
+		{
+			name:                "invalid virtual IP",
+			haproxyLoadBalancer: withReplicas(createHAProxyLoadBalancer(nil), 2, "192.168.0"),
+			wantErr:             true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.haproxyLoadBalancer.ValidateCreate()
+			if tc.wantErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+//nolint
+func TestHAProxyLoadBalancer_ValidateUpdate(t *testing.T) {
+
+	g := NewWithT(t)
+	tests := []struct {
+		name                   string
+		oldHAProxyLoadBalancer *HAProxyLoadBalancer
+		haproxyLoadBalancer    *HAProxyLoadBalancer
+		wantErr                bool
+	}{
+		{
+			name:                   "replicas can be scaled",
+			oldHAProxyLoadBalancer: withReplicas(createHAProxyLoadBalancer(nil), 2, "192.168.0.10"),
+			haproxyLoadBalancer:    withReplicas(createHAProxyLoadBalancer(nil), 3, "192.168.0.10"),
+			wantErr:                false,
+		},
+		{
+			name:                   "virtual IP cannot be modified",
+			oldHAProxyLoadBalancer: withReplicas(createHAProxyLoadBalancer(nil), 2, "192.168.0.10"),
+			haproxyLoadBalancer:    withReplicas(createHAProxyLoadBalancer(nil), 2, "192.168.0.11"),
+			wantErr:                true,
+		},
+		{
+			name:                   "virtual IP can be set",
+			oldHAProxyLoadBalancer: createHAProxyLoadBalancer(nil),
+			haproxyLoadBalancer:    withReplicas(createHAProxyLoadBalancer(nil), 3, "192.168.0.10"),
+			wantErr:                false,
+		},
+		{
+			name:                   "virtual IP cannot be removed",
+			oldHAProxyLoadBalancer: withReplicas(createHAProxyLoadBalancer(nil), 1, "192.168.0.10"),
+			haproxyLoadBalancer:    withReplicas(createHAProxyLoadBalancer(nil), 1, ""),
+			wantErr:                true,
+		},
+		{
+			name:                   "virtual router ID can be set with the virtual IP",
+			oldHAProxyLoadBalancer: createHAProxyLoadBalancer(nil),
+			haproxyLoadBalancer:    withVirtualRouterID(withReplicas(createHAProxyLoadBalancer(nil), 2, "192.168.0.10"), 52),
+			wantErr:                false,
+		},
+		{
+			name:                   "virtual router ID cannot be modified",
+			oldHAProxyLoadBalancer: withReplicas(createHAProxyLoadBalancer(nil), 2, "192.168.0.10"),
+			haproxyLoadBalancer:    withVirtualRouterID(withReplicas(createHAProxyLoadBalancer(nil), 2, "192.168.0.10"), 52),
+			wantErr:                true,
+		},
+		{
+			name:                   "API server port cannot be modified",
+			oldHAProxyLoadBalancer: createHAProxyLoadBalancer(nil),
+			haproxyLoadBalancer:    createHAProxyLoadBalancer(pointer.Int32Ptr(443)),
+			wantErr:                true,
+		},
+		{
+			name:                   "API server port can be set to the default",
+			oldHAProxyLoadBalancer: createHAProxyLoadBalancer(nil),
+			haproxyLoadBalancer:    createHAProxyLoadBalancer(pointer.Int32Ptr(6443)),
+			wantErr:                false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.haproxyLoadBalancer.ValidateUpdate(tc.oldHAProxyLoadBalancer)
+			if tc.wantErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func createHAProxyLoadBalancer(apiServerPort *int32, frontends ...HAProxyFrontend) *HAProxyLoadBalancer {
+	return &HAProxyLoadBalancer{
+		Spec: HAProxyLoadBalancerSpec{
+			APIServerPort: apiServerPort,
+			Frontends:     frontends,
+		},
+	}
+}
+
+func withReplicas(haproxyLoadBalancer *HAProxyLoadBalancer, replicas int32, virtualIP string) *HAProxyLoadBalancer {
+	haproxyLoadBalancer.Spec.Replicas = pointer.Int32Ptr(replicas)
+	haproxyLoadBalancer.Spec.VirtualIP = virtualIP
+	return haproxyLoadBalancer
+}
+
+func withVirtualRouterID(haproxyLoadBalancer *HAProxyLoadBalancer, virtualRouterID int32) *HAProxyLoadBalancer {
+	haproxyLoadBalancer.Spec.VirtualRouterID = pointer.Int32Ptr(virtualRouterID)
+	return haproxyLoadBalancer
+}
@@ -18,6 +18,8 @@ package v1alpha4
 
 import (
 	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
 const (
@@ -52,10 +54,20 @@ const (
 // VirtualMachineCloneSpec is information used to clone a virtual machine.
 type VirtualMachineCloneSpec struct {
 	// Template is the name or inventory path of the template used to clone
-	// the virtual machine.
+	// the virtual machine. When ContentLibrary is set, Template is the name
+	// or ID of the library item from which the virtual machine is deployed.
 	// +kubebuilder:validation:MinLength=1
 	Template string `json:"template"`
 
+	// ContentLibrary is the name or ID of the content library containing the
+	// template. When set, the virtual machine is deployed from the library
+	// item named by Template, which may be either an OVF template or a VM
+	// template, instead of being cloned from a virtual machine template of
+	// the inventory.
+	// Deployments from a content library are always full clones.
+	// +optional
+	ContentLibrary string `json:"contentLibrary,omitempty"`
+
 	// CloneMode specifies the type of clone operation.
 	// The LinkedClone mode is only support for templates that have at least
 	// one snapshot. If the template has no snapshots, then CloneMode defaults
@@ -138,6 +150,190 @@ type VirtualMachineCloneSpec struct {
 	// Defaults to empty map
 	// +optional
 	CustomVMXKeys map[string]string `json:"customVMXKeys,omitempty"`
+	// TemplateDisks overrides the size and placement of the disks of the
+	// template. Template disks without an override keep their size, except
+	// for the first disk which is resized according to DiskGiB.
+	// +optional
+	TemplateDisks []TemplateDiskSpec `json:"templateDisks,omitempty"`
+	// AdditionalDisks is the list of data disks created and attached to the
+	// virtual machine when it is cloned, in addition to the disks of the
+	// template.
+	// +optional
+	AdditionalDisks []VirtualDiskSpec `json:"additionalDisks,omitempty"`
+	// TagIDs is the list of IDs of the vSphere tags attached to the virtual
+	// machine, in addition to the tags identifying the cluster, the namespace
+	// and the role of the virtual machine which are always attached when
+	// connected to vCenter.
+	// +optional
+	TagIDs []string `json:"tagIDs,omitempty"`
+	// MachineNameAttribute is the name of a custom attribute of the virtual
+	// machine which is set to the name of the Machine owning the virtual
+	// machine. The custom attribute is defined if it does not exist.
+	// No custom attribute is set when empty.
+	// +optional
+	MachineNameAttribute string `json:"machineNameAttribute,omitempty"`
+	// Customization configures the guest operating system with a vSphere
+	// guest customization spec applied when the virtual machine is cloned,
+	// instead of with cloud-init metadata. It is meant for images without
+	// cloud-init, such as Windows images.
+	// +optional
+	Customization *GuestCustomizationSpec `json:"customization,omitempty"`
+	// OS is the operating system of the virtual machine, which determines
+	// the format of its metadata. The metadata of a Windows virtual machine
+	// is read by cloudbase-init, and its guest may only be customized with
+	// Sysprep. Windows virtual machines may not be members of the control
+	// plane.
+	// Defaults to Linux.
+	// +kubebuilder:validation:Enum=Linux;Windows
+	// +optional
+	OS OS `json:"os,omitempty"`
+}
+
+// OS is the operating system of a virtual machine.
+type OS string
+
+const (
+	// Linux is the operating system of virtual machines bootstrapped with
+	// cloud-init or Ignition.
+	Linux OS = "Linux"
+
+	// Windows is the operating system of virtual machines bootstrapped with
+	// cloudbase-init.
+	Windows OS = "Windows"
+)
+
+// TemplateDiskSpec overrides the size and placement of a disk of the
+// template. The disk is identified by its unit number, its label or both.
+type TemplateDiskSpec struct {
+	// UnitNumber identifies the disk by its unit number on its controller.
+	// +optional
+	UnitNumber *int32 `json:"unitNumber,omitempty"`
+
+	// ControllerKey identifies the controller of the disk identified by
+	// UnitNumber by its device key, for example 1000 for the first SCSI
+	// controller. It is required if the disks of the template are attached
+	// to several controllers.
+	// +optional
+	ControllerKey *int32 `json:"controllerKey,omitempty"`
+
+	// Label identifies the disk by its device label, for example "Hard disk 2".
+	// +optional
+	Label string `json:"label,omitempty"`
+
+	// SizeGiB is the size of the disk, in GiB. The disk cannot be smaller
+	// than the disk of the template. This field is ignored for linked clones.
+	// Defaults to the size of the disk of the template.
+	// +optional
+	SizeGiB int32 `json:"sizeGiB,omitempty"`
+
+	// Datastore is the name or inventory path of the datastore on which the
+	// disk is placed.
+	// Defaults to the datastore of the virtual machine.
+	// +optional
+	Datastore string `json:"datastore,omitempty"`
+
+	// StoragePolicyName is the name of the storage policy associated with
+	// the disk.
+	// +optional
+	StoragePolicyName string `json:"storagePolicyName,omitempty"`
+}
+
+// DiskProvisioningMode is the provisioning type of a virtual disk.
+type DiskProvisioningMode string
+
+const (
+	// ThinProvisioningMode allocates the space of the disk as it is used.
+	ThinProvisioningMode DiskProvisioningMode = "Thin"
+
+	// ThickProvisioningMode allocates all of the space of the disk when it
+	// is created.
+	ThickProvisioningMode DiskProvisioningMode = "Thick"
+
+	// EagerlyZeroedProvisioningMode allocates all of the space of the disk
+	// and zeroes it when the disk is created.
+	EagerlyZeroedProvisioningMode DiskProvisioningMode = "EagerlyZeroed"
+)
+
+// VirtualDiskSpec describes a data disk added to a virtual machine.
+type VirtualDiskSpec struct {
+	// SizeGiB is the size of the disk, in GiB.
+	// +kubebuilder:validation:Minimum=1
+	SizeGiB int32 `json:"sizeGiB"`
+
+	// ProvisioningMode is the provisioning type of the disk.
+	// Defaults to Thin.
+	// +kubebuilder:validation:Enum=Thin;Thick;EagerlyZeroed
+	// +optional
+	ProvisioningMode DiskProvisioningMode `json:"provisioningMode,omitempty"`
+
+	// Datastore is the name or inventory path of the datastore on which the
+	// disk is created.
+	// Defaults to the datastore of the virtual machine.
+	// +optional
+	Datastore string `json:"datastore,omitempty"`
+
+	// StoragePolicyName is the name of the storage policy associated with
+	// the disk.
+	// +optional
+	StoragePolicyName string `json:"storagePolicyName,omitempty"`
+
+	// ControllerBusNumber is the bus number of the SCSI controller to which
+	// the disk is attached.
+	// Defaults to the SCSI controller of the first disk of the template.
+	// +optional
+	ControllerBusNumber *int32 `json:"controllerBusNumber,omitempty"`
+
+	// UnitNumber is the unit number of the disk on its controller.
+	// Defaults to the first free unit number of the controller.
+	// +optional
+	UnitNumber *int32 `json:"unitNumber,omitempty"`
+}
+
+// GuestCustomizationType is the type of the guest customization of a
+// virtual machine.
+type GuestCustomizationType string
+
+const (
+	// LinuxGuestCustomization customizes the guest with the Linux
+	// customization tools.
+	LinuxGuestCustomization GuestCustomizationType = "Linux"
+
+	// SysprepGuestCustomization customizes a Windows guest with Sysprep.
+	SysprepGuestCustomization GuestCustomizationType = "Sysprep"
+)
+
+// GuestCustomizationSpec describes the guest customization of a virtual
+// machine. The customization spec is either built from the network spec of
+// the virtual machine, or is a customization spec stored in vCenter.
+type GuestCustomizationSpec struct {
+	// Type is the type of the customization spec built from the network
+	// spec. Mutually exclusive with SpecName.
+	// +kubebuilder:validation:Enum=Linux;Sysprep
+	// +optional
+	Type GuestCustomizationType `json:"type,omitempty"`
+
+	// SpecName is the name of a customization spec stored in vCenter.
+	// The IP addresses of the network adapters of the spec which are
+	// prompted for when the spec is applied are set to the IP addresses of
+	// the matching network devices. Mutually exclusive with Type.
+	// +optional
+	SpecName string `json:"specName,omitempty"`
+
+	// Domain is the DNS domain of a Linux guest.
+	// +optional
+	Domain string `json:"domain,omitempty"`
+
+	// Workgroup is the workgroup joined by a Windows guest.
+	// Defaults to WORKGROUP.
+	// +optional
+	Workgroup string `json:"workgroup,omitempty"`
+
+	// TimeZone is the time zone of the guest: a tz database name such as
+	// "Etc/UTC" for a Linux guest, or the index of a Microsoft time zone
+	// such as "85" for a Windows guest. Defaults to "Etc/UTC" and to "85",
+	// Greenwich Mean Time, respectively.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
 // VSphereMachineTemplateResource describes the data needed to create a VSphereMachine from a template
@@ -191,6 +387,186 @@ type NetworkSpec struct {
 	// server endpoint on this machine
 	// +optional
 	PreferredAPIServerCIDR string `json:"preferredAPIServerCidr,omitempty"`
+
+	// Bonds is a list of bond interfaces aggregating network devices.
+	// +optional
+	Bonds []NetworkBondSpec `json:"bonds,omitempty"`
+
+	// VLANs is a list of VLAN interfaces on top of network devices, bonds
+	// or bridges.
+	// +optional
+	VLANs []NetworkVLANSpec `json:"vlans,omitempty"`
+
+	// Bridges is a list of bridge interfaces connecting network devices,
+	// bonds or VLANs.
+	// +optional
+	Bridges []NetworkBridgeSpec `json:"bridges,omitempty"`
+}
+
+// DeviceName returns the name of the network device with the provided index
+// in the guest operating system.
+func (n *NetworkSpec) DeviceName(i int) string {
+	if name := n.Devices[i].DeviceName; name != "" {
+		return name
+	}
+	return fmt.Sprintf("eth%d", i)
+}
+
+// IsLinked returns whether the interface with the provided name is aggregated
+// by a bond, connected by a bridge or the link of a VLAN. A linked network
+// device does not require an address of its own.
+func (n *NetworkSpec) IsLinked(name string) bool {
+	for _, bond := range n.Bonds {
+		for _, iface := range bond.Interfaces {
+			if iface == name {
+				return true
+			}
+		}
+	}
+	for _, bridge := range n.Bridges {
+		for _, iface := range bridge.Interfaces {
+			if iface == name {
+				return true
+			}
+		}
+	}
+	for _, vlan := range n.VLANs {
+		if vlan.Link == name {
+			return true
+		}
+	}
+	return false
+}
+
+// VirtualInterfaces returns the network configuration of the bonds, the
+// VLANs and the bridges of the network.
+func (n *NetworkSpec) VirtualInterfaces() []NetworkInterfaceSpec {
+	ifaces := make([]NetworkInterfaceSpec, 0, len(n.Bonds)+len(n.VLANs)+len(n.Bridges))
+	for _, bond := range n.Bonds {
+		ifaces = append(ifaces, bond.NetworkInterfaceSpec)
+	}
+	for _, vlan := range n.VLANs {
+		ifaces = append(ifaces, vlan.NetworkInterfaceSpec)
+	}
+	for _, bridge := range n.Bridges {
+		ifaces = append(ifaces, bridge.NetworkInterfaceSpec)
+	}
+	return ifaces
+}
+
+// NetworkInterfaceSpec defines the network configuration of a bond, a VLAN
+// or a bridge interface.
+type NetworkInterfaceSpec struct {
+	// DHCP4 is a flag that indicates whether or not to use DHCP for IPv4
+	// on this interface.
+	// +optional
+	DHCP4 bool `json:"dhcp4,omitempty"`
+
+	// DHCP6 is a flag that indicates whether or not to use DHCP for IPv6
+	// on this interface.
+	// +optional
+	DHCP6 bool `json:"dhcp6,omitempty"`
+
+	// Gateway4 is the IPv4 gateway used by this interface.
+	// +optional
+	Gateway4 string `json:"gateway4,omitempty"`
+
+	// Gateway6 is the IPv6 gateway used by this interface.
+	// +optional
+	Gateway6 string `json:"gateway6,omitempty"`
+
+	// IPAddrs is a list of one or more IPv4 and/or IPv6 addresses to assign
+	// to this interface, in the CIDR format.
+	// +optional
+	IPAddrs []string `json:"ipAddrs,omitempty"`
+
+	// MTU is the interface’s Maximum Transmission Unit size in bytes.
+	// +optional
+	MTU *int64 `json:"mtu,omitempty"`
+
+	// Nameservers is a list of IPv4 and/or IPv6 addresses used as DNS
+	// nameservers.
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// Routes is a list of optional, static routes applied to the interface.
+	// +optional
+	Routes []NetworkRouteSpec `json:"routes,omitempty"`
+
+	// SearchDomains is a list of search domains used when resolving IP
+	// addresses with DNS.
+	// +optional
+	SearchDomains []string `json:"searchDomains,omitempty"`
+}
+
+// NetworkBondSpec defines a bond interface aggregating network devices.
+type NetworkBondSpec struct {
+	// Name is the name of the bond interface in the guest operating system.
+	Name string `json:"name"`
+
+	// Interfaces is the list of the names of the network devices aggregated
+	// by the bond. The name of a network device is its DeviceName, or
+	// eth<index> when its DeviceName is empty.
+	// +kubebuilder:validation:MinItems=1
+	Interfaces []string `json:"interfaces"`
+
+	// Mode is the bonding mode, e.g. 802.3ad for LACP.
+	// +kubebuilder:validation:Enum=balance-rr;active-backup;balance-xor;broadcast;802.3ad;balance-tlb;balance-alb
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// LACPRate is the rate at which LACPDUs are transmitted in the 802.3ad
+	// mode.
+	// +kubebuilder:validation:Enum=slow;fast
+	// +optional
+	LACPRate string `json:"lacpRate,omitempty"`
+
+	// MIIMonitorInterval is the interval in milliseconds at which the links
+	// of the bond are monitored.
+	// +optional
+	MIIMonitorInterval *int32 `json:"miiMonitorInterval,omitempty"`
+
+	// TransmitHashPolicy is the policy used to select the link of the bond
+	// packets are transmitted on, e.g. layer3+4.
+	// +optional
+	TransmitHashPolicy string `json:"transmitHashPolicy,omitempty"`
+
+	NetworkInterfaceSpec `json:",inline"`
+}
+
+// NetworkVLANSpec defines a VLAN interface.
+type NetworkVLANSpec struct {
+	// Name is the name of the VLAN interface in the guest operating system.
+	Name string `json:"name"`
+
+	// ID is the VLAN ID.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=4094
+	ID int32 `json:"id"`
+
+	// Link is the name of the network device, bond or bridge the VLAN
+	// interface is created on.
+	Link string `json:"link"`
+
+	NetworkInterfaceSpec `json:",inline"`
+}
+
+// NetworkBridgeSpec defines a bridge interface.
+type NetworkBridgeSpec struct {
+	// Name is the name of the bridge interface in the guest operating system.
+	Name string `json:"name"`
+
+	// Interfaces is the list of the names of the network devices, bonds or
+	// VLANs connected by the bridge.
+	// +kubebuilder:validation:MinItems=1
+	Interfaces []string `json:"interfaces"`
+
+	// STP is a flag that indicates whether or not the bridge uses the
+	// Spanning Tree Protocol.
+	// +optional
+	STP *bool `json:"stp,omitempty"`
+
+	NetworkInterfaceSpec `json:",inline"`
 }
 
 // NetworkDeviceSpec defines the network configuration for a virtual machine's
@@ -233,6 +609,13 @@ type NetworkDeviceSpec struct {
 	// +optional
 	IPAddrs []string `json:"ipAddrs,omitempty"`
 
+	// IPPoolRef is a reference to a VSphereIPPool, in the namespace of the
+	// VSphereVM, from which an address is allocated to this device when
+	// DHCP4 and DHCP6 are both false and IPAddrs is empty. The gateway and
+	// the nameservers of the pool are used unless the device sets its own.
+	// +optional
+	IPPoolRef *corev1.LocalObjectReference `json:"ipPoolRef,omitempty"`
+
 	// MTU is the device’s Maximum Transmission Unit size in bytes.
 	// +optional
 	MTU *int64 `json:"mtu,omitempty"`
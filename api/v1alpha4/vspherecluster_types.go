@@ -67,6 +67,28 @@ type VSphereClusterSpec struct {
 	// the identity to use when reconciling the cluster.
 	// +optional
 	IdentityRef *VSphereIdentityReference `json:"identityRef,omitempty"`
+
+	// VMAntiAffinity configures the DRS anti-affinity rules which keep the
+	// VMs of the cluster on different ESXi hosts. By default, a rule is
+	// maintained for the control plane VMs.
+	// +optional
+	VMAntiAffinity *VMAntiAffinitySpec `json:"vmAntiAffinity,omitempty"`
+}
+
+// VMAntiAffinitySpec configures the DRS anti-affinity rules of the VMs of a
+// cluster. The rules are created in the compute cluster of the VMs, and are
+// not mandatory, so that DRS may still place VMs on the same host when there
+// are not enough hosts.
+type VMAntiAffinitySpec struct {
+	// Disabled disables the anti-affinity rules of the cluster.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// MachineDeployments enables an anti-affinity rule for the VMs of each
+	// MachineDeployment of the cluster, in addition to the rule of the
+	// control plane VMs.
+	// +optional
+	MachineDeployments bool `json:"machineDeployments,omitempty"`
 }
 
 // VSphereClusterStatus defines the observed state of VSphereClusterSpec
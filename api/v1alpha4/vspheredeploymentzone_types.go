@@ -27,6 +27,11 @@ type VSphereDeploymentZoneSpec struct {
 	// Server is the address of the vSphere endpoint.
 	Server string `json:"server,omitempty"`
 
+	// Thumbprint is the colon-separated SHA-1 checksum of the vCenter server's host certificate.
+	// The manager credentials are used to connect to the server.
+	// +optional
+	Thumbprint string `json:"thumbprint,omitempty"`
+
 	// failureDomain is the name of the VSphereFailureDomain used for this VSphereDeploymentZone
 	FailureDomain string `json:"failureDomain,omitempty"`
 
@@ -99,6 +104,14 @@ type VSphereDeploymentZone struct {
 	Status VSphereDeploymentZoneStatus `json:"status,omitempty"`
 }
 
+func (z *VSphereDeploymentZone) GetConditions() clusterv1.Conditions {
+	return z.Status.Conditions
+}
+
+func (z *VSphereDeploymentZone) SetConditions(conditions clusterv1.Conditions) {
+	z.Status.Conditions = conditions
+}
+
 // +kubebuilder:object:root=true
 
 // VSphereDeploymentZoneList contains a list of VSphereDeploymentZone
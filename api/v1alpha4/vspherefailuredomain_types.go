@@ -78,6 +78,12 @@ type FailureDomainHostGroup struct {
 	// AutoConfigure creates the given hostGroup based on the supplied zone tagging
 	// +optional
 	AutoConfigure *bool `json:"autoConfigure,omitempty"`
+
+	// VMGroupName is the name of the VM group the virtual machines of this failure domain
+	// are added to. When AutoConfigure is set, the VM group and a VM-host affinity rule
+	// binding it to the host group are created.
+	// +optional
+	VMGroupName string `json:"vmGroupName,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha4
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	// IPPoolFinalizer allows ReconcileVSphereIPPool to keep the pool until
+	// all of its addresses have been released.
+	IPPoolFinalizer = "vsphereippool.infrastructure.cluster.x-k8s.io"
+)
+
+// VSphereIPPoolSpec defines the desired state of VSphereIPPool
+type VSphereIPPoolSpec struct {
+	// CIDR is the IPv4 or IPv6 network of the pool, for example
+	// 192.168.10.0/24. The addresses allocated from the pool use the prefix
+	// length of the CIDR.
+	CIDR string `json:"cidr"`
+
+	// Ranges restricts the addresses allocated from the pool. Each range
+	// must be within the CIDR.
+	// Defaults to all the host addresses of the CIDR.
+	// +optional
+	Ranges []IPRange `json:"ranges,omitempty"`
+
+	// Gateway is the gateway of the network devices whose address is
+	// allocated from the pool. The gateway address is never allocated.
+	// +optional
+	Gateway string `json:"gateway,omitempty"`
+
+	// Nameservers is a list of IPv4 and/or IPv6 addresses used as DNS
+	// nameservers by the network devices whose address is allocated from
+	// the pool.
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+}
+
+// IPRange is an inclusive range of IP addresses.
+type IPRange struct {
+	// Start is the first address of the range.
+	Start string `json:"start"`
+
+	// End is the last address of the range.
+	End string `json:"end"`
+}
+
+// VSphereIPPoolStatus defines the observed state of VSphereIPPool
+type VSphereIPPoolStatus struct {
+	// Allocations is the list of addresses allocated from the pool.
+	// +optional
+	Allocations []IPAddressAllocation `json:"allocations,omitempty"`
+
+	// Conditions defines current service state of the VSphereIPPool.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+// IPAddressAllocation is an address allocated from a VSphereIPPool to a
+// network device of a VSphereVM.
+type IPAddressAllocation struct {
+	// Address is the allocated address.
+	Address string `json:"address"`
+
+	// VSphereVM is the name of the VSphereVM the address is allocated to.
+	VSphereVM string `json:"vsphereVM"`
+
+	// DeviceIndex is the index of the network device of the VSphereVM the
+	// address is allocated to.
+	DeviceIndex int32 `json:"deviceIndex"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:storageversion
+// +kubebuilder:resource:path=vsphereippools,scope=Namespaced,categories=cluster-api
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="CIDR",type="string",JSONPath=".spec.cidr",description="Network of the pool"
+// +kubebuilder:printcolumn:name="Gateway",type="string",JSONPath=".spec.gateway",description="Gateway of the pool"
+
+// VSphereIPPool is the Schema for the vsphereippools API
+type VSphereIPPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VSphereIPPoolSpec   `json:"spec,omitempty"`
+	Status VSphereIPPoolStatus `json:"status,omitempty"`
+}
+
+func (p *VSphereIPPool) GetConditions() clusterv1.Conditions {
+	return p.Status.Conditions
+}
+
+func (p *VSphereIPPool) SetConditions(conditions clusterv1.Conditions) {
+	p.Status.Conditions = conditions
+}
+
+// +kubebuilder:object:root=true
+
+// VSphereIPPoolList contains a list of VSphereIPPool
+type VSphereIPPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VSphereIPPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VSphereIPPool{}, &VSphereIPPoolList{})
+}
@@ -25,6 +25,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -53,6 +54,13 @@ func (m *VSphereMachine) ValidateCreate() error {
 		}
 	}
 
+	allErrs = append(allErrs, validateNetworkInterfaces(field.NewPath("spec", "network"), spec.Network)...)
+	allErrs = append(allErrs, validateGuestCustomization(field.NewPath("spec", "customization"), spec.Customization)...)
+	allErrs = append(allErrs, validateOS(field.NewPath("spec"), spec.VirtualMachineCloneSpec)...)
+	if _, ok := m.Labels[clusterv1.MachineControlPlaneLabelName]; ok && spec.OS == Windows {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "os"), "Windows machines may not be members of the control plane"))
+	}
+
 	return aggregateObjErrors(m.GroupVersionKind().GroupKind(), m.Name, allErrs)
 }
 
@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	. "github.com/onsi/gomega"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
 var (
@@ -55,6 +56,90 @@ func TestVSphereMachine_ValidateCreate(t *testing.T) {
 			vsphereMachine: createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32", "192.168.0.3/32"}),
 			wantErr:        false,
 		},
+		{
+			name: "VLAN on a bond of network devices",
+			vsphereMachine: withNetworkInterfaces(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32", "192.168.0.3/32"}),
+				[]NetworkBondSpec{{Name: "bond0", Interfaces: []string{"eth0", "eth1"}}},
+				[]NetworkVLANSpec{{Name: "vlan100", ID: 100, Link: "bond0"}},
+				[]NetworkBridgeSpec{{Name: "br0", Interfaces: []string{"vlan100"}}}),
+			wantErr: false,
+		},
+		{
+			name: "bond of a network device which does not exist",
+			vsphereMachine: withNetworkInterfaces(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}),
+				[]NetworkBondSpec{{Name: "bond0", Interfaces: []string{"eth0", "eth1"}}}, nil, nil),
+			wantErr: true,
+		},
+		{
+			name: "VLAN on a link which does not exist",
+			vsphereMachine: withNetworkInterfaces(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}),
+				nil, []NetworkVLANSpec{{Name: "vlan100", ID: 100, Link: "bond0"}}, nil),
+			wantErr: true,
+		},
+		{
+			name: "bond named after a network device",
+			vsphereMachine: withNetworkInterfaces(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32", "192.168.0.3/32"}),
+				[]NetworkBondSpec{{Name: "eth1", Interfaces: []string{"eth0"}}}, nil, nil),
+			wantErr: true,
+		},
+		{
+			name: "bond IPs are not in CIDR format",
+			vsphereMachine: withNetworkInterfaces(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32", "192.168.0.3/32"}),
+				[]NetworkBondSpec{{Name: "bond0", Interfaces: []string{"eth0", "eth1"}, NetworkInterfaceSpec: NetworkInterfaceSpec{IPAddrs: []string{"192.168.0.5"}}}}, nil, nil),
+			wantErr: true,
+		},
+		{
+			name: "Sysprep customization",
+			vsphereMachine: withCustomization(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}),
+				&GuestCustomizationSpec{Type: SysprepGuestCustomization, TimeZone: "85"}),
+			wantErr: false,
+		},
+		{
+			name: "customization spec stored in vCenter",
+			vsphereMachine: withCustomization(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}),
+				&GuestCustomizationSpec{SpecName: "windows"}),
+			wantErr: false,
+		},
+		{
+			name: "customization with both a type and a spec name",
+			vsphereMachine: withCustomization(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}),
+				&GuestCustomizationSpec{Type: LinuxGuestCustomization, SpecName: "linux"}),
+			wantErr: true,
+		},
+		{
+			name: "customization without a type nor a spec name",
+			vsphereMachine: withCustomization(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}),
+				&GuestCustomizationSpec{Domain: "example.com"}),
+			wantErr: true,
+		},
+		{
+			name: "Sysprep customization with a tz database time zone",
+			vsphereMachine: withCustomization(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}),
+				&GuestCustomizationSpec{Type: SysprepGuestCustomization, TimeZone: "Etc/UTC"}),
+			wantErr: true,
+		},
+		{
+			name:           "Windows worker machine",
+			vsphereMachine: withOS(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}), Windows, false),
+			wantErr:        false,
+		},
+		{
+			name:           "Windows control plane machine",
+			vsphereMachine: withOS(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}), Windows, true),
+			wantErr:        true,
+		},
+		{
+			name: "Windows machine with a Linux customization",
+			vsphereMachine: withCustomization(withOS(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}), Windows, false),
+				&GuestCustomizationSpec{Type: LinuxGuestCustomization}),
+			wantErr: true,
+		},
+		{
+			name: "Windows machine with a bond",
+			vsphereMachine: withNetworkInterfaces(withOS(createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32", "192.168.0.3/32"}), Windows, false),
+				[]NetworkBondSpec{{Name: "bond0", Interfaces: []string{"eth0", "eth1"}}}, nil, nil),
+			wantErr: true,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -142,3 +227,23 @@ func createVSphereMachine(server string, providerID *string, preferredAPIServerC
 	}
 	return VSphereMachine
 }
+
+func withNetworkInterfaces(vsphereMachine *VSphereMachine, bonds []NetworkBondSpec, vlans []NetworkVLANSpec, bridges []NetworkBridgeSpec) *VSphereMachine {
+	vsphereMachine.Spec.Network.Bonds = bonds
+	vsphereMachine.Spec.Network.VLANs = vlans
+	vsphereMachine.Spec.Network.Bridges = bridges
+	return vsphereMachine
+}
+
+func withCustomization(vsphereMachine *VSphereMachine, customization *GuestCustomizationSpec) *VSphereMachine {
+	vsphereMachine.Spec.Customization = customization
+	return vsphereMachine
+}
+
+func withOS(vsphereMachine *VSphereMachine, os OS, controlPlane bool) *VSphereMachine {
+	vsphereMachine.Spec.OS = os
+	if controlPlane {
+		vsphereMachine.Labels = map[string]string{clusterv1.MachineControlPlaneLabelName: ""}
+	}
+	return vsphereMachine
+}
@@ -21,6 +21,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
@@ -54,6 +55,20 @@ func (r *VSphereMachineTemplate) ValidateCreate() error {
 		}
 	}
 
+	for _, iface := range spec.Network.VirtualInterfaces() {
+		if len(iface.IPAddrs) != 0 {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "template", "spec", "network"), "ipAddrs of bonds, VLANs and bridges cannot be set in templates"))
+			break
+		}
+	}
+
+	allErrs = append(allErrs, validateNetworkInterfaces(field.NewPath("spec", "template", "spec", "network"), spec.Network)...)
+	allErrs = append(allErrs, validateGuestCustomization(field.NewPath("spec", "template", "spec", "customization"), spec.Customization)...)
+	allErrs = append(allErrs, validateOS(field.NewPath("spec", "template", "spec"), spec.VirtualMachineCloneSpec)...)
+	if _, ok := r.Labels[clusterv1.MachineControlPlaneLabelName]; ok && spec.OS == Windows {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "template", "spec", "os"), "Windows machines may not be members of the control plane"))
+	}
+
 	return aggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, allErrs)
 }
 
@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	. "github.com/onsi/gomega"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
 //nolint
@@ -51,6 +52,11 @@ func TestVSphereMachineTemplate_ValidateCreate(t *testing.T) {
 			vsphereMachine: createVSphereMachineTemplate("foo.com", nil, "", []string{"192.168.0.1/32", "192.168.0.3/32"}),
 			wantErr:        true,
 		},
+		{
+			name:           "Windows control plane template",
+			vsphereMachine: createWindowsControlPlaneVSphereMachineTemplate(),
+			wantErr:        true,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -130,3 +136,10 @@ func createVSphereMachineTemplate(server string, providerID *string, preferredAP
 	}
 	return VSphereMachineTemplate
 }
+
+func createWindowsControlPlaneVSphereMachineTemplate() *VSphereMachineTemplate {
+	vsphereMachineTemplate := createVSphereMachineTemplate("foo.com", nil, "", []string{})
+	vsphereMachineTemplate.Labels = map[string]string{clusterv1.MachineControlPlaneLabelName: ""}
+	vsphereMachineTemplate.Spec.Template.Spec.OS = Windows
+	return vsphereMachineTemplate
+}
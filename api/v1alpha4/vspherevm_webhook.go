@@ -53,6 +53,10 @@ func (r *VSphereVM) ValidateCreate() error {
 		}
 	}
 
+	allErrs = append(allErrs, validateNetworkInterfaces(field.NewPath("spec", "network"), spec.Network)...)
+	allErrs = append(allErrs, validateGuestCustomization(field.NewPath("spec", "customization"), spec.Customization)...)
+	allErrs = append(allErrs, validateOS(field.NewPath("spec"), spec.VirtualMachineCloneSpec)...)
+
 	return aggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, allErrs)
 }
 
@@ -17,6 +17,9 @@ limitations under the License.
 package v1alpha4
 
 import (
+	"net"
+	"strconv"
+
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
@@ -33,3 +36,118 @@ func aggregateObjErrors(gk schema.GroupKind, name string, allErrs field.ErrorLis
 		allErrs,
 	)
 }
+
+// validateNetworkInterfaces validates that the bonds, the VLANs and the
+// bridges of the network reference existing interfaces.
+func validateNetworkInterfaces(fldPath *field.Path, network NetworkSpec) field.ErrorList {
+	var allErrs field.ErrorList
+
+	devices := map[string]bool{}
+	for i := range network.Devices {
+		devices[network.DeviceName(i)] = true
+	}
+	bonds, vlans, bridges := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	names := map[string]bool{}
+	for name := range devices {
+		names[name] = true
+	}
+	addName := func(path *field.Path, name string, kind map[string]bool) {
+		if names[name] {
+			allErrs = append(allErrs, field.Duplicate(path, name))
+		}
+		names[name] = true
+		kind[name] = true
+	}
+	for i, bond := range network.Bonds {
+		addName(fldPath.Child("bonds").Index(i).Child("name"), bond.Name, bonds)
+	}
+	for i, vlan := range network.VLANs {
+		addName(fldPath.Child("vlans").Index(i).Child("name"), vlan.Name, vlans)
+	}
+	for i, bridge := range network.Bridges {
+		addName(fldPath.Child("bridges").Index(i).Child("name"), bridge.Name, bridges)
+	}
+
+	for i, bond := range network.Bonds {
+		path := fldPath.Child("bonds").Index(i)
+		for j, iface := range bond.Interfaces {
+			if !devices[iface] {
+				allErrs = append(allErrs, field.NotFound(path.Child("interfaces").Index(j), iface))
+			}
+		}
+		allErrs = append(allErrs, validateNetworkInterfaceSpec(path, bond.NetworkInterfaceSpec)...)
+	}
+	for i, vlan := range network.VLANs {
+		path := fldPath.Child("vlans").Index(i)
+		if !devices[vlan.Link] && !bonds[vlan.Link] && !bridges[vlan.Link] {
+			allErrs = append(allErrs, field.NotFound(path.Child("link"), vlan.Link))
+		}
+		allErrs = append(allErrs, validateNetworkInterfaceSpec(path, vlan.NetworkInterfaceSpec)...)
+	}
+	for i, bridge := range network.Bridges {
+		path := fldPath.Child("bridges").Index(i)
+		for j, iface := range bridge.Interfaces {
+			if !devices[iface] && !bonds[iface] && !vlans[iface] {
+				allErrs = append(allErrs, field.NotFound(path.Child("interfaces").Index(j), iface))
+			}
+		}
+		allErrs = append(allErrs, validateNetworkInterfaceSpec(path, bridge.NetworkInterfaceSpec)...)
+	}
+	return allErrs
+}
+
+func validateNetworkInterfaceSpec(fldPath *field.Path, iface NetworkInterfaceSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, ip := range iface.IPAddrs {
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ipAddrs").Index(i), ip, "ip addresses should be in the CIDR format"))
+		}
+	}
+	return allErrs
+}
+
+// validateGuestCustomization validates that the guest customization either
+// is built from the network spec or references a customization spec.
+func validateGuestCustomization(fldPath *field.Path, customization *GuestCustomizationSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if customization == nil {
+		return allErrs
+	}
+
+	switch {
+	case customization.Type == "" && customization.SpecName == "":
+		allErrs = append(allErrs, field.Required(fldPath, "either type or specName must be set"))
+	case customization.Type != "" && customization.SpecName != "":
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("specName"), "type and specName are mutually exclusive"))
+	}
+	if customization.Type == SysprepGuestCustomization && customization.TimeZone != "" {
+		if _, err := strconv.Atoi(customization.TimeZone); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("timeZone"), customization.TimeZone, "the time zone of a Sysprep customization should be the index of a Microsoft time zone"))
+		}
+	}
+	return allErrs
+}
+
+// validateOS validates that the clone spec of a Windows virtual machine only
+// configures what is supported on Windows.
+func validateOS(fldPath *field.Path, spec VirtualMachineCloneSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if spec.OS != Windows {
+		return allErrs
+	}
+
+	if spec.Customization != nil && spec.Customization.Type == LinuxGuestCustomization {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("customization", "type"), spec.Customization.Type, "the guest of a Windows virtual machine may only be customized with Sysprep"))
+	}
+	network := fldPath.Child("network")
+	if len(spec.Network.Bonds) > 0 {
+		allErrs = append(allErrs, field.Forbidden(network.Child("bonds"), "bonds are not supported on Windows"))
+	}
+	if len(spec.Network.VLANs) > 0 {
+		allErrs = append(allErrs, field.Forbidden(network.Child("vlans"), "VLANs are not supported on Windows"))
+	}
+	if len(spec.Network.Bridges) > 0 {
+		allErrs = append(allErrs, field.Forbidden(network.Child("bridges"), "bridges are not supported on Windows"))
+	}
+	return allErrs
+}
@@ -22,6 +22,7 @@ package v1alpha4
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	apiv1alpha4 "sigs.k8s.io/cluster-api/api/v1alpha4"
 	"sigs.k8s.io/cluster-api/errors"
@@ -283,13 +284,103 @@ func (in *FailureDomainHostGroup) DeepCopy() *FailureDomainHostGroup {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GuestCustomizationSpec) DeepCopyInto(out *GuestCustomizationSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GuestCustomizationSpec.
+func (in *GuestCustomizationSpec) DeepCopy() *GuestCustomizationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GuestCustomizationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HAProxyBackend) DeepCopyInto(out *HAProxyBackend) {
+	*out = *in
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MachineSelector != nil {
+		in, out := &in.MachineSelector, &out.MachineSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HAProxyBackend.
+func (in *HAProxyBackend) DeepCopy() *HAProxyBackend {
+	if in == nil {
+		return nil
+	}
+	out := new(HAProxyBackend)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HAProxyBackendServerStatus) DeepCopyInto(out *HAProxyBackendServerStatus) {
+	*out = *in
+	if in.LastTransitionTime != nil {
+		in, out := &in.LastTransitionTime, &out.LastTransitionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HAProxyBackendServerStatus.
+func (in *HAProxyBackendServerStatus) DeepCopy() *HAProxyBackendServerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(HAProxyBackendServerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HAProxyConfigurationTemplateReference) DeepCopyInto(out *HAProxyConfigurationTemplateReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HAProxyConfigurationTemplateReference.
+func (in *HAProxyConfigurationTemplateReference) DeepCopy() *HAProxyConfigurationTemplateReference {
+	if in == nil {
+		return nil
+	}
+	out := new(HAProxyConfigurationTemplateReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HAProxyFrontend) DeepCopyInto(out *HAProxyFrontend) {
+	*out = *in
+	in.Backend.DeepCopyInto(&out.Backend)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HAProxyFrontend.
+func (in *HAProxyFrontend) DeepCopy() *HAProxyFrontend {
+	if in == nil {
+		return nil
+	}
+	out := new(HAProxyFrontend)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HAProxyLoadBalancer) DeepCopyInto(out *HAProxyLoadBalancer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HAProxyLoadBalancer.
@@ -342,6 +433,26 @@ func (in *HAProxyLoadBalancerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HAProxyLoadBalancerReplicaStatus) DeepCopyInto(out *HAProxyLoadBalancerReplicaStatus) {
+	*out = *in
+	if in.Frontends != nil {
+		in, out := &in.Frontends, &out.Frontends
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HAProxyLoadBalancerReplicaStatus.
+func (in *HAProxyLoadBalancerReplicaStatus) DeepCopy() *HAProxyLoadBalancerReplicaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(HAProxyLoadBalancerReplicaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HAProxyLoadBalancerSpec) DeepCopyInto(out *HAProxyLoadBalancerSpec) {
 	*out = *in
@@ -351,6 +462,33 @@ func (in *HAProxyLoadBalancerSpec) DeepCopyInto(out *HAProxyLoadBalancerSpec) {
 		*out = new(SSHUser)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.APIServerPort != nil {
+		in, out := &in.APIServerPort, &out.APIServerPort
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Frontends != nil {
+		in, out := &in.Frontends, &out.Frontends
+		*out = make([]HAProxyFrontend, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.VirtualRouterID != nil {
+		in, out := &in.VirtualRouterID, &out.VirtualRouterID
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ConfigurationTemplate != nil {
+		in, out := &in.ConfigurationTemplate, &out.ConfigurationTemplate
+		*out = new(HAProxyConfigurationTemplateReference)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HAProxyLoadBalancerSpec.
@@ -366,6 +504,35 @@ func (in *HAProxyLoadBalancerSpec) DeepCopy() *HAProxyLoadBalancerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HAProxyLoadBalancerStatus) DeepCopyInto(out *HAProxyLoadBalancerStatus) {
 	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = make([]HAProxyLoadBalancerReplicaStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CertificateAuthorityExpiry != nil {
+		in, out := &in.CertificateAuthorityExpiry, &out.CertificateAuthorityExpiry
+		*out = (*in).DeepCopy()
+	}
+	if in.ClientCertificateExpiry != nil {
+		in, out := &in.ClientCertificateExpiry, &out.ClientCertificateExpiry
+		*out = (*in).DeepCopy()
+	}
+	if in.BackendServers != nil {
+		in, out := &in.BackendServers, &out.BackendServers
+		*out = make([]HAProxyBackendServerStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1alpha4.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HAProxyLoadBalancerStatus.
@@ -378,6 +545,36 @@ func (in *HAProxyLoadBalancerStatus) DeepCopy() *HAProxyLoadBalancerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAddressAllocation) DeepCopyInto(out *IPAddressAllocation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAddressAllocation.
+func (in *IPAddressAllocation) DeepCopy() *IPAddressAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAddressAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPRange) DeepCopyInto(out *IPRange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPRange.
+func (in *IPRange) DeepCopy() *IPRange {
+	if in == nil {
+		return nil
+	}
+	out := new(IPRange)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Network) DeepCopyInto(out *Network) {
 	*out = *in
@@ -403,6 +600,58 @@ func (in *Network) DeepCopy() *Network {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkBondSpec) DeepCopyInto(out *NetworkBondSpec) {
+	*out = *in
+	if in.Interfaces != nil {
+		in, out := &in.Interfaces, &out.Interfaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MIIMonitorInterval != nil {
+		in, out := &in.MIIMonitorInterval, &out.MIIMonitorInterval
+		*out = new(int32)
+		**out = **in
+	}
+	in.NetworkInterfaceSpec.DeepCopyInto(&out.NetworkInterfaceSpec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkBondSpec.
+func (in *NetworkBondSpec) DeepCopy() *NetworkBondSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkBondSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkBridgeSpec) DeepCopyInto(out *NetworkBridgeSpec) {
+	*out = *in
+	if in.Interfaces != nil {
+		in, out := &in.Interfaces, &out.Interfaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.STP != nil {
+		in, out := &in.STP, &out.STP
+		*out = new(bool)
+		**out = **in
+	}
+	in.NetworkInterfaceSpec.DeepCopyInto(&out.NetworkInterfaceSpec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkBridgeSpec.
+func (in *NetworkBridgeSpec) DeepCopy() *NetworkBridgeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkBridgeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkDeviceSpec) DeepCopyInto(out *NetworkDeviceSpec) {
 	*out = *in
@@ -411,6 +660,11 @@ func (in *NetworkDeviceSpec) DeepCopyInto(out *NetworkDeviceSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.IPPoolRef != nil {
+		in, out := &in.IPPoolRef, &out.IPPoolRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
 	if in.MTU != nil {
 		in, out := &in.MTU, &out.MTU
 		*out = new(int64)
@@ -443,6 +697,46 @@ func (in *NetworkDeviceSpec) DeepCopy() *NetworkDeviceSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkInterfaceSpec) DeepCopyInto(out *NetworkInterfaceSpec) {
+	*out = *in
+	if in.IPAddrs != nil {
+		in, out := &in.IPAddrs, &out.IPAddrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MTU != nil {
+		in, out := &in.MTU, &out.MTU
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]NetworkRouteSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.SearchDomains != nil {
+		in, out := &in.SearchDomains, &out.SearchDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkInterfaceSpec.
+func (in *NetworkInterfaceSpec) DeepCopy() *NetworkInterfaceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkInterfaceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkRouteSpec) DeepCopyInto(out *NetworkRouteSpec) {
 	*out = *in
@@ -473,6 +767,27 @@ func (in *NetworkSpec) DeepCopyInto(out *NetworkSpec) {
 		*out = make([]NetworkRouteSpec, len(*in))
 		copy(*out, *in)
 	}
+	if in.Bonds != nil {
+		in, out := &in.Bonds, &out.Bonds
+		*out = make([]NetworkBondSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VLANs != nil {
+		in, out := &in.VLANs, &out.VLANs
+		*out = make([]NetworkVLANSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Bridges != nil {
+		in, out := &in.Bridges, &out.Bridges
+		*out = make([]NetworkBridgeSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkSpec.
@@ -505,6 +820,22 @@ func (in *NetworkStatus) DeepCopy() *NetworkStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkVLANSpec) DeepCopyInto(out *NetworkVLANSpec) {
+	*out = *in
+	in.NetworkInterfaceSpec.DeepCopyInto(&out.NetworkInterfaceSpec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkVLANSpec.
+func (in *NetworkVLANSpec) DeepCopy() *NetworkVLANSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkVLANSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlacementConstraint) DeepCopyInto(out *PlacementConstraint) {
 	*out = *in
@@ -547,6 +878,31 @@ func (in *SSHUser) DeepCopy() *SSHUser {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateDiskSpec) DeepCopyInto(out *TemplateDiskSpec) {
+	*out = *in
+	if in.UnitNumber != nil {
+		in, out := &in.UnitNumber, &out.UnitNumber
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ControllerKey != nil {
+		in, out := &in.ControllerKey, &out.ControllerKey
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateDiskSpec.
+func (in *TemplateDiskSpec) DeepCopy() *TemplateDiskSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateDiskSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Topology) DeepCopyInto(out *Topology) {
 	*out = *in
@@ -572,6 +928,21 @@ func (in *Topology) DeepCopy() *Topology {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VMAntiAffinitySpec) DeepCopyInto(out *VMAntiAffinitySpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VMAntiAffinitySpec.
+func (in *VMAntiAffinitySpec) DeepCopy() *VMAntiAffinitySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VMAntiAffinitySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VSphereCluster) DeepCopyInto(out *VSphereCluster) {
 	*out = *in
@@ -752,6 +1123,11 @@ func (in *VSphereClusterSpec) DeepCopyInto(out *VSphereClusterSpec) {
 		*out = new(VSphereIdentityReference)
 		**out = **in
 	}
+	if in.VMAntiAffinity != nil {
+		in, out := &in.VMAntiAffinity, &out.VMAntiAffinity
+		*out = new(VMAntiAffinitySpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereClusterSpec.
@@ -976,6 +1352,117 @@ func (in *VSphereFailureDomainSpec) DeepCopy() *VSphereFailureDomainSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereIPPool) DeepCopyInto(out *VSphereIPPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereIPPool.
+func (in *VSphereIPPool) DeepCopy() *VSphereIPPool {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereIPPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VSphereIPPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereIPPoolList) DeepCopyInto(out *VSphereIPPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VSphereIPPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereIPPoolList.
+func (in *VSphereIPPoolList) DeepCopy() *VSphereIPPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereIPPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VSphereIPPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereIPPoolSpec) DeepCopyInto(out *VSphereIPPoolSpec) {
+	*out = *in
+	if in.Ranges != nil {
+		in, out := &in.Ranges, &out.Ranges
+		*out = make([]IPRange, len(*in))
+		copy(*out, *in)
+	}
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereIPPoolSpec.
+func (in *VSphereIPPoolSpec) DeepCopy() *VSphereIPPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereIPPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereIPPoolStatus) DeepCopyInto(out *VSphereIPPoolStatus) {
+	*out = *in
+	if in.Allocations != nil {
+		in, out := &in.Allocations, &out.Allocations
+		*out = make([]IPAddressAllocation, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1alpha4.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereIPPoolStatus.
+func (in *VSphereIPPoolStatus) DeepCopy() *VSphereIPPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereIPPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VSphereIdentityReference) DeepCopyInto(out *VSphereIdentityReference) {
 	*out = *in
@@ -1334,6 +1821,31 @@ func (in *VSphereVMStatus) DeepCopy() *VSphereVMStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualDiskSpec) DeepCopyInto(out *VirtualDiskSpec) {
+	*out = *in
+	if in.ControllerBusNumber != nil {
+		in, out := &in.ControllerBusNumber, &out.ControllerBusNumber
+		*out = new(int32)
+		**out = **in
+	}
+	if in.UnitNumber != nil {
+		in, out := &in.UnitNumber, &out.UnitNumber
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualDiskSpec.
+func (in *VirtualDiskSpec) DeepCopy() *VirtualDiskSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualDiskSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualMachine) DeepCopyInto(out *VirtualMachine) {
 	*out = *in
@@ -1367,6 +1879,30 @@ func (in *VirtualMachineCloneSpec) DeepCopyInto(out *VirtualMachineCloneSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.TemplateDisks != nil {
+		in, out := &in.TemplateDisks, &out.TemplateDisks
+		*out = make([]TemplateDiskSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AdditionalDisks != nil {
+		in, out := &in.AdditionalDisks, &out.AdditionalDisks
+		*out = make([]VirtualDiskSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TagIDs != nil {
+		in, out := &in.TagIDs, &out.TagIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Customization != nil {
+		in, out := &in.Customization, &out.Customization
+		*out = new(GuestCustomizationSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineCloneSpec.
@@ -20,18 +20,19 @@ import (
 	goctx "context"
 	"fmt"
 	"reflect"
-	"regexp"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/antihax/optional"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilnet "k8s.io/utils/net"
 	"k8s.io/utils/pointer"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
@@ -55,15 +56,25 @@ import (
 	hapi "sigs.k8s.io/cluster-api-provider-vsphere/contrib/haproxy/openapi"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/haproxy"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
 	infrautilv1 "sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
 )
 
+const (
+	// haproxyBackendHealthPollInterval is how often the health of the
+	// backend servers is read from the stats of HAProxy.
+	haproxyBackendHealthPollInterval = time.Minute
+
+	// haproxyServerStateUp is the state of a backend server passing its
+	// health checks.
+	haproxyServerStateUp = "UP"
+)
+
 var (
 	haproxyControlledType     = &infrav1.HAProxyLoadBalancer{}
 	haproxyControlledTypeName = reflect.TypeOf(haproxyControlledType).Elem().Name()
 	haproxyControlledTypeGVK  = infrav1.GroupVersion.WithKind(haproxyControlledTypeName)
-	trimmer                   = regexp.MustCompile(`(?m)[\t ]?(.*)[\t ]$`)
 )
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=haproxyloadbalancers,verbs=get;list;watch;create;update;patch;delete
@@ -71,7 +82,8 @@ var (
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
-// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;patch;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;patch;update;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
 
 // AddHAProxyLoadBalancerControllerToManager adds the HAProxy load balancer
 // controller to the provided manager.
@@ -106,6 +118,20 @@ func AddHAProxyLoadBalancerControllerToManager(ctx *context.ControllerManagerCon
 			&source.Kind{Type: &clusterv1.Machine{}},
 			handler.EnqueueRequestsFromMapFunc(reconciler.controlPlaneMachineToHAProxyLoadBalancer),
 		).
+		// Watch the CAPI machines that back the frontends of the
+		// HAProxyLoadBalancers of their cluster.
+		Watches(
+			&source.Kind{Type: &clusterv1.Machine{}},
+			handler.EnqueueRequestsFromMapFunc(reconciler.frontendMachineToHAProxyLoadBalancers),
+		).
+		// Watch the ConfigMaps holding the HAProxy configuration templates of
+		// the HAProxyLoadBalancers, so the changes to a template are rendered
+		// into the bootstrap data and pushed to the replicas. The manager
+		// only caches the ConfigMaps labeled as templates.
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(reconciler.configurationTemplateToHAProxyLoadBalancers),
+		).
 		// Watch a GenericEvent channel for the controlled resource.
 		//
 		// This is useful when there are events outside of Kubernetes that
@@ -214,20 +240,24 @@ func (r haproxylbReconciler) Reconcile(_ goctx.Context, req ctrl.Request) (_ ctr
 func (r haproxylbReconciler) reconcileDelete(ctx *context.HAProxyLoadBalancerContext) (ctrl.Result, error) {
 	ctx.Logger.Info("Handling deleted HAProxyLoadBalancer")
 
-	if err := r.reconcileDeleteVM(ctx); err != nil {
-		if apierrors.IsNotFound(err) {
-			if err := r.reconcileDeleteSecrets(ctx); err != nil {
-				ctx.Logger.Error(err, "Error deleting secrets")
-				return ctrl.Result{}, err
-			}
+	conditions.MarkFalse(ctx.HAProxyLoadBalancer, infrav1.VMProvisionedCondition, clusterv1.DeletingReason, clusterv1.ConditionSeverityInfo, "")
 
-			// The VM is deleted so remove the finalizer.
-			ctrlutil.RemoveFinalizer(ctx.HAProxyLoadBalancer, infrav1.HAProxyLoadBalancerFinalizer)
-		}
+	deleted, err := r.reconcileDeleteVM(ctx)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
+	if deleted {
+		if err := r.reconcileDeleteSecrets(ctx); err != nil {
+			ctx.Logger.Error(err, "Error deleting secrets")
+			return ctrl.Result{}, err
+		}
+
+		// The VMs are deleted so remove the finalizer.
+		ctrlutil.RemoveFinalizer(ctx.HAProxyLoadBalancer, infrav1.HAProxyLoadBalancerFinalizer)
+		return ctrl.Result{}, nil
+	}
 
-	ctx.Logger.Info("Waiting for VSphereVM to be deleted")
+	ctx.Logger.Info("Waiting for VSphereVMs to be deleted")
 	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 }
 
@@ -244,35 +274,49 @@ func (r haproxylbReconciler) reconcileDeleteSecrets(ctx *context.HAProxyLoadBala
 	return nil
 }
 
-func (r haproxylbReconciler) reconcileDeleteVM(ctx *context.HAProxyLoadBalancerContext) error {
+// reconcileDeleteVM deletes the VSphereVMs of all the replicas and returns
+// whether they are gone.
+func (r haproxylbReconciler) reconcileDeleteVM(ctx *context.HAProxyLoadBalancerContext) (bool, error) {
 	// TODO(akutz) Determine the version of vSphere.
-	return r.reconcileDeleteVMPre7(ctx)
+	remaining, err := r.reconcileDeleteVMPre7(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	return remaining == 0, nil
 }
 
-func (r haproxylbReconciler) reconcileDeleteVMPre7(ctx *context.HAProxyLoadBalancerContext) error {
-	// Get ready to find the associated VSphereVM resource.
-	vm := &infrav1.VSphereVM{}
-	vmKey := types.NamespacedName{
-		Namespace: ctx.HAProxyLoadBalancer.Namespace,
-		Name:      ctx.HAProxyLoadBalancer.Name + "-lb",
+// reconcileDeleteVMPre7 deletes the VSphereVMs controlled by the
+// HAProxyLoadBalancer, except for the ones in the provided set of names, and
+// returns how many of them still exist.
+func (r haproxylbReconciler) reconcileDeleteVMPre7(ctx *context.HAProxyLoadBalancerContext, keep map[string]struct{}) (int, error) {
+	// Find the VSphereVM resources associated with the HAProxyLoadBalancer.
+	vms := &infrav1.VSphereVMList{}
+	if err := ctx.Client.List(ctx, vms, ctrlclient.InNamespace(ctx.HAProxyLoadBalancer.Namespace)); err != nil {
+		return 0, errors.Wrapf(err, "Failed to list VSphereVMs in namespace %s", ctx.HAProxyLoadBalancer.Namespace)
 	}
 
-	// Attempt to find the associated VSphereVM resource.
-	if err := ctx.Client.Get(ctx, vmKey, vm); err != nil {
-		return err
-	} else if vm.GetDeletionTimestamp().IsZero() {
-		// If the VSphereVM was found and it's not already enqueued for
-		// deletion, go ahead and attempt to delete it.
-		if err := ctx.Client.Delete(ctx, vm); err != nil {
-			return err
+	remaining := 0
+	for i := range vms.Items {
+		vm := &vms.Items[i]
+		if !metav1.IsControlledBy(vm, ctx.HAProxyLoadBalancer) {
+			continue
+		}
+		if _, ok := keep[vm.Name]; ok {
+			continue
+		}
+		remaining++
+
+		// If the VSphereVM is not already enqueued for deletion, go ahead
+		// and attempt to delete it. Its deletion will trigger a new
+		// reconcile for this HAProxyLoadBalancer resource.
+		if vm.GetDeletionTimestamp().IsZero() {
+			ctx.Logger.Info("Deleting VSphereVM", "vm-name", vm.Name)
+			if err := ctx.Client.Delete(ctx, vm); err != nil && !apierrors.IsNotFound(err) {
+				return 0, errors.Wrapf(err, "Failed to delete VSphereVM %s/%s", vm.Namespace, vm.Name)
+			}
 		}
-
-		// Go ahead and return here since the deletion of the VSphereVM resource
-		// will trigger a new reconcile for this HAProxyLoadBalancer resource.
-		return nil
 	}
-
-	return nil
+	return remaining, nil
 }
 
 func (r haproxylbReconciler) reconcileNormal(ctx *context.HAProxyLoadBalancerContext) (ctrl.Result, error) {
@@ -297,21 +341,34 @@ func (r haproxylbReconciler) reconcileNormal(ctx *context.HAProxyLoadBalancerCon
 		}
 	}
 
-	// Reconcile the load balancer VM.
-	vm, err := r.reconcileVM(ctx)
+	// Keep the bootstrap data of the replicas in sync with the spec. The
+	// secrets are created in a later reconciliation if they are not found.
+	if err := haproxy.UpdateBootstrapSecret(ctx, ctx.Client, ctx.Cluster, ctx.HAProxyLoadBalancer); err != nil {
+		if !apierrors.IsNotFound(err) {
+			ctx.Logger.Error(err, "Failed to update bootstrap secret")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Reconcile the load balancer VMs.
+	vms, err := r.reconcileVMs(ctx)
 	if err != nil {
-		ctx.Logger.Error(err, "Unexpected error reconciling vm")
+		ctx.Logger.Error(err, "Unexpected error reconciling vms")
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile the addresses of the replicas, which may be scaled after the
+	// load balancer is ready, and the HAProxyLoadBalancer's address.
+	networkReady, err := r.reconcileNetwork(ctx, vms)
+	if err != nil {
+		ctx.Logger.Error(err, "Unexpected error while reconciling network")
 		return ctrl.Result{}, err
 	}
 
 	if !ctx.HAProxyLoadBalancer.Status.Ready {
 		ctx.Logger.Info("HAProxy LoadBalancer not ready, reconciling network")
-		// Reconcile the HAProxyLoadBalancer's address.
-		if ok, err := r.reconcileNetwork(ctx, vm); !ok {
-			if err != nil {
-				ctx.Logger.Error(err, "Unexpected error while reconciling network")
-				return ctrl.Result{}, err
-			}
+		if !networkReady {
+			conditions.MarkFalse(ctx.HAProxyLoadBalancer, infrav1.DataplaneAPIAvailableCondition, infrav1.WaitingForNetworkAddressesReason, clusterv1.ConditionSeverityInfo, "")
 			ctx.Logger.Info("Network is not reconciled, requeing in 10 seconds")
 			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 		}
@@ -329,17 +386,98 @@ func (r haproxylbReconciler) reconcileNormal(ctx *context.HAProxyLoadBalancerCon
 		ctx.Logger.Info("HAProxyLoadBalancer is ready")
 	}
 
+	// Renew the certificates used to access the dataplane API before they
+	// expire.
+	if err := r.reconcileCertificates(ctx); err != nil {
+		ctx.Logger.Error(err, "Failed to renew certificates")
+		return ctrl.Result{}, err
+	}
+
 	// Reconcile the HAProxyLoadBalancer's backen!d servers.
 	if err := r.reconcileLoadBalancerConfiguration(ctx); err != nil {
 		ctx.Logger.Error(err, "Requeing after 10 seconds")
 		return ctrl.Result{RequeueAfter: 10 * time.Second}, err
 	}
 
-	return ctrl.Result{}, nil
+	// Poll the health of the backend servers.
+	return ctrl.Result{RequeueAfter: haproxyBackendHealthPollInterval}, nil
+}
+
+// reconcileCertificates renews the signing and client certificates which
+// expire soon and records when they expire.
+func (r haproxylbReconciler) reconcileCertificates(ctx *context.HAProxyLoadBalancerContext) error {
+	caNotAfter, err := haproxy.RenewCASecret(ctx, ctx.Client, ctx.Cluster, ctx.HAProxyLoadBalancer)
+	if err != nil {
+		return errors.Wrap(err, "Failed to renew signing certificate")
+	}
+	if expiry := ctx.HAProxyLoadBalancer.Status.CertificateAuthorityExpiry; expiry != nil && !expiry.Time.Equal(caNotAfter) {
+		ctx.Logger.Info("Renewed signing certificate", "expiry", caNotAfter)
+	}
+	ctx.HAProxyLoadBalancer.Status.CertificateAuthorityExpiry = &metav1.Time{Time: caNotAfter}
+
+	clientNotAfter, err := haproxy.RenewConfigSecret(ctx, ctx.Client, ctx.HAProxyLoadBalancer)
+	if err != nil {
+		return errors.Wrap(err, "Failed to renew client certificate")
+	}
+	if expiry := ctx.HAProxyLoadBalancer.Status.ClientCertificateExpiry; expiry != nil && !expiry.Time.Equal(clientNotAfter) {
+		ctx.Logger.Info("Renewed client certificate", "expiry", clientNotAfter)
+	}
+	ctx.HAProxyLoadBalancer.Status.ClientCertificateExpiry = &metav1.Time{Time: clientNotAfter}
+	return nil
 }
 
 func (r haproxylbReconciler) BackEndpointsForCluster(ctx *context.HAProxyLoadBalancerContext) ([]corev1.EndpointAddress, error) {
-	// Get the CAPI Machine resources for the cluster.
+	machines, err := r.machinesForCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the control plane machines.
+	controlPlaneMachines := machines.Filter(collections.ControlPlaneMachines(ctx.Cluster.Name))
+	endpoints := make([]corev1.EndpointAddress, 0)
+	for _, machine := range controlPlaneMachines {
+		// Windows machines cannot run the API server.
+		windows, err := r.isWindowsMachine(ctx, machine)
+		if err != nil {
+			return nil, err
+		}
+		if windows {
+			continue
+		}
+		endpoints = append(endpoints, r.machineEndpoints(ctx, machine)...)
+	}
+	return endpoints, nil
+}
+
+// FrontendEndpointsForCluster returns the endpoints of the machines the
+// connections accepted by the provided frontend are forwarded to.
+func (r haproxylbReconciler) FrontendEndpointsForCluster(ctx *context.HAProxyLoadBalancerContext, frontend infrav1.HAProxyFrontend) ([]corev1.EndpointAddress, error) {
+	if frontend.Backend.MachineSelector == nil {
+		return r.BackEndpointsForCluster(ctx)
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(frontend.Backend.MachineSelector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid machine selector of frontend %s", frontend.Name)
+	}
+
+	machines, err := r.machinesForCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]corev1.EndpointAddress, 0)
+	for _, machine := range machines {
+		if !selector.Matches(labels.Set(machine.Labels)) {
+			continue
+		}
+		endpoints = append(endpoints, r.machineEndpoints(ctx, machine)...)
+	}
+	return endpoints, nil
+}
+
+// machinesForCluster returns the CAPI Machine resources for the cluster.
+func (r haproxylbReconciler) machinesForCluster(ctx *context.HAProxyLoadBalancerContext) (collections.Machines, error) {
 	machineList := &clusterv1.MachineList{}
 	if err := ctx.Client.List(
 		ctx, machineList,
@@ -351,38 +489,49 @@ func (r haproxylbReconciler) BackEndpointsForCluster(ctx *context.HAProxyLoadBal
 		)); err != nil {
 		return nil, errors.Wrap(err, "Failed to get machines for cluster")
 	}
+	return collections.FromMachineList(machineList), nil
+}
 
-	// Get the control plane machines.
-	controlPlaneMachines := collections.FromMachineList(machineList).Filter(collections.ControlPlaneMachines(ctx.Cluster.Name))
-	endpoints := make([]corev1.EndpointAddress, 0)
-	for _, machine := range controlPlaneMachines {
+// machineEndpoints returns the endpoints of a CAPI Machine which can be added
+// to the list of backends.
+func (r haproxylbReconciler) machineEndpoints(ctx *context.HAProxyLoadBalancerContext, machine *clusterv1.Machine) []corev1.EndpointAddress {
+	// check if machine has joined the cluster before adding it to the list of backends
+	if conditions.IsTrue(ctx.Cluster, clusterv1.ControlPlaneInitializedCondition) {
+		if machine.Status.NodeRef == nil ||
+			machine.Status.FailureReason != nil ||
+			machine.Status.FailureMessage != nil {
+			return nil
+		}
+	}
 
-		// check if machine has joined the cluster before adding it to the list of backends
-		if conditions.IsTrue(ctx.Cluster, clusterv1.ControlPlaneInitializedCondition) {
-			if machine.Status.NodeRef == nil ||
-				machine.Status.FailureReason != nil ||
-				machine.Status.FailureMessage != nil {
-				continue
+	machineEndpoints := make([]corev1.EndpointAddress, 0)
+	for i, addr := range machine.Status.Addresses {
+		if addr.Type == clusterv1.MachineExternalIP {
+			endpoint := corev1.EndpointAddress{
+				NodeName: pointer.StringPtr(fmt.Sprintf("%s-%d", machine.Name, i)),
+				IP:       addr.Address,
 			}
+			machineEndpoints = append(machineEndpoints, endpoint)
 		}
+	}
+	return machineEndpoints
+}
 
-		machineEndpoints := make([]corev1.EndpointAddress, 0)
-		for i, addr := range machine.Status.Addresses {
-			if addr.Type == clusterv1.MachineExternalIP {
-				// TODO(frapposelli): Remove this check once HAproxy fully supports IPv6 - issue #859
-				if utilnet.IsIPv6String(addr.Address) {
-					continue
-				}
-				endpoint := corev1.EndpointAddress{
-					NodeName: pointer.StringPtr(fmt.Sprintf("%s-%d", machine.Name, i)),
-					IP:       addr.Address,
-				}
-				machineEndpoints = append(machineEndpoints, endpoint)
-			}
+// isWindowsMachine returns whether the VSphereMachine of the CAPI Machine
+// runs Windows.
+func (r haproxylbReconciler) isWindowsMachine(ctx *context.HAProxyLoadBalancerContext, machine *clusterv1.Machine) (bool, error) {
+	infraRef := machine.Spec.InfrastructureRef
+	if infraRef.Kind != "VSphereMachine" {
+		return false, nil
+	}
+	vsphereMachine, err := infrautilv1.GetVSphereMachine(ctx, ctx.Client, machine.Namespace, infraRef.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
 		}
-		endpoints = append(endpoints, machineEndpoints...)
+		return false, errors.Wrapf(err, "failed to get VSphereMachine %s/%s", machine.Namespace, infraRef.Name)
 	}
-	return endpoints, nil
+	return infrautilv1.IsWindowsMachine(vsphereMachine), nil
 }
 
 func (r haproxylbReconciler) reconcileLoadBalancerConfiguration(ctx *context.HAProxyLoadBalancerContext) error {
@@ -399,103 +548,342 @@ func (r haproxylbReconciler) reconcileLoadBalancerConfiguration(ctx *context.HAP
 		return errors.Wrap(err, "Failed to rehydrate HAProxy dataplane client config")
 	}
 
-	// Create a HAPI client.
-	client, err := haproxy.ClientFromHAPIConfig(dataplaneConfig)
+	backends, err := r.BackEndpointsForCluster(ctx)
 	if err != nil {
-		return errors.Wrap(err, "Failed to get HAProxy dataplane client")
+		return errors.Wrap(err, "Couldn't fetch endpoints for cluster")
 	}
 
-	// Get the current configuration version.
-	global, _, err := client.GlobalApi.GetGlobal(ctx, nil)
+	ctx.HAProxyLoadBalancer.Status.Backends = int32(len(backends))
+	if len(backends) == 0 {
+		ctx.Logger.Info("No backends found, skipping reconfiguration")
+		ctx.HAProxyLoadBalancer.Status.BackendServers = nil
+		conditions.MarkFalse(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition, infrav1.NoBackendsReason, clusterv1.ConditionSeverityWarning,
+			"No control plane machine has an address")
+		return nil
+	}
+	conditions.MarkTrue(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition)
+
+	tpl, err := haproxy.GetConfigurationTemplate(ctx, ctx.Client, ctx.HAProxyLoadBalancer)
 	if err != nil {
-		return errors.Wrap(err, "Failed to get HAProxy dataplane global config")
+		return errors.Wrap(err, "Failed to get HAProxy configuration template")
 	}
 
-	// Attempt to close existing transactions in case controller had previously crashed
-	// TODO: When migrating to Dataplane APIv2 and no longer string templating,
-	// this should switch to tracking the existing transaction ID in the spec or status
-	// for re-entrancy, allowing other dataplane users to do configuration changes.
-	if err := r.closeAllTransactions(ctx, client); err != nil {
-		// only log error when closing existing transactions
-		ctx.Logger.Error(err, "error closing transactions")
+	_, ipv6Enabled := haproxy.ClusterIPv6(ctx.Cluster)
+	renderConfig := haproxy.NewRenderConfiguration().
+		WithDataPlaneConfig(dataplaneConfig).
+		WithPort(haproxy.APIServerPort(*ctx.HAProxyLoadBalancer)).
+		WithAddresses(backends).
+		WithIPv6(ipv6Enabled).
+		WithConfigurationTemplate(tpl)
+	for _, frontend := range ctx.HAProxyLoadBalancer.Spec.Frontends {
+		frontendBackends, err := r.FrontendEndpointsForCluster(ctx, frontend)
+		if err != nil {
+			return errors.Wrapf(err, "Couldn't fetch endpoints of frontend %s for cluster", frontend.Name)
+		}
+		renderConfig = renderConfig.WithFrontend(frontend, frontendBackends)
 	}
 
-	transaction, _, err := client.TransactionsApi.StartTransaction(ctx, global.Version)
+	// Keep the configuration identical across the replicas, without letting
+	// an unreachable replica hold back the others.
+	var (
+		errs                         []error
+		pending, unreachable, failed []string
+		stats                        []hapi.NativeStat
+		statsErr                     error
+		polled                       bool
+	)
+	for i := range ctx.HAProxyLoadBalancer.Status.Replicas {
+		replica := &ctx.HAProxyLoadBalancer.Status.Replicas[i]
+		if replica.Address == "" {
+			pending = append(pending, replica.Name)
+			continue
+		}
 
-	if err != nil {
-		return errors.Wrap(err, "Failed to create HAProxy dataplane transaction")
-	}
-	transactionID := optional.NewString(transaction.Id)
+		// Create a HAPI client for the replica.
+		dataplaneConfig.Server = haproxy.DataplaneServerURL(replica.Address)
+		client, err := haproxy.ClientFromHAPIConfig(dataplaneConfig)
+		if err != nil {
+			return errors.Wrap(err, "Failed to get HAProxy dataplane client")
+		}
 
-	defer func() {
-		if _, _, err := client.TransactionsApi.CommitTransaction(ctx, transaction.Id, nil); err != nil {
-			ctx.Logger.Error(err, "Failed to commit HAProxy dataplane transaction")
+		transactionID, version, err := r.reconcileTransaction(ctx, client, replica)
+		if err != nil {
+			unreachable = append(unreachable, replica.Name)
+			errs = append(errs, errors.Wrapf(err, "Failed to reach dataplane API of replica %s", replica.Name))
+			continue
+		}
+		if err := r.reconcileReplicaConfiguration(ctx, replica, client, transactionID, version, renderConfig); err != nil {
+			failed = append(failed, replica.Name)
+			errs = append(errs, errors.Wrapf(err, "Failed to reconcile configuration of replica %s", replica.Name))
 		}
-	}()
 
-	backends, err := r.BackEndpointsForCluster(ctx)
-	if err != nil {
-		return errors.Wrap(err, "Couldn't fetch endpoints for cluster")
+		// The replicas check the health of the backend servers
+		// independently, so the stats of the first reachable one are used.
+		if !polled {
+			if stats, statsErr = haproxy.APIServerBackendStats(ctx, client); statsErr != nil {
+				ctx.Logger.Error(statsErr, "Failed to get backend server stats", "replica", replica.Name)
+			} else {
+				polled = true
+			}
+		}
+	}
+	switch {
+	case polled:
+		r.reconcileBackendServers(ctx, stats)
+	case statsErr != nil:
+		// The health of the backend servers is unknown when none of the
+		// replicas could report it.
+		conditions.MarkUnknown(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition, infrav1.BackendStatsUnavailableReason,
+			"Failed to get backend server stats: %v", statsErr)
 	}
 
-	if len(backends) == 0 {
-		return errors.Wrap(err, "No backends found, skipping reconfiguration")
+	switch {
+	case len(unreachable) > 0:
+		conditions.MarkFalse(ctx.HAProxyLoadBalancer, infrav1.DataplaneAPIAvailableCondition, infrav1.DataplaneAPIUnreachableReason, clusterv1.ConditionSeverityWarning,
+			"Dataplane API of %s is unreachable", strings.Join(unreachable, ", "))
+	case len(pending) > 0:
+		conditions.MarkFalse(ctx.HAProxyLoadBalancer, infrav1.DataplaneAPIAvailableCondition, infrav1.WaitingForNetworkAddressesReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for the address of %s", strings.Join(pending, ", "))
+	default:
+		conditions.MarkTrue(ctx.HAProxyLoadBalancer, infrav1.DataplaneAPIAvailableCondition)
 	}
 
-	renderConfig := haproxy.NewRenderConfiguration().
-		WithDataPlaneConfig(dataplaneConfig).
-		WithAddresses(backends)
-	haProxyConfig, err := renderConfig.RenderHAProxyConfiguration()
+	switch {
+	case len(failed) > 0:
+		conditions.MarkFalse(ctx.HAProxyLoadBalancer, infrav1.LoadBalancerConfiguredCondition, infrav1.LoadBalancerConfigurationFailedReason, clusterv1.ConditionSeverityWarning,
+			"Failed to configure %s", strings.Join(failed, ", "))
+	case len(unreachable) > 0 || len(pending) > 0:
+		conditions.MarkFalse(ctx.HAProxyLoadBalancer, infrav1.LoadBalancerConfiguredCondition, infrav1.WaitingForDataplaneAPIReason, clusterv1.ConditionSeverityInfo, "")
+	default:
+		conditions.MarkTrue(ctx.HAProxyLoadBalancer, infrav1.LoadBalancerConfiguredCondition)
+	}
 
-	if err != nil {
-		return errors.Wrap(err, "Unable to render new configuration")
+	if len(errs) > 0 {
+		return kerrors.NewAggregate(errs)
+	}
+
+	ctx.Logger.Info("Reconciled load balancer backend servers")
+	return nil
+}
+
+// reconcileBackendServers records the health of the backend servers from the
+// stats of HAProxy and emits an event when the state of a server changes.
+func (r haproxylbReconciler) reconcileBackendServers(ctx *context.HAProxyLoadBalancerContext, stats []hapi.NativeStat) {
+	previous := make(map[string]infrav1.HAProxyBackendServerStatus, len(ctx.HAProxyLoadBalancer.Status.BackendServers))
+	for _, server := range ctx.HAProxyLoadBalancer.Status.BackendServers {
+		previous[server.Name] = server
 	}
 
-	resp, _, err := client.ConfigurationApi.GetHAProxyConfiguration(ctx, &hapi.GetHAProxyConfigurationOpts{
-		TransactionId: transactionID,
+	now := time.Now()
+	servers := make([]infrav1.HAProxyBackendServerStatus, 0, len(stats))
+	var unhealthy []string
+	for _, stat := range stats {
+		server := infrav1.HAProxyBackendServerStatus{
+			Name:                 stat.Name,
+			State:                stat.Stats.Status,
+			LastCheck:            stat.Stats.CheckStatus,
+			LastCheckDescription: stat.Stats.CheckDesc,
+		}
+
+		// The state of a server in transition is followed by its progress,
+		// ex. "UP 1/3" for a server going down.
+		state := serverState(server.State)
+		if state != haproxyServerStateUp {
+			unhealthy = append(unhealthy, server.Name)
+		}
+
+		prev, ok := previous[server.Name]
+		switch {
+		case ok && serverState(prev.State) == state:
+			server.LastTransitionTime = prev.LastTransitionTime
+		case stat.Stats.Lastchg != nil:
+			server.LastTransitionTime = &metav1.Time{Time: now.Add(-time.Duration(*stat.Stats.Lastchg) * time.Second)}
+		default:
+			server.LastTransitionTime = &metav1.Time{Time: now}
+		}
+
+		// Raise an event when a server flaps.
+		if ok && prev.State != "" && serverState(prev.State) != state {
+			if state == haproxyServerStateUp {
+				ctx.Recorder.Eventf(ctx.HAProxyLoadBalancer, "BackendServerUp", "Backend server %s is up", server.Name)
+			} else {
+				ctx.Recorder.Warnf(ctx.HAProxyLoadBalancer, "BackendServerDown", "Backend server %s is %s: %s", server.Name, server.State, server.LastCheckDescription)
+			}
+		}
+		servers = append(servers, server)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Name < servers[j].Name
 	})
+	ctx.HAProxyLoadBalancer.Status.BackendServers = servers
 
+	if len(unhealthy) > 0 {
+		sort.Strings(unhealthy)
+		conditions.MarkFalse(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition, infrav1.BackendsUnhealthyReason, clusterv1.ConditionSeverityWarning,
+			"%d of %d backend servers are not up: %s", len(unhealthy), len(servers), strings.Join(unhealthy, ", "))
+	}
+}
+
+// serverState returns the state of a backend server without the progress of
+// its transition.
+func serverState(state string) string {
+	if fields := strings.Fields(state); len(fields) > 0 {
+		return fields[0]
+	}
+	return state
+}
+
+// reconcileReplicaConfiguration updates the configuration of a replica of the
+// load balancer in the provided dataplane API transaction, started from the
+// provided configuration version.
+func (r haproxylbReconciler) reconcileReplicaConfiguration(ctx *context.HAProxyLoadBalancerContext, replica *infrav1.HAProxyLoadBalancerReplicaStatus, client *hapi.APIClient, transactionID string, version int32, renderConfig haproxy.RenderConfiguration) error {
+	changed, err := renderConfig.ReconcileConfiguration(ctx, client, transactionID, replica.Frontends)
 	if err != nil {
-		return errors.Wrap(err, "Failed to get haproxy configuration")
+		return errors.Wrapf(err, "Failed to update HAProxy configuration in dataplane transaction %s", transactionID)
 	}
 
-	originalConfig := trimmer.ReplaceAllString(resp.Data, "$1")
-	comparisonConfig := trimmer.ReplaceAllString(haProxyConfig, "$1")
+	// Discard the transaction if it does not change anything, which would
+	// otherwise reload HAProxy.
+	if !changed {
+		ctx.Logger.V(4).Info("No change in HAProxy configuration, skipping reconciliation.", "replica", replica.Name)
+		if _, err := client.TransactionsApi.DeleteTransaction(ctx, transactionID); err != nil && !haproxy.IsNotFound(err) {
+			return errors.Wrapf(err, "Failed to delete HAProxy dataplane transaction %s", transactionID)
+		}
+		replica.TransactionID = ""
+		replica.ConfigurationVersion = version
+		replica.Frontends = renderConfig.FrontendNames()
+		return nil
+	}
 
-	// commit new configuration, ending the transaction
-	if originalConfig != comparisonConfig {
-		ctx.Logger.Info("HAProxy Configuration changed, reloading")
-		_, _, err := client.ConfigurationApi.PostHAProxyConfiguration(ctx, haProxyConfig, &hapi.PostHAProxyConfigurationOpts{
-			Version: optional.NewInt32(transaction.Version),
-		})
-		if err != nil {
-			return errors.Wrap(err, "Unable to post new configuration")
+	ctx.Logger.Info("HAProxy configuration changed, committing dataplane transaction", "replica", replica.Name, "transaction-id", transactionID)
+	if _, _, err := client.TransactionsApi.CommitTransaction(ctx, transactionID, nil); err != nil {
+		metrics.HAProxyReconfigurations.WithLabelValues(metrics.ResultFailure).Inc()
+		// A transaction which failed to commit cannot be committed again.
+		if _, err := client.TransactionsApi.DeleteTransaction(ctx, transactionID); err != nil && !haproxy.IsNotFound(err) {
+			ctx.Logger.Error(err, "Failed to delete HAProxy dataplane transaction", "replica", replica.Name, "transaction-id", transactionID)
 		}
-	} else {
-		ctx.Logger.Info("No change in HAProxy configration, skipping reconciliation.")
+		replica.TransactionID = ""
+		return errors.Wrapf(err, "Failed to commit HAProxy dataplane transaction %s", transactionID)
 	}
+	metrics.HAProxyReconfigurations.WithLabelValues(metrics.ResultSuccess).Inc()
+	replica.TransactionID = ""
+	replica.Frontends = renderConfig.FrontendNames()
+	return r.reconcileConfigurationVersion(ctx, replica, client)
+}
 
-	ctx.Logger.Info("Reconciled load balancer backend servers")
+// reconcileConfigurationVersion records the configuration version of the
+// replica, which is read back once the configuration has been changed since
+// other dataplane API users may change it as well.
+func (r haproxylbReconciler) reconcileConfigurationVersion(ctx *context.HAProxyLoadBalancerContext, replica *infrav1.HAProxyLoadBalancerReplicaStatus, client *hapi.APIClient) error {
+	version, err := configurationVersion(ctx, client)
+	if err != nil {
+		return err
+	}
+	replica.ConfigurationVersion = version
 	return nil
 }
 
-func (r haproxylbReconciler) closeAllTransactions(ctx *context.HAProxyLoadBalancerContext, client *hapi.APIClient) error {
-	transactions, _, err := client.TransactionsApi.GetTransactions(ctx, nil)
+// configurationVersion returns the current configuration version of the
+// replica the client is connected to.
+func configurationVersion(ctx *context.HAProxyLoadBalancerContext, client *hapi.APIClient) (int32, error) {
+	global, _, err := client.GlobalApi.GetGlobal(ctx, nil)
 	if err != nil {
-		return err
+		return 0, errors.Wrap(err, "Failed to get HAProxy dataplane global config")
 	}
-	for _, t := range transactions {
-		if _, _, err := client.TransactionsApi.CommitTransaction(ctx, t.Id, nil); err != nil {
-			return err
+	return global.Version, nil
+}
+
+// reconcileTransaction returns the ID of the dataplane API transaction in
+// which the configuration of the replica is updated, and the configuration
+// version it was started from. The transaction recorded
+// in the status of the replica is resumed unless the configuration has been
+// changed since it was started, in which case it is replaced with a new one.
+func (r haproxylbReconciler) reconcileTransaction(ctx *context.HAProxyLoadBalancerContext, client *hapi.APIClient, replica *infrav1.HAProxyLoadBalancerReplicaStatus) (string, int32, error) {
+	// Get the current configuration version.
+	version, err := configurationVersion(ctx, client)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if transactionID := replica.TransactionID; transactionID != "" {
+		transaction, _, err := client.TransactionsApi.GetTransaction(ctx, transactionID)
+		switch {
+		case haproxy.IsNotFound(err):
+		case err != nil:
+			return "", 0, errors.Wrapf(err, "Failed to get HAProxy dataplane transaction %s", transactionID)
+		case transaction.Status != haproxy.TransactionInProgress:
+		case transaction.Version == version:
+			ctx.Logger.V(4).Info("Resuming HAProxy dataplane transaction", "replica", replica.Name, "transaction-id", transactionID)
+			return transactionID, transaction.Version, nil
+		default:
+			// The configuration has been changed since the transaction was
+			// started, so it can no longer be committed.
+			if _, err := client.TransactionsApi.DeleteTransaction(ctx, transactionID); err != nil && !haproxy.IsNotFound(err) {
+				return "", 0, errors.Wrapf(err, "Failed to delete outdated HAProxy dataplane transaction %s", transactionID)
+			}
 		}
+		replica.TransactionID = ""
 	}
 
-	return nil
+	transaction, _, err := client.TransactionsApi.StartTransaction(ctx, version)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "Failed to create HAProxy dataplane transaction")
+	}
+
+	// Record the transaction, which is patched with the status when the
+	// reconciliation returns, so it is resumed rather than leaked if the
+	// update fails.
+	replica.TransactionID = transaction.Id
+	return transaction.Id, transaction.Version, nil
 }
 
-func (r haproxylbReconciler) reconcileVM(ctx *context.HAProxyLoadBalancerContext) (*unstructured.Unstructured, error) {
+// reconcileVMs creates or updates the VSphereVMs of the replicas and deletes
+// the ones of the replicas which have been scaled down.
+func (r haproxylbReconciler) reconcileVMs(ctx *context.HAProxyLoadBalancerContext) ([]*unstructured.Unstructured, error) {
+	replicas := 1
+	if ctx.HAProxyLoadBalancer.Spec.Replicas != nil {
+		replicas = int(*ctx.HAProxyLoadBalancer.Spec.Replicas)
+	}
+
+	vms := make([]*unstructured.Unstructured, 0, replicas)
+	vmNames := make(map[string]struct{}, replicas)
+	for i := 0; i < replicas; i++ {
+		vm, err := r.reconcileVM(ctx, vmNameForReplica(ctx.HAProxyLoadBalancer.Name, i))
+		if err != nil {
+			return nil, err
+		}
+		vms = append(vms, vm)
+		vmNames[vm.GetName()] = struct{}{}
+	}
+
 	// TODO(akutz) Determine the version of vSphere.
-	vm, err := r.reconcileVMPre7(ctx)
+	if _, err := r.reconcileDeleteVMPre7(ctx, vmNames); err != nil {
+		return nil, err
+	}
+
+	// HAProxyLoadBalancer wraps the VSphereVMs of its replicas, so we are
+	// aggregating their status in order to provide evidences about the
+	// provisioning of the load balancer.
+	getters := make([]conditions.Getter, 0, len(vms))
+	for _, vm := range vms {
+		getters = append(getters, conditions.UnstructuredGetter(vm))
+	}
+	conditions.SetAggregate(ctx.HAProxyLoadBalancer, infrav1.VMProvisionedCondition, getters, conditions.AddSourceRef())
+	return vms, nil
+}
+
+// vmNameForReplica returns the name of the VSphereVM of a replica. The first
+// replica keeps the name of the VSphereVM of a load balancer without replicas.
+func vmNameForReplica(loadBalancerName string, index int) string {
+	if index == 0 {
+		return loadBalancerName + "-lb"
+	}
+	return fmt.Sprintf("%s-lb-%d", loadBalancerName, index)
+}
+
+func (r haproxylbReconciler) reconcileVM(ctx *context.HAProxyLoadBalancerContext, name string) (*unstructured.Unstructured, error) {
+	// TODO(akutz) Determine the version of vSphere.
+	vm, err := r.reconcileVMPre7(ctx, name)
 	if err != nil {
 		if !apierrors.IsAlreadyExists(err) {
 			return nil, err
@@ -517,15 +905,15 @@ func (r haproxylbReconciler) reconcileVM(ctx *context.HAProxyLoadBalancerContext
 	return vmObj, nil
 }
 
-func (r haproxylbReconciler) reconcileVMPre7(ctx *context.HAProxyLoadBalancerContext) (runtime.Object, error) {
+func (r haproxylbReconciler) reconcileVMPre7(ctx *context.HAProxyLoadBalancerContext, name string) (runtime.Object, error) {
 	// Create or update the VSphereVM resource.
 	vm := &infrav1.VSphereVM{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: ctx.HAProxyLoadBalancer.Namespace,
-			Name:      ctx.HAProxyLoadBalancer.Name + "-lb",
+			Name:      name,
 		},
 	}
-	ctx.Logger = ctx.Logger.WithValues("vm-name", vm.Name)
+	logger := ctx.Logger.WithValues("vm-name", vm.Name)
 	mutateFn := func() (err error) {
 		// Ensure the HAProxyLoadBalancer is marked as an owner of the VSphereVM.
 		if err := ctrlutil.SetControllerReference(ctx.HAProxyLoadBalancer, vm, r.Scheme); err != nil {
@@ -566,62 +954,126 @@ func (r haproxylbReconciler) reconcileVMPre7(ctx *context.HAProxyLoadBalancerCon
 	}
 	if _, err := ctrlutil.CreateOrUpdate(ctx, ctx.Client, vm, mutateFn); err != nil {
 		if apierrors.IsAlreadyExists(err) {
-			ctx.Logger.Info("VSphereVM already exists")
+			logger.Info("VSphereVM already exists")
 			return nil, err
 		}
-		ctx.Logger.Error(err, "Failed to CreateOrUpdate VSphereVM")
+		logger.Error(err, "Failed to CreateOrUpdate VSphereVM")
 		return nil, err
 	}
 
 	return vm, nil
 }
 
-func (r haproxylbReconciler) reconcileNetwork(ctx *context.HAProxyLoadBalancerContext, vm *unstructured.Unstructured) (bool, error) {
+// reconcileNetwork records the addresses of the replicas and sets the address
+// of the load balancer to either its virtual IP, once a replica sharing it has
+// an address, or the address of its first replica. It returns whether all the
+// replicas have an address.
+func (r haproxylbReconciler) reconcileNetwork(ctx *context.HAProxyLoadBalancerContext, vms []*unstructured.Unstructured) (bool, error) {
 	var (
 		newAddr string
 		oldAddr = ctx.HAProxyLoadBalancer.Status.Address
 	)
 
-	ctx.Logger = ctx.Logger.WithValues("old-ip-address", oldAddr, "vm-api-version", vm.GetAPIVersion(), "vm-kind", vm.GetKind(), "vm-name", vm.GetName())
+	logger := ctx.Logger.WithValues("old-ip-address", oldAddr)
 
-	// Otherwise the IP for the load balancer is obtained from the VM's
-	// status.addresses field.
-	addresses, ok, err := unstructured.NestedStringSlice(vm.Object, "status", "addresses")
-	if !ok {
+	ready := true
+	replicas := make([]infrav1.HAProxyLoadBalancerReplicaStatus, 0, len(vms))
+	for _, vm := range vms {
+		// A new replica is bootstrapped with the frontends and the virtual IP
+		// of the spec.
+		replica := infrav1.HAProxyLoadBalancerReplicaStatus{
+			Name:       vm.GetName(),
+			Keepalived: ctx.HAProxyLoadBalancer.Spec.VirtualIP != "",
+		}
+		for _, frontend := range ctx.HAProxyLoadBalancer.Spec.Frontends {
+			replica.Frontends = append(replica.Frontends, frontend.Name)
+		}
+
+		// Keep the state of the configuration of an existing replica, such
+		// as the transaction it is being updated in.
+		for _, oldReplica := range ctx.HAProxyLoadBalancer.Status.Replicas {
+			if oldReplica.Name == replica.Name {
+				replica = oldReplica
+			}
+		}
+
+		addr, err := r.vmAddress(ctx, vm)
 		if err != nil {
-			return false, errors.Wrapf(err,
-				"Unexpected error getting status.addresses from VM %s %s/%s for %s",
-				vm.GroupVersionKind(),
-				vm.GetNamespace(),
-				vm.GetName(),
-				ctx)
+			return false, err
 		}
-		ctx.Logger.Info("waiting on vm for ip address")
-		return false, nil
-	}
-	for _, addr := range addresses {
 		if addr == "" {
-			continue
+			ready = false
+		}
+		replica.Address = addr
+		replicas = append(replicas, replica)
+	}
+	ctx.HAProxyLoadBalancer.Status.Replicas = replicas
+
+	// The virtual IP is only held by the replicas bootstrapped with
+	// keepalived, which are the ones created after it was set.
+	for _, replica := range replicas {
+		if replica.Keepalived && replica.Address != "" {
+			newAddr = ctx.HAProxyLoadBalancer.Spec.VirtualIP
+			break
 		}
-		newAddr = addr
-		ctx.Logger = ctx.Logger.WithValues("ip-address", newAddr)
-		ctx.Logger.Info("Discovered IP address from VM")
-		break
 	}
+	if newAddr == "" && len(replicas) > 0 {
+		newAddr = replicas[0].Address
+	}
+	logger = logger.WithValues("ip-address", newAddr)
 
 	switch {
 	case newAddr == "":
-		ctx.Logger.Info("Waiting on IP address")
+		logger.Info("Waiting on IP address")
 		return false, nil
 	case ctx.HAProxyLoadBalancer.Status.Address == "":
 		ctx.HAProxyLoadBalancer.Status.Address = newAddr
-		ctx.Logger.Info("Initialized IP address")
+		logger.Info("Initialized IP address")
 	case newAddr != ctx.HAProxyLoadBalancer.Status.Address:
 		ctx.HAProxyLoadBalancer.Status.Address = newAddr
-		ctx.Logger.Info("Updated IP address")
+		logger.Info("Updated IP address")
 	}
 
-	return true, nil
+	return ready, nil
+}
+
+// vmAddress returns the IP address of a replica from the VM's
+// status.addresses field, ignoring the virtual IP it may hold. An IPv6
+// address is preferred for an IPv6-only cluster, and an IPv4 one otherwise.
+func (r haproxylbReconciler) vmAddress(ctx *context.HAProxyLoadBalancerContext, vm *unstructured.Unstructured) (string, error) {
+	logger := ctx.Logger.WithValues("vm-api-version", vm.GetAPIVersion(), "vm-kind", vm.GetKind(), "vm-name", vm.GetName())
+
+	addresses, ok, err := unstructured.NestedStringSlice(vm.Object, "status", "addresses")
+	if !ok {
+		if err != nil {
+			return "", errors.Wrapf(err,
+				"Unexpected error getting status.addresses from VM %s %s/%s for %s",
+				vm.GroupVersionKind(),
+				vm.GetNamespace(),
+				vm.GetName(),
+				ctx)
+		}
+		logger.Info("waiting on vm for ip address")
+		return "", nil
+	}
+	preferIPv6, _ := haproxy.ClusterIPv6(ctx.Cluster)
+	var vmAddr string
+	for _, addr := range addresses {
+		if addr == "" || addr == ctx.HAProxyLoadBalancer.Spec.VirtualIP {
+			continue
+		}
+		if utilnet.IsIPv6String(addr) == preferIPv6 {
+			vmAddr = addr
+			break
+		}
+		if vmAddr == "" {
+			vmAddr = addr
+		}
+	}
+	if vmAddr != "" {
+		logger.V(4).Info("Discovered IP address from VM", "ip-address", vmAddr)
+	}
+	return vmAddr, nil
 }
 
 // controlPlaneMachineToHAProxyLoadBalancer is a handler.ToRequestsFunc to be
@@ -739,6 +1191,107 @@ func (r haproxylbReconciler) controlPlaneMachineToHAProxyLoadBalancer(o ctrlclie
 	}}
 }
 
+// frontendMachineToHAProxyLoadBalancers is a handler.ToRequestsFunc to be
+// used to trigger reconcile events for the HAProxyLoadBalancers of a cluster
+// when one of its CAPI Machines, which is not a member of the control plane,
+// is reconciled and it has IP addresses and is selected by one of their
+// frontends.
+func (r haproxylbReconciler) frontendMachineToHAProxyLoadBalancers(o ctrlclient.Object) []ctrl.Request {
+	machine, ok := o.(*clusterv1.Machine)
+	if !ok {
+		r.Logger.Error(errors.New("invalid type"),
+			"Expected to receive a CAPI Machine resource",
+			"expected-type", "Machine",
+			"actual-type", fmt.Sprintf("%T", o))
+		return nil
+	}
+	if infrautilv1.IsControlPlaneMachine(machine) {
+		return nil
+	}
+	if len(machine.Status.Addresses) == 0 {
+		return nil
+	}
+	clusterName, ok := machine.Labels[clusterv1.ClusterLabelName]
+	if !ok {
+		return nil
+	}
+
+	lbs := &infrav1.HAProxyLoadBalancerList{}
+	if err := r.Client.List(goctx.Background(),
+		lbs,
+		ctrlclient.InNamespace(machine.Namespace),
+		ctrlclient.MatchingLabels(
+			map[string]string{
+				clusterv1.ClusterLabelName: clusterName,
+			},
+		)); err != nil {
+		return nil
+	}
+	requests := []ctrl.Request{}
+	for _, lb := range lbs.Items {
+		if !frontendsSelectMachine(lb.Spec.Frontends, machine) {
+			continue
+		}
+		requests = append(requests, ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: lb.Namespace,
+				Name:      lb.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// configurationTemplateToHAProxyLoadBalancers is a handler.ToRequestsFunc to
+// be used to enqueue requests for reconciliation of the HAProxyLoadBalancers
+// whose configuration template is held by a ConfigMap.
+func (r haproxylbReconciler) configurationTemplateToHAProxyLoadBalancers(o ctrlclient.Object) []ctrl.Request {
+	configMap, ok := o.(*corev1.ConfigMap)
+	if !ok {
+		r.Logger.Error(errors.New("invalid type"),
+			"Expected to receive a ConfigMap resource",
+			"expected-type", "ConfigMap",
+			"actual-type", fmt.Sprintf("%T", o))
+		return nil
+	}
+
+	lbs := &infrav1.HAProxyLoadBalancerList{}
+	if err := r.Client.List(goctx.Background(), lbs, ctrlclient.InNamespace(configMap.Namespace)); err != nil {
+		return nil
+	}
+	requests := []ctrl.Request{}
+	for _, lb := range lbs.Items {
+		if lb.Spec.ConfigurationTemplate == nil || lb.Spec.ConfigurationTemplate.Name != configMap.Name {
+			continue
+		}
+		requests = append(requests, ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: lb.Namespace,
+				Name:      lb.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// frontendsSelectMachine returns whether the machine selector of one of the
+// frontends matches the labels of the CAPI Machine.
+func frontendsSelectMachine(frontends []infrav1.HAProxyFrontend, machine *clusterv1.Machine) bool {
+	for _, frontend := range frontends {
+		if frontend.Backend.MachineSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(frontend.Backend.MachineSelector)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(machine.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *haproxylbReconciler) reconcileClusterToHAProxyLoadBalancers(a ctrlclient.Object) []reconcile.Request {
 	requests := []reconcile.Request{}
 	lbs := &infrav1.HAProxyLoadBalancerList{}
@@ -0,0 +1,717 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	apirecord "k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	hapi "sigs.k8s.io/cluster-api-provider-vsphere/contrib/haproxy/openapi"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/haproxy"
+	haproxyfake "sigs.k8s.io/cluster-api-provider-vsphere/pkg/haproxy/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
+)
+
+func TestHAProxyLoadBalancerReconciler_ReconcileVMs(t *testing.T) {
+	g := NewWithT(t)
+
+	controllerCtx := fake.NewControllerContext(fake.NewControllerManagerContext())
+	ctx := newHAProxyLoadBalancerContext(controllerCtx)
+	ctx.HAProxyLoadBalancer.Spec.Replicas = pointer.Int32Ptr(3)
+	ctx.HAProxyLoadBalancer.Spec.VirtualMachineConfiguration.Template = "haproxy"
+	r := haproxylbReconciler{ControllerContext: controllerCtx}
+
+	// A VSphereVM is created for each replica, the first one keeping the name
+	// of the VSphereVM of a load balancer without replicas.
+	vms, err := r.reconcileVMs(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(vmNames(vms)).To(Equal([]string{"lb-lb", "lb-lb-1", "lb-lb-2"}))
+	for _, name := range vmNames(vms) {
+		vm := &infrav1.VSphereVM{}
+		g.Expect(ctx.Client.Get(ctx, ctrlclient.ObjectKey{Namespace: ctx.HAProxyLoadBalancer.Namespace, Name: name}, vm)).To(Succeed())
+		g.Expect(metav1.IsControlledBy(vm, ctx.HAProxyLoadBalancer)).To(BeTrue())
+		g.Expect(vm.Labels).To(HaveKeyWithValue(clusterv1.ClusterLabelName, ctx.Cluster.Name))
+		g.Expect(vm.Spec.BootstrapRef).NotTo(BeNil())
+		g.Expect(vm.Spec.BootstrapRef.Name).To(Equal(haproxy.NameForBootstrapSecret(ctx.HAProxyLoadBalancer.Name)))
+		g.Expect(vm.Spec.Template).To(Equal("haproxy"))
+	}
+
+	// The VSphereVMs of the replicas which are scaled down are deleted,
+	// while the ones the load balancer does not control are kept.
+	other := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ctx.HAProxyLoadBalancer.Namespace, Name: "other"},
+	}
+	g.Expect(ctx.Client.Create(ctx, other)).To(Succeed())
+	ctx.HAProxyLoadBalancer.Spec.Replicas = pointer.Int32Ptr(2)
+	vms, err = r.reconcileVMs(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(vmNames(vms)).To(Equal([]string{"lb-lb", "lb-lb-1"}))
+
+	vmList := &infrav1.VSphereVMList{}
+	g.Expect(ctx.Client.List(ctx, vmList, ctrlclient.InNamespace(ctx.HAProxyLoadBalancer.Namespace))).To(Succeed())
+	var remaining []string
+	for _, vm := range vmList.Items {
+		remaining = append(remaining, vm.Name)
+	}
+	g.Expect(remaining).To(ConsistOf("lb-lb", "lb-lb-1", "other"))
+}
+
+func TestHAProxyLoadBalancerReconciler_ReconcileNetwork(t *testing.T) {
+	tests := []struct {
+		name             string
+		virtualIP        string
+		frontends        []infrav1.HAProxyFrontend
+		replicas         []infrav1.HAProxyLoadBalancerReplicaStatus
+		address          string
+		vmAddresses      map[string][]string
+		expectedReady    bool
+		expectedAddress  string
+		expectedReplicas []infrav1.HAProxyLoadBalancerReplicaStatus
+	}{
+		{
+			name:        "single replica without an address",
+			vmAddresses: map[string][]string{"lb-lb": nil},
+			expectedReplicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb"},
+			},
+		},
+		{
+			name:            "single replica",
+			vmAddresses:     map[string][]string{"lb-lb": {"192.168.0.2"}},
+			expectedReady:   true,
+			expectedAddress: "192.168.0.2",
+			expectedReplicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb", Address: "192.168.0.2"},
+			},
+		},
+		{
+			name:      "replicas sharing a virtual IP",
+			virtualIP: "192.168.0.10",
+			vmAddresses: map[string][]string{
+				"lb-lb":   {"192.168.0.10", "192.168.0.2"},
+				"lb-lb-1": {"192.168.0.3"},
+				"lb-lb-2": nil,
+			},
+			expectedAddress: "192.168.0.10",
+			expectedReplicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb", Address: "192.168.0.2", Keepalived: true},
+				{Name: "lb-lb-1", Address: "192.168.0.3", Keepalived: true},
+				{Name: "lb-lb-2", Keepalived: true},
+			},
+		},
+		{
+			name:      "replicas sharing a virtual IP without an address",
+			virtualIP: "192.168.0.10",
+			vmAddresses: map[string][]string{
+				"lb-lb":   nil,
+				"lb-lb-1": nil,
+			},
+			expectedReplicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb", Keepalived: true},
+				{Name: "lb-lb-1", Keepalived: true},
+			},
+		},
+		{
+			name:      "virtual IP set on a load balancer created without it",
+			virtualIP: "192.168.0.10",
+			replicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb", Address: "192.168.0.2", ConfigurationVersion: 3},
+			},
+			address: "192.168.0.2",
+			vmAddresses: map[string][]string{
+				"lb-lb":   {"192.168.0.2"},
+				"lb-lb-1": nil,
+			},
+			expectedAddress: "192.168.0.2",
+			expectedReplicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb", Address: "192.168.0.2", ConfigurationVersion: 3},
+				{Name: "lb-lb-1", Keepalived: true},
+			},
+		},
+		{
+			name:      "virtual IP held by a replica created after it was set",
+			virtualIP: "192.168.0.10",
+			replicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb", Address: "192.168.0.2", ConfigurationVersion: 3},
+			},
+			address: "192.168.0.2",
+			vmAddresses: map[string][]string{
+				"lb-lb":   {"192.168.0.2"},
+				"lb-lb-1": {"192.168.0.10", "192.168.0.3"},
+			},
+			expectedReady:   true,
+			expectedAddress: "192.168.0.10",
+			expectedReplicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb", Address: "192.168.0.2", ConfigurationVersion: 3},
+				{Name: "lb-lb-1", Address: "192.168.0.3", Keepalived: true},
+			},
+		},
+		{
+			name:      "replicas keep the state of their configuration",
+			virtualIP: "192.168.0.10",
+			frontends: []infrav1.HAProxyFrontend{{Name: "konnectivity", Port: 8132}},
+			replicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb", Address: "192.168.0.2", Keepalived: true, TransactionID: "transaction", ConfigurationVersion: 5},
+				{Name: "lb-lb-2", Address: "192.168.0.4", Keepalived: true},
+			},
+			address: "192.168.0.10",
+			vmAddresses: map[string][]string{
+				"lb-lb":   {"192.168.0.5"},
+				"lb-lb-1": {"192.168.0.3"},
+			},
+			expectedReady:   true,
+			expectedAddress: "192.168.0.10",
+			expectedReplicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb", Address: "192.168.0.5", Keepalived: true, TransactionID: "transaction", ConfigurationVersion: 5},
+				{Name: "lb-lb-1", Address: "192.168.0.3", Keepalived: true, Frontends: []string{"konnectivity"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			controllerCtx := fake.NewControllerContext(fake.NewControllerManagerContext())
+			ctx := newHAProxyLoadBalancerContext(controllerCtx)
+			ctx.HAProxyLoadBalancer.Spec.VirtualIP = tt.virtualIP
+			ctx.HAProxyLoadBalancer.Spec.Frontends = tt.frontends
+			ctx.HAProxyLoadBalancer.Status.Replicas = tt.replicas
+			ctx.HAProxyLoadBalancer.Status.Address = tt.address
+			r := haproxylbReconciler{ControllerContext: controllerCtx}
+
+			var vms []*unstructured.Unstructured
+			for i := 0; i < len(tt.vmAddresses); i++ {
+				name := vmNameForReplica(ctx.HAProxyLoadBalancer.Name, i)
+				vm := &unstructured.Unstructured{Object: map[string]interface{}{}}
+				vm.SetGroupVersionKind(infrav1.GroupVersion.WithKind("VSphereVM"))
+				vm.SetNamespace(ctx.HAProxyLoadBalancer.Namespace)
+				vm.SetName(name)
+				if addresses := tt.vmAddresses[name]; addresses != nil {
+					g.Expect(unstructured.SetNestedStringSlice(vm.Object, addresses, "status", "addresses")).To(Succeed())
+				}
+				vms = append(vms, vm)
+			}
+
+			ready, err := r.reconcileNetwork(ctx, vms)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ready).To(Equal(tt.expectedReady))
+			g.Expect(ctx.HAProxyLoadBalancer.Status.Address).To(Equal(tt.expectedAddress))
+			g.Expect(ctx.HAProxyLoadBalancer.Status.Replicas).To(Equal(tt.expectedReplicas))
+		})
+	}
+}
+
+func TestHAProxyLoadBalancerReconciler_VMAddress(t *testing.T) {
+	ipv4Network := &clusterv1.ClusterNetwork{
+		Pods:     &clusterv1.NetworkRanges{CIDRBlocks: []string{"192.168.0.0/16"}},
+		Services: &clusterv1.NetworkRanges{CIDRBlocks: []string{"10.128.0.0/12"}},
+	}
+	ipv6Network := &clusterv1.ClusterNetwork{
+		Pods:     &clusterv1.NetworkRanges{CIDRBlocks: []string{"fd00:100::/56"}},
+		Services: &clusterv1.NetworkRanges{CIDRBlocks: []string{"fd00:200::/108"}},
+	}
+	dualStackNetwork := &clusterv1.ClusterNetwork{
+		Pods:     &clusterv1.NetworkRanges{CIDRBlocks: []string{"192.168.0.0/16", "fd00:100::/56"}},
+		Services: &clusterv1.NetworkRanges{CIDRBlocks: []string{"10.128.0.0/12", "fd00:200::/108"}},
+	}
+	tests := []struct {
+		name      string
+		network   *clusterv1.ClusterNetwork
+		virtualIP string
+		addresses []string
+		expected  string
+	}{
+		{
+			name: "VM without addresses",
+		},
+		{
+			name:      "IPv4 cluster",
+			network:   ipv4Network,
+			addresses: []string{"fd00::2", "192.168.0.2"},
+			expected:  "192.168.0.2",
+		},
+		{
+			name:      "IPv6 cluster",
+			network:   ipv6Network,
+			addresses: []string{"192.168.0.2", "fd00::2"},
+			expected:  "fd00::2",
+		},
+		{
+			name:      "dual-stack cluster",
+			network:   dualStackNetwork,
+			addresses: []string{"fd00::2", "192.168.0.2"},
+			expected:  "192.168.0.2",
+		},
+		{
+			name:      "IPv6 cluster with an IPv4 address only",
+			network:   ipv6Network,
+			addresses: []string{"", "192.168.0.2"},
+			expected:  "192.168.0.2",
+		},
+		{
+			name:      "virtual IP",
+			network:   ipv6Network,
+			virtualIP: "fd00::10",
+			addresses: []string{"fd00::10", "192.168.0.2", "fd00::2"},
+			expected:  "fd00::2",
+		},
+		{
+			name:      "virtual IP only",
+			virtualIP: "192.168.0.10",
+			addresses: []string{"192.168.0.10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			controllerCtx := fake.NewControllerContext(fake.NewControllerManagerContext())
+			ctx := newHAProxyLoadBalancerContext(controllerCtx)
+			ctx.Cluster.Spec.ClusterNetwork = tt.network
+			ctx.HAProxyLoadBalancer.Spec.VirtualIP = tt.virtualIP
+			r := haproxylbReconciler{ControllerContext: controllerCtx}
+
+			vm := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			vm.SetGroupVersionKind(infrav1.GroupVersion.WithKind("VSphereVM"))
+			vm.SetNamespace(ctx.HAProxyLoadBalancer.Namespace)
+			vm.SetName("lb-lb")
+			if tt.addresses != nil {
+				g.Expect(unstructured.SetNestedStringSlice(vm.Object, tt.addresses, "status", "addresses")).To(Succeed())
+			}
+
+			addr, err := r.vmAddress(ctx, vm)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(addr).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestHAProxyLoadBalancerReconciler_ReconcileLoadBalancerConfiguration(t *testing.T) {
+	tests := []struct {
+		name                         string
+		machineAddresses             []string
+		replicas                     []infrav1.HAProxyLoadBalancerReplicaStatus
+		wantErr                      bool
+		expectedBackends             int32
+		expectedBackendsReason       string
+		expectedDataplaneAPIReason   string
+		expectedConfigurationReason  string
+		expectedConfigurationChecked bool
+	}{
+		{
+			name:                   "no control plane machine with an address",
+			replicas:               []infrav1.HAProxyLoadBalancerReplicaStatus{{Name: "lb-lb", Address: "127.0.0.1"}},
+			expectedBackends:       0,
+			expectedBackendsReason: infrav1.NoBackendsReason,
+		},
+		{
+			name:                         "replica waiting for its address",
+			machineAddresses:             []string{"192.168.0.10", "192.168.0.11"},
+			replicas:                     []infrav1.HAProxyLoadBalancerReplicaStatus{{Name: "lb-lb"}},
+			expectedBackends:             2,
+			expectedDataplaneAPIReason:   infrav1.WaitingForNetworkAddressesReason,
+			expectedConfigurationReason:  infrav1.WaitingForDataplaneAPIReason,
+			expectedConfigurationChecked: true,
+		},
+		{
+			name:             "unreachable replica",
+			machineAddresses: []string{"192.168.0.10"},
+			replicas: []infrav1.HAProxyLoadBalancerReplicaStatus{
+				{Name: "lb-lb", Address: "127.0.0.1", ConfigurationVersion: 3},
+				{Name: "lb-lb-1"},
+			},
+			wantErr:                      true,
+			expectedBackends:             1,
+			expectedDataplaneAPIReason:   infrav1.DataplaneAPIUnreachableReason,
+			expectedConfigurationReason:  infrav1.WaitingForDataplaneAPIReason,
+			expectedConfigurationChecked: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			controllerCtx := fake.NewControllerContext(fake.NewControllerManagerContext())
+			ctx := newHAProxyLoadBalancerContext(controllerCtx)
+			ctx.HAProxyLoadBalancer.Status.Address = "127.0.0.1"
+			ctx.HAProxyLoadBalancer.Status.Replicas = append([]infrav1.HAProxyLoadBalancerReplicaStatus(nil), tt.replicas...)
+			g.Expect(haproxy.CreateCASecret(ctx, ctx.Client, ctx.Cluster, ctx.HAProxyLoadBalancer)).To(Succeed())
+			g.Expect(haproxy.CreateConfigSecret(ctx, ctx.Client, ctx.Cluster, ctx.HAProxyLoadBalancer)).To(Succeed())
+			if tt.machineAddresses != nil {
+				machine := &clusterv1.Machine{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: ctx.Cluster.Namespace,
+						Name:      "control-plane",
+						Labels: map[string]string{
+							clusterv1.ClusterLabelName:             ctx.Cluster.Name,
+							clusterv1.MachineControlPlaneLabelName: "",
+						},
+					},
+					Spec: clusterv1.MachineSpec{ClusterName: ctx.Cluster.Name},
+				}
+				for _, addr := range tt.machineAddresses {
+					machine.Status.Addresses = append(machine.Status.Addresses, clusterv1.MachineAddress{
+						Type:    clusterv1.MachineExternalIP,
+						Address: addr,
+					})
+				}
+				g.Expect(ctx.Client.Create(ctx, machine)).To(Succeed())
+			}
+			r := haproxylbReconciler{ControllerContext: controllerCtx}
+
+			err := r.reconcileLoadBalancerConfiguration(ctx)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+
+			g.Expect(ctx.HAProxyLoadBalancer.Status.Backends).To(Equal(tt.expectedBackends))
+			if tt.expectedBackendsReason != "" {
+				g.Expect(conditions.IsFalse(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition)).To(BeTrue())
+				g.Expect(conditions.GetReason(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition)).To(Equal(tt.expectedBackendsReason))
+			} else {
+				g.Expect(conditions.IsTrue(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition)).To(BeTrue())
+			}
+			if !tt.expectedConfigurationChecked {
+				g.Expect(conditions.Has(ctx.HAProxyLoadBalancer, infrav1.DataplaneAPIAvailableCondition)).To(BeFalse())
+				g.Expect(conditions.Has(ctx.HAProxyLoadBalancer, infrav1.LoadBalancerConfiguredCondition)).To(BeFalse())
+				return
+			}
+			g.Expect(conditions.IsFalse(ctx.HAProxyLoadBalancer, infrav1.DataplaneAPIAvailableCondition)).To(BeTrue())
+			g.Expect(conditions.GetReason(ctx.HAProxyLoadBalancer, infrav1.DataplaneAPIAvailableCondition)).To(Equal(tt.expectedDataplaneAPIReason))
+			g.Expect(conditions.IsFalse(ctx.HAProxyLoadBalancer, infrav1.LoadBalancerConfiguredCondition)).To(BeTrue())
+			g.Expect(conditions.GetReason(ctx.HAProxyLoadBalancer, infrav1.LoadBalancerConfiguredCondition)).To(Equal(tt.expectedConfigurationReason))
+
+			// The configuration version is only recorded once the
+			// configuration of the replica is updated.
+			g.Expect(ctx.HAProxyLoadBalancer.Status.Replicas).To(Equal(tt.replicas))
+		})
+	}
+}
+
+func TestHAProxyLoadBalancerReconciler_ReconcileReplicaConfiguration(t *testing.T) {
+	renderConfig := haproxy.NewRenderConfiguration().
+		WithDataPlaneConfig(haproxy.DataplaneConfig{Username: "client", Password: "cert"}).
+		WithAddresses([]corev1.EndpointAddress{
+			{IP: "192.168.0.10", NodeName: pointer.StringPtr("control-plane-0")},
+		})
+
+	tests := []struct {
+		name            string
+		failCommit      bool
+		wantErr         bool
+		expectedChanges []string
+		expectedReplica infrav1.HAProxyLoadBalancerReplicaStatus
+	}{
+		{
+			name: "changed configuration is committed",
+			expectedChanges: []string{
+				"POST servers kube_api_backend/control-plane-0",
+				"PUT transactions transaction",
+			},
+			expectedReplica: infrav1.HAProxyLoadBalancerReplicaStatus{
+				Name:                 "lb-lb",
+				Address:              "192.168.0.2",
+				ConfigurationVersion: 12,
+				Frontends:            []string{},
+			},
+		},
+		{
+			name:       "transaction which fails to commit is discarded",
+			failCommit: true,
+			wantErr:    true,
+			expectedChanges: []string{
+				"POST servers kube_api_backend/control-plane-0",
+				"DELETE transactions transaction",
+			},
+			expectedReplica: infrav1.HAProxyLoadBalancerReplicaStatus{
+				Name:                 "lb-lb",
+				Address:              "192.168.0.2",
+				ConfigurationVersion: 10,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// The configuration is changed by another dataplane API user
+			// while it is updated, so its version is read back.
+			dataplane, client := haproxyfake.NewDataplane(t)
+			dataplane.AddRenderedConfiguration()
+			dataplane.Version = 11
+			dataplane.FailCommit = tt.failCommit
+
+			controllerCtx := fake.NewControllerContext(fake.NewControllerManagerContext())
+			ctx := newHAProxyLoadBalancerContext(controllerCtx)
+			replica := &infrav1.HAProxyLoadBalancerReplicaStatus{
+				Name:                 "lb-lb",
+				Address:              "192.168.0.2",
+				TransactionID:        "transaction",
+				ConfigurationVersion: 10,
+			}
+			r := haproxylbReconciler{ControllerContext: controllerCtx}
+
+			err := r.reconcileReplicaConfiguration(ctx, replica, client, "transaction", 10, renderConfig)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+			g.Expect(*replica).To(Equal(tt.expectedReplica))
+			g.Expect(dataplane.Reset()).To(Equal(tt.expectedChanges))
+		})
+	}
+}
+
+func TestHAProxyLoadBalancerReconciler_ReconcileBackendServers(t *testing.T) {
+	now := time.Now()
+	hourAgo := metav1.NewTime(now.Add(-time.Hour))
+	stat := func(name, status string, lastchg *int32) hapi.NativeStat {
+		return hapi.NativeStat{
+			Type:        "server",
+			BackendName: "kube_api_backend",
+			Name:        name,
+			Stats:       hapi.NativeStatStats{Status: status, Lastchg: lastchg},
+		}
+	}
+	type server struct {
+		name         string
+		state        string
+		transitioned time.Time
+	}
+	tests := []struct {
+		name            string
+		previous        []infrav1.HAProxyBackendServerStatus
+		stats           []hapi.NativeStat
+		expectedServers []server
+		expectedEvents  []string
+		expectedReason  string
+	}{
+		{
+			name: "new servers",
+			stats: []hapi.NativeStat{
+				stat("control-plane-1", "UP", nil),
+				stat("control-plane-0", "UP", pointer.Int32Ptr(60)),
+			},
+			expectedServers: []server{
+				{name: "control-plane-0", state: "UP", transitioned: now.Add(-time.Minute)},
+				{name: "control-plane-1", state: "UP", transitioned: now},
+			},
+		},
+		{
+			name: "server going down",
+			previous: []infrav1.HAProxyBackendServerStatus{
+				{Name: "control-plane-0", State: "UP", LastTransitionTime: &hourAgo},
+				{Name: "control-plane-1", State: "UP", LastTransitionTime: &hourAgo},
+			},
+			stats: []hapi.NativeStat{
+				stat("control-plane-0", "UP 1/3", pointer.Int32Ptr(5)),
+				{
+					Type:        "server",
+					BackendName: "kube_api_backend",
+					Name:        "control-plane-1",
+					Stats: hapi.NativeStatStats{
+						Status:      "DOWN",
+						CheckStatus: "L4CON",
+						CheckDesc:   "Connection refused",
+						Lastchg:     pointer.Int32Ptr(10),
+					},
+				},
+			},
+			expectedServers: []server{
+				{name: "control-plane-0", state: "UP 1/3", transitioned: hourAgo.Time},
+				{name: "control-plane-1", state: "DOWN", transitioned: now.Add(-10 * time.Second)},
+			},
+			expectedEvents: []string{"Warning BackendServerDown Backend server control-plane-1 is DOWN: Connection refused"},
+			expectedReason: infrav1.BackendsUnhealthyReason,
+		},
+		{
+			name: "server going up",
+			previous: []infrav1.HAProxyBackendServerStatus{
+				{Name: "control-plane-0", State: "DOWN", LastTransitionTime: &hourAgo},
+			},
+			stats: []hapi.NativeStat{
+				stat("control-plane-0", "UP", pointer.Int32Ptr(2)),
+			},
+			expectedServers: []server{
+				{name: "control-plane-0", state: "UP", transitioned: now.Add(-2 * time.Second)},
+			},
+			expectedEvents: []string{"Normal BackendServerUp Backend server control-plane-0 is up"},
+		},
+		{
+			name: "server in maintenance and removed server",
+			previous: []infrav1.HAProxyBackendServerStatus{
+				{Name: "control-plane-0", State: "MAINT", LastTransitionTime: &hourAgo},
+				{Name: "control-plane-1", State: "UP", LastTransitionTime: &hourAgo},
+			},
+			stats: []hapi.NativeStat{
+				stat("control-plane-0", "MAINT", pointer.Int32Ptr(5)),
+			},
+			expectedServers: []server{
+				{name: "control-plane-0", state: "MAINT", transitioned: hourAgo.Time},
+			},
+			expectedReason: infrav1.BackendsUnhealthyReason,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			recorder := apirecord.NewFakeRecorder(10)
+			controllerCtx := fake.NewControllerContext(fake.NewControllerManagerContext())
+			controllerCtx.Recorder = record.New(recorder)
+			ctx := newHAProxyLoadBalancerContext(controllerCtx)
+			ctx.HAProxyLoadBalancer.Status.BackendServers = tt.previous
+			conditions.MarkTrue(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition)
+			r := haproxylbReconciler{ControllerContext: controllerCtx}
+
+			r.reconcileBackendServers(ctx, tt.stats)
+
+			servers := ctx.HAProxyLoadBalancer.Status.BackendServers
+			g.Expect(servers).To(HaveLen(len(tt.expectedServers)))
+			for i, expected := range tt.expectedServers {
+				g.Expect(servers[i].Name).To(Equal(expected.name))
+				g.Expect(servers[i].State).To(Equal(expected.state))
+				g.Expect(servers[i].LastTransitionTime).NotTo(BeNil())
+				g.Expect(servers[i].LastTransitionTime.Time).To(BeTemporally("~", expected.transitioned, 5*time.Second))
+			}
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			g.Expect(events).To(Equal(tt.expectedEvents))
+
+			if tt.expectedReason == "" {
+				g.Expect(conditions.IsTrue(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition)).To(BeTrue())
+			} else {
+				g.Expect(conditions.IsFalse(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition)).To(BeTrue())
+				g.Expect(conditions.GetReason(ctx.HAProxyLoadBalancer, infrav1.BackendsAvailableCondition)).To(Equal(tt.expectedReason))
+			}
+		})
+	}
+}
+
+func TestHAProxyLoadBalancerReconciler_ConfigurationTemplateToHAProxyLoadBalancers(t *testing.T) {
+	g := NewWithT(t)
+
+	controllerCtx := fake.NewControllerContext(fake.NewControllerManagerContext())
+	ctx := newHAProxyLoadBalancerContext(controllerCtx)
+	ctx.HAProxyLoadBalancer.Spec.ConfigurationTemplate = &infrav1.HAProxyConfigurationTemplateReference{Name: "haproxy-template"}
+	g.Expect(ctx.Client.Update(ctx, ctx.HAProxyLoadBalancer)).To(Succeed())
+	for name, template := range map[string]*infrav1.HAProxyConfigurationTemplateReference{
+		"lb-default":  nil,
+		"lb-other":    {Name: "other-template"},
+		"lb-same-key": {Name: "haproxy-template", Key: "custom.cfg"},
+	} {
+		g.Expect(ctx.Client.Create(ctx, &infrav1.HAProxyLoadBalancer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ctx.HAProxyLoadBalancer.Namespace, Name: name},
+			Spec:       infrav1.HAProxyLoadBalancerSpec{ConfigurationTemplate: template},
+		})).To(Succeed())
+	}
+	r := haproxylbReconciler{ControllerContext: controllerCtx}
+
+	// The load balancers whose template is held by the ConfigMap are
+	// reconciled, whichever key of its data holds the template.
+	requests := r.configurationTemplateToHAProxyLoadBalancers(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ctx.HAProxyLoadBalancer.Namespace, Name: "haproxy-template"},
+	})
+	var names []string
+	for _, request := range requests {
+		names = append(names, request.Name)
+	}
+	g.Expect(names).To(ConsistOf("lb", "lb-same-key"))
+
+	// The load balancers of other namespaces are not reconciled.
+	g.Expect(r.configurationTemplateToHAProxyLoadBalancers(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "haproxy-template"},
+	})).To(BeEmpty())
+}
+
+func TestServerState(t *testing.T) {
+	tests := []struct {
+		state    string
+		expected string
+	}{
+		{state: "UP", expected: "UP"},
+		{state: "UP 1/3", expected: "UP"},
+		{state: "DOWN 2/2", expected: "DOWN"},
+		{state: "MAINT", expected: "MAINT"},
+		{state: "no check", expected: "no"},
+		{state: "", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(serverState(tt.state)).To(Equal(tt.expected))
+		})
+	}
+}
+
+// newHAProxyLoadBalancerContext returns an HAProxyLoadBalancerContext for an
+// HAProxyLoadBalancer of the fake cluster, which are both created with the
+// fake client.
+func newHAProxyLoadBalancerContext(controllerCtx *context.ControllerContext) *context.HAProxyLoadBalancerContext {
+	clusterCtx := fake.NewClusterContext(controllerCtx)
+	loadBalancer := &infrav1.HAProxyLoadBalancer{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: infrav1.GroupVersion.String(),
+			Kind:       "HAProxyLoadBalancer",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: clusterCtx.Cluster.Namespace,
+			Name:      "lb",
+			UID:       types.UID("30000000-0000-0000-0000-000000000000"),
+			Labels:    map[string]string{clusterv1.ClusterLabelName: clusterCtx.Cluster.Name},
+		},
+	}
+	if err := controllerCtx.Client.Create(controllerCtx, loadBalancer); err != nil {
+		panic(err)
+	}
+	return &context.HAProxyLoadBalancerContext{
+		ControllerContext:   controllerCtx,
+		Cluster:             clusterCtx.Cluster,
+		HAProxyLoadBalancer: loadBalancer,
+		Logger:              controllerCtx.Logger.WithName(loadBalancer.Name),
+	}
+}
+
+func vmNames(vms []*unstructured.Unstructured) []string {
+	names := make([]string, 0, len(vms))
+	for _, vm := range vms {
+		names = append(names, vm.GetName())
+	}
+	return names
+}
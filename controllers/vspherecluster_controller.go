@@ -31,6 +31,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/pointer"
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
@@ -67,7 +68,9 @@ var (
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereclusteridentities,verbs=get;list;watch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereclusters/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspheredeploymentzones,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines,verbs=get;list;watch
 
 // AddClusterControllerToManager adds the cluster controller to the provided
 // manager.
@@ -131,6 +134,12 @@ func AddClusterControllerToManager(ctx *context.ControllerManagerContext, mgr ma
 			&source.Kind{Type: &infrav1.HAProxyLoadBalancer{}},
 			handler.EnqueueRequestsFromMapFunc(reconciler.loadBalancerToCluster),
 		).
+		// Watch the deployment zones, which are published as the failure
+		// domains of the VSphereClusters using the same server.
+		Watches(
+			&source.Kind{Type: &infrav1.VSphereDeploymentZone{}},
+			handler.EnqueueRequestsFromMapFunc(reconciler.deploymentZoneToCluster),
+		).
 		// Watch a GenericEvent channel for the controlled resource.
 		//
 		// This is useful when there are events outside of Kubernetes that
@@ -310,6 +319,16 @@ func (r clusterReconciler) reconcileNormal(ctx *context.ClusterContext) (reconci
 		conditions.MarkTrue(ctx.VSphereCluster, infrav1.VCenterAvailableCondition)
 	}
 
+	// Publish the ready VSphereDeploymentZones as failure domains.
+	if ok, err := r.reconcileDeploymentZones(ctx); !ok {
+		if err != nil {
+			return reconcile.Result{}, errors.Wrapf(err,
+				"unexpected error while reconciling failure domains for %s", ctx)
+		}
+		ctx.Logger.Info("waiting for failure domains to be reconciled")
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
 	// Reconcile the VSphereCluster's load balancer.
 	if ok, err := r.reconcileLoadBalancer(ctx); !ok {
 		if err != nil {
@@ -449,6 +468,100 @@ func (r clusterReconciler) reconcileVCenterConnectivity(ctx *context.ClusterCont
 	return err
 }
 
+// reconcileDeploymentZones publishes the ready VSphereDeploymentZones that
+// use the same server as the VSphereCluster as failure domains. It returns
+// false while some of the zones the cluster uses have not yet reported their
+// status.
+func (r clusterReconciler) reconcileDeploymentZones(ctx *context.ClusterContext) (bool, error) {
+	var deploymentZones infrav1.VSphereDeploymentZoneList
+	if err := r.Client.List(ctx, &deploymentZones); err != nil {
+		return false, errors.Wrap(err, "failed to list VSphereDeploymentZones")
+	}
+
+	usedZones, err := r.usedDeploymentZones(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var (
+		failureDomains                        clusterv1.FailureDomains
+		zoneCount, readyNotReported, notReady int
+		usedNotReported                       int
+	)
+	for _, zone := range deploymentZones.Items {
+		if zone.Spec.Server != ctx.VSphereCluster.Spec.Server {
+			continue
+		}
+		zoneCount++
+
+		if zone.Status.Ready == nil {
+			readyNotReported++
+			if _, ok := usedZones[zone.Name]; ok {
+				usedNotReported++
+			}
+			// Keep publishing the zone until it reports its status again.
+			if failureDomain, ok := ctx.VSphereCluster.Status.FailureDomains[zone.Name]; ok {
+				if failureDomains == nil {
+					failureDomains = clusterv1.FailureDomains{}
+				}
+				failureDomains[zone.Name] = failureDomain
+			}
+			continue
+		}
+		if !*zone.Status.Ready {
+			notReady++
+			continue
+		}
+
+		if failureDomains == nil {
+			failureDomains = clusterv1.FailureDomains{}
+		}
+		failureDomains[zone.Name] = clusterv1.FailureDomainSpec{
+			ControlPlane: pointer.BoolDeref(zone.Spec.ControlPlane, true),
+		}
+	}
+	ctx.VSphereCluster.Status.FailureDomains = failureDomains
+
+	switch {
+	case zoneCount == 0:
+		conditions.Delete(ctx.VSphereCluster, infrav1.FailureDomainsAvailableCondition)
+	case readyNotReported > 0:
+		conditions.MarkFalse(ctx.VSphereCluster, infrav1.FailureDomainsAvailableCondition, infrav1.WaitingForFailureDomainStatusReason, clusterv1.ConditionSeverityInfo,
+			"waiting for %d of %d deployment zones to report their status", readyNotReported, zoneCount)
+		// The zones which the cluster does not use yet are published once
+		// they are ready, without holding back the rest of the reconcile.
+		return usedNotReported == 0, nil
+	case notReady > 0:
+		conditions.MarkFalse(ctx.VSphereCluster, infrav1.FailureDomainsAvailableCondition, infrav1.FailureDomainsSkippedReason, clusterv1.ConditionSeverityWarning,
+			"%d of %d deployment zones are not ready", notReady, zoneCount)
+	default:
+		conditions.MarkTrue(ctx.VSphereCluster, infrav1.FailureDomainsAvailableCondition)
+	}
+
+	return true, nil
+}
+
+// usedDeploymentZones returns the names of the deployment zones which are
+// already published as failure domains of the cluster or which its machines
+// are placed in.
+func (r clusterReconciler) usedDeploymentZones(ctx *context.ClusterContext) (map[string]struct{}, error) {
+	usedZones := map[string]struct{}{}
+	for name := range ctx.VSphereCluster.Status.FailureDomains {
+		usedZones[name] = struct{}{}
+	}
+
+	machines, err := infrautilv1.GetMachinesInCluster(ctx, r.Client, ctx.Cluster.Namespace, ctx.Cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, machine := range machines {
+		if machine.Spec.FailureDomain != nil {
+			usedZones[*machine.Spec.FailureDomain] = struct{}{}
+		}
+	}
+	return usedZones, nil
+}
+
 func (r clusterReconciler) reconcileLoadBalancer(ctx *context.ClusterContext) (bool, error) {
 
 	if ctx.VSphereCluster.Spec.LoadBalancerRef == nil {
@@ -579,11 +692,22 @@ func (r clusterReconciler) reconcileLoadBalancer(ctx *context.ClusterContext) (b
 	// Update the VSphereCluster.Spec.ControlPlaneEndpoint with the address
 	// from the load balancer.
 	// The control plane endpoint also requires a port, which is obtained
-	// either from the VSphereCluster.Spec.ControlPlaneEndpoint.Port
-	// or the default port is used.
+	// either from the VSphereCluster.Spec.ControlPlaneEndpoint.Port,
+	// the spec.apiServerPort of the load balancer or the default port is used.
 	ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Host = address
 	if ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Port == 0 {
-		ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Port = defaultAPIEndpointPort
+		port, ok, err := unstructured.NestedInt64(loadBalancer.Object, "spec", "apiServerPort")
+		if err != nil {
+			return false, errors.Wrapf(err,
+				"unexpected error when getting spec.apiServerPort for load balancer %s %s/%s",
+				loadBalancer.GroupVersionKind(),
+				loadBalancer.GetNamespace(),
+				loadBalancer.GetName())
+		}
+		if !ok {
+			port = int64(defaultAPIEndpointPort)
+		}
+		ctx.VSphereCluster.Spec.ControlPlaneEndpoint.Port = int32(port)
 	}
 	ctx.Logger.Info("ControlPlaneEndpoint discovered via load balancer",
 		"controlPlaneEndpoint", ctx.VSphereCluster.Spec.ControlPlaneEndpoint.String())
@@ -911,7 +1035,7 @@ func (r clusterReconciler) controlPlaneMachineToCluster(o client.Object) []ctrl.
 		r.Logger.Error(nil, fmt.Sprintf("expected a VSphereMachine but got a %T", o))
 		return nil
 	}
-	if !infrautilv1.IsControlPlaneMachine(vsphereMachine) {
+	if !infrautilv1.IsControlPlaneMachine(vsphereMachine) || infrautilv1.IsWindowsMachine(vsphereMachine) {
 		return nil
 	}
 	if len(vsphereMachine.Status.Addresses) == 0 {
@@ -996,3 +1120,30 @@ func (r clusterReconciler) loadBalancerToCluster(o client.Object) []ctrl.Request
 		},
 	}}
 }
+
+func (r clusterReconciler) deploymentZoneToCluster(o client.Object) []ctrl.Request {
+	zone, ok := o.(*infrav1.VSphereDeploymentZone)
+	if !ok {
+		r.Logger.Error(nil, fmt.Sprintf("expected a VSphereDeploymentZone but got a %T", o))
+		return nil
+	}
+
+	var vsphereClusters infrav1.VSphereClusterList
+	if err := r.Client.List(r, &vsphereClusters); err != nil {
+		r.Logger.Error(err, "failed to list VSphereClusters")
+		return nil
+	}
+
+	var requests []ctrl.Request
+	for _, vsphereCluster := range vsphereClusters.Items {
+		if vsphereCluster.Spec.Server == zone.Spec.Server {
+			requests = append(requests, ctrl.Request{
+				NamespacedName: types.NamespacedName{
+					Namespace: vsphereCluster.Namespace,
+					Name:      vsphereCluster.Name,
+				},
+			})
+		}
+	}
+	return requests
+}
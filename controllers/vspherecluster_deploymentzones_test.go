@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestClusterReconciler_ReconcileDeploymentZones(t *testing.T) {
+	const server = "vcenter.example.com"
+
+	newZone := func(name string, ready *bool) *infrav1.VSphereDeploymentZone {
+		return &infrav1.VSphereDeploymentZone{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: infrav1.VSphereDeploymentZoneSpec{
+				Server:        server,
+				FailureDomain: name,
+			},
+			Status: infrav1.VSphereDeploymentZoneStatus{Ready: ready},
+		}
+	}
+
+	tests := []struct {
+		name                   string
+		machineFailureDomain   *string
+		expectedOK             bool
+		expectedFailureDomains []string
+	}{
+		{
+			name:                   "unready zones which are not used do not block the reconcile",
+			expectedOK:             true,
+			expectedFailureDomains: []string{"zone-a"},
+		},
+		{
+			name:                   "unready zones which are used by a machine block the reconcile",
+			machineFailureDomain:   pointer.String("zone-b"),
+			expectedOK:             false,
+			expectedFailureDomains: []string{"zone-a"},
+		},
+		{
+			name:                   "zones used by machines of other clusters do not block the reconcile",
+			machineFailureDomain:   pointer.String("zone-c"),
+			expectedOK:             true,
+			expectedFailureDomains: []string{"zone-a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			controllerCtx := fake.NewControllerContext(fake.NewControllerManagerContext(
+				newZone("zone-a", pointer.Bool(true)),
+				newZone("zone-b", nil),
+				newZone("zone-c", nil),
+			))
+			ctx := fake.NewClusterContext(controllerCtx)
+			ctx.VSphereCluster.Spec.Server = server
+
+			if tt.machineFailureDomain != nil {
+				clusterName := ctx.Cluster.Name
+				if *tt.machineFailureDomain == "zone-c" {
+					clusterName = "other-cluster"
+				}
+				machine := &clusterv1.Machine{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: ctx.Cluster.Namespace,
+						Name:      "machine",
+						Labels:    map[string]string{clusterv1.ClusterLabelName: clusterName},
+					},
+					Spec: clusterv1.MachineSpec{
+						ClusterName:   clusterName,
+						FailureDomain: tt.machineFailureDomain,
+					},
+				}
+				g.Expect(ctx.Client.Create(ctx, machine)).To(Succeed())
+			}
+
+			r := clusterReconciler{ControllerContext: controllerCtx}
+			ok, err := r.reconcileDeploymentZones(ctx)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ok).To(Equal(tt.expectedOK))
+
+			var failureDomains []string
+			for name := range ctx.VSphereCluster.Status.FailureDomains {
+				failureDomains = append(failureDomains, name)
+			}
+			g.Expect(failureDomains).To(ConsistOf(tt.expectedFailureDomains))
+			g.Expect(conditions.IsFalse(ctx.VSphereCluster, infrav1.FailureDomainsAvailableCondition)).To(BeTrue())
+		})
+	}
+}
@@ -0,0 +1,437 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	goctx "context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vim25/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/cluster"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspheredeploymentzones,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspheredeploymentzones/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherefailuredomains,verbs=get;list;watch
+
+// AddVSphereDeploymentZoneControllerToManager adds the VSphereDeploymentZone
+// controller to the provided manager.
+func AddVSphereDeploymentZoneControllerToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) error {
+	var (
+		controlledType     = &infrav1.VSphereDeploymentZone{}
+		controlledTypeName = reflect.TypeOf(controlledType).Elem().Name()
+		controlledTypeGVK  = infrav1.GroupVersion.WithKind(controlledTypeName)
+
+		controllerNameShort = fmt.Sprintf("%s-controller", strings.ToLower(controlledTypeName))
+		controllerNameLong  = fmt.Sprintf("%s/%s/%s", ctx.Namespace, ctx.Name, controllerNameShort)
+	)
+
+	// Build the controller context.
+	controllerContext := &context.ControllerContext{
+		ControllerManagerContext: ctx,
+		Name:                     controllerNameShort,
+		Recorder:                 record.New(mgr.GetEventRecorderFor(controllerNameLong)),
+		Logger:                   ctx.Logger.WithName(controllerNameShort),
+	}
+	reconciler := vsphereDeploymentZoneReconciler{ControllerContext: controllerContext}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		// Watch the controlled, infrastructure resource.
+		For(controlledType).
+		// Watch the failure domains referenced by the deployment zones, so
+		// that changes to the topology are validated again.
+		Watches(
+			&source.Kind{Type: &infrav1.VSphereFailureDomain{}},
+			handler.EnqueueRequestsFromMapFunc(reconciler.failureDomainsToDeploymentZones),
+		).
+		// Watch a GenericEvent channel for the controlled resource.
+		//
+		// This is useful when there are events outside of Kubernetes that
+		// should cause a resource to be synchronized, such as a goroutine
+		// waiting on some asynchronous, external task to complete.
+		Watches(
+			&source.Channel{Source: ctx.GetGenericEventChannelFor(controlledTypeGVK)},
+			&handler.EnqueueRequestForObject{},
+		).
+		WithOptions(controller.Options{MaxConcurrentReconciles: ctx.MaxConcurrentReconciles}).
+		Complete(reconciler)
+}
+
+type vsphereDeploymentZoneReconciler struct {
+	*context.ControllerContext
+}
+
+// Reconcile ensures the back-end state reflects the Kubernetes resource state intent.
+func (r vsphereDeploymentZoneReconciler) Reconcile(ctx goctx.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	// Get the VSphereDeploymentZone resource for this request.
+	vsphereDeploymentZone := &infrav1.VSphereDeploymentZone{}
+	if err := r.Client.Get(r, req.NamespacedName, vsphereDeploymentZone); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Logger.V(4).Info("VSphereDeploymentZone not found, won't reconcile", "key", req.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// Create the patch helper.
+	patchHelper, err := patch.NewHelper(vsphereDeploymentZone, r.Client)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(
+			err,
+			"failed to init patch helper for %s %s",
+			vsphereDeploymentZone.GroupVersionKind(),
+			vsphereDeploymentZone.Name)
+	}
+
+	// Create the deployment zone context for this request.
+	vsphereDeploymentZoneContext := &context.VSphereDeploymentZoneContext{
+		ControllerContext:     r.ControllerContext,
+		VSphereDeploymentZone: vsphereDeploymentZone,
+		Logger:                r.Logger.WithName(req.Name),
+		PatchHelper:           patchHelper,
+	}
+
+	// Always issue a patch when exiting this function so changes to the
+	// resource are patched back to the API server.
+	defer func() {
+		if err := vsphereDeploymentZoneContext.Patch(); err != nil {
+			if reterr == nil {
+				reterr = err
+			}
+			vsphereDeploymentZoneContext.Logger.Error(err, "patch failed", "vsphereDeploymentZone", vsphereDeploymentZoneContext.String())
+		}
+	}()
+
+	// Deleted deployment zones do not own any vSphere resources, and the
+	// VSphereClusters stop publishing them as failure domains once they
+	// are gone.
+	if !vsphereDeploymentZone.DeletionTimestamp.IsZero() {
+		return reconcile.Result{}, nil
+	}
+
+	return r.reconcileNormal(vsphereDeploymentZoneContext)
+}
+
+func (r vsphereDeploymentZoneReconciler) reconcileNormal(ctx *context.VSphereDeploymentZoneContext) (reconcile.Result, error) {
+	ctx.Logger.Info("Reconciling VSphereDeploymentZone")
+
+	// Assume the deployment zone is not ready until all of its references
+	// have been validated.
+	ctx.VSphereDeploymentZone.Status.Ready = pointer.Bool(false)
+
+	failureDomain := &infrav1.VSphereFailureDomain{}
+	failureDomainKey := client.ObjectKey{Name: ctx.VSphereDeploymentZone.Spec.FailureDomain}
+	if err := ctx.Client.Get(ctx, failureDomainKey, failureDomain); err != nil {
+		conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.VSphereFailureDomainValidatedCondition, infrav1.VSphereFailureDomainNotFoundReason, clusterv1.ConditionSeverityError, err.Error())
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to get VSphereFailureDomain %s for %s", failureDomainKey.Name, ctx)
+	}
+	ctx.VSphereFailureDomain = failureDomain
+
+	authSession, err := r.getVCenterSession(ctx)
+	if err != nil {
+		conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.VCenterAvailableCondition, infrav1.VCenterUnreachableReason, clusterv1.ConditionSeverityError, err.Error())
+		return reconcile.Result{}, errors.Wrapf(err,
+			"unexpected error while probing vcenter for %s", ctx)
+	}
+	conditions.MarkTrue(ctx.VSphereDeploymentZone, infrav1.VCenterAvailableCondition)
+	ctx.Session = authSession
+
+	if err := r.reconcileFailureDomain(ctx); err != nil {
+		conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.VSphereFailureDomainValidatedCondition, infrav1.FailureDomainConfigurationFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to configure VSphereFailureDomain %s for %s", failureDomain.Name, ctx)
+	}
+
+	if err := r.reconcileTopology(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to validate topology of VSphereFailureDomain %s for %s", failureDomain.Name, ctx)
+	}
+	conditions.MarkTrue(ctx.VSphereDeploymentZone, infrav1.VSphereFailureDomainValidatedCondition)
+
+	if err := r.reconcilePlacementConstraint(ctx); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err,
+			"failed to validate placement constraint for %s", ctx)
+	}
+	conditions.MarkTrue(ctx.VSphereDeploymentZone, infrav1.PlacementConstraintMetCondition)
+
+	ctx.VSphereDeploymentZone.Status.Ready = pointer.Bool(true)
+	return reconcile.Result{}, nil
+}
+
+// reconcileTopology verifies the datacenter, compute cluster and host group
+// described by the VSphereFailureDomain exist in vCenter.
+func (r vsphereDeploymentZoneReconciler) reconcileTopology(ctx *context.VSphereDeploymentZoneContext) error {
+	topology := ctx.VSphereFailureDomain.Spec.Topology
+
+	if _, err := ctx.Session.Finder.Datacenter(ctx, topology.Datacenter); err != nil {
+		conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.VSphereFailureDomainValidatedCondition, infrav1.DatacenterNotFoundReason, clusterv1.ConditionSeverityError, err.Error())
+		return errors.Wrapf(err, "unable to find datacenter %q", topology.Datacenter)
+	}
+
+	if topology.ComputeCluster == nil {
+		if topology.HostGroup != nil {
+			err := errors.Errorf("host group %q requires a compute cluster", topology.HostGroup.Name)
+			conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.VSphereFailureDomainValidatedCondition, infrav1.ComputeClusterNotFoundReason, clusterv1.ConditionSeverityError, err.Error())
+			return err
+		}
+		return nil
+	}
+
+	computeCluster, err := ctx.Session.Finder.ClusterComputeResource(ctx, *topology.ComputeCluster)
+	if err != nil {
+		conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.VSphereFailureDomainValidatedCondition, infrav1.ComputeClusterNotFoundReason, clusterv1.ConditionSeverityError, err.Error())
+		return errors.Wrapf(err, "unable to find compute cluster %q", *topology.ComputeCluster)
+	}
+
+	if topology.HostGroup == nil {
+		return nil
+	}
+
+	hostGroup, err := cluster.FindHostGroup(ctx, computeCluster, topology.HostGroup.Name)
+	if err != nil {
+		return err
+	}
+	if hostGroup == nil {
+		err = errors.Errorf("unable to find host group %q in compute cluster %q", topology.HostGroup.Name, *topology.ComputeCluster)
+		conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.VSphereFailureDomainValidatedCondition, infrav1.HostGroupNotFoundReason, clusterv1.ConditionSeverityError, err.Error())
+		return err
+	}
+
+	if topology.HostGroup.VMGroupName == "" {
+		return nil
+	}
+	vmGroup, err := cluster.FindVMGroup(ctx, computeCluster, topology.HostGroup.VMGroupName)
+	if err != nil {
+		return err
+	}
+	if vmGroup == nil {
+		err = errors.Errorf("unable to find VM group %q in compute cluster %q", topology.HostGroup.VMGroupName, *topology.ComputeCluster)
+		conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.VSphereFailureDomainValidatedCondition, infrav1.VMGroupNotFoundReason, clusterv1.ConditionSeverityError, err.Error())
+		return err
+	}
+	return nil
+}
+
+// reconcileFailureDomain creates the tags, host group, VM group and VM-host
+// affinity rule described by the VSphereFailureDomain when auto-configuration
+// is enabled for them.
+func (r vsphereDeploymentZoneReconciler) reconcileFailureDomain(ctx *context.VSphereDeploymentZoneContext) error {
+	spec := ctx.VSphereFailureDomain.Spec
+
+	if pointer.BoolDeref(spec.Region.AutoConfigure, false) {
+		if err := r.reconcileFailureDomainTag(ctx, spec.Region); err != nil {
+			return errors.Wrapf(err, "failed to configure region %q", spec.Region.Name)
+		}
+	}
+
+	if pointer.BoolDeref(spec.Zone.AutoConfigure, false) {
+		if err := r.reconcileFailureDomainTag(ctx, spec.Zone); err != nil {
+			return errors.Wrapf(err, "failed to configure zone %q", spec.Zone.Name)
+		}
+	}
+
+	if spec.Topology.HostGroup != nil && pointer.BoolDeref(spec.Topology.HostGroup.AutoConfigure, false) {
+		if err := r.reconcileHostGroup(ctx); err != nil {
+			return errors.Wrapf(err, "failed to configure host group %q", spec.Topology.HostGroup.Name)
+		}
+	}
+
+	return nil
+}
+
+// reconcileFailureDomainTag ensures the tag of the failure domain exists and
+// is attached to the datacenter or compute cluster of the topology. Hosts are
+// not tagged, as only the administrator knows which hosts belong to a zone.
+func (r vsphereDeploymentZoneReconciler) reconcileFailureDomainTag(ctx *context.VSphereDeploymentZoneContext, failureDomain infrav1.FailureDomain) error {
+	tagID, err := cluster.EnsureTag(ctx, failureDomain)
+	if err != nil {
+		return err
+	}
+
+	topology := ctx.VSphereFailureDomain.Spec.Topology
+	switch failureDomain.Type {
+	case infrav1.DatacenterFailureDomain:
+		datacenter, err := ctx.Session.Finder.Datacenter(ctx, topology.Datacenter)
+		if err != nil {
+			return errors.Wrapf(err, "unable to find datacenter %q", topology.Datacenter)
+		}
+		return cluster.AttachTag(ctx, tagID, datacenter)
+	case infrav1.ComputeClusterFailureDomain:
+		if topology.ComputeCluster == nil {
+			return errors.Errorf("failure domain of type %s requires a compute cluster", failureDomain.Type)
+		}
+		computeCluster, err := ctx.Session.Finder.ClusterComputeResource(ctx, *topology.ComputeCluster)
+		if err != nil {
+			return errors.Wrapf(err, "unable to find compute cluster %q", *topology.ComputeCluster)
+		}
+		return cluster.AttachTag(ctx, tagID, computeCluster)
+	}
+	return nil
+}
+
+// reconcileHostGroup ensures the host group of the topology contains the
+// hosts of the compute cluster tagged with the zone, and that the VM group
+// and its VM-host affinity rule exist when a VM group name is provided.
+func (r vsphereDeploymentZoneReconciler) reconcileHostGroup(ctx *context.VSphereDeploymentZoneContext) error {
+	spec := ctx.VSphereFailureDomain.Spec
+	if spec.Topology.ComputeCluster == nil {
+		return errors.New("auto-configuring a host group requires a compute cluster")
+	}
+
+	computeCluster, err := ctx.Session.Finder.ClusterComputeResource(ctx, *spec.Topology.ComputeCluster)
+	if err != nil {
+		return errors.Wrapf(err, "unable to find compute cluster %q", *spec.Topology.ComputeCluster)
+	}
+
+	tagID, err := cluster.EnsureTag(ctx, spec.Zone)
+	if err != nil {
+		return err
+	}
+	taggedObjects, err := cluster.ListTaggedObjects(ctx, tagID)
+	if err != nil {
+		return err
+	}
+	tagged := make(map[types.ManagedObjectReference]struct{}, len(taggedObjects))
+	for _, obj := range taggedObjects {
+		tagged[obj.Reference()] = struct{}{}
+	}
+
+	clusterHosts, err := computeCluster.Hosts(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "unable to list hosts of compute cluster %q", *spec.Topology.ComputeCluster)
+	}
+	var hosts []types.ManagedObjectReference
+	for _, host := range clusterHosts {
+		if _, ok := tagged[host.Reference()]; ok {
+			hosts = append(hosts, host.Reference())
+		}
+	}
+
+	hostGroup := spec.Topology.HostGroup
+	if err := cluster.EnsureHostGroup(ctx, computeCluster, hostGroup.Name, hosts); err != nil {
+		return err
+	}
+
+	if hostGroup.VMGroupName == "" {
+		return nil
+	}
+	if err := cluster.EnsureVMGroup(ctx, computeCluster, hostGroup.VMGroupName); err != nil {
+		return err
+	}
+	ruleName := fmt.Sprintf("%s-%s", hostGroup.VMGroupName, hostGroup.Name)
+	return cluster.EnsureVMHostAffinityRule(ctx, computeCluster, ruleName, hostGroup.VMGroupName, hostGroup.Name)
+}
+
+// reconcilePlacementConstraint verifies the resource pool, datastore, folder
+// and networks of the VSphereDeploymentZone exist in vCenter.
+func (r vsphereDeploymentZoneReconciler) reconcilePlacementConstraint(ctx *context.VSphereDeploymentZoneContext) error {
+	placementConstraint := ctx.VSphereDeploymentZone.Spec.PlacementConstaint
+
+	if placementConstraint.ResourcePool != "" {
+		if _, err := ctx.Session.Finder.ResourcePool(ctx, placementConstraint.ResourcePool); err != nil {
+			conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.PlacementConstraintMetCondition, infrav1.ResourcePoolNotFoundReason, clusterv1.ConditionSeverityError, err.Error())
+			return errors.Wrapf(err, "unable to find resource pool %q", placementConstraint.ResourcePool)
+		}
+	}
+
+	if placementConstraint.Datastore != "" {
+		if _, err := ctx.Session.Finder.Datastore(ctx, placementConstraint.Datastore); err != nil {
+			conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.PlacementConstraintMetCondition, infrav1.DatastoreNotFoundReason, clusterv1.ConditionSeverityError, err.Error())
+			return errors.Wrapf(err, "unable to find datastore %q", placementConstraint.Datastore)
+		}
+	}
+
+	if placementConstraint.Folder != "" {
+		if _, err := ctx.Session.Finder.Folder(ctx, placementConstraint.Folder); err != nil {
+			conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.PlacementConstraintMetCondition, infrav1.FolderNotFoundReason, clusterv1.ConditionSeverityError, err.Error())
+			return errors.Wrapf(err, "unable to find folder %q", placementConstraint.Folder)
+		}
+	}
+
+	for _, network := range placementConstraint.Network {
+		if _, err := ctx.Session.Finder.Network(ctx, network.NetworkName); err != nil {
+			conditions.MarkFalse(ctx.VSphereDeploymentZone, infrav1.PlacementConstraintMetCondition, infrav1.NetworkNotFoundReason, clusterv1.ConditionSeverityError, err.Error())
+			return errors.Wrapf(err, "unable to find network %q", network.NetworkName)
+		}
+	}
+
+	return nil
+}
+
+// getVCenterSession returns a session for the server of the deployment zone.
+// VSphereDeploymentZones are cluster scoped and do not reference an identity,
+// so the credentials provided to the manager are used.
+func (r vsphereDeploymentZoneReconciler) getVCenterSession(ctx *context.VSphereDeploymentZoneContext) (*session.Session, error) {
+	params := session.NewParams().
+		WithServer(ctx.VSphereDeploymentZone.Spec.Server).
+		WithDatacenter(ctx.VSphereFailureDomain.Spec.Topology.Datacenter).
+		WithThumbprint(ctx.VSphereDeploymentZone.Spec.Thumbprint).
+		WithUserInfo(r.ControllerContext.Username, r.ControllerContext.Password).
+		WithFeatures(session.Feature{
+			EnableKeepAlive:   r.EnableKeepAlive,
+			KeepAliveDuration: r.KeepAliveDuration,
+		})
+
+	return session.GetOrCreate(r.Context, params)
+}
+
+// failureDomainsToDeploymentZones maps a VSphereFailureDomain to the
+// VSphereDeploymentZones that reference it.
+func (r vsphereDeploymentZoneReconciler) failureDomainsToDeploymentZones(a client.Object) []reconcile.Request {
+	failureDomain, ok := a.(*infrav1.VSphereFailureDomain)
+	if !ok {
+		r.Logger.Error(nil, fmt.Sprintf("expected a VSphereFailureDomain but got a %T", a))
+		return nil
+	}
+
+	var zones infrav1.VSphereDeploymentZoneList
+	if err := r.Client.List(r, &zones); err != nil {
+		r.Logger.Error(err, "failed to list VSphereDeploymentZones")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, zone := range zones.Items {
+		if zone.Spec.FailureDomain == failureDomain.Name {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKey{Name: zone.Name},
+			})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	goctx "context"
+	"crypto/tls"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware/govmomi/simulator"
+	_ "github.com/vmware/govmomi/vapi/simulator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apirecord "k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
+)
+
+func TestVSphereDeploymentZoneReconciler_Reconcile(t *testing.T) {
+	// initializing a fake server to replace the vSphere endpoint
+	model := simulator.VPX()
+	model.Host = 0
+	defer model.Remove()
+
+	err := model.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+	model.Service.RegisterEndpoints = true
+
+	s := model.Service.NewServer()
+	defer s.Close()
+
+	tests := []struct {
+		name                string
+		autoConfigure       bool
+		topology            infrav1.Topology
+		placementConstraint infrav1.PlacementConstraint
+		expectedCondition   corev1.ConditionStatus
+		expectedReason      string
+		failedCondition     clusterv1.ConditionType
+	}{
+		{
+			name: "with a valid topology and placement constraint",
+			topology: infrav1.Topology{
+				Datacenter:     "DC0",
+				ComputeCluster: pointer.String("DC0_C0"),
+			},
+			placementConstraint: infrav1.PlacementConstraint{
+				ResourcePool: "DC0_C0/Resources",
+				Datastore:    "LocalDS_0",
+				Folder:       "/DC0/vm",
+				Network:      []infrav1.Network{{NetworkName: "VM Network"}},
+			},
+			expectedCondition: corev1.ConditionTrue,
+		},
+		{
+			name:          "with an auto-configured topology",
+			autoConfigure: true,
+			topology: infrav1.Topology{
+				Datacenter:     "DC0",
+				ComputeCluster: pointer.String("DC0_C0"),
+				HostGroup: &infrav1.FailureDomainHostGroup{
+					Name:          "zone-a-hosts",
+					AutoConfigure: pointer.Bool(true),
+					VMGroupName:   "zone-a-vms",
+				},
+			},
+			expectedCondition: corev1.ConditionTrue,
+		},
+		{
+			name: "with a missing compute cluster",
+			topology: infrav1.Topology{
+				Datacenter:     "DC0",
+				ComputeCluster: pointer.String("DC0_C99"),
+			},
+			expectedCondition: corev1.ConditionFalse,
+			expectedReason:    infrav1.ComputeClusterNotFoundReason,
+			failedCondition:   infrav1.VSphereFailureDomainValidatedCondition,
+		},
+		{
+			name: "with a missing host group",
+			topology: infrav1.Topology{
+				Datacenter:     "DC0",
+				ComputeCluster: pointer.String("DC0_C0"),
+				HostGroup:      &infrav1.FailureDomainHostGroup{Name: "missing-host-group"},
+			},
+			expectedCondition: corev1.ConditionFalse,
+			expectedReason:    infrav1.HostGroupNotFoundReason,
+			failedCondition:   infrav1.VSphereFailureDomainValidatedCondition,
+		},
+		{
+			name: "with a missing datastore",
+			topology: infrav1.Topology{
+				Datacenter: "DC0",
+			},
+			placementConstraint: infrav1.PlacementConstraint{
+				Datastore: "missing-datastore",
+			},
+			expectedCondition: corev1.ConditionFalse,
+			expectedReason:    infrav1.DatastoreNotFoundReason,
+			failedCondition:   infrav1.PlacementConstraintMetCondition,
+		},
+		{
+			name: "with a missing network",
+			topology: infrav1.Topology{
+				Datacenter: "DC0",
+			},
+			placementConstraint: infrav1.PlacementConstraint{
+				Network: []infrav1.Network{{NetworkName: "missing-network"}},
+			},
+			expectedCondition: corev1.ConditionFalse,
+			expectedReason:    infrav1.NetworkNotFoundReason,
+			failedCondition:   infrav1.PlacementConstraintMetCondition,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			failureDomain := &infrav1.VSphereFailureDomain{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "blah-fd",
+				},
+				Spec: infrav1.VSphereFailureDomainSpec{
+					Region: infrav1.FailureDomain{
+						Name:        "region-a",
+						Type:        infrav1.DatacenterFailureDomain,
+						TagCategory: "k8s-region",
+					},
+					Zone: infrav1.FailureDomain{
+						Name:        "zone-a",
+						Type:        infrav1.ComputeClusterFailureDomain,
+						TagCategory: "k8s-zone",
+					},
+					Topology: tt.topology,
+				},
+			}
+
+			deploymentZone := &infrav1.VSphereDeploymentZone{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "blah",
+					// To make sure PatchHelper does not error out
+					ResourceVersion: "1234",
+				},
+				Spec: infrav1.VSphereDeploymentZoneSpec{
+					Server:             s.URL.Host,
+					FailureDomain:      failureDomain.Name,
+					ControlPlane:       pointer.Bool(true),
+					PlacementConstaint: tt.placementConstraint,
+				},
+			}
+
+			controllerMgrContext := fake.NewControllerManagerContext(deploymentZone, failureDomain)
+			password, _ := s.URL.User.Password()
+			controllerMgrContext.Password = password
+			controllerMgrContext.Username = s.URL.User.Username()
+
+			controllerContext := &context.ControllerContext{
+				ControllerManagerContext: controllerMgrContext,
+				Recorder:                 record.New(apirecord.NewFakeRecorder(100)),
+				Logger:                   log.Log,
+			}
+			r := vsphereDeploymentZoneReconciler{ControllerContext: controllerContext}
+
+			_, err := r.Reconcile(goctx.Background(), ctrl.Request{NamespacedName: util.ObjectKey(deploymentZone)})
+			if tt.expectedCondition == corev1.ConditionTrue {
+				g.Expect(err).NotTo(HaveOccurred())
+			} else {
+				g.Expect(err).To(HaveOccurred())
+			}
+
+			zone := &infrav1.VSphereDeploymentZone{}
+			g.Expect(r.Client.Get(goctx.Background(), util.ObjectKey(deploymentZone), zone)).NotTo(HaveOccurred())
+			g.Expect(zone.Status.Ready).NotTo(BeNil())
+			g.Expect(*zone.Status.Ready).To(Equal(tt.expectedCondition == corev1.ConditionTrue))
+			g.Expect(conditions.IsTrue(zone, infrav1.VCenterAvailableCondition)).To(BeTrue())
+
+			if tt.failedCondition != "" {
+				condition := conditions.Get(zone, tt.failedCondition)
+				g.Expect(condition).NotTo(BeNil())
+				g.Expect(condition.Status).To(Equal(tt.expectedCondition))
+				g.Expect(condition.Reason).To(Equal(tt.expectedReason))
+			}
+			g.Expect(conditions.Get(zone, clusterv1.ReadyCondition).Status).To(Equal(tt.expectedCondition))
+		})
+	}
+}
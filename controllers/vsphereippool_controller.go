@@ -0,0 +1,381 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	goctx "context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/ipam"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereippools,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereippools/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherevms,verbs=get;list;watch;update;patch
+
+// AddVSphereIPPoolControllerToManager adds the VSphereIPPool controller to
+// the provided manager.
+func AddVSphereIPPoolControllerToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) error {
+	var (
+		controlledType     = &infrav1.VSphereIPPool{}
+		controlledTypeName = reflect.TypeOf(controlledType).Elem().Name()
+		controlledTypeGVK  = infrav1.GroupVersion.WithKind(controlledTypeName)
+
+		controllerNameShort = fmt.Sprintf("%s-controller", strings.ToLower(controlledTypeName))
+		controllerNameLong  = fmt.Sprintf("%s/%s/%s", ctx.Namespace, ctx.Name, controllerNameShort)
+	)
+
+	// Build the controller context.
+	controllerContext := &context.ControllerContext{
+		ControllerManagerContext: ctx,
+		Name:                     controllerNameShort,
+		Recorder:                 record.New(mgr.GetEventRecorderFor(controllerNameLong)),
+		Logger:                   ctx.Logger.WithName(controllerNameShort),
+	}
+	reconciler := vsphereIPPoolReconciler{ControllerContext: controllerContext}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		// Watch the controlled, infrastructure resource.
+		For(controlledType).
+		// Watch the VSphereVMs referencing the pools, so that addresses are
+		// allocated to new VMs and released once VMs are deleted.
+		Watches(
+			&source.Kind{Type: &infrav1.VSphereVM{}},
+			handler.EnqueueRequestsFromMapFunc(reconciler.vsphereVMToIPPools),
+		).
+		// Watch a GenericEvent channel for the controlled resource.
+		//
+		// This is useful when there are events outside of Kubernetes that
+		// should cause a resource to be synchronized, such as a goroutine
+		// waiting on some asynchronous, external task to complete.
+		Watches(
+			&source.Channel{Source: ctx.GetGenericEventChannelFor(controlledTypeGVK)},
+			&handler.EnqueueRequestForObject{},
+		).
+		WithOptions(controller.Options{MaxConcurrentReconciles: ctx.MaxConcurrentReconciles}).
+		Complete(reconciler)
+}
+
+type vsphereIPPoolReconciler struct {
+	*context.ControllerContext
+}
+
+// Reconcile ensures the back-end state reflects the Kubernetes resource state intent.
+func (r vsphereIPPoolReconciler) Reconcile(ctx goctx.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	// Get the VSphereIPPool resource for this request.
+	vsphereIPPool := &infrav1.VSphereIPPool{}
+	if err := r.Client.Get(r, req.NamespacedName, vsphereIPPool); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Logger.V(4).Info("VSphereIPPool not found, won't reconcile", "key", req.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// Create the patch helper.
+	patchHelper, err := patch.NewHelper(vsphereIPPool, r.Client)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(
+			err,
+			"failed to init patch helper for %s %s/%s",
+			vsphereIPPool.GroupVersionKind(),
+			vsphereIPPool.Namespace,
+			vsphereIPPool.Name)
+	}
+
+	// Create the IP pool context for this request.
+	vsphereIPPoolContext := &context.VSphereIPPoolContext{
+		ControllerContext: r.ControllerContext,
+		VSphereIPPool:     vsphereIPPool,
+		Logger:            r.Logger.WithName(req.Namespace).WithName(req.Name),
+		PatchHelper:       patchHelper,
+	}
+
+	// Always issue a patch when exiting this function so changes to the
+	// resource are patched back to the API server.
+	defer func() {
+		if err := vsphereIPPoolContext.Patch(); err != nil {
+			if reterr == nil {
+				reterr = err
+			}
+			vsphereIPPoolContext.Logger.Error(err, "patch failed", "vsphereIPPool", vsphereIPPoolContext.String())
+		}
+	}()
+
+	// Handle deleted pools
+	if !vsphereIPPool.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(vsphereIPPoolContext)
+	}
+
+	// Handle non-deleted pools
+	return r.reconcileNormal(vsphereIPPoolContext)
+}
+
+func (r vsphereIPPoolReconciler) reconcileDelete(ctx *context.VSphereIPPoolContext) (reconcile.Result, error) {
+	ctx.Logger.Info("Handling deleted VSphereIPPool")
+
+	vms, err := r.listVSphereVMs(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// The addresses of the pool are released when the VSphereVMs using them
+	// are deleted, which causes the pool to be reconciled again.
+	for _, vm := range vms {
+		for _, device := range vm.Spec.Network.Devices {
+			if usesIPPool(device, ctx.VSphereIPPool) && len(device.IPAddrs) > 0 {
+				ctx.Logger.Info("Waiting for the addresses of the pool to be released", "vsphereVM", vm.Name)
+				return reconcile.Result{}, nil
+			}
+		}
+	}
+
+	ctrlutil.RemoveFinalizer(ctx.VSphereIPPool, infrav1.IPPoolFinalizer)
+	return reconcile.Result{}, nil
+}
+
+// ipPoolDevice is a network device of a VSphereVM which uses a VSphereIPPool.
+type ipPoolDevice struct {
+	vm    *infrav1.VSphereVM
+	index int
+}
+
+func (d ipPoolDevice) spec() *infrav1.NetworkDeviceSpec {
+	return &d.vm.Spec.Network.Devices[d.index]
+}
+
+func (r vsphereIPPoolReconciler) reconcileNormal(ctx *context.VSphereIPPoolContext) (reconcile.Result, error) {
+	ctx.Logger.Info("Reconciling VSphereIPPool")
+
+	// If the VSphereIPPool doesn't have our finalizer, add it.
+	ctrlutil.AddFinalizer(ctx.VSphereIPPool, infrav1.IPPoolFinalizer)
+
+	pool, err := ipam.NewPool(ctx.VSphereIPPool.Spec)
+	if err != nil {
+		// The pool cannot be used until its spec is fixed, which causes the
+		// pool to be reconciled again.
+		conditions.MarkFalse(ctx.VSphereIPPool, infrav1.IPAddressesAvailableCondition, infrav1.InvalidIPPoolReason, clusterv1.ConditionSeverityError, err.Error())
+		ctx.Logger.Error(err, "invalid VSphereIPPool")
+		return reconcile.Result{}, nil
+	}
+
+	vms, err := r.listVSphereVMs(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Addresses assigned to network devices which do not use the pool are
+	// never allocated by the pool.
+	for _, vm := range vms {
+		for _, device := range vm.Spec.Network.Devices {
+			if usesIPPool(device, ctx.VSphereIPPool) {
+				continue
+			}
+			for _, address := range device.IPAddrs {
+				pool.ReserveAddress(address)
+			}
+		}
+	}
+
+	// Claim the addresses already allocated to the devices using the pool,
+	// oldest VSphereVMs first. An address claimed twice is allocated again
+	// to the newest VSphereVM, unless the VM was already cloned with it.
+	var (
+		allocations []infrav1.IPAddressAllocation
+		conflicts   []string
+		pending     []ipPoolDevice
+		updated     = map[*infrav1.VSphereVM]*infrav1.VSphereVM{}
+	)
+	for _, vm := range vms {
+		for i, device := range vm.Spec.Network.Devices {
+			if !usesIPPool(device, ctx.VSphereIPPool) {
+				continue
+			}
+			poolDevice := ipPoolDevice{vm: vm, index: i}
+			if len(device.IPAddrs) == 0 {
+				if vm.DeletionTimestamp.IsZero() {
+					pending = append(pending, poolDevice)
+				}
+				continue
+			}
+
+			address := device.IPAddrs[0]
+			if pool.Contains(address) && pool.ReserveAddress(address) {
+				allocations = append(allocations, infrav1.IPAddressAllocation{
+					Address:     address,
+					VSphereVM:   vm.Name,
+					DeviceIndex: int32(i),
+				})
+				continue
+			}
+
+			if vm.Spec.BiosUUID != "" || !vm.DeletionTimestamp.IsZero() {
+				conflicts = append(conflicts, fmt.Sprintf("address %s of VSphereVM %s is not available", address, vm.Name))
+				continue
+			}
+			ctx.Logger.Info("Releasing an unavailable address", "vsphereVM", vm.Name, "device", i, "address", address)
+			if _, ok := updated[vm]; !ok {
+				updated[vm] = vm.DeepCopy()
+			}
+			poolDevice.spec().IPAddrs = nil
+			pending = append(pending, poolDevice)
+		}
+	}
+
+	// Allocate addresses to the devices waiting for one.
+	exhausted := 0
+	for _, poolDevice := range pending {
+		address, err := pool.Allocate()
+		if err != nil {
+			exhausted++
+			continue
+		}
+		if _, ok := updated[poolDevice.vm]; !ok {
+			updated[poolDevice.vm] = poolDevice.vm.DeepCopy()
+		}
+		r.assignAddress(ctx, pool, poolDevice.spec(), address)
+		allocations = append(allocations, infrav1.IPAddressAllocation{
+			Address:     address,
+			VSphereVM:   poolDevice.vm.Name,
+			DeviceIndex: int32(poolDevice.index),
+		})
+		ctx.Logger.Info("Allocated an address", "vsphereVM", poolDevice.vm.Name, "device", poolDevice.index, "address", address)
+	}
+
+	// Persist the allocations in the VSphereVMs. The optimistic lock ensures
+	// the devices of a VSphereVM updated in the meantime are not overwritten.
+	for _, vm := range vms {
+		original, ok := updated[vm]
+		if !ok {
+			continue
+		}
+		if err := r.Client.Patch(ctx, vm, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err,
+				"failed to patch the addresses of VSphereVM %s/%s for %s", vm.Namespace, vm.Name, ctx)
+		}
+	}
+
+	sort.Slice(allocations, func(i, j int) bool {
+		if allocations[i].VSphereVM != allocations[j].VSphereVM {
+			return allocations[i].VSphereVM < allocations[j].VSphereVM
+		}
+		return allocations[i].DeviceIndex < allocations[j].DeviceIndex
+	})
+	ctx.VSphereIPPool.Status.Allocations = allocations
+
+	switch {
+	case exhausted > 0:
+		conditions.MarkFalse(ctx.VSphereIPPool, infrav1.IPAddressesAvailableCondition, infrav1.IPPoolExhaustedReason, clusterv1.ConditionSeverityWarning,
+			"%d network devices are waiting for an address", exhausted)
+	case len(conflicts) > 0:
+		conditions.MarkFalse(ctx.VSphereIPPool, infrav1.IPAddressesAvailableCondition, infrav1.IPAddressConflictReason, clusterv1.ConditionSeverityWarning,
+			"%s", strings.Join(conflicts, "; "))
+	default:
+		conditions.MarkTrue(ctx.VSphereIPPool, infrav1.IPAddressesAvailableCondition)
+	}
+	return reconcile.Result{}, nil
+}
+
+// assignAddress assigns an address allocated from the pool to a network
+// device, along with the gateway and the nameservers of the pool unless the
+// device sets its own.
+func (r vsphereIPPoolReconciler) assignAddress(ctx *context.VSphereIPPoolContext, pool *ipam.Pool, device *infrav1.NetworkDeviceSpec, address string) {
+	device.IPAddrs = []string{address}
+	if gateway := ctx.VSphereIPPool.Spec.Gateway; gateway != "" {
+		if pool.IsIPv6() {
+			if device.Gateway6 == "" {
+				device.Gateway6 = gateway
+			}
+		} else if device.Gateway4 == "" {
+			device.Gateway4 = gateway
+		}
+	}
+	if len(device.Nameservers) == 0 && len(ctx.VSphereIPPool.Spec.Nameservers) > 0 {
+		device.Nameservers = append([]string{}, ctx.VSphereIPPool.Spec.Nameservers...)
+	}
+}
+
+// listVSphereVMs returns the VSphereVMs in the namespace of the pool, the
+// oldest first.
+func (r vsphereIPPoolReconciler) listVSphereVMs(ctx *context.VSphereIPPoolContext) ([]*infrav1.VSphereVM, error) {
+	var vmList infrav1.VSphereVMList
+	if err := r.Client.List(ctx, &vmList, client.InNamespace(ctx.VSphereIPPool.Namespace)); err != nil {
+		return nil, errors.Wrapf(err, "failed to list VSphereVMs for %s", ctx)
+	}
+
+	vms := make([]*infrav1.VSphereVM, 0, len(vmList.Items))
+	for i := range vmList.Items {
+		vms = append(vms, &vmList.Items[i])
+	}
+	sort.SliceStable(vms, func(i, j int) bool {
+		if !vms[i].CreationTimestamp.Equal(&vms[j].CreationTimestamp) {
+			return vms[i].CreationTimestamp.Before(&vms[j].CreationTimestamp)
+		}
+		return vms[i].Name < vms[j].Name
+	})
+	return vms, nil
+}
+
+// usesIPPool returns whether the address of the network device is allocated
+// from the pool.
+func usesIPPool(device infrav1.NetworkDeviceSpec, pool *infrav1.VSphereIPPool) bool {
+	return device.IPPoolRef != nil && device.IPPoolRef.Name == pool.Name && !device.DHCP4 && !device.DHCP6
+}
+
+func (r vsphereIPPoolReconciler) vsphereVMToIPPools(a client.Object) []reconcile.Request {
+	vm, ok := a.(*infrav1.VSphereVM)
+	if !ok {
+		r.Logger.Error(nil, fmt.Sprintf("expected a VSphereVM but got a %T", a))
+		return nil
+	}
+
+	var requests []reconcile.Request
+	pools := map[string]struct{}{}
+	for _, device := range vm.Spec.Network.Devices {
+		if device.IPPoolRef == nil {
+			continue
+		}
+		if _, ok := pools[device.IPPoolRef.Name]; ok {
+			continue
+		}
+		pools[device.IPPoolRef.Name] = struct{}{}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{Namespace: vm.Namespace, Name: device.IPPoolRef.Name},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	goctx "context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	apirecord "k8s.io/client-go/tools/record"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
+)
+
+func TestVSphereIPPoolReconciler_Reconcile(t *testing.T) {
+	now := time.Now()
+
+	newVSphereVM := func(name string, age time.Duration, devices ...infrav1.NetworkDeviceSpec) *infrav1.VSphereVM {
+		return &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				ResourceVersion:   "1",
+			},
+			Spec: infrav1.VSphereVMSpec{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+					Network: infrav1.NetworkSpec{Devices: devices},
+				},
+			},
+		}
+	}
+	poolDevice := func(ipAddrs ...string) infrav1.NetworkDeviceSpec {
+		device := infrav1.NetworkDeviceSpec{
+			NetworkName: "VM Network",
+			IPPoolRef:   &corev1.LocalObjectReference{Name: "pool"},
+		}
+		if len(ipAddrs) > 0 {
+			// The device was already assigned an address by the pool.
+			device.IPAddrs = ipAddrs
+			device.Gateway4 = "10.0.0.1"
+			device.Nameservers = []string{"10.0.0.53"}
+		}
+		return device
+	}
+	staticDevice := func(ipAddrs ...string) infrav1.NetworkDeviceSpec {
+		return infrav1.NetworkDeviceSpec{
+			NetworkName: "VM Network",
+			IPAddrs:     ipAddrs,
+		}
+	}
+
+	tests := []struct {
+		name              string
+		ranges            []infrav1.IPRange
+		vms               []*infrav1.VSphereVM
+		expectedAddresses map[string]string
+		expectedReason    string
+	}{
+		{
+			name: "allocates free addresses",
+			vms: []*infrav1.VSphereVM{
+				newVSphereVM("vm-a", 3*time.Minute, poolDevice()),
+				newVSphereVM("vm-b", 2*time.Minute, staticDevice("10.0.0.2/29")),
+				newVSphereVM("vm-c", time.Minute, poolDevice("10.0.0.3/29")),
+			},
+			expectedAddresses: map[string]string{
+				"vm-a": "10.0.0.4/29",
+				"vm-c": "10.0.0.3/29",
+			},
+		},
+		{
+			name: "allocates another address to the newest of two conflicting VMs",
+			vms: []*infrav1.VSphereVM{
+				newVSphereVM("vm-a", 2*time.Minute, poolDevice("10.0.0.2/29")),
+				newVSphereVM("vm-b", time.Minute, poolDevice("10.0.0.2/29")),
+			},
+			expectedAddresses: map[string]string{
+				"vm-a": "10.0.0.2/29",
+				"vm-b": "10.0.0.3/29",
+			},
+		},
+		{
+			name:   "reports an exhausted pool",
+			ranges: []infrav1.IPRange{{Start: "10.0.0.5", End: "10.0.0.5"}},
+			vms: []*infrav1.VSphereVM{
+				newVSphereVM("vm-a", 2*time.Minute, poolDevice()),
+				newVSphereVM("vm-b", time.Minute, poolDevice()),
+			},
+			expectedAddresses: map[string]string{
+				"vm-a": "10.0.0.5/29",
+				"vm-b": "",
+			},
+			expectedReason: infrav1.IPPoolExhaustedReason,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ipPool := &infrav1.VSphereIPPool{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pool",
+					Namespace: "default",
+					// To make sure PatchHelper does not error out
+					ResourceVersion: "1234",
+				},
+				Spec: infrav1.VSphereIPPoolSpec{
+					CIDR:        "10.0.0.0/29",
+					Ranges:      tt.ranges,
+					Gateway:     "10.0.0.1",
+					Nameservers: []string{"10.0.0.53"},
+				},
+			}
+
+			initObjects := []runtime.Object{ipPool}
+			for _, vm := range tt.vms {
+				initObjects = append(initObjects, vm)
+			}
+			controllerMgrContext := fake.NewControllerManagerContext(initObjects...)
+			controllerContext := &context.ControllerContext{
+				ControllerManagerContext: controllerMgrContext,
+				Recorder:                 record.New(apirecord.NewFakeRecorder(100)),
+				Logger:                   log.Log,
+			}
+			r := vsphereIPPoolReconciler{ControllerContext: controllerContext}
+
+			_, err := r.Reconcile(goctx.Background(), ctrl.Request{NamespacedName: util.ObjectKey(ipPool)})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			allocated := 0
+			for name, address := range tt.expectedAddresses {
+				vm := &infrav1.VSphereVM{}
+				g.Expect(controllerMgrContext.Client.Get(goctx.Background(), client.ObjectKey{Namespace: "default", Name: name}, vm)).To(Succeed())
+				device := vm.Spec.Network.Devices[0]
+				if address == "" {
+					g.Expect(device.IPAddrs).To(BeEmpty())
+					continue
+				}
+				allocated++
+				g.Expect(device.IPAddrs).To(Equal([]string{address}))
+				g.Expect(device.Gateway4).To(Equal("10.0.0.1"))
+				g.Expect(device.Nameservers).To(Equal([]string{"10.0.0.53"}))
+			}
+
+			pool := &infrav1.VSphereIPPool{}
+			g.Expect(controllerMgrContext.Client.Get(goctx.Background(), util.ObjectKey(ipPool), pool)).To(Succeed())
+			g.Expect(pool.Finalizers).To(ContainElement(infrav1.IPPoolFinalizer))
+			g.Expect(pool.Status.Allocations).To(HaveLen(allocated))
+			if tt.expectedReason == "" {
+				g.Expect(conditions.IsTrue(pool, infrav1.IPAddressesAvailableCondition)).To(BeTrue())
+			} else {
+				g.Expect(conditions.GetReason(pool, infrav1.IPAddressesAvailableCondition)).To(Equal(tt.expectedReason))
+			}
+		})
+	}
+}
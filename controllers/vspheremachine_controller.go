@@ -392,6 +392,13 @@ func (r machineReconciler) reconcileNormal(ctx *context.MachineContext) (reconci
 }
 
 func (r machineReconciler) reconcileNormalPre7(ctx *context.MachineContext, vsphereVM *infrav1.VSphereVM) (runtime.Object, error) {
+	// Resolve the machine's failure domain into the deployment zone and the
+	// failure domain that describe where the VM is placed.
+	deploymentZone, failureDomain, err := r.getFailureDomain(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create or update the VSphereVM resource.
 	vm := &infrav1.VSphereVM{
 		ObjectMeta: metav1.ObjectMeta{
@@ -435,15 +442,23 @@ func (r machineReconciler) reconcileNormalPre7(ctx *context.MachineContext, vsph
 		}
 
 		// Copy the VSphereMachine's VM clone spec into the VSphereVM's
-		// clone spec.
+		// clone spec, keeping the addresses allocated from IP pools to the
+		// existing VSphereVM's network devices.
+		existingDevices := vm.Spec.Network.Devices
 		ctx.VSphereMachine.Spec.VirtualMachineCloneSpec.DeepCopyInto(&vm.Spec.VirtualMachineCloneSpec)
 
 		// Several of the VSphereVM's clone spec properties can be derived
 		// from multiple places. The order is:
 		//
-		//   1. From the VSphereMachine.Spec (the DeepCopyInto above)
-		//   2. From the VSphereCluster.Spec.CloudProviderConfiguration.Workspace
-		//   3. From the VSphereCluster.Spec
+		//   1. From the VSphereDeploymentZone and VSphereFailureDomain of the
+		//      machine's failure domain
+		//   2. From the VSphereMachine.Spec (the DeepCopyInto above)
+		//   3. From the VSphereCluster.Spec.CloudProviderConfiguration.Workspace
+		//   4. From the VSphereCluster.Spec
+		if deploymentZone != nil {
+			overrideWithFailureDomain(&vm.Spec.VirtualMachineCloneSpec, deploymentZone, failureDomain)
+		}
+		preserveIPPoolAddresses(vm.Spec.Network.Devices, existingDevices)
 		vsphereCloudConfig := ctx.VSphereCluster.Spec.CloudProviderConfiguration.Workspace
 		if vm.Spec.Server == "" {
 			if vm.Spec.Server = vsphereCloudConfig.Server; vm.Spec.Server == "" {
@@ -483,6 +498,108 @@ func (r machineReconciler) reconcileNormalPre7(ctx *context.MachineContext, vsph
 	return vm, nil
 }
 
+// getFailureDomain returns the VSphereDeploymentZone and VSphereFailureDomain
+// for the failure domain of the machine.
+func (r machineReconciler) getFailureDomain(ctx *context.MachineContext) (*infrav1.VSphereDeploymentZone, *infrav1.VSphereFailureDomain, error) {
+	deploymentZone, failureDomain, err := getFailureDomain(ctx, ctx.Client, ctx.Machine, ctx.VSphereMachine)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get failure domain for %s", ctx)
+	}
+	return deploymentZone, failureDomain, nil
+}
+
+// getFailureDomain returns the VSphereDeploymentZone and VSphereFailureDomain
+// for the failure domain of a machine. The failure domain is read from the
+// VSphereMachine and falls back to the one assigned to the CAPI Machine. Nil
+// values are returned if the machine does not have a failure domain.
+func getFailureDomain(ctx goctx.Context, c client.Client, machine *clusterv1.Machine, vsphereMachine *infrav1.VSphereMachine) (*infrav1.VSphereDeploymentZone, *infrav1.VSphereFailureDomain, error) {
+	failureDomainName := vsphereMachine.Spec.FailureDomain
+	if failureDomainName == nil || *failureDomainName == "" {
+		failureDomainName = machine.Spec.FailureDomain
+	}
+	if failureDomainName == nil || *failureDomainName == "" {
+		return nil, nil, nil
+	}
+
+	deploymentZone := &infrav1.VSphereDeploymentZone{}
+	if err := c.Get(ctx, client.ObjectKey{Name: *failureDomainName}, deploymentZone); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get VSphereDeploymentZone %s", *failureDomainName)
+	}
+
+	failureDomain := &infrav1.VSphereFailureDomain{}
+	if err := c.Get(ctx, client.ObjectKey{Name: deploymentZone.Spec.FailureDomain}, failureDomain); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get VSphereFailureDomain %s", deploymentZone.Spec.FailureDomain)
+	}
+
+	return deploymentZone, failureDomain, nil
+}
+
+// preserveIPPoolAddresses copies the addresses allocated from a
+// VSphereIPPool to the existing network devices of a VSphereVM into the
+// devices which use the same pool and do not have addresses.
+func preserveIPPoolAddresses(devices, existingDevices []infrav1.NetworkDeviceSpec) {
+	for i := range devices {
+		device := &devices[i]
+		if i >= len(existingDevices) || device.IPPoolRef == nil || len(device.IPAddrs) > 0 {
+			continue
+		}
+		existing := existingDevices[i]
+		if existing.IPPoolRef == nil || existing.IPPoolRef.Name != device.IPPoolRef.Name {
+			continue
+		}
+		device.IPAddrs = existing.IPAddrs
+		if device.Gateway4 == "" {
+			device.Gateway4 = existing.Gateway4
+		}
+		if device.Gateway6 == "" {
+			device.Gateway6 = existing.Gateway6
+		}
+		if len(device.Nameservers) == 0 {
+			device.Nameservers = existing.Nameservers
+		}
+	}
+}
+
+// overrideWithFailureDomain applies the placement of a deployment zone and
+// the topology of its failure domain to the provided clone spec. Only the
+// values defined by the deployment zone and failure domain are overridden.
+func overrideWithFailureDomain(spec *infrav1.VirtualMachineCloneSpec, deploymentZone *infrav1.VSphereDeploymentZone, failureDomain *infrav1.VSphereFailureDomain) {
+	if deploymentZone.Spec.Server != "" {
+		spec.Server = deploymentZone.Spec.Server
+	}
+	if failureDomain.Spec.Topology.Datacenter != "" {
+		spec.Datacenter = failureDomain.Spec.Topology.Datacenter
+	}
+
+	placementConstraint := deploymentZone.Spec.PlacementConstaint
+	if placementConstraint.ResourcePool != "" {
+		spec.ResourcePool = placementConstraint.ResourcePool
+	}
+	if placementConstraint.Datastore != "" {
+		spec.Datastore = placementConstraint.Datastore
+	}
+	if placementConstraint.Folder != "" {
+		spec.Folder = placementConstraint.Folder
+	}
+
+	// The networks of the deployment zone replace the networks of the
+	// devices at the same index, and devices are added for any additional
+	// networks.
+	for i, network := range placementConstraint.Network {
+		if i >= len(spec.Network.Devices) {
+			spec.Network.Devices = append(spec.Network.Devices, infrav1.NetworkDeviceSpec{})
+		}
+		device := &spec.Network.Devices[i]
+		device.NetworkName = network.NetworkName
+		if network.DHCP4 != nil {
+			device.DHCP4 = *network.DHCP4
+		}
+		if network.DHCP6 != nil {
+			device.DHCP6 = *network.DHCP6
+		}
+	}
+}
+
 func (r machineReconciler) reconcileNetwork(ctx *context.MachineContext, vm *unstructured.Unstructured) (bool, error) {
 	var errs []error
 	if networkStatusListOfIfaces, ok, _ := unstructured.NestedSlice(vm.Object, "status", "network"); ok {
@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"k8s.io/utils/pointer"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+)
+
+func TestOverrideWithFailureDomain(t *testing.T) {
+	failureDomain := &infrav1.VSphereFailureDomain{
+		Spec: infrav1.VSphereFailureDomainSpec{
+			Topology: infrav1.Topology{
+				Datacenter:     "dc-a",
+				ComputeCluster: pointer.String("cluster-a"),
+			},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		spec           infrav1.VirtualMachineCloneSpec
+		deploymentZone *infrav1.VSphereDeploymentZone
+		expected       infrav1.VirtualMachineCloneSpec
+	}{
+		{
+			name: "overrides the placement defined by the deployment zone",
+			spec: infrav1.VirtualMachineCloneSpec{
+				Server:       "vcenter",
+				Datacenter:   "dc",
+				Datastore:    "ds",
+				Folder:       "folder",
+				ResourcePool: "rp",
+				Template:     "template",
+			},
+			deploymentZone: &infrav1.VSphereDeploymentZone{
+				Spec: infrav1.VSphereDeploymentZoneSpec{
+					Server: "vcenter-a",
+					PlacementConstaint: infrav1.PlacementConstraint{
+						ResourcePool: "rp-a",
+						Datastore:    "ds-a",
+						Folder:       "folder-a",
+					},
+				},
+			},
+			expected: infrav1.VirtualMachineCloneSpec{
+				Server:       "vcenter-a",
+				Datacenter:   "dc-a",
+				Datastore:    "ds-a",
+				Folder:       "folder-a",
+				ResourcePool: "rp-a",
+				Template:     "template",
+			},
+		},
+		{
+			name: "keeps the values not defined by the deployment zone",
+			spec: infrav1.VirtualMachineCloneSpec{
+				Server:    "vcenter",
+				Datastore: "ds",
+				Folder:    "folder",
+			},
+			deploymentZone: &infrav1.VSphereDeploymentZone{
+				Spec: infrav1.VSphereDeploymentZoneSpec{
+					PlacementConstaint: infrav1.PlacementConstraint{
+						ResourcePool: "rp-a",
+					},
+				},
+			},
+			expected: infrav1.VirtualMachineCloneSpec{
+				Server:       "vcenter",
+				Datacenter:   "dc-a",
+				Datastore:    "ds",
+				Folder:       "folder",
+				ResourcePool: "rp-a",
+			},
+		},
+		{
+			name: "replaces the networks of the devices and adds missing devices",
+			spec: infrav1.VirtualMachineCloneSpec{
+				Network: infrav1.NetworkSpec{
+					Devices: []infrav1.NetworkDeviceSpec{
+						{NetworkName: "nw", DHCP4: true, IPAddrs: []string{"192.168.1.2/24"}},
+					},
+				},
+			},
+			deploymentZone: &infrav1.VSphereDeploymentZone{
+				Spec: infrav1.VSphereDeploymentZoneSpec{
+					PlacementConstaint: infrav1.PlacementConstraint{
+						Network: []infrav1.Network{
+							{NetworkName: "nw-a"},
+							{NetworkName: "nw-b", DHCP6: pointer.Bool(true)},
+						},
+					},
+				},
+			},
+			expected: infrav1.VirtualMachineCloneSpec{
+				Datacenter: "dc-a",
+				Network: infrav1.NetworkSpec{
+					Devices: []infrav1.NetworkDeviceSpec{
+						{NetworkName: "nw-a", DHCP4: true, IPAddrs: []string{"192.168.1.2/24"}},
+						{NetworkName: "nw-b", DHCP6: true},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			overrideWithFailureDomain(&tt.spec, tt.deploymentZone, failureDomain)
+			g.Expect(tt.spec).To(Equal(tt.expected))
+		})
+	}
+}
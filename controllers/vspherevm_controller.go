@@ -27,6 +27,7 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/pkg/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
@@ -49,10 +50,12 @@ import (
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/record"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+	infrautilv1 "sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
 )
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspherevms,verbs=get;list;watch;create;update;patch;delete
@@ -182,6 +185,8 @@ func (r vmReconciler) Reconcile(ctx goctx.Context, req ctrl.Request) (_ ctrl.Res
 			conditions.WithConditions(
 				infrav1.VMProvisionedCondition,
 				infrav1.VCenterAvailableCondition,
+				infrav1.AntiAffinityRuleConfiguredCondition,
+				infrav1.GuestCustomizationSucceededCondition,
 			),
 		)
 
@@ -287,6 +292,23 @@ func (r vmReconciler) reconcileDelete(ctx *context.VMContext) (reconcile.Result,
 	// TODO(akutz) Implement selection of VM service based on vSphere version
 	var vmService services.VirtualMachineService = &govmomi.VMService{}
 
+	// Get the VM group and the anti-affinity rule the VM is removed from. A
+	// failure does not block the deletion.
+	if machine, vsphereMachine, err := r.fetchOwnerMachine(ctx); err != nil {
+		ctx.Logger.Error(err, "unable to get owner machine")
+	} else {
+		if failureDomain, err := r.fetchFailureDomain(ctx, machine, vsphereMachine); err != nil {
+			ctx.Logger.Error(err, "unable to get failure domain")
+		} else {
+			ctx.VSphereFailureDomain = failureDomain
+		}
+		if ruleName, err := r.fetchAntiAffinityRuleName(ctx, machine); err != nil {
+			ctx.Logger.Error(err, "unable to get anti-affinity rule")
+		} else {
+			ctx.AntiAffinityRuleName = ruleName
+		}
+	}
+
 	conditions.MarkFalse(ctx.VSphereVM, infrav1.VMProvisionedCondition, clusterv1.DeletingReason, clusterv1.ConditionSeverityInfo, "")
 	vm, err := vmService.DestroyVM(ctx)
 	if err != nil {
@@ -324,6 +346,29 @@ func (r vmReconciler) reconcileNormal(ctx *context.VMContext) (reconcile.Result,
 		return reconcile.Result{}, nil
 	}
 
+	machine, vsphereMachine, err := r.fetchOwnerMachine(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if machine != nil {
+		ctx.MachineName = machine.Name
+	}
+
+	// Get the failure domain of the machine owning the VM, so the VM is
+	// added to the VM group of the failure domain.
+	failureDomain, err := r.fetchFailureDomain(ctx, machine, vsphereMachine)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	ctx.VSphereFailureDomain = failureDomain
+
+	// Get the anti-affinity rule the VM is added to.
+	ruleName, err := r.fetchAntiAffinityRuleName(ctx, machine)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	ctx.AntiAffinityRuleName = ruleName
+
 	// Get or create the VM.
 	vm, err := vmService.ReconcileVM(ctx)
 	if err != nil {
@@ -336,6 +381,12 @@ func (r vmReconciler) reconcileNormal(ctx *context.VMContext) (reconcile.Result,
 			"VM state is not reconciled",
 			"expected-vm-state", infrav1.VirtualMachineStateReady,
 			"actual-vm-state", vm.State)
+
+		// The completion of the guest customization is reported by events,
+		// which do not trigger a reconcile.
+		if conditions.GetReason(ctx.VSphereVM, infrav1.GuestCustomizationSucceededCondition) == infrav1.GuestCustomizationPendingReason {
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
 		return reconcile.Result{}, nil
 	}
 
@@ -352,12 +403,20 @@ func (r vmReconciler) reconcileNormal(ctx *context.VMContext) (reconcile.Result,
 	// Update the VSphereVM's network status.
 	r.reconcileNetwork(ctx, vm)
 
-	// we didn't get any addresses, requeue
+	// we didn't get any addresses, wait for the VM to report them, which
+	// triggers a reconcile. The VM is requeued after a while anyway, in case
+	// the update is missed, e.g. while the watcher of the session restarts.
 	if len(ctx.VSphereVM.Status.Addresses) == 0 {
-		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		ctx.Logger.Info("waiting for the VM to report IP addresses")
+		return reconcile.Result{RequeueAfter: time.Minute}, nil
 	}
 
 	// Once the network is online the VM is considered ready.
+	if !conditions.IsTrue(ctx.VSphereVM, infrav1.VMProvisionedCondition) {
+		metrics.VMProvisioningDuration.
+			WithLabelValues(ctx.VSphereVM.Spec.Server, ctx.VSphereVM.Spec.Datacenter).
+			Observe(time.Since(ctx.VSphereVM.CreationTimestamp.Time).Seconds())
+	}
 	ctx.VSphereVM.Status.Ready = true
 	conditions.MarkTrue(ctx.VSphereVM, infrav1.VMProvisionedCondition)
 	ctx.Logger.Info("VSphereVM is ready")
@@ -370,9 +429,14 @@ func (r vmReconciler) reconcileNormal(ctx *context.VMContext) (reconcile.Result,
 // It checks the state of both DHCP4 and DHCP6 for all the network devices and if
 // any static IP addresses are specified.
 func (r vmReconciler) isWaitingForStaticIPAllocation(ctx *context.VMContext) bool {
-	devices := ctx.VSphereVM.Spec.Network.Devices
-	for _, dev := range devices {
+	network := &ctx.VSphereVM.Spec.Network
+	for i, dev := range network.Devices {
 		if !dev.DHCP4 && !dev.DHCP6 && len(dev.IPAddrs) == 0 {
+			// A device linked to a bond, a bridge or a VLAN does not
+			// require an address of its own.
+			if dev.IPPoolRef == nil && network.IsLinked(network.DeviceName(i)) {
+				continue
+			}
 			// Static IP is not available yet
 			return true
 		}
@@ -381,6 +445,92 @@ func (r vmReconciler) isWaitingForStaticIPAllocation(ctx *context.VMContext) boo
 	return false
 }
 
+// fetchOwnerMachine returns the Machine and the VSphereMachine owning the
+// VSphereVM. Nil is returned if the VSphereVM is not owned by a
+// VSphereMachine or if the VSphereMachine is not owned by a Machine.
+func (r vmReconciler) fetchOwnerMachine(ctx *context.VMContext) (*clusterv1.Machine, *infrav1.VSphereMachine, error) {
+	var vsphereMachineName string
+	for _, ref := range ctx.VSphereVM.OwnerReferences {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to parse owner reference %s for %s", ref.Name, ctx)
+		}
+		if gv.Group == infrav1.GroupVersion.Group && ref.Kind == "VSphereMachine" {
+			vsphereMachineName = ref.Name
+			break
+		}
+	}
+	if vsphereMachineName == "" {
+		return nil, nil, nil
+	}
+
+	vsphereMachine := &infrav1.VSphereMachine{}
+	vsphereMachineKey := client.ObjectKey{Namespace: ctx.VSphereVM.Namespace, Name: vsphereMachineName}
+	if err := ctx.Client.Get(ctx, vsphereMachineKey, vsphereMachine); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get VSphereMachine %s for %s", vsphereMachineKey, ctx)
+	}
+	machine, err := clusterutilv1.GetOwnerMachine(ctx, ctx.Client, vsphereMachine.ObjectMeta)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get owner Machine of VSphereMachine %s for %s", vsphereMachineKey, ctx)
+	}
+	if machine == nil {
+		return nil, nil, nil
+	}
+	return machine, vsphereMachine, nil
+}
+
+// fetchFailureDomain returns the VSphereFailureDomain of the machine owning
+// the VSphereVM. Nil is returned if the VSphereVM is not owned by a machine
+// or if the machine does not have a failure domain.
+func (r vmReconciler) fetchFailureDomain(ctx *context.VMContext, machine *clusterv1.Machine, vsphereMachine *infrav1.VSphereMachine) (*infrav1.VSphereFailureDomain, error) {
+	if machine == nil {
+		return nil, nil
+	}
+
+	_, failureDomain, err := getFailureDomain(ctx, ctx.Client, machine, vsphereMachine)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get failure domain for %s", ctx)
+	}
+	return failureDomain, nil
+}
+
+// fetchAntiAffinityRuleName returns the name of the DRS anti-affinity rule
+// of the machine owning the VSphereVM, which is shared by the control plane
+// machines of the cluster, or by the machines of a MachineDeployment when
+// enabled by the VSphereCluster. An empty name is returned if the VSphereVM
+// is not a member of any rule.
+func (r vmReconciler) fetchAntiAffinityRuleName(ctx *context.VMContext, machine *clusterv1.Machine) (string, error) {
+	if machine == nil {
+		return "", nil
+	}
+
+	cluster, err := clusterutilv1.GetClusterFromMetadata(ctx, ctx.Client, machine.ObjectMeta)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get cluster of Machine %s/%s for %s", machine.Namespace, machine.Name, ctx)
+	}
+	if cluster.Spec.InfrastructureRef == nil {
+		return "", nil
+	}
+	vsphereCluster := &infrav1.VSphereCluster{}
+	vsphereClusterKey := client.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Spec.InfrastructureRef.Name}
+	if err := ctx.Client.Get(ctx, vsphereClusterKey, vsphereCluster); err != nil {
+		return "", errors.Wrapf(err, "failed to get VSphereCluster %s for %s", vsphereClusterKey, ctx)
+	}
+
+	antiAffinity := vsphereCluster.Spec.VMAntiAffinity
+	if antiAffinity != nil && antiAffinity.Disabled {
+		return "", nil
+	}
+	if infrautilv1.IsControlPlaneMachine(machine) {
+		return fmt.Sprintf("capv-%s-%s-control-plane", cluster.Namespace, cluster.Name), nil
+	}
+	machineDeployment := machine.Labels[clusterv1.MachineDeploymentLabelName]
+	if antiAffinity != nil && antiAffinity.MachineDeployments && machineDeployment != "" {
+		return fmt.Sprintf("capv-%s-%s-%s", cluster.Namespace, cluster.Name, machineDeployment), nil
+	}
+	return "", nil
+}
+
 func (r vmReconciler) reconcileNetwork(ctx *context.VMContext, vm infrav1.VirtualMachine) {
 	ctx.VSphereVM.Status.Network = vm.Network
 	ipAddrs := make([]string, 0, len(vm.Network))
@@ -30,11 +30,13 @@ import (
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 	ctrlmgr "sigs.k8s.io/controller-runtime/pkg/manager"
 	ctrlsig "sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	"sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
 	"sigs.k8s.io/cluster-api-provider-vsphere/controllers"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/constants"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/haproxy"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/manager"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/version"
 )
@@ -153,6 +155,13 @@ func main() {
 	// manager.
 	addToManager := func(ctx *context.ControllerManagerContext, mgr ctrlmgr.Manager) error {
 
+		if err := (&v1alpha4.HAProxyLoadBalancer{}).SetupWebhookWithManager(mgr); err != nil {
+			return err
+		}
+		mgr.GetWebhookServer().Register(haproxy.ConfigurationTemplateWebhookPath, &webhook.Admission{
+			Handler: &haproxy.ConfigurationTemplateValidator{},
+		})
+
 		if err := (&v1alpha4.VSphereCluster{}).SetupWebhookWithManager(mgr); err != nil {
 			return err
 		}
@@ -196,6 +205,12 @@ func main() {
 		if err := controllers.AddVsphereClusterIdentityControllerToManager(ctx, mgr); err != nil {
 			return err
 		}
+		if err := controllers.AddVSphereDeploymentZoneControllerToManager(ctx, mgr); err != nil {
+			return err
+		}
+		if err := controllers.AddVSphereIPPoolControllerToManager(ctx, mgr); err != nil {
+			return err
+		}
 
 		return nil
 	}
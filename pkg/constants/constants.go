@@ -56,4 +56,8 @@ const (
 
 	// KeepaliveDuration unit minutes
 	DefaultKeepAliveDuration = time.Minute * 5
+
+	// DefaultSessionIdleTimeout is the duration after which a cached vSphere
+	// session which has not been used is logged out and evicted.
+	DefaultSessionIdleTimeout = time.Minute * 30
 )
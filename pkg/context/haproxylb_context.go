@@ -21,6 +21,7 @@ import (
 
 	"github.com/go-logr/logr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
@@ -42,6 +43,16 @@ func (c *HAProxyLoadBalancerContext) String() string {
 
 // Patch updates the object and its status on the API server.
 func (c *HAProxyLoadBalancerContext) Patch() error {
+	// always update the readyCondition.
+	conditions.SetSummary(c.HAProxyLoadBalancer,
+		conditions.WithConditions(
+			infrav1.VMProvisionedCondition,
+			infrav1.DataplaneAPIAvailableCondition,
+			infrav1.LoadBalancerConfiguredCondition,
+			infrav1.BackendsAvailableCondition,
+		),
+		conditions.WithStepCounterIf(c.HAProxyLoadBalancer.ObjectMeta.DeletionTimestamp.IsZero()),
+	)
 	return c.PatchHelper.Patch(c, c.HAProxyLoadBalancer)
 }
 
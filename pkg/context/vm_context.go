@@ -33,6 +33,18 @@ type VMContext struct {
 	PatchHelper *patch.Helper
 	Logger      logr.Logger
 	Session     *session.Session
+
+	// VSphereFailureDomain is the failure domain of the machine owning the
+	// VSphereVM. It is nil if the machine does not have a failure domain.
+	VSphereFailureDomain *infrav1.VSphereFailureDomain
+
+	// AntiAffinityRuleName is the name of the DRS anti-affinity rule the VM
+	// is a member of. It is empty if the VM is not a member of any rule.
+	AntiAffinityRuleName string
+
+	// MachineName is the name of the Machine owning the VSphereVM. It is
+	// empty if the VSphereVM is not owned by a Machine.
+	MachineName string
 }
 
 // String returns VSphereVMGroupVersionKind VSphereVMNamespace/VSphereVMName.
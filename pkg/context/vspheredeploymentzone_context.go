@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package context
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// VSphereDeploymentZoneContext is a Go context used with a VSphereDeploymentZone.
+type VSphereDeploymentZoneContext struct {
+	*ControllerContext
+	VSphereDeploymentZone *infrav1.VSphereDeploymentZone
+	VSphereFailureDomain  *infrav1.VSphereFailureDomain
+	PatchHelper           *patch.Helper
+	Logger                logr.Logger
+	Session               *session.Session
+}
+
+// String returns VSphereDeploymentZoneGroupVersionKind VSphereDeploymentZoneName.
+func (c *VSphereDeploymentZoneContext) String() string {
+	return fmt.Sprintf("%s %s", c.VSphereDeploymentZone.GroupVersionKind(), c.VSphereDeploymentZone.Name)
+}
+
+// Patch updates the object and its status on the API server.
+func (c *VSphereDeploymentZoneContext) Patch() error {
+	conditions.SetSummary(c.VSphereDeploymentZone,
+		conditions.WithConditions(
+			infrav1.VCenterAvailableCondition,
+			infrav1.VSphereFailureDomainValidatedCondition,
+			infrav1.PlacementConstraintMetCondition,
+		),
+	)
+	return c.PatchHelper.Patch(c, c.VSphereDeploymentZone)
+}
+
+// GetLogger returns this context's logger.
+func (c *VSphereDeploymentZoneContext) GetLogger() logr.Logger {
+	return c.Logger
+}
+
+// GetSession returns this context's session.
+func (c *VSphereDeploymentZoneContext) GetSession() *session.Session {
+	return c.Session
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package context
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+)
+
+// VSphereIPPoolContext is a Go context used with a VSphereIPPool.
+type VSphereIPPoolContext struct {
+	*ControllerContext
+	VSphereIPPool *infrav1.VSphereIPPool
+	PatchHelper   *patch.Helper
+	Logger        logr.Logger
+}
+
+// String returns VSphereIPPoolGroupVersionKind VSphereIPPoolNamespace/VSphereIPPoolName.
+func (c *VSphereIPPoolContext) String() string {
+	return fmt.Sprintf("%s %s/%s", c.VSphereIPPool.GroupVersionKind(), c.VSphereIPPool.Namespace, c.VSphereIPPool.Name)
+}
+
+// Patch updates the object and its status on the API server.
+func (c *VSphereIPPoolContext) Patch() error {
+	conditions.SetSummary(c.VSphereIPPool,
+		conditions.WithConditions(
+			infrav1.IPAddressesAvailableCondition,
+		),
+	)
+	return c.PatchHelper.Patch(c, c.VSphereIPPool)
+}
+
+// GetLogger returns this context's logger.
+func (c *VSphereIPPoolContext) GetLogger() logr.Logger {
+	return c.Logger
+}
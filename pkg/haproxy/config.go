@@ -18,19 +18,27 @@ package haproxy
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/pkg/errors"
 	"sigs.k8s.io/yaml"
 
 	corev1 "k8s.io/api/core/v1"
+	utilnet "k8s.io/utils/net"
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
 )
 
 const (
 	defaultAPIServerPort = 6443
 
+	defaultVirtualRouterID = 51
+
+	// keepalivedPasswordLength is the maximum length of a VRRP password.
+	keepalivedPasswordLength = 8
+
 	// This template is based upon
 	// https://github.com/kubernetes-sigs/kubespray/blob/7f74906d332942093ddbc1596497e9e2dd8eb7c2/roles/kubernetes/node/templates/loadbalancer/haproxy.cfg.j2
 	// NOTE: The configuration is order-dependent.
@@ -74,10 +82,16 @@ frontend healthz
 
 frontend kube_api_frontend
   mode tcp
-  bind *:{{.Port | printf "%d"}} name lb
+  bind {{ if .IPv6 }}:::{{.Port | printf "%d"}} v4v6{{ else }}*:{{.Port | printf "%d"}}{{ end }} name lb
   option tcplog
   default_backend kube_api_backend
-
+{{range .Frontends}}
+frontend {{ .Name }}_frontend
+  mode tcp
+  bind {{ if $.IPv6 }}:::{{ .Port }} v4v6{{ else }}*:{{ .Port }}{{ end }} name {{ .Name }}
+  option tcplog
+  default_backend {{ .Name }}_backend
+{{end}}
 frontend stats
   bind *:8404
   stats enable
@@ -90,16 +104,75 @@ backend kube_api_backend
   mode tcp
   balance first
   option httpchk GET /readyz
-  default-server inter 10s downinter 10s rise 5 fall 3 slowstart 120s maxconn 1000 maxqueue 256 weight 100{{range .Addresses}}
-  server {{ .NodeName }} {{ .IP }}:{{ $port }} check check-ssl verify none{{end}}
+  default-server check-ssl verify none slowstart 120s {{ .DefaultServer }}{{range .Addresses}}
+  server {{ .NodeName }} {{ .IP }}:{{ $port }} check{{end}}
   http-check expect status 200
-
+{{range .Frontends}}{{ $backendPort := .BackendPort }}
+backend {{ .Name }}_backend
+  mode tcp
+  balance roundrobin
+  default-server {{ $.DefaultServer }}{{range .Addresses}}
+  server {{ .NodeName }} {{ .IP }}:{{ $backendPort }} check{{end}}
+{{end}}
 program api
-  command dataplaneapi --scheme=https --haproxy-bin=/usr/sbin/haproxy --config-file=/etc/haproxy/haproxy.cfg --reload-cmd="/usr/bin/systemctl reload haproxy" --reload-delay=5 --tls-host=0.0.0.0 --tls-port=5556 --tls-ca=/etc/haproxy/ca.crt --tls-certificate=/etc/haproxy/server.crt --tls-key=/etc/haproxy/server.key --userlist=controller
+  command dataplaneapi --scheme=https --haproxy-bin=/usr/sbin/haproxy --config-file=/etc/haproxy/haproxy.cfg --reload-cmd="/usr/bin/systemctl reload haproxy" --reload-delay=5 --tls-host={{ if .IPv6 }}::{{ else }}0.0.0.0{{ end }} --tls-port=5556 --tls-ca=/etc/haproxy/ca.crt --tls-certificate=/etc/haproxy/server.crt --tls-key=/etc/haproxy/server.key --userlist=controller
   no option start-on-reload
 `
 )
 
+// defaultServer is the default server of the backends of the load balancer,
+// whether they are rendered in haproxy.cfg or created through the dataplane
+// API.
+var defaultServer = DefaultServer{
+	Inter:     10 * time.Second,
+	Downinter: 10 * time.Second,
+	Rise:      5,
+	Fall:      3,
+	Maxconn:   1000,
+	Maxqueue:  256,
+	Weight:    100,
+}
+
+// keepalivedConfigurationTemplate moves the virtual IP between the replicas
+// of the load balancer, to one whose HAProxy is healthy. The interface is
+// replaced with the one of the default route when the VM is bootstrapped.
+const keepalivedConfigurationTemplate = `
+global_defs {
+  enable_script_security
+  script_user root
+}
+
+vrrp_script chk_haproxy {
+  script "/usr/bin/curl -sf http://127.0.0.1:8081/healthz"
+  interval 2
+  fall 2
+  rise 2
+}
+
+vrrp_instance haproxy {
+  state BACKUP
+  interface __INTERFACE__
+  virtual_router_id {{ .VirtualRouterID }}
+  priority 100
+  advert_int 1
+{{- if .IPv6 }}
+  version 3
+  native_ipv6
+{{- else }}
+  authentication {
+    auth_type PASS
+    auth_pass {{ .Password }}
+  }
+{{- end }}
+  virtual_ipaddress {
+    {{ .VirtualIP }}
+  }
+  track_script {
+    chk_haproxy
+  }
+}
+`
+
 var haproxyLoadBalancerBootstrapTemplateFormat = `## template: jinja
 #cloud-config
 
@@ -119,6 +192,62 @@ write_files:
   permissions: "0440"
   content: |
 {{ .CertificateAuthorityKey | BytesIndent 4 }}
+- path: /etc/haproxy/renew-certs.sh
+  owner: root:root
+  permissions: "0750"
+  content: |
+    #!/bin/sh
+    # Renews the certificates of the load balancer before they expire. The
+    # signing certificate is self-signed again with its key and subject, as
+    # done by the controller, so the certificates signed with it remain valid.
+    set -e
+    renew_before={{ .CertificateRenewBefore.Seconds | printf "%.0f" }}
+    restart=
+    if ! openssl x509 -checkend "${renew_before}" -noout -in /etc/haproxy/ca.crt; then
+      openssl x509 -in /etc/haproxy/ca.crt -signkey /etc/haproxy/ca.key -days 3650 -out /etc/haproxy/ca.crt.new
+      mv /etc/haproxy/ca.crt.new /etc/haproxy/ca.crt
+      chown haproxy:haproxy /etc/haproxy/ca.crt
+      restart=1
+    fi
+    if [ -n "${restart}" ] || ! openssl x509 -checkend "${renew_before}" -noout -in /etc/haproxy/server.crt; then
+      new-cert.sh -1 /etc/haproxy/ca.crt -2 /etc/haproxy/ca.key -3 "{{ template "certificateIPAddresses" . }}" -4 "localhost" "{{ .Hostname }}" /etc/haproxy
+      restart=1
+    fi
+    # Restart HAProxy for the dataplane API to load the new certificates.
+    if [ -n "${restart}" ]; then
+      systemctl restart haproxy
+    fi
+- path: /etc/systemd/system/haproxy-renew-certs.service
+  owner: root:root
+  permissions: "0644"
+  content: |
+    [Unit]
+    Description=Renew the certificates of the HAProxy dataplane API
+
+    [Service]
+    Type=oneshot
+    ExecStart=/etc/haproxy/renew-certs.sh
+- path: /etc/systemd/system/haproxy-renew-certs.timer
+  owner: root:root
+  permissions: "0644"
+  content: |
+    [Unit]
+    Description=Renew the certificates of the HAProxy dataplane API daily
+
+    [Timer]
+    OnCalendar=daily
+    RandomizedDelaySec=1h
+    Persistent=true
+
+    [Install]
+    WantedBy=timers.target
+{{- if .Keepalived }}
+- path: /etc/keepalived/keepalived.conf
+  owner: root:root
+  permissions: "0600"
+  content: |
+{{ .KeepalivedConfiguration | Indent 4 }}
+{{- end }}
 
 runcmd:
 - "hostname \"{{ .Hostname }}\""
@@ -127,7 +256,13 @@ runcmd:
 - "echo \"127.0.0.1   localhost {{ .Hostname }}\" >>/etc/hosts"
 - "echo \"127.0.0.1   {{ .Hostname }}\" >>/etc/hosts"
 - "echo \"{{ .Hostname }}\" >/etc/hostname"
-- "new-cert.sh -1 /etc/haproxy/ca.crt -2 /etc/haproxy/ca.key -3 \"127.0.0.1,{{ .IPv4Address }}\" -4 \"localhost\" \"{{ .Hostname }}\" /etc/haproxy"
+- "new-cert.sh -1 /etc/haproxy/ca.crt -2 /etc/haproxy/ca.key -3 \"{{ template "certificateIPAddresses" . }}\" -4 \"localhost\" \"{{ .Hostname }}\" /etc/haproxy"
+- "systemctl daemon-reload"
+- "systemctl enable --now haproxy-renew-certs.timer"
+{{- if .Keepalived }}
+- 'sed -i "s/__INTERFACE__/$(ip {{ if .Keepalived.IPv6 }}-6{{ else }}-4{{ end }} route show default | awk ''{print $5; exit}'')/" /etc/keepalived/keepalived.conf'
+- "systemctl enable --now keepalived"
+{{- end }}
 
 {{- if .SSHUser }}
 users:
@@ -140,6 +275,9 @@ users:
   {{- end }}
   {{- end }}
 {{- end }}
+{{- define "certificateIPAddresses" -}}
+127.0.0.1,::1{% if ds.meta_data.local_ipv4 %},{{ .IPv4Address }}{% endif %}{% if ds.meta_data.local_ipv6 %},{{ .IPv6Address }}{% endif %}
+{{- end }}
 `
 
 // DataplaneConfig contains the information required to communicate with an
@@ -211,23 +349,127 @@ type RenderConfiguration struct {
 	// Hostname is the hostname of the load balancer
 	Hostname string
 
-	// IPv4Address is the hostname of the load balancer
+	// IPv4Address is the IPv4 address of the load balancer
 	IPv4Address string
 
+	// IPv6Address is the IPv6 address of the load balancer
+	IPv6Address string
+
+	// IPv6 is whether the load balancer listens on IPv6 as well as IPv4,
+	// which is the case in an IPv6 or dual-stack cluster
+	IPv6 bool
+
 	// HAProxyConfiguration is the string for haproxy.cfg for use only in CloudInit
 	HAProxyConfiguration string
 
+	// Keepalived is the configuration of the VRRP instance sharing the
+	// virtual IP between the replicas of the load balancer
+	Keepalived *KeepalivedConfig
+
+	// KeepalivedConfiguration is the string for keepalived.conf for use only
+	// in CloudInit
+	KeepalivedConfiguration string
+
 	// Addresses of the machines backing the control plane
 	Addresses []corev1.EndpointAddress
 
-	// The load balancer port. Is not currently configurable.
+	// Port is the port on which the load balancer and the machines backing
+	// the control plane serve the API server.
+	Port uint32
+
+	// Frontends are the additional TCP frontends of the load balancer.
+	Frontends []Frontend
+
+	// CertificateRenewBefore is how long before they expire the load
+	// balancer VM renews its certificates.
+	CertificateRenewBefore time.Duration
+
+	// ConfigurationTemplate is the Go template of haproxy.cfg. Defaults to
+	// the built-in template.
+	ConfigurationTemplate string
+}
+
+// Frontend represents data required to render an additional TCP frontend
+// and its backend.
+type Frontend struct {
+	// Name is the name of the frontend
+	Name string
+
+	// Port is the port on which the frontend accepts connections
 	Port uint32
+
+	// BackendPort is the port of the machines the connections are forwarded to
+	BackendPort uint32
+
+	// Addresses of the machines the connections are forwarded to
+	Addresses []corev1.EndpointAddress
+}
+
+// DefaultServer represents the parameters shared by the servers of a
+// backend.
+type DefaultServer struct {
+	// Inter is the interval between the health checks of a server
+	Inter time.Duration
+
+	// Downinter is the interval between the health checks of a server which
+	// is down
+	Downinter time.Duration
+
+	// Rise is the number of successful health checks after which a server is
+	// up
+	Rise int32
+
+	// Fall is the number of failed health checks after which a server is
+	// down
+	Fall int32
+
+	// Maxconn is the maximum number of connections to a server
+	Maxconn int32
+
+	// Maxqueue is the maximum number of connections queued for a server
+	Maxqueue int32
+
+	// Weight is the weight of a server in the load balancing
+	Weight int32
+}
+
+// String returns the parameters of a default-server line of haproxy.cfg.
+func (s DefaultServer) String() string {
+	return fmt.Sprintf("inter %s downinter %s rise %d fall %d maxconn %d maxqueue %d weight %d",
+		haproxyDuration(s.Inter), haproxyDuration(s.Downinter), s.Rise, s.Fall, s.Maxconn, s.Maxqueue, s.Weight)
+}
+
+// haproxyDuration returns a duration in the time format of haproxy.cfg.
+func haproxyDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
+
+// KeepalivedConfig represents data required to render the keepalived
+// configuration.
+type KeepalivedConfig struct {
+	// VirtualIP is the IP address shared by the replicas
+	VirtualIP string
+
+	// VirtualRouterID is the VRRP virtual router ID of the replicas
+	VirtualRouterID int32
+
+	// Password authenticates the VRRP advertisements of the replicas. VRRP
+	// version 3, which is used for an IPv6 virtual IP, does not support
+	// authentication.
+	Password string
+
+	// IPv6 is whether the virtual IP is an IPv6 address
+	IPv6 bool
 }
 
 // NewRenderConfiguration returns a new RenderConfiguration
 func NewRenderConfiguration() RenderConfiguration {
 	return RenderConfiguration{
-		Port: defaultAPIServerPort,
+		Port:                   defaultAPIServerPort,
+		CertificateRenewBefore: DefaultCertificateRenewBefore,
 	}
 }
 
@@ -241,7 +483,27 @@ func (c RenderConfiguration) WithBootstrapInfo(haProxyLoadBalancer infrav1.HAPro
 	c.SSHUser = haProxyLoadBalancer.Spec.User
 	c.Hostname = "{{ ds.meta_data.hostname }}"
 	c.IPv4Address = "{{ ds.meta_data.local_ipv4 }}"
+	c.IPv6Address = "{{ ds.meta_data.local_ipv6 }}"
 	c.CertificateAuthorityKey = signingCertificateKey
+	c.Port = APIServerPort(haProxyLoadBalancer)
+	for _, frontend := range haProxyLoadBalancer.Spec.Frontends {
+		c = c.WithFrontend(frontend, nil)
+	}
+	if haProxyLoadBalancer.Spec.VirtualIP != "" {
+		virtualRouterID := int32(defaultVirtualRouterID)
+		if haProxyLoadBalancer.Spec.VirtualRouterID != nil {
+			virtualRouterID = *haProxyLoadBalancer.Spec.VirtualRouterID
+		}
+		if len(password) > keepalivedPasswordLength {
+			password = password[:keepalivedPasswordLength]
+		}
+		c.Keepalived = &KeepalivedConfig{
+			VirtualIP:       haProxyLoadBalancer.Spec.VirtualIP,
+			VirtualRouterID: virtualRouterID,
+			Password:        password,
+			IPv6:            utilnet.IsIPv6String(haProxyLoadBalancer.Spec.VirtualIP),
+		}
+	}
 	return c
 }
 
@@ -256,6 +518,56 @@ func (c RenderConfiguration) WithAddresses(addr []corev1.EndpointAddress) Render
 	return c
 }
 
+// WithPort sets the port on which the API server is served
+func (c RenderConfiguration) WithPort(port uint32) RenderConfiguration {
+	c.Port = port
+	return c
+}
+
+// WithIPv6 sets whether the load balancer listens on IPv6 as well as IPv4
+func (c RenderConfiguration) WithIPv6(ipv6 bool) RenderConfiguration {
+	c.IPv6 = ipv6
+	return c
+}
+
+// WithConfigurationTemplate sets the Go template of haproxy.cfg, the
+// built-in template being used if it is empty
+func (c RenderConfiguration) WithConfigurationTemplate(tpl string) RenderConfiguration {
+	c.ConfigurationTemplate = tpl
+	return c
+}
+
+// WithFrontend adds a TCP frontend forwarding connections to the provided
+// endpoints to the RenderConfiguration
+func (c RenderConfiguration) WithFrontend(frontend infrav1.HAProxyFrontend, addr []corev1.EndpointAddress) RenderConfiguration {
+	backendPort := uint32(frontend.Port)
+	if frontend.Backend.Port != nil {
+		backendPort = uint32(*frontend.Backend.Port)
+	}
+	c.Frontends = append(c.Frontends[:len(c.Frontends):len(c.Frontends)], Frontend{
+		Name:        frontend.Name,
+		Port:        uint32(frontend.Port),
+		BackendPort: backendPort,
+		Addresses:   addr,
+	})
+	return c
+}
+
+// DefaultServer returns the parameters of the default server of the
+// backends, for use in the HAProxy configuration template.
+func (c RenderConfiguration) DefaultServer() DefaultServer {
+	return defaultServer
+}
+
+// APIServerPort returns the port on which the load balancer serves the API
+// server.
+func APIServerPort(haProxyLoadBalancer infrav1.HAProxyLoadBalancer) uint32 {
+	if haProxyLoadBalancer.Spec.APIServerPort != nil {
+		return uint32(*haProxyLoadBalancer.Spec.APIServerPort)
+	}
+	return defaultAPIServerPort
+}
+
 // LoadConfig returns the configuration for an HAProxy dataplane API client
 // from the provided, raw configuration YAML.
 func LoadDataplaneConfig(data []byte) (DataplaneConfig, error) {
@@ -278,6 +590,14 @@ func (c *RenderConfiguration) BootstrapDataForLoadBalancer() ([]byte, error) {
 
 	c.HAProxyConfiguration = haProxyConfiguration
 
+	if c.Keepalived != nil {
+		keepalivedConfiguration, err := c.RenderKeepalivedConfiguration()
+		if err != nil {
+			return nil, err
+		}
+		c.KeepalivedConfiguration = keepalivedConfiguration
+	}
+
 	tpl := template.Must(template.
 		New("bootstrapTemplate").
 		Funcs(template.FuncMap{
@@ -296,16 +616,33 @@ func (c *RenderConfiguration) BootstrapDataForLoadBalancer() ([]byte, error) {
 
 // RenderHAProxyConfiguration generates a haproxy.cfg file
 func (c *RenderConfiguration) RenderHAProxyConfiguration() (string, error) {
-	tpl := template.Must(
-		template.
-			New("haproxyTemplate").
-			Funcs(template.FuncMap{
-				"Indent":      templateStringLinesIndent,
-				"BytesIndent": templateByteLinesIndent,
-			}).
-			Parse(haproxyConfigurationTemplate))
+	text := c.ConfigurationTemplate
+	if text == "" {
+		text = haproxyConfigurationTemplate
+	}
+	tpl, err := template.
+		New("haproxyTemplate").
+		Funcs(template.FuncMap{
+			"Indent":      templateStringLinesIndent,
+			"BytesIndent": templateByteLinesIndent,
+		}).
+		Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse HAProxy configuration template")
+	}
 	buf := &bytes.Buffer{}
 	if err := tpl.Execute(buf, c); err != nil {
+		return "", errors.Wrap(err, "failed to render HAProxy configuration template")
+	}
+
+	return buf.String(), nil
+}
+
+// RenderKeepalivedConfiguration generates a keepalived.conf file
+func (c *RenderConfiguration) RenderKeepalivedConfiguration() (string, error) {
+	tpl := template.Must(template.New("keepalivedTemplate").Parse(keepalivedConfigurationTemplate))
+	buf := &bytes.Buffer{}
+	if err := tpl.Execute(buf, c.Keepalived); err != nil {
 		return "", err
 	}
 
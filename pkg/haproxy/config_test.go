@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy_test
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/haproxy"
+)
+
+func TestRenderHAProxyConfigurationFrontends(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	controlPlane := []corev1.EndpointAddress{
+		{IP: "192.168.0.10", NodeName: pointer.StringPtr("control-plane-0")},
+	}
+	workers := []corev1.EndpointAddress{
+		{IP: "192.168.0.20", NodeName: pointer.StringPtr("worker-0")},
+		{IP: "192.168.0.21", NodeName: pointer.StringPtr("worker-1")},
+	}
+	renderConfig := haproxy.NewRenderConfiguration().
+		WithDataPlaneConfig(haproxy.DataplaneConfig{Username: "client", Password: "cert"}).
+		WithPort(443).
+		WithAddresses(controlPlane).
+		WithFrontend(infrav1.HAProxyFrontend{Name: "konnectivity", Port: 8132}, controlPlane).
+		WithFrontend(infrav1.HAProxyFrontend{Name: "ingress", Port: 80, Backend: infrav1.HAProxyBackend{
+			Port: pointer.Int32Ptr(30080),
+		}}, workers)
+
+	haproxyCfg, err := renderConfig.RenderHAProxyConfiguration()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// The API server is served on the configured port of the load balancer
+	// and of the control plane machines.
+	g.Expect(haproxyCfg).To(gomega.ContainSubstring("bind *:443 name lb\n"))
+	g.Expect(haproxyCfg).To(gomega.ContainSubstring("server control-plane-0 192.168.0.10:443 check\n"))
+
+	// Each frontend forwards the connections to its own backend, on the port
+	// of the frontend unless the backend sets its own.
+	g.Expect(haproxyCfg).To(gomega.ContainSubstring(`
+frontend konnectivity_frontend
+  mode tcp
+  bind *:8132 name konnectivity
+  option tcplog
+  default_backend konnectivity_backend
+`))
+	g.Expect(haproxyCfg).To(gomega.ContainSubstring(`
+backend konnectivity_backend
+  mode tcp
+  balance roundrobin
+  default-server inter 10s downinter 10s rise 5 fall 3 maxconn 1000 maxqueue 256 weight 100
+  server control-plane-0 192.168.0.10:8132 check
+`))
+	g.Expect(haproxyCfg).To(gomega.ContainSubstring(`
+frontend ingress_frontend
+  mode tcp
+  bind *:80 name ingress
+  option tcplog
+  default_backend ingress_backend
+`))
+	g.Expect(haproxyCfg).To(gomega.ContainSubstring(`
+backend ingress_backend
+  mode tcp
+  balance roundrobin
+  default-server inter 10s downinter 10s rise 5 fall 3 maxconn 1000 maxqueue 256 weight 100
+  server worker-0 192.168.0.20:30080 check
+  server worker-1 192.168.0.21:30080 check
+`))
+}
+
+func TestRenderHAProxyConfigurationIPv6(t *testing.T) {
+	tests := []struct {
+		name     string
+		ipv6     bool
+		contains []string
+	}{
+		{
+			name: "IPv4 cluster",
+			contains: []string{
+				"bind *:6443 name lb\n",
+				"bind *:8132 name konnectivity\n",
+				"--tls-host=0.0.0.0 ",
+			},
+		},
+		{
+			name: "IPv6 or dual-stack cluster",
+			ipv6: true,
+			contains: []string{
+				"bind :::6443 v4v6 name lb\n",
+				"bind :::8132 v4v6 name konnectivity\n",
+				"--tls-host=:: ",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			renderConfig := haproxy.NewRenderConfiguration().
+				WithDataPlaneConfig(haproxy.DataplaneConfig{Username: "client", Password: "cert"}).
+				WithFrontend(infrav1.HAProxyFrontend{Name: "konnectivity", Port: 8132}, nil).
+				WithIPv6(tt.ipv6)
+			haproxyCfg, err := renderConfig.RenderHAProxyConfiguration()
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			for _, s := range tt.contains {
+				g.Expect(haproxyCfg).To(gomega.ContainSubstring(s))
+			}
+		})
+	}
+}
+
+func TestBootstrapDataForLoadBalancerRenewsCertificates(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	renderConfig := haproxy.NewRenderConfiguration().
+		WithBootstrapInfo(infrav1.HAProxyLoadBalancer{}, "client", "cert", []byte("ca.crt"), []byte("ca.key"))
+	bootstrapData, err := renderConfig.BootstrapDataForLoadBalancer()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// The certificates of the dataplane API are renewed 30 days before they
+	// expire by a daily systemd timer, outside of HAProxy.
+	g.Expect(string(bootstrapData)).To(gomega.ContainSubstring("- path: /etc/haproxy/renew-certs.sh\n"))
+	g.Expect(string(bootstrapData)).To(gomega.ContainSubstring("    renew_before=2592000\n"))
+	g.Expect(string(bootstrapData)).To(gomega.ContainSubstring("    ExecStart=/etc/haproxy/renew-certs.sh\n"))
+	g.Expect(string(bootstrapData)).To(gomega.ContainSubstring("    OnCalendar=daily\n"))
+	g.Expect(string(bootstrapData)).To(gomega.ContainSubstring("- \"systemctl enable --now haproxy-renew-certs.timer\"\n"))
+	g.Expect(string(bootstrapData)).NotTo(gomega.ContainSubstring("program renew-certs"))
+}
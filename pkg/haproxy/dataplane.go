@@ -0,0 +1,403 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/antihax/optional"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	hapi "sigs.k8s.io/cluster-api-provider-vsphere/contrib/haproxy/openapi"
+)
+
+const (
+	// TransactionInProgress is the status of a dataplane API transaction
+	// which has been neither committed nor deleted.
+	TransactionInProgress = "in_progress"
+
+	apiServerFrontendName = "kube_api_frontend"
+	apiServerBackendName  = "kube_api_backend"
+	apiServerBindName     = "lb"
+
+	// ipv4BindAddress is the address the frontends listen on in an IPv4
+	// cluster.
+	ipv4BindAddress = "*"
+
+	// ipv6BindAddress is the address the frontends listen on in an IPv6 or
+	// dual-stack cluster, which accepts IPv4 connections as well with the
+	// v4v6 option.
+	ipv6BindAddress = "::"
+
+	statsTypeServer = "server"
+
+	frontendSuffix = "_frontend"
+	backendSuffix  = "_backend"
+)
+
+// ReconcileConfiguration updates the binds, frontends, backends and servers
+// of the load balancer in the provided dataplane API transaction so they
+// match the RenderConfiguration. The provided frontends, which were created
+// by the controller, are deleted with their backends unless they are still
+// rendered. It returns whether the configuration has been changed.
+func (c RenderConfiguration) ReconcileConfiguration(ctx context.Context, client *hapi.APIClient, transactionID string, createdFrontends []string) (bool, error) {
+	changed, err := reconcileBind(ctx, client, transactionID, apiServerFrontendName, c.bind(apiServerBindName, c.Port))
+	if err != nil {
+		return false, err
+	}
+	// The API server is checked over TLS with the check-ssl parameter of the
+	// default server of its backend, which version 1.2 of the dataplane API
+	// cannot set on a server. Its certificate is not verified either way.
+	apiServerServers := servers(c.Addresses, c.Port)
+	for i := range apiServerServers {
+		apiServerServers[i].Verify = "none"
+	}
+	serversChanged, err := reconcileServers(ctx, client, transactionID, apiServerBackendName, apiServerServers)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || serversChanged
+
+	for _, frontend := range c.Frontends {
+		frontendChanged, err := reconcileFrontend(ctx, client, transactionID, frontend)
+		if err != nil {
+			return false, err
+		}
+		bindChanged, err := reconcileBind(ctx, client, transactionID, frontend.Name+frontendSuffix, c.bind(frontend.Name, frontend.Port))
+		if err != nil {
+			return false, err
+		}
+		serversChanged, err := reconcileServers(ctx, client, transactionID, frontend.Name+backendSuffix, servers(frontend.Addresses, frontend.BackendPort))
+		if err != nil {
+			return false, err
+		}
+		changed = changed || frontendChanged || bindChanged || serversChanged
+	}
+
+	frontendNames := c.FrontendNames()
+	var removedFrontends []string
+	for _, name := range createdFrontends {
+		if !containsString(frontendNames, name) {
+			removedFrontends = append(removedFrontends, name)
+		}
+	}
+	deleted, err := deleteFrontends(ctx, client, transactionID, removedFrontends)
+	if err != nil {
+		return false, err
+	}
+	return changed || deleted, nil
+}
+
+// FrontendNames returns the names of the additional TCP frontends of the
+// RenderConfiguration.
+func (c RenderConfiguration) FrontendNames() []string {
+	names := make([]string, 0, len(c.Frontends))
+	for _, frontend := range c.Frontends {
+		names = append(names, frontend.Name)
+	}
+	return names
+}
+
+// reconcileFrontend creates the TCP frontend and its backend if they do not
+// exist.
+func reconcileFrontend(ctx context.Context, client *hapi.APIClient, transactionID string, frontend Frontend) (bool, error) {
+	frontendName := frontend.Name + frontendSuffix
+	backendName := frontend.Name + backendSuffix
+	changed, err := reconcileBackend(ctx, client, transactionID, backendName)
+	if err != nil {
+		return false, err
+	}
+
+	if _, _, err := client.FrontendApi.GetFrontend(ctx, frontendName, &hapi.GetFrontendOpts{
+		TransactionId: optional.NewString(transactionID),
+	}); err == nil {
+		return changed, nil
+	} else if !IsNotFound(err) {
+		return false, errors.Wrapf(err, "failed to get frontend %s", frontendName)
+	}
+
+	if _, _, err := client.FrontendApi.CreateFrontend(ctx, hapi.Frontend{
+		Name:           frontendName,
+		Mode:           "tcp",
+		Tcplog:         true,
+		DefaultBackend: backendName,
+	}, &hapi.CreateFrontendOpts{
+		TransactionId: optional.NewString(transactionID),
+	}); err != nil {
+		return false, errors.Wrapf(err, "failed to create frontend %s", frontendName)
+	}
+	return true, nil
+}
+
+// reconcileBackend creates the TCP backend of a frontend if it does not
+// exist, and updates the parameters of its default server.
+func reconcileBackend(ctx context.Context, client *hapi.APIClient, transactionID, name string) (bool, error) {
+	want := dataplaneDefaultServer()
+	current, _, err := client.BackendApi.GetBackend(ctx, name, &hapi.GetBackendOpts{
+		TransactionId: optional.NewString(transactionID),
+	})
+	switch {
+	case IsNotFound(err):
+		if _, _, err := client.BackendApi.CreateBackend(ctx, hapi.Backend{
+			Name:          name,
+			Mode:          "tcp",
+			Balance:       hapi.Balance{Algorithm: "roundrobin"},
+			DefaultServer: want,
+		}, &hapi.CreateBackendOpts{
+			TransactionId: optional.NewString(transactionID),
+		}); err != nil {
+			return false, errors.Wrapf(err, "failed to create backend %s", name)
+		}
+		return true, nil
+	case err != nil:
+		return false, errors.Wrapf(err, "failed to get backend %s", name)
+	case defaultServerEqual(current.Data.DefaultServer, want):
+		return false, nil
+	}
+
+	// Keep the other parameters of the backend.
+	current.Data.DefaultServer = want
+	if _, _, err := client.BackendApi.ReplaceBackend(ctx, name, current.Data, &hapi.ReplaceBackendOpts{
+		TransactionId: optional.NewString(transactionID),
+	}); err != nil {
+		return false, errors.Wrapf(err, "failed to replace backend %s", name)
+	}
+	return true, nil
+}
+
+// dataplaneDefaultServer returns the parameters of the default server of
+// the backends which the dataplane API supports.
+func dataplaneDefaultServer() *hapi.DefaultServer {
+	return &hapi.DefaultServer{
+		Inter: AddrOfInt32(int32(defaultServer.Inter / time.Millisecond)),
+		Rise:  AddrOfInt32(defaultServer.Rise),
+		Fall:  AddrOfInt32(defaultServer.Fall),
+	}
+}
+
+func defaultServerEqual(a, b *hapi.DefaultServer) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return int32PtrEqual(a.Inter, b.Inter) &&
+		int32PtrEqual(a.Rise, b.Rise) &&
+		int32PtrEqual(a.Fall, b.Fall)
+}
+
+// deleteFrontends deletes the provided TCP frontends, as well as their
+// backends.
+func deleteFrontends(ctx context.Context, client *hapi.APIClient, transactionID string, names []string) (bool, error) {
+	deleted := false
+	for _, name := range names {
+		frontendName := name + frontendSuffix
+		if _, err := client.FrontendApi.DeleteFrontend(ctx, frontendName, &hapi.DeleteFrontendOpts{
+			TransactionId: optional.NewString(transactionID),
+		}); err == nil {
+			deleted = true
+		} else if !IsNotFound(err) {
+			return false, errors.Wrapf(err, "failed to delete frontend %s", frontendName)
+		}
+		backendName := name + backendSuffix
+		if _, err := client.BackendApi.DeleteBackend(ctx, backendName, &hapi.DeleteBackendOpts{
+			TransactionId: optional.NewString(transactionID),
+		}); err == nil {
+			deleted = true
+		} else if !IsNotFound(err) {
+			return false, errors.Wrapf(err, "failed to delete backend %s", backendName)
+		}
+	}
+	return deleted, nil
+}
+
+// bind returns the bind of a frontend listening on the provided port, over
+// IPv6 as well as IPv4 in an IPv6 or dual-stack cluster.
+func (c RenderConfiguration) bind(name string, port uint32) hapi.Bind {
+	if c.IPv6 {
+		return hapi.Bind{
+			Name:    name,
+			Address: ipv6BindAddress,
+			Port:    AddrOfInt32(int32(port)),
+			V4v6:    true,
+		}
+	}
+	return hapi.Bind{
+		Name:    name,
+		Address: ipv4BindAddress,
+		Port:    AddrOfInt32(int32(port)),
+	}
+}
+
+// reconcileBind creates or updates the bind of the frontend so it listens
+// on the address and port of the provided bind.
+func reconcileBind(ctx context.Context, client *hapi.APIClient, transactionID, frontend string, bind hapi.Bind) (bool, error) {
+	name := bind.Name
+	current, _, err := client.BindApi.GetBind(ctx, name, frontend, &hapi.GetBindOpts{
+		TransactionId: optional.NewString(transactionID),
+	})
+	switch {
+	case IsNotFound(err):
+		if _, _, err := client.BindApi.CreateBind(ctx, frontend, bind, &hapi.CreateBindOpts{
+			TransactionId: optional.NewString(transactionID),
+		}); err != nil {
+			return false, errors.Wrapf(err, "failed to create bind %s of frontend %s", name, frontend)
+		}
+		return true, nil
+	case err != nil:
+		return false, errors.Wrapf(err, "failed to get bind %s of frontend %s", name, frontend)
+	case current.Data.Address == bind.Address && current.Data.V4v6 == bind.V4v6 &&
+		current.Data.Port != nil && *current.Data.Port == *bind.Port:
+		return false, nil
+	}
+
+	// Keep the other parameters of the bind.
+	current.Data.Address = bind.Address
+	current.Data.Port = bind.Port
+	current.Data.V4v6 = bind.V4v6
+	if _, _, err := client.BindApi.ReplaceBind(ctx, name, frontend, current.Data, &hapi.ReplaceBindOpts{
+		TransactionId: optional.NewString(transactionID),
+	}); err != nil {
+		return false, errors.Wrapf(err, "failed to replace bind %s of frontend %s", name, frontend)
+	}
+	return true, nil
+}
+
+// reconcileServers adds, replaces and deletes the servers of the backend so
+// they match the provided servers.
+func reconcileServers(ctx context.Context, client *hapi.APIClient, transactionID, backend string, servers []hapi.Server) (bool, error) {
+	current, _, err := client.ServerApi.GetServers(ctx, backend, &hapi.GetServersOpts{
+		TransactionId: optional.NewString(transactionID),
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get servers of backend %s", backend)
+	}
+	currentServers := make(map[string]hapi.Server, len(current.Data))
+	for _, server := range current.Data {
+		currentServers[server.Name] = server
+	}
+
+	changed := false
+	for _, server := range servers {
+		currentServer, ok := currentServers[server.Name]
+		delete(currentServers, server.Name)
+		switch {
+		case !ok:
+			if _, _, err := client.ServerApi.CreateServer(ctx, backend, server, &hapi.CreateServerOpts{
+				TransactionId: optional.NewString(transactionID),
+			}); err != nil {
+				return false, errors.Wrapf(err, "failed to create server %s of backend %s", server.Name, backend)
+			}
+		case !serverEqual(currentServer, server):
+			if _, _, err := client.ServerApi.ReplaceServer(ctx, server.Name, backend, server, &hapi.ReplaceServerOpts{
+				TransactionId: optional.NewString(transactionID),
+			}); err != nil {
+				return false, errors.Wrapf(err, "failed to replace server %s of backend %s", server.Name, backend)
+			}
+		default:
+			continue
+		}
+		changed = true
+	}
+
+	for name := range currentServers {
+		if _, err := client.ServerApi.DeleteServer(ctx, name, backend, &hapi.DeleteServerOpts{
+			TransactionId: optional.NewString(transactionID),
+		}); err != nil && !IsNotFound(err) {
+			return false, errors.Wrapf(err, "failed to delete server %s of backend %s", name, backend)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// servers returns the servers of a backend forwarding connections to the
+// provided port of the endpoints.
+func servers(addresses []corev1.EndpointAddress, port uint32) []hapi.Server {
+	servers := make([]hapi.Server, 0, len(addresses))
+	for _, addr := range addresses {
+		name := addr.IP
+		if addr.NodeName != nil {
+			name = *addr.NodeName
+		}
+		servers = append(servers, hapi.Server{
+			Name:    name,
+			Address: addr.IP,
+			Port:    AddrOfInt32(int32(port)),
+			Check:   "enabled",
+		})
+	}
+	return servers
+}
+
+func serverEqual(a, b hapi.Server) bool {
+	return a.Address == b.Address &&
+		a.Check == b.Check &&
+		a.Verify == b.Verify &&
+		a.Port != nil && b.Port != nil && *a.Port == *b.Port
+}
+
+func int32PtrEqual(a, b *int32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// APIServerBackendStats returns the runtime stats of the servers the API
+// server connections are forwarded to.
+func APIServerBackendStats(ctx context.Context, client *hapi.APIClient) ([]hapi.NativeStat, error) {
+	stats, _, err := client.StatsApi.GetStats(ctx, &hapi.GetStatsOpts{
+		Type_:  optional.NewString(statsTypeServer),
+		Parent: optional.NewString(apiServerBackendName),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get stats of backend %s", apiServerBackendName)
+	}
+
+	// The stats of each runtime API of HAProxy are returned as untyped data.
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal stats of backend %s", apiServerBackendName)
+	}
+	var runtimeStats []struct {
+		Stats []hapi.NativeStat `json:"stats"`
+	}
+	if err := json.Unmarshal(data, &runtimeStats); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal stats of backend %s", apiServerBackendName)
+	}
+
+	var servers []hapi.NativeStat
+	for _, runtime := range runtimeStats {
+		for _, stat := range runtime.Stats {
+			if stat.Type == statsTypeServer && stat.BackendName == apiServerBackendName {
+				servers = append(servers, stat)
+			}
+		}
+	}
+	return servers, nil
+}
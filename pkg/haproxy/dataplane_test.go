@@ -0,0 +1,273 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	hapi "sigs.k8s.io/cluster-api-provider-vsphere/contrib/haproxy/openapi"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/haproxy"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/haproxy/fake"
+)
+
+func TestReconcileConfiguration(t *testing.T) {
+	ctx := context.Background()
+	controlPlane := []corev1.EndpointAddress{
+		{IP: "192.168.0.10", NodeName: pointer.StringPtr("control-plane-0")},
+		{IP: "192.168.0.11", NodeName: pointer.StringPtr("control-plane-1")},
+	}
+	workers := []corev1.EndpointAddress{
+		{IP: "192.168.0.20", NodeName: pointer.StringPtr("worker-0")},
+	}
+	ingress := infrav1.HAProxyFrontend{Name: "ingress", Port: 80, Backend: infrav1.HAProxyBackend{Port: pointer.Int32Ptr(30080)}}
+
+	t.Run("configuration of a new load balancer", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		dataplane, client := fake.NewDataplane(t)
+		dataplane.AddRenderedConfiguration()
+
+		renderConfig := haproxy.NewRenderConfiguration().
+			WithAddresses(controlPlane).
+			WithFrontend(ingress, workers)
+		changed, err := renderConfig.ReconcileConfiguration(ctx, client, "txn", nil)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(changed).To(gomega.BeTrue())
+		g.Expect(dataplane.Reset()).To(gomega.Equal([]string{
+			"POST servers kube_api_backend/control-plane-0",
+			"POST servers kube_api_backend/control-plane-1",
+			"POST backends ingress_backend",
+			"POST frontends ingress_frontend",
+			"POST binds ingress_frontend/ingress",
+			"POST servers ingress_backend/worker-0",
+		}))
+
+		var server hapi.Server
+		g.Expect(dataplane.Get("servers", "kube_api_backend", "control-plane-0", &server)).To(gomega.BeTrue())
+		g.Expect(server).To(gomega.Equal(hapi.Server{
+			Name:    "control-plane-0",
+			Address: "192.168.0.10",
+			Port:    pointer.Int32Ptr(6443),
+			Check:   "enabled",
+			Verify:  "none",
+		}))
+		var workerServer hapi.Server
+		g.Expect(dataplane.Get("servers", "ingress_backend", "worker-0", &workerServer)).To(gomega.BeTrue())
+		g.Expect(workerServer).To(gomega.Equal(hapi.Server{
+			Name:    "worker-0",
+			Address: "192.168.0.20",
+			Port:    pointer.Int32Ptr(30080),
+			Check:   "enabled",
+		}))
+		var backend hapi.Backend
+		g.Expect(dataplane.Get("backends", "", "ingress_backend", &backend)).To(gomega.BeTrue())
+		g.Expect(backend.DefaultServer).To(gomega.Equal(&hapi.DefaultServer{
+			Inter: pointer.Int32Ptr(10000),
+			Rise:  pointer.Int32Ptr(5),
+			Fall:  pointer.Int32Ptr(3),
+		}))
+		var bind hapi.Bind
+		g.Expect(dataplane.Get("binds", "ingress_frontend", "ingress", &bind)).To(gomega.BeTrue())
+		g.Expect(bind).To(gomega.Equal(hapi.Bind{Name: "ingress", Address: "*", Port: pointer.Int32Ptr(80)}))
+
+		// The configuration is not changed once it is up to date.
+		changed, err = renderConfig.ReconcileConfiguration(ctx, client, "txn", renderConfig.FrontendNames())
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(changed).To(gomega.BeFalse())
+		g.Expect(dataplane.Reset()).To(gomega.BeEmpty())
+	})
+
+	t.Run("servers of a changed control plane", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		dataplane, client := fake.NewDataplane(t)
+		dataplane.AddRenderedConfiguration()
+		dataplane.Add("servers", "kube_api_backend", hapi.Server{Name: "control-plane-0", Address: "192.168.0.9", Port: pointer.Int32Ptr(6443), Check: "enabled", Verify: "none"})
+		dataplane.Add("servers", "kube_api_backend", hapi.Server{Name: "control-plane-1", Address: "192.168.0.11", Port: pointer.Int32Ptr(6443), Check: "enabled"})
+		dataplane.Add("servers", "kube_api_backend", hapi.Server{Name: "control-plane-2", Address: "192.168.0.12", Port: pointer.Int32Ptr(6443), Check: "enabled", Verify: "none"})
+
+		changed, err := haproxy.NewRenderConfiguration().
+			WithAddresses(controlPlane).
+			ReconcileConfiguration(ctx, client, "txn", nil)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(changed).To(gomega.BeTrue())
+		g.Expect(dataplane.Reset()).To(gomega.Equal([]string{
+			"PUT servers kube_api_backend/control-plane-0",
+			"PUT servers kube_api_backend/control-plane-1",
+			"DELETE servers kube_api_backend/control-plane-2",
+		}))
+	})
+
+	t.Run("port of the API server", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		dataplane, client := fake.NewDataplane(t)
+		dataplane.AddRenderedConfiguration()
+
+		changed, err := haproxy.NewRenderConfiguration().
+			WithPort(443).
+			ReconcileConfiguration(ctx, client, "txn", nil)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(changed).To(gomega.BeTrue())
+		g.Expect(dataplane.Reset()).To(gomega.Equal([]string{"PUT binds kube_api_frontend/lb"}))
+		var bind hapi.Bind
+		g.Expect(dataplane.Get("binds", "kube_api_frontend", "lb", &bind)).To(gomega.BeTrue())
+		g.Expect(bind.Port).To(gomega.Equal(pointer.Int32Ptr(443)))
+	})
+
+	t.Run("binds of an IPv6 or dual-stack cluster", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		dataplane, client := fake.NewDataplane(t)
+		dataplane.AddRenderedConfiguration()
+
+		changed, err := haproxy.NewRenderConfiguration().
+			WithIPv6(true).
+			WithFrontend(ingress, nil).
+			ReconcileConfiguration(ctx, client, "txn", nil)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(changed).To(gomega.BeTrue())
+		g.Expect(dataplane.Reset()).To(gomega.Equal([]string{
+			"PUT binds kube_api_frontend/lb",
+			"POST backends ingress_backend",
+			"POST frontends ingress_frontend",
+			"POST binds ingress_frontend/ingress",
+		}))
+
+		// The binds accept IPv4 connections as well.
+		var bind hapi.Bind
+		g.Expect(dataplane.Get("binds", "kube_api_frontend", "lb", &bind)).To(gomega.BeTrue())
+		g.Expect(bind).To(gomega.Equal(hapi.Bind{Name: "lb", Address: "::", Port: pointer.Int32Ptr(6443), V4v6: true}))
+		g.Expect(dataplane.Get("binds", "ingress_frontend", "ingress", &bind)).To(gomega.BeTrue())
+		g.Expect(bind).To(gomega.Equal(hapi.Bind{Name: "ingress", Address: "::", Port: pointer.Int32Ptr(80), V4v6: true}))
+	})
+
+	t.Run("frontend without a backend", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		dataplane, client := fake.NewDataplane(t)
+		dataplane.AddRenderedConfiguration()
+		dataplane.Add("frontends", "", hapi.Frontend{Name: "ingress_frontend", Mode: "tcp", DefaultBackend: "ingress_backend"})
+		dataplane.Add("binds", "ingress_frontend", hapi.Bind{Name: "ingress", Address: "*", Port: pointer.Int32Ptr(80)})
+
+		changed, err := haproxy.NewRenderConfiguration().
+			WithFrontend(ingress, nil).
+			ReconcileConfiguration(ctx, client, "txn", []string{"ingress"})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(changed).To(gomega.BeTrue())
+		g.Expect(dataplane.Reset()).To(gomega.Equal([]string{"POST backends ingress_backend"}))
+	})
+
+	t.Run("removed frontends", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		dataplane, client := fake.NewDataplane(t)
+		// The custom frontend is rendered by a custom configuration
+		// template rather than created by the controller.
+		dataplane.AddRenderedConfiguration("ingress", "konnectivity", "custom")
+
+		changed, err := haproxy.NewRenderConfiguration().
+			WithFrontend(ingress, nil).
+			ReconcileConfiguration(ctx, client, "txn", []string{"ingress", "konnectivity"})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(changed).To(gomega.BeTrue())
+		g.Expect(dataplane.Reset()).To(gomega.Equal([]string{
+			"PUT binds ingress_frontend/ingress",
+			"DELETE frontends konnectivity_frontend",
+			"DELETE backends konnectivity_backend",
+		}))
+		var frontend hapi.Frontend
+		g.Expect(dataplane.Get("frontends", "", "custom_frontend", &frontend)).To(gomega.BeTrue())
+		var backend hapi.Backend
+		g.Expect(dataplane.Get("backends", "", "custom_backend", &backend)).To(gomega.BeTrue())
+	})
+}
+
+func TestAPIServerBackendStats(t *testing.T) {
+	server := func(backend, name, status string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":         "server",
+			"backend_name": backend,
+			"name":         name,
+			"stats":        map[string]interface{}{"status": status},
+		}
+	}
+	tests := []struct {
+		name     string
+		stats    []map[string]interface{}
+		wantErr  bool
+		expected []hapi.NativeStat
+	}{
+		{
+			name: "servers of the API server backend",
+			stats: []map[string]interface{}{{
+				"runtimeAPI": "/run/haproxy.sock",
+				"stats": []interface{}{
+					map[string]interface{}{"type": "backend", "name": "kube_api_backend", "stats": map[string]interface{}{"status": "UP"}},
+					server("kube_api_backend", "control-plane-0", "UP"),
+					server("kube_api_backend", "control-plane-1", "DOWN 1/2"),
+					server("konnectivity_backend", "control-plane-0", "UP"),
+				},
+			}},
+			expected: []hapi.NativeStat{
+				{Type: "server", BackendName: "kube_api_backend", Name: "control-plane-0", Stats: hapi.NativeStatStats{Status: "UP"}},
+				{Type: "server", BackendName: "kube_api_backend", Name: "control-plane-1", Stats: hapi.NativeStatStats{Status: "DOWN 1/2"}},
+			},
+		},
+		{
+			name: "servers of each runtime API",
+			stats: []map[string]interface{}{
+				{
+					"runtimeAPI": "/run/haproxy-1.sock",
+					"stats":      []interface{}{server("kube_api_backend", "control-plane-0", "UP")},
+				},
+				{
+					"runtimeAPI": "/run/haproxy-2.sock",
+					"stats":      []interface{}{server("kube_api_backend", "control-plane-0", "MAINT")},
+				},
+			},
+			expected: []hapi.NativeStat{
+				{Type: "server", BackendName: "kube_api_backend", Name: "control-plane-0", Stats: hapi.NativeStatStats{Status: "UP"}},
+				{Type: "server", BackendName: "kube_api_backend", Name: "control-plane-0", Stats: hapi.NativeStatStats{Status: "MAINT"}},
+			},
+		},
+		{
+			name:  "no server",
+			stats: []map[string]interface{}{{"runtimeAPI": "/run/haproxy.sock", "stats": []interface{}{}}},
+		},
+		{
+			name:    "runtime API unavailable",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			dataplane, client := fake.NewDataplane(t)
+			dataplane.Stats = tt.stats
+
+			stats, err := haproxy.APIServerBackendStats(context.Background(), client)
+			if tt.wantErr {
+				g.Expect(err).To(gomega.HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(stats).To(gomega.Equal(tt.expected))
+		})
+	}
+}
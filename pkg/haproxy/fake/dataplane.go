@@ -0,0 +1,293 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/utils/pointer"
+
+	hapi "sigs.k8s.io/cluster-api-provider-vsphere/contrib/haproxy/openapi"
+)
+
+const (
+	dataplaneConfigurationPath = "/v1/services/haproxy/configuration/"
+	dataplaneTransactionsPath  = "/v1/services/haproxy/transactions/"
+	dataplaneStatsPath         = "/v1/services/haproxy/stats/native"
+)
+
+// Dataplane is an in-memory HAProxy dataplane API serving the configuration
+// of the frontends, binds, backends and servers, the global configuration,
+// the commit of transactions and the stats of the runtime APIs. The binds
+// and servers are stored under the name of their frontend or backend. The
+// configuration objects are changed immediately, whichever transaction they
+// are changed in.
+type Dataplane struct {
+	sync.Mutex
+
+	// Version is the configuration version, which is incremented when a
+	// transaction is committed.
+	Version int32
+
+	// FailCommit makes the commit of transactions fail.
+	FailCommit bool
+
+	// Stats are the stats of the runtime APIs of HAProxy, or nil when they
+	// cannot be retrieved.
+	Stats []map[string]interface{}
+
+	// objects are the configuration objects by kind, then parent and name.
+	objects map[string]map[string][]json.RawMessage
+
+	// changes are the requests which changed the configuration, ex.
+	// "POST frontends ingress_frontend" or "PUT transactions 1234".
+	changes []string
+}
+
+// NewDataplane starts a Dataplane without configuration objects, which is
+// stopped when the test completes, and returns a client connected to it.
+func NewDataplane(t testing.TB) (*Dataplane, *hapi.APIClient) {
+	dataplane := &Dataplane{objects: map[string]map[string][]json.RawMessage{}}
+	server := httptest.NewServer(dataplane)
+	t.Cleanup(server.Close)
+	client := hapi.NewAPIClient(&hapi.Configuration{
+		BasePath:   server.URL + "/v1",
+		HTTPClient: server.Client(),
+	})
+	return dataplane, client
+}
+
+// Add stores a configuration object without recording a change.
+func (d *Dataplane) Add(kind, parent string, object interface{}) {
+	d.Lock()
+	defer d.Unlock()
+	data, err := json.Marshal(object)
+	if err != nil {
+		panic(err)
+	}
+	d.add(kind, parent, data)
+}
+
+// AddRenderedConfiguration stores the frontends, binds and backends of the
+// API server, and of the provided frontends, which are rendered in
+// haproxy.cfg when a load balancer is bootstrapped.
+func (d *Dataplane) AddRenderedConfiguration(frontends ...string) {
+	d.Add("frontends", "", hapi.Frontend{Name: "kube_api_frontend", Mode: "tcp", DefaultBackend: "kube_api_backend"})
+	d.Add("binds", "kube_api_frontend", hapi.Bind{Name: "lb", Address: "*", Port: pointer.Int32Ptr(6443)})
+	d.Add("backends", "", hapi.Backend{Name: "kube_api_backend", Mode: "tcp"})
+	for i, frontend := range frontends {
+		d.Add("frontends", "", hapi.Frontend{Name: frontend + "_frontend", Mode: "tcp", DefaultBackend: frontend + "_backend"})
+		d.Add("binds", frontend+"_frontend", hapi.Bind{Name: frontend, Address: "*", Port: pointer.Int32Ptr(int32(8000 + i))})
+		d.Add("backends", "", hapi.Backend{Name: frontend + "_backend", Mode: "tcp", DefaultServer: &hapi.DefaultServer{
+			Inter: pointer.Int32Ptr(10000),
+			Rise:  pointer.Int32Ptr(5),
+			Fall:  pointer.Int32Ptr(3),
+		}})
+	}
+}
+
+// Get decodes the configuration object of the provided kind, parent and
+// name, returning whether it exists.
+func (d *Dataplane) Get(kind, parent, name string, object interface{}) bool {
+	d.Lock()
+	defer d.Unlock()
+	if i := d.index(kind, parent, name); i >= 0 {
+		if err := json.Unmarshal(d.objects[kind][parent][i], object); err != nil {
+			panic(err)
+		}
+		return true
+	}
+	return false
+}
+
+// Reset returns the changes recorded since the last reset and forgets them.
+func (d *Dataplane) Reset() []string {
+	d.Lock()
+	defer d.Unlock()
+	changes := d.changes
+	d.changes = nil
+	return changes
+}
+
+func (d *Dataplane) add(kind, parent string, data json.RawMessage) {
+	if d.objects[kind] == nil {
+		d.objects[kind] = map[string][]json.RawMessage{}
+	}
+	d.objects[kind][parent] = append(d.objects[kind][parent], data)
+}
+
+func (d *Dataplane) index(kind, parent, name string) int {
+	for i, data := range d.objects[kind][parent] {
+		var object struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &object); err != nil {
+			panic(err)
+		}
+		if object.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *Dataplane) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.Lock()
+	defer d.Unlock()
+
+	switch {
+	case r.URL.Path == dataplaneStatsPath:
+		d.serveStats(w, r)
+	case strings.HasPrefix(r.URL.Path, dataplaneTransactionsPath):
+		d.serveTransaction(w, r)
+	case r.URL.Path == dataplaneConfigurationPath+"global":
+		d.serveGlobal(w, r)
+	case strings.HasPrefix(r.URL.Path, dataplaneConfigurationPath):
+		d.serveConfiguration(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "unknown path %s", r.URL.Path)
+	}
+}
+
+// serveConfiguration serves the configuration objects.
+func (d *Dataplane) serveConfiguration(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, dataplaneConfigurationPath), "/")
+	kind := path[0]
+	parent := r.URL.Query().Get("frontend") + r.URL.Query().Get("backend")
+	objects := d.objects[kind][parent]
+
+	if len(path) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			if objects == nil {
+				objects = []json.RawMessage{}
+			}
+			writeResponse(w, http.StatusOK, map[string]interface{}{"_version": d.Version, "data": objects})
+		case http.MethodPost:
+			var object struct {
+				Name string `json:"name"`
+			}
+			data := json.RawMessage{}
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := json.Unmarshal(data, &object); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if d.index(kind, parent, object.Name) >= 0 {
+				writeError(w, http.StatusConflict, "%s %s already exists", kind, object.Name)
+				return
+			}
+			d.add(kind, parent, data)
+			d.changes = append(d.changes, fmt.Sprintf("POST %s %s", kind, strings.TrimPrefix(parent+"/"+object.Name, "/")))
+			writeResponse(w, http.StatusCreated, data)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+		}
+		return
+	}
+
+	name := path[1]
+	i := d.index(kind, parent, name)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "%s %s not found", kind, name)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeResponse(w, http.StatusOK, map[string]interface{}{"_version": d.Version, "data": objects[i]})
+		return
+	case http.MethodPut:
+		data := json.RawMessage{}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		objects[i] = data
+		writeResponse(w, http.StatusOK, data)
+	case http.MethodDelete:
+		d.objects[kind][parent] = append(objects[:i:i], objects[i+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+		return
+	}
+	d.changes = append(d.changes, fmt.Sprintf("%s %s %s", r.Method, kind, strings.TrimPrefix(parent+"/"+name, "/")))
+}
+
+// serveGlobal returns the global configuration, with the configuration
+// version.
+func (d *Dataplane) serveGlobal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+		return
+	}
+	writeResponse(w, http.StatusOK, map[string]interface{}{"_version": d.Version, "data": hapi.Global{}})
+}
+
+// serveTransaction commits or deletes a transaction.
+func (d *Dataplane) serveTransaction(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, dataplaneTransactionsPath)
+	switch {
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method != http.MethodPut:
+		writeError(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+		return
+	case d.FailCommit:
+		writeError(w, http.StatusNotAcceptable, "invalid configuration")
+		return
+	default:
+		d.Version++
+		writeResponse(w, http.StatusOK, hapi.Transaction{Id: id, Version: d.Version, Status: "success"})
+	}
+	d.changes = append(d.changes, fmt.Sprintf("%s transactions %s", r.Method, id))
+}
+
+// serveStats returns the stats of the runtime APIs of HAProxy.
+func (d *Dataplane) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+		return
+	}
+	if d.Stats == nil {
+		writeError(w, http.StatusInternalServerError, "runtime API unavailable")
+		return
+	}
+	writeResponse(w, http.StatusOK, d.Stats)
+}
+
+func writeResponse(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeResponse(w, status, hapi.ModelError{
+		Code:    pointer.Int32Ptr(int32(status)),
+		Message: pointer.StringPtr(fmt.Sprintf(format, args...)),
+	})
+}
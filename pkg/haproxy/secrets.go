@@ -17,10 +17,13 @@ limitations under the License.
 package haproxy
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"time"
 
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -76,6 +79,10 @@ const (
 	// DefaultNegativeTimeSkew is the time by which a certificate's validity should be set in the past to
 	// account for clock skew
 	DefaultNegativeTimeSkew = -10 * time.Minute
+
+	// DefaultCertificateRenewBefore is how long before they expire the
+	// signing and client certificates are renewed.
+	DefaultCertificateRenewBefore = 30 * 24 * time.Hour
 )
 
 // NameForCASecret returns the name of the Secret for the signing
@@ -244,16 +251,7 @@ func CreateBootstrapSecret(
 		return err
 	}
 
-	renderConfig := NewRenderConfiguration().
-		WithBootstrapInfo(
-			*loadBalancer,
-			string(caSecret.Data[SecretDataKeyUsername]),
-			string(caSecret.Data[SecretDataKeyPassword]),
-			caSecret.Data[SecretDataKeyCACert],
-			caSecret.Data[SecretDataKeyCAKey],
-		)
-
-	bootstrapData, err := renderConfig.BootstrapDataForLoadBalancer()
+	bootstrapData, err := bootstrapDataForLoadBalancer(ctx, client, cluster, caSecret, loadBalancer)
 	if err != nil {
 		return err
 	}
@@ -266,6 +264,31 @@ func CreateBootstrapSecret(
 	})
 }
 
+func bootstrapDataForLoadBalancer(
+	ctx context.Context,
+	client ctrlclient.Client,
+	cluster *clusterv1.Cluster,
+	caSecret *corev1.Secret,
+	loadBalancer *infrav1.HAProxyLoadBalancer) ([]byte, error) {
+
+	tpl, err := GetConfigurationTemplate(ctx, client, loadBalancer)
+	if err != nil {
+		return nil, err
+	}
+	_, ipv6Enabled := ClusterIPv6(cluster)
+	renderConfig := NewRenderConfiguration().
+		WithBootstrapInfo(
+			*loadBalancer,
+			string(caSecret.Data[SecretDataKeyUsername]),
+			string(caSecret.Data[SecretDataKeyPassword]),
+			caSecret.Data[SecretDataKeyCACert],
+			caSecret.Data[SecretDataKeyCAKey],
+		).
+		WithIPv6(ipv6Enabled).
+		WithConfigurationTemplate(tpl)
+	return renderConfig.BootstrapDataForLoadBalancer()
+}
+
 // CreateConfigSecret creates the Secret resource that contains
 // the config data required to access the HAProxy API server.
 func CreateConfigSecret(
@@ -295,7 +318,7 @@ func CreateConfigSecret(
 		CertificateAuthorityData: caSecret.Data[SecretDataKeyCACert],
 		ClientCertificateData:    clientCertPEM,
 		ClientKeyData:            clientKeyPEM,
-		Server:                   fmt.Sprintf("https://%s:5556/v1", loadBalancer.Status.Address),
+		Server:                   DataplaneServerURL(loadBalancer.Status.Address),
 		Username:                 string(caSecret.Data[SecretDataKeyUsername]),
 		Password:                 string(caSecret.Data[SecretDataKeyPassword]),
 	}
@@ -313,6 +336,160 @@ func CreateConfigSecret(
 	})
 }
 
+// RenewCASecret renews the signing certificate if it expires within
+// DefaultCertificateRenewBefore and updates the bootstrap data of new load
+// balancer VMs with it. The renewed certificate keeps the signing key, so the
+// certificates already signed with it remain valid. It returns when the
+// signing certificate expires.
+func RenewCASecret(
+	ctx context.Context,
+	client ctrlclient.Client,
+	cluster *clusterv1.Cluster,
+	loadBalancer *infrav1.HAProxyLoadBalancer) (time.Time, error) {
+
+	caSecret, err := GetCASecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	notAfter, err := certificateNotAfter(caSecret.Data[SecretDataKeyCACert])
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse signing certificate")
+	}
+	if !needsRenewal(notAfter) {
+		return notAfter, nil
+	}
+
+	notBefore, notAfter := newDefaultCertificateValidity()
+	crt, err := renewSigningCertificate(
+		caSecret.Data[SecretDataKeyCACert],
+		caSecret.Data[SecretDataKeyCAKey],
+		notBefore,
+		notAfter)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to renew signing certificate")
+	}
+	caSecret.Data[SecretDataKeyCACert] = crt
+	if err := client.Update(ctx, caSecret); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := updateBootstrapSecret(ctx, client, cluster, caSecret, loadBalancer); err != nil {
+		if apierrors.IsNotFound(err) {
+			return notAfter, CreateBootstrapSecret(ctx, client, cluster, loadBalancer)
+		}
+		return time.Time{}, err
+	}
+	return notAfter, nil
+}
+
+// UpdateBootstrapSecret renders the bootstrap data again and updates the
+// bootstrap Secret if it changed, so the load balancer VMs created afterwards
+// are bootstrapped with the current spec, such as a virtual IP set after the
+// load balancer was created.
+func UpdateBootstrapSecret(
+	ctx context.Context,
+	client ctrlclient.Client,
+	cluster *clusterv1.Cluster,
+	loadBalancer *infrav1.HAProxyLoadBalancer) error {
+
+	caSecret, err := GetCASecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+	if err != nil {
+		return err
+	}
+	return updateBootstrapSecret(ctx, client, cluster, caSecret, loadBalancer)
+}
+
+func updateBootstrapSecret(
+	ctx context.Context,
+	client ctrlclient.Client,
+	cluster *clusterv1.Cluster,
+	caSecret *corev1.Secret,
+	loadBalancer *infrav1.HAProxyLoadBalancer) error {
+
+	bootstrapSecret, err := GetBootstrapSecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+	if err != nil {
+		return err
+	}
+	bootstrapData, err := bootstrapDataForLoadBalancer(ctx, client, cluster, caSecret, loadBalancer)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(bootstrapSecret.Data[SecretDataKey], bootstrapData) {
+		return nil
+	}
+	bootstrapSecret.Data = map[string][]byte{
+		SecretDataKey: bootstrapData,
+	}
+	return client.Update(ctx, bootstrapSecret)
+}
+
+// RenewConfigSecret renews the client certificate used to access the HAProxy
+// API server if it expires within DefaultCertificateRenewBefore or if the
+// signing certificate has been renewed since it was issued. It returns when
+// the client certificate expires.
+func RenewConfigSecret(
+	ctx context.Context,
+	client ctrlclient.Client,
+	loadBalancer *infrav1.HAProxyLoadBalancer) (time.Time, error) {
+
+	caSecret, err := GetCASecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	configSecret, err := GetConfigSecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	config, err := LoadDataplaneConfig(configSecret.Data[SecretDataKey])
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	notAfter, err := certificateNotAfter(config.ClientCertificateData)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse client certificate")
+	}
+	if !needsRenewal(notAfter) && bytes.Equal(config.CertificateAuthorityData, caSecret.Data[SecretDataKeyCACert]) {
+		return notAfter, nil
+	}
+
+	notBefore, notAfter := newDefaultCertificateValidity()
+	clientCertPEM, clientKeyPEM, err := generateAndSignClientCertificateKeyPair(
+		caSecret.Data[SecretDataKeyCACert],
+		caSecret.Data[SecretDataKeyCAKey],
+		notBefore,
+		notAfter,
+		loadBalancer.Status.Address)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to renew client certificate")
+	}
+	config.CertificateAuthorityData = caSecret.Data[SecretDataKeyCACert]
+	config.ClientCertificateData = clientCertPEM
+	config.ClientKeyData = clientKeyPEM
+
+	configData, err := yaml.Marshal(config)
+	if err != nil {
+		return time.Time{}, err
+	}
+	configSecret.Data = map[string][]byte{
+		SecretDataKey: configData,
+	}
+	return notAfter, client.Update(ctx, configSecret)
+}
+
+func needsRenewal(notAfter time.Time) bool {
+	return time.Now().UTC().Add(DefaultCertificateRenewBefore).After(notAfter)
+}
+
+// DataplaneServerURL returns the URL of the dataplane API of the load
+// balancer VM with the provided address.
+func DataplaneServerURL(address string) string {
+	return fmt.Sprintf("https://%s/v1", net.JoinHostPort(address, "5556"))
+}
+
 func objectMetaForSecret(
 	cluster *clusterv1.Cluster,
 	loadBalancer *infrav1.HAProxyLoadBalancer,
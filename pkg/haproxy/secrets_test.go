@@ -0,0 +1,233 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+)
+
+func TestRenewCASecret(t *testing.T) {
+	t.Run("signing certificate which does not expire soon", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		ctx, client, cluster, loadBalancer := newTestLoadBalancerSecrets(g)
+		caSecret, err := GetCASecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		expectedNotAfter, err := certificateNotAfter(caSecret.Data[SecretDataKeyCACert])
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		notAfter, err := RenewCASecret(ctx, client, cluster, loadBalancer)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(notAfter).To(gomega.Equal(expectedNotAfter))
+
+		renewedCASecret, err := GetCASecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(renewedCASecret.Data).To(gomega.Equal(caSecret.Data))
+	})
+
+	t.Run("signing certificate which expires soon", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		ctx, client, cluster, loadBalancer := newTestLoadBalancerSecrets(g)
+		caSecret := expireSigningCertificate(ctx, g, client, loadBalancer)
+		bootstrapSecret, err := GetBootstrapSecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		notAfter, err := RenewCASecret(ctx, client, cluster, loadBalancer)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(notAfter).To(gomega.BeTemporally("~", time.Now().AddDate(10, 0, 0), time.Hour))
+
+		// The signing certificate is renewed with the same key, and the
+		// bootstrap data of new load balancer VMs is updated with it.
+		renewedCASecret, err := GetCASecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(renewedCASecret.Data[SecretDataKeyCACert]).NotTo(gomega.Equal(caSecret.Data[SecretDataKeyCACert]))
+		g.Expect(renewedCASecret.Data[SecretDataKeyCAKey]).To(gomega.Equal(caSecret.Data[SecretDataKeyCAKey]))
+		renewedNotAfter, err := certificateNotAfter(renewedCASecret.Data[SecretDataKeyCACert])
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(renewedNotAfter).To(gomega.BeTemporally("~", notAfter, time.Second))
+
+		renewedBootstrapSecret, err := GetBootstrapSecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(renewedBootstrapSecret.Data[SecretDataKey]).NotTo(gomega.Equal(bootstrapSecret.Data[SecretDataKey]))
+		g.Expect(string(renewedBootstrapSecret.Data[SecretDataKey])).To(gomega.ContainSubstring(
+			templateByteLinesIndent(4, renewedCASecret.Data[SecretDataKeyCACert])))
+	})
+
+	t.Run("signing certificate which expires soon without bootstrap data", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		ctx, client, cluster, loadBalancer := newTestLoadBalancerSecrets(g)
+		expireSigningCertificate(ctx, g, client, loadBalancer)
+		g.Expect(DeleteBootstrapSecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)).To(gomega.Succeed())
+
+		_, err := RenewCASecret(ctx, client, cluster, loadBalancer)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		_, err = GetBootstrapSecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+}
+
+func TestRenewConfigSecret(t *testing.T) {
+	t.Run("client certificate which does not expire soon", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		ctx, client, _, loadBalancer := newTestLoadBalancerSecrets(g)
+		configSecret, err := GetConfigSecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		config, err := LoadDataplaneConfig(configSecret.Data[SecretDataKey])
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		expectedNotAfter, err := certificateNotAfter(config.ClientCertificateData)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		notAfter, err := RenewConfigSecret(ctx, client, loadBalancer)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(notAfter).To(gomega.Equal(expectedNotAfter))
+
+		renewedConfigSecret, err := GetConfigSecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(renewedConfigSecret.Data).To(gomega.Equal(configSecret.Data))
+	})
+
+	t.Run("client certificate which expires soon", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		ctx, client, _, loadBalancer := newTestLoadBalancerSecrets(g)
+		caSecret, err := GetCASecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		configSecret, err := GetConfigSecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		config, err := LoadDataplaneConfig(configSecret.Data[SecretDataKey])
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		notBefore := time.Now().UTC().Add(DefaultNegativeTimeSkew)
+		config.ClientCertificateData, config.ClientKeyData, err = generateAndSignClientCertificateKeyPair(
+			caSecret.Data[SecretDataKeyCACert],
+			caSecret.Data[SecretDataKeyCAKey],
+			notBefore,
+			notBefore.Add(24*time.Hour),
+			loadBalancer.Status.Address)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		updateConfigSecret(ctx, g, client, configSecret, config)
+
+		notAfter, err := RenewConfigSecret(ctx, client, loadBalancer)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(notAfter).To(gomega.BeTemporally("~", time.Now().AddDate(10, 0, 0), time.Hour))
+		expectRenewedClientCertificate(ctx, g, client, loadBalancer, notAfter)
+	})
+
+	t.Run("signing certificate which has been renewed", func(t *testing.T) {
+		g := gomega.NewWithT(t)
+		ctx, client, cluster, loadBalancer := newTestLoadBalancerSecrets(g)
+		expireSigningCertificate(ctx, g, client, loadBalancer)
+		_, err := RenewCASecret(ctx, client, cluster, loadBalancer)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		notAfter, err := RenewConfigSecret(ctx, client, loadBalancer)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		expectRenewedClientCertificate(ctx, g, client, loadBalancer, notAfter)
+	})
+}
+
+// newTestLoadBalancerSecrets returns a fake client with the signing
+// certificate, bootstrap data and API config secrets of a ready load
+// balancer.
+func newTestLoadBalancerSecrets(g *gomega.WithT) (context.Context, ctrlclient.Client, *clusterv1.Cluster, *infrav1.HAProxyLoadBalancer) {
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(gomega.Succeed())
+	client := fake.NewClientBuilder().WithScheme(scheme).Build()
+	ctx := context.Background()
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+	}
+	loadBalancer := &infrav1.HAProxyLoadBalancer{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: infrav1.GroupVersion.String(),
+			Kind:       "HAProxyLoadBalancer",
+		},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "lb"},
+		Status:     infrav1.HAProxyLoadBalancerStatus{Address: "192.168.0.2"},
+	}
+	g.Expect(CreateCASecret(ctx, client, cluster, loadBalancer)).To(gomega.Succeed())
+	g.Expect(CreateBootstrapSecret(ctx, client, cluster, loadBalancer)).To(gomega.Succeed())
+	g.Expect(CreateConfigSecret(ctx, client, cluster, loadBalancer)).To(gomega.Succeed())
+	return ctx, client, cluster, loadBalancer
+}
+
+// expireSigningCertificate replaces the signing certificate with one which
+// expires within DefaultCertificateRenewBefore and returns the updated
+// secret.
+func expireSigningCertificate(ctx context.Context, g *gomega.WithT, client ctrlclient.Client, loadBalancer *infrav1.HAProxyLoadBalancer) *corev1.Secret {
+	caSecret, err := GetCASecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	notBefore := time.Now().UTC().Add(DefaultNegativeTimeSkew)
+	caSecret.Data[SecretDataKeyCACert], err = renewSigningCertificate(
+		caSecret.Data[SecretDataKeyCACert],
+		caSecret.Data[SecretDataKeyCAKey],
+		notBefore,
+		notBefore.Add(24*time.Hour))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(client.Update(ctx, caSecret)).To(gomega.Succeed())
+	return caSecret
+}
+
+func updateConfigSecret(ctx context.Context, g *gomega.WithT, client ctrlclient.Client, configSecret *corev1.Secret, config DataplaneConfig) {
+	configData, err := yaml.Marshal(config)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	configSecret.Data[SecretDataKey] = configData
+	g.Expect(client.Update(ctx, configSecret)).To(gomega.Succeed())
+}
+
+// expectRenewedClientCertificate checks that the client certificate of the
+// API config expires at the provided time and is signed with the current
+// signing certificate.
+func expectRenewedClientCertificate(ctx context.Context, g *gomega.WithT, client ctrlclient.Client, loadBalancer *infrav1.HAProxyLoadBalancer, notAfter time.Time) {
+	caSecret, err := GetCASecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	configSecret, err := GetConfigSecret(ctx, client, loadBalancer.Namespace, loadBalancer.Name)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	config, err := LoadDataplaneConfig(configSecret.Data[SecretDataKey])
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(config.CertificateAuthorityData).To(gomega.Equal(caSecret.Data[SecretDataKeyCACert]))
+
+	clientNotAfter, err := certificateNotAfter(config.ClientCertificateData)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(clientNotAfter).To(gomega.BeTemporally("~", notAfter, time.Second))
+
+	caCert, err := parseCertificate(caSecret.Data[SecretDataKeyCACert])
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	clientCert, err := parseCertificate(config.ClientCertificateData)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	_, err = clientCert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+}
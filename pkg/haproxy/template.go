@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+)
+
+// ConfigurationTemplateWebhookPath is the path of the webhook validating the
+// ConfigMaps labeled with infrav1.HAProxyConfigurationTemplateLabel.
+const ConfigurationTemplateWebhookPath = "/validate-v1-configmap-haproxy-configuration-template"
+
+var (
+	apiServerFrontendSection = regexp.MustCompile(`(?m)^\s*frontend\s+` + apiServerFrontendName + `\s*$`)
+	apiServerBackendSection  = regexp.MustCompile(`(?m)^\s*backend\s+` + apiServerBackendName + `\s*$`)
+
+	// requiredConfigurationSections are the sections of the HAProxy
+	// configuration the controller updates through the dataplane API.
+	requiredConfigurationSections = []*regexp.Regexp{
+		apiServerFrontendSection,
+		apiServerBackendSection,
+	}
+
+	// apiServerBind is the bind of the API server frontend whose port the
+	// controller updates through the dataplane API.
+	apiServerBind = regexp.MustCompile(`(?m)^\s*bind\s+\S+.*\sname\s+` + apiServerBindName + `(\s|$)`)
+
+	// configurationSection is the header of any section of the HAProxy
+	// configuration.
+	configurationSection = regexp.MustCompile(`(?m)^\s*(global|defaults|frontend|backend|listen|program|userlist|peers|resolvers|mailers|cache|http-errors|ring)(\s|$)`)
+)
+
+// GetConfigurationTemplate returns the HAProxy configuration template of the
+// load balancer, or an empty string if it uses the built-in template. The
+// ConfigMap holding the template must be labeled with
+// infrav1.HAProxyConfigurationTemplateLabel, since the manager only caches
+// those ConfigMaps.
+func GetConfigurationTemplate(
+	ctx context.Context,
+	client ctrlclient.Client,
+	loadBalancer *infrav1.HAProxyLoadBalancer) (string, error) {
+
+	ref := loadBalancer.Spec.ConfigurationTemplate
+	if ref == nil {
+		return "", nil
+	}
+	key := ref.Key
+	if key == "" {
+		key = infrav1.DefaultHAProxyConfigurationTemplateKey
+	}
+
+	configMap := &corev1.ConfigMap{}
+	configMapKey := apitypes.NamespacedName{
+		Namespace: loadBalancer.Namespace,
+		Name:      ref.Name,
+	}
+	if err := client.Get(ctx, configMapKey, configMap); err != nil {
+		return "", errors.Wrapf(err, "failed to get HAProxy configuration template ConfigMap %s labeled with %s",
+			configMapKey, infrav1.HAProxyConfigurationTemplateLabel)
+	}
+	tpl, ok := configMap.Data[key]
+	if !ok {
+		return "", errors.Errorf("HAProxy configuration template ConfigMap %s has no key %q", configMapKey, key)
+	}
+	if err := ValidateConfigurationTemplate(tpl); err != nil {
+		return "", errors.Wrapf(err, "invalid HAProxy configuration template in ConfigMap %s", configMapKey)
+	}
+	return tpl, nil
+}
+
+// ValidateConfigurationTemplate renders the HAProxy configuration template
+// with sample data, for IPv4 as well as IPv6 and dual-stack clusters, and
+// checks that the rendered configuration defines the sections and the API
+// server bind the controller updates through the dataplane API.
+func ValidateConfigurationTemplate(tpl string) error {
+	addresses := []corev1.EndpointAddress{
+		{IP: "192.168.0.10", NodeName: pointer.StringPtr("control-plane-0")},
+		{IP: "fd00::10", NodeName: pointer.StringPtr("control-plane-1")},
+	}
+	renderConfig := NewRenderConfiguration().
+		WithConfigurationTemplate(tpl).
+		WithDataPlaneConfig(DataplaneConfig{
+			Username: "client",
+			Password: "cert",
+		}).
+		WithAddresses(addresses).
+		WithFrontend(infrav1.HAProxyFrontend{Name: "konnectivity", Port: 8132}, addresses)
+	renderConfig.Hostname = "haproxy-lb"
+	renderConfig.IPv4Address = "192.168.0.2"
+	renderConfig.IPv6Address = "fd00::2"
+
+	for _, ipv6 := range []bool{false, true} {
+		renderConfig.IPv6 = ipv6
+		haproxyCfg, err := renderConfig.RenderHAProxyConfiguration()
+		if err != nil {
+			return err
+		}
+		for _, section := range requiredConfigurationSections {
+			if !section.MatchString(haproxyCfg) {
+				return errors.Errorf("rendered HAProxy configuration does not match %q", section)
+			}
+		}
+		if !apiServerBind.MatchString(configurationSectionBody(haproxyCfg, apiServerFrontendSection)) {
+			return errors.Errorf("rendered HAProxy configuration has no bind named %q in frontend %s", apiServerBindName, apiServerFrontendName)
+		}
+	}
+	return nil
+}
+
+// configurationSectionBody returns the lines of the first section of the
+// HAProxy configuration whose header matches, up to the next section.
+func configurationSectionBody(haproxyCfg string, header *regexp.Regexp) string {
+	loc := header.FindStringIndex(haproxyCfg)
+	if loc == nil {
+		return ""
+	}
+	body := haproxyCfg[loc[1]:]
+	if next := configurationSection.FindStringIndex(body); next != nil {
+		body = body[:next[0]]
+	}
+	return body
+}
+
+// ConfigurationTemplateValidator validates the HAProxy configuration
+// templates of the ConfigMaps labeled with
+// infrav1.HAProxyConfigurationTemplateLabel. Each key of their data holds a
+// template.
+type ConfigurationTemplateValidator struct {
+	decoder *admission.Decoder
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-v1-configmap-haproxy-configuration-template,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups="",resources=configmaps,versions=v1,name=validation.haproxyconfigurationtemplate.infrastructure.x-k8s.io,sideEffects=None,admissionReviewVersions=v1beta1
+
+// Handle implements admission.Handler.
+func (v *ConfigurationTemplateValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	configMap := &corev1.ConfigMap{}
+	if err := v.decoder.Decode(req, configMap); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if _, ok := configMap.Labels[infrav1.HAProxyConfigurationTemplateLabel]; !ok {
+		return admission.Allowed("")
+	}
+
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := ValidateConfigurationTemplate(configMap.Data[key]); err != nil {
+			return admission.Denied(fmt.Sprintf("invalid HAProxy configuration template in key %q: %v", key, err))
+		}
+	}
+	return admission.Allowed("")
+}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (v *ConfigurationTemplateValidator) InjectDecoder(decoder *admission.Decoder) error {
+	v.decoder = decoder
+	return nil
+}
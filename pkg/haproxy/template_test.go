@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy_test
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/haproxy"
+)
+
+const testConfigurationTemplate = `
+defaults
+  mode tcp
+  timeout client 1h
+  timeout server 1h
+
+frontend kube_api_frontend
+  bind {{ if .IPv6 }}:::{{ .Port }} v4v6{{ else }}*:{{ .Port }}{{ end }} name lb
+  default_backend kube_api_backend
+
+backend kube_api_backend
+  balance leastconn{{ $port := .Port }}{{ range .Addresses }}
+  server {{ .NodeName }} {{ .IP }}:{{ $port }} check{{ end }}
+`
+
+func TestValidateConfigurationTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  bool
+	}{
+		{
+			name:     "custom template",
+			template: testConfigurationTemplate,
+		},
+		{
+			name:     "template that does not parse",
+			template: "frontend kube_api_frontend\n  bind *:{{ .Port }",
+			wantErr:  true,
+		},
+		{
+			name:     "template that does not render",
+			template: testConfigurationTemplate + "{{ .NoSuchField }}",
+			wantErr:  true,
+		},
+		{
+			name:     "template without the API server bind",
+			template: "frontend kube_api_frontend\n  bind *:{{ .Port }}\n  default_backend kube_api_backend\n\nbackend kube_api_backend\n",
+			wantErr:  true,
+		},
+		{
+			name:     "template with the API server bind in another frontend",
+			template: "frontend kube_api_frontend\n  default_backend kube_api_backend\n\nfrontend other\n  bind *:{{ .Port }} name lb\n\nbackend kube_api_backend\n",
+			wantErr:  true,
+		},
+		{
+			name:     "template without the API server backend",
+			template: "frontend kube_api_frontend\n  bind *:{{ .Port }} name lb\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			err := haproxy.ValidateConfigurationTemplate(tt.template)
+			if tt.wantErr {
+				g.Expect(err).To(gomega.HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestRenderHAProxyConfigurationWithTemplate(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	renderConfig := haproxy.NewRenderConfiguration().
+		WithConfigurationTemplate(testConfigurationTemplate)
+	haproxyCfg, err := renderConfig.RenderHAProxyConfiguration()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(haproxyCfg).To(gomega.ContainSubstring("balance leastconn"))
+	g.Expect(haproxyCfg).To(gomega.ContainSubstring("bind *:6443 name lb"))
+
+	renderConfig = renderConfig.WithIPv6(true)
+	haproxyCfg, err = renderConfig.RenderHAProxyConfiguration()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(haproxyCfg).To(gomega.ContainSubstring("bind :::6443 v4v6 name lb"))
+}
+
+func TestRenderKeepalivedConfiguration(t *testing.T) {
+	tests := []struct {
+		name      string
+		virtualIP string
+		ipv6      bool
+		contains  []string
+		excludes  []string
+	}{
+		{
+			name:      "IPv4 virtual IP",
+			virtualIP: "192.168.0.2",
+			contains:  []string{"auth_pass secret", "192.168.0.2"},
+			excludes:  []string{"native_ipv6"},
+		},
+		{
+			name:      "IPv6 virtual IP",
+			virtualIP: "fd00::2",
+			ipv6:      true,
+			contains:  []string{"version 3", "native_ipv6", "fd00::2"},
+			excludes:  []string{"auth_pass"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			renderConfig := haproxy.NewRenderConfiguration()
+			renderConfig.Keepalived = &haproxy.KeepalivedConfig{
+				VirtualIP:       tt.virtualIP,
+				VirtualRouterID: 51,
+				Password:        "secret",
+				IPv6:            tt.ipv6,
+			}
+			keepalivedCfg, err := renderConfig.RenderKeepalivedConfiguration()
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			for _, s := range tt.contains {
+				g.Expect(keepalivedCfg).To(gomega.ContainSubstring(s))
+			}
+			for _, s := range tt.excludes {
+				g.Expect(keepalivedCfg).NotTo(gomega.ContainSubstring(s))
+			}
+		})
+	}
+}
@@ -26,6 +26,8 @@ import (
 	"math/big"
 	"net"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 const (
@@ -79,6 +81,46 @@ func generateSigningCertificateKeyPair(notBefore, notAfter time.Time) (publicKey
 	return caCertPEM, caPrivateKeyPEM, nil
 }
 
+// renewSigningCertificate self-signs the signing certificate again with its
+// key, subject and key identifier so the certificates it signed before it is
+// renewed remain valid.
+func renewSigningCertificate(signingCertificatePEM, signingKeyPEM []byte, notBefore, notAfter time.Time) ([]byte, error) {
+	signingCertificate, err := parseCertificate(signingCertificatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKeyPEMBlock, _ := pem.Decode(signingKeyPEM)
+	if signingKeyPEMBlock == nil {
+		return nil, errors.New("failed to decode PEM-encoded signing key")
+	}
+	signingKey, err := x509.ParsePKCS1PrivateKey(signingKeyPEMBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          newSerial(notBefore),
+		Subject:               signingCertificate.Subject,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		SubjectKeyId:          signingCertificate.SubjectKeyId,
+		IsCA:                  true,
+		KeyUsage:              signingCertificate.KeyUsage,
+		BasicConstraintsValid: true,
+	}
+
+	caBytes, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &signingKey.PublicKey, signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  pemTypeCertificate,
+		Bytes: caBytes,
+	}), nil
+}
+
 func generateAndSignClientCertificateKeyPair(
 	signingCertificatePEM []byte,
 	signingKeyPEM []byte,
@@ -151,3 +193,22 @@ func bigIntHash(n *big.Int) []byte {
 	_, _ = h.Write(n.Bytes())
 	return h.Sum(nil)
 }
+
+// parseCertificate returns the first certificate in the PEM-encoded data.
+func parseCertificate(certificatePEM []byte) (*x509.Certificate, error) {
+	certificatePEMBlock, _ := pem.Decode(certificatePEM)
+	if certificatePEMBlock == nil {
+		return nil, errors.New("failed to decode PEM-encoded certificate")
+	}
+	return x509.ParseCertificate(certificatePEMBlock.Bytes)
+}
+
+// certificateNotAfter returns the time after which the first certificate in
+// the PEM-encoded data is no longer valid.
+func certificateNotAfter(certificatePEM []byte) (time.Time, error) {
+	certificate, err := parseCertificate(certificatePEM)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return certificate.NotAfter, nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+)
+
+func TestRenewSigningCertificate(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	notBefore := time.Now().UTC().Add(DefaultNegativeTimeSkew)
+	caCertPEM, caKeyPEM, err := generateSigningCertificateKeyPair(notBefore, notBefore.Add(24*time.Hour))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	clientCertPEM, _, err := generateAndSignClientCertificateKeyPair(caCertPEM, caKeyPEM, notBefore, notBefore.AddDate(1, 0, 0), "192.168.0.1")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	renewedCACertPEM, err := renewSigningCertificate(caCertPEM, caKeyPEM, notBefore, notBefore.AddDate(10, 0, 0))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	notAfter, err := certificateNotAfter(renewedCACertPEM)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(notAfter).To(gomega.BeTemporally("~", notBefore.AddDate(10, 0, 0), time.Second))
+
+	// The client certificate signed before the renewal is verified with the
+	// renewed signing certificate, even once the previous one has expired.
+	renewedCACert, err := parseCertificate(renewedCACertPEM)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	clientCert, err := parseCertificate(clientCertPEM)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	roots := x509.NewCertPool()
+	roots.AddCert(renewedCACert)
+	_, err = clientCert.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: notBefore.Add(48 * time.Hour),
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+}
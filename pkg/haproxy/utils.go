@@ -19,6 +19,9 @@ package haproxy
 import (
 	"net/http"
 
+	utilnet "k8s.io/utils/net"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+
 	hapi "sigs.k8s.io/cluster-api-provider-vsphere/contrib/haproxy/openapi"
 )
 
@@ -27,6 +30,33 @@ func AddrOfInt32(i int32) *int32 {
 	return &i
 }
 
+// ClusterIPv6 returns whether the pod and service networks of the cluster
+// are all IPv6 networks, i.e. it is an IPv6 cluster, and whether one of them
+// is, i.e. it is an IPv6 or dual-stack cluster. The load balancer listens on
+// IPv6 as well as IPv4 in the latter case, and its replicas are reached on
+// their IPv6 address in the former.
+func ClusterIPv6(cluster *clusterv1.Cluster) (ipv6Only, ipv6Enabled bool) {
+	if cluster == nil || cluster.Spec.ClusterNetwork == nil {
+		return false, false
+	}
+	var cidrBlocks []string
+	if pods := cluster.Spec.ClusterNetwork.Pods; pods != nil {
+		cidrBlocks = append(cidrBlocks, pods.CIDRBlocks...)
+	}
+	if services := cluster.Spec.ClusterNetwork.Services; services != nil {
+		cidrBlocks = append(cidrBlocks, services.CIDRBlocks...)
+	}
+	ipv6Only = len(cidrBlocks) > 0
+	for _, cidrBlock := range cidrBlocks {
+		if utilnet.IsIPv6CIDRString(cidrBlock) {
+			ipv6Enabled = true
+		} else {
+			ipv6Only = false
+		}
+	}
+	return ipv6Only, ipv6Enabled
+}
+
 // IsNotFound returns true if the provided error indicates a resource is
 // not found.
 func IsNotFound(err error) bool {
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy_test
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/haproxy"
+)
+
+func TestClusterIPv6(t *testing.T) {
+	tests := []struct {
+		name                string
+		network             *clusterv1.ClusterNetwork
+		expectedIPv6Only    bool
+		expectedIPv6Enabled bool
+	}{
+		{
+			name: "without cluster network",
+		},
+		{
+			name:    "without network ranges",
+			network: &clusterv1.ClusterNetwork{},
+		},
+		{
+			name: "IPv4 cluster",
+			network: &clusterv1.ClusterNetwork{
+				Pods:     &clusterv1.NetworkRanges{CIDRBlocks: []string{"192.168.0.0/16"}},
+				Services: &clusterv1.NetworkRanges{CIDRBlocks: []string{"10.128.0.0/12"}},
+			},
+		},
+		{
+			name: "IPv6 cluster",
+			network: &clusterv1.ClusterNetwork{
+				Pods:     &clusterv1.NetworkRanges{CIDRBlocks: []string{"fd00:100::/56"}},
+				Services: &clusterv1.NetworkRanges{CIDRBlocks: []string{"fd00:200::/108"}},
+			},
+			expectedIPv6Only:    true,
+			expectedIPv6Enabled: true,
+		},
+		{
+			name: "dual-stack cluster",
+			network: &clusterv1.ClusterNetwork{
+				Pods:     &clusterv1.NetworkRanges{CIDRBlocks: []string{"fd00:100::/56", "192.168.0.0/16"}},
+				Services: &clusterv1.NetworkRanges{CIDRBlocks: []string{"fd00:200::/108", "10.128.0.0/12"}},
+			},
+			expectedIPv6Enabled: true,
+		},
+		{
+			name: "IPv6 service network only",
+			network: &clusterv1.ClusterNetwork{
+				Services: &clusterv1.NetworkRanges{CIDRBlocks: []string{"fd00:200::/108"}},
+			},
+			expectedIPv6Only:    true,
+			expectedIPv6Enabled: true,
+		},
+		{
+			name: "IPv6 service network and IPv4 pod network",
+			network: &clusterv1.ClusterNetwork{
+				Pods:     &clusterv1.NetworkRanges{CIDRBlocks: []string{"192.168.0.0/16"}},
+				Services: &clusterv1.NetworkRanges{CIDRBlocks: []string{"fd00:200::/108"}},
+			},
+			expectedIPv6Enabled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			cluster := &clusterv1.Cluster{Spec: clusterv1.ClusterSpec{ClusterNetwork: tt.network}}
+			ipv6Only, ipv6Enabled := haproxy.ClusterIPv6(cluster)
+			g.Expect(ipv6Only).To(gomega.Equal(tt.expectedIPv6Only))
+			g.Expect(ipv6Enabled).To(gomega.Equal(tt.expectedIPv6Enabled))
+		})
+	}
+
+	g := gomega.NewWithT(t)
+	ipv6Only, ipv6Enabled := haproxy.ClusterIPv6(nil)
+	g.Expect(ipv6Only).To(gomega.BeFalse())
+	g.Expect(ipv6Enabled).To(gomega.BeFalse())
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ipam allocates the addresses of a VSphereIPPool.
+package ipam
+
+import (
+	"bytes"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+)
+
+// ErrPoolExhausted is returned when all the addresses of a pool are in use.
+var ErrPoolExhausted = errors.New("no address left in the pool")
+
+type ipRange struct {
+	start net.IP
+	end   net.IP
+}
+
+func (r ipRange) contains(ip net.IP) bool {
+	return bytes.Compare(ip, r.start) >= 0 && bytes.Compare(ip, r.end) <= 0
+}
+
+// Pool keeps track of the addresses of a VSphereIPPool which are in use.
+type Pool struct {
+	network *net.IPNet
+	ranges  []ipRange
+	gateway net.IP
+	used    map[string]struct{}
+}
+
+// NewPool returns a Pool for the spec of a VSphereIPPool, in which only the
+// gateway is in use.
+func NewPool(spec infrav1.VSphereIPPoolSpec) (*Pool, error) {
+	_, network, err := net.ParseCIDR(spec.CIDR)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid CIDR %q", spec.CIDR)
+	}
+	pool := &Pool{
+		network: network,
+		used:    map[string]struct{}{},
+	}
+
+	if spec.Gateway != "" {
+		if pool.gateway = pool.parseIP(spec.Gateway); pool.gateway == nil || !network.Contains(pool.gateway) {
+			return nil, errors.Errorf("gateway %q is not an address of %s", spec.Gateway, network)
+		}
+		pool.Reserve(pool.gateway)
+	}
+
+	if len(spec.Ranges) == 0 {
+		pool.ranges = []ipRange{hostRange(network)}
+		return pool, nil
+	}
+	for _, r := range spec.Ranges {
+		start, end := pool.parseIP(r.Start), pool.parseIP(r.End)
+		if start == nil || !network.Contains(start) {
+			return nil, errors.Errorf("range start %q is not an address of %s", r.Start, network)
+		}
+		if end == nil || !network.Contains(end) {
+			return nil, errors.Errorf("range end %q is not an address of %s", r.End, network)
+		}
+		if bytes.Compare(start, end) > 0 {
+			return nil, errors.Errorf("range start %q is after range end %q", r.Start, r.End)
+		}
+		pool.ranges = append(pool.ranges, ipRange{start: start, end: end})
+	}
+	return pool, nil
+}
+
+// hostRange returns the range of the host addresses of the network, which
+// excludes the network and broadcast addresses of IPv4 networks larger than
+// two addresses.
+func hostRange(network *net.IPNet) ipRange {
+	start := network.IP
+	end := make(net.IP, len(start))
+	for i := range start {
+		end[i] = start[i] | ^network.Mask[i]
+	}
+	if ones, bits := network.Mask.Size(); bits-ones > 1 {
+		start = nextIP(start)
+		if bits == 8*net.IPv4len {
+			end = previousIP(end)
+		}
+	}
+	return ipRange{start: start, end: end}
+}
+
+// parseIP parses an address, with or without prefix length, in the address
+// family of the pool.
+func (p *Pool) parseIP(address string) net.IP {
+	if i := strings.IndexByte(address, '/'); i >= 0 {
+		address = address[:i]
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil
+	}
+	if len(p.network.IP) == net.IPv4len {
+		return ip.To4()
+	}
+	if ip.To4() != nil {
+		return nil
+	}
+	return ip
+}
+
+// Contains returns whether the address, with or without prefix length, is
+// one of the addresses allocated by the pool.
+func (p *Pool) Contains(address string) bool {
+	ip := p.parseIP(address)
+	if ip == nil || !p.network.Contains(ip) || ip.Equal(p.gateway) {
+		return false
+	}
+	for _, r := range p.ranges {
+		if r.contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reserve marks the address as in use. It returns false if the address was
+// already in use.
+func (p *Pool) Reserve(ip net.IP) bool {
+	key := ip.String()
+	if _, ok := p.used[key]; ok {
+		return false
+	}
+	p.used[key] = struct{}{}
+	return true
+}
+
+// ReserveAddress is like Reserve for an address which may have a prefix
+// length. Addresses which are not in the pool are ignored.
+func (p *Pool) ReserveAddress(address string) bool {
+	if !p.Contains(address) {
+		return true
+	}
+	return p.Reserve(p.parseIP(address))
+}
+
+// Allocate reserves the lowest address of the pool which is not in use and
+// returns it with the prefix length of the pool, for example 10.0.0.2/24.
+func (p *Pool) Allocate() (string, error) {
+	for _, r := range p.ranges {
+		for ip := r.start; r.contains(ip); ip = nextIP(ip) {
+			if p.Reserve(ip) {
+				return p.withPrefix(ip), nil
+			}
+			if ip.Equal(r.end) {
+				break
+			}
+		}
+	}
+	return "", ErrPoolExhausted
+}
+
+// IsIPv6 returns whether the addresses of the pool are IPv6 addresses.
+func (p *Pool) IsIPv6() bool {
+	return len(p.network.IP) == net.IPv6len
+}
+
+func (p *Pool) withPrefix(ip net.IP) string {
+	ones, _ := p.network.Mask.Size()
+	return (&net.IPNet{IP: ip, Mask: net.CIDRMask(ones, 8*len(ip))}).String()
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func previousIP(ip net.IP) net.IP {
+	previous := make(net.IP, len(ip))
+	copy(previous, ip)
+	for i := len(previous) - 1; i >= 0; i-- {
+		previous[i]--
+		if previous[i] != 0xff {
+			break
+		}
+	}
+	return previous
+}
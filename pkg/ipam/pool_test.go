@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam_test
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/ipam"
+)
+
+func Test_PoolAllocate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		spec        infrav1.VSphereIPPoolSpec
+		reserved    []string
+		allocated   []string
+		exhausted   bool
+		expectedErr string
+	}{
+		{
+			name:      "IPv4 CIDR without ranges",
+			spec:      infrav1.VSphereIPPoolSpec{CIDR: "10.0.0.0/30"},
+			allocated: []string{"10.0.0.1/30", "10.0.0.2/30"},
+			exhausted: true,
+		},
+		{
+			name:      "IPv4 CIDR skips the gateway",
+			spec:      infrav1.VSphereIPPoolSpec{CIDR: "10.0.0.0/29", Gateway: "10.0.0.1"},
+			allocated: []string{"10.0.0.2/29", "10.0.0.3/29"},
+		},
+		{
+			name: "IPv4 ranges skip reserved addresses",
+			spec: infrav1.VSphereIPPoolSpec{
+				CIDR: "192.168.10.0/24",
+				Ranges: []infrav1.IPRange{
+					{Start: "192.168.10.10", End: "192.168.10.11"},
+					{Start: "192.168.10.20", End: "192.168.10.20"},
+				},
+			},
+			reserved:  []string{"192.168.10.10/24"},
+			allocated: []string{"192.168.10.11/24", "192.168.10.20/24"},
+			exhausted: true,
+		},
+		{
+			name: "IPv6 CIDR",
+			spec: infrav1.VSphereIPPoolSpec{
+				CIDR:    "fd00:10::/64",
+				Gateway: "fd00:10::1",
+			},
+			allocated: []string{"fd00:10::2/64", "fd00:10::3/64"},
+		},
+		{
+			name:        "invalid CIDR",
+			spec:        infrav1.VSphereIPPoolSpec{CIDR: "10.0.0.0"},
+			expectedErr: `invalid CIDR "10.0.0.0": invalid CIDR address: 10.0.0.0`,
+		},
+		{
+			name: "gateway outside of the CIDR",
+			spec: infrav1.VSphereIPPoolSpec{
+				CIDR:    "10.0.0.0/24",
+				Gateway: "10.0.1.1",
+			},
+			expectedErr: `gateway "10.0.1.1" is not an address of 10.0.0.0/24`,
+		},
+		{
+			name: "range outside of the CIDR",
+			spec: infrav1.VSphereIPPoolSpec{
+				CIDR:   "10.0.0.0/24",
+				Ranges: []infrav1.IPRange{{Start: "10.0.0.10", End: "10.0.1.10"}},
+			},
+			expectedErr: `range end "10.0.1.10" is not an address of 10.0.0.0/24`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+
+			pool, err := ipam.NewPool(tc.spec)
+			if tc.expectedErr != "" {
+				g.Expect(err).To(gomega.MatchError(tc.expectedErr))
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+
+			for _, address := range tc.reserved {
+				g.Expect(pool.ReserveAddress(address)).To(gomega.BeTrue())
+			}
+			for _, expected := range tc.allocated {
+				address, err := pool.Allocate()
+				g.Expect(err).NotTo(gomega.HaveOccurred())
+				g.Expect(address).To(gomega.Equal(expected))
+			}
+			if tc.exhausted {
+				_, err = pool.Allocate()
+				g.Expect(err).To(gomega.Equal(ipam.ErrPoolExhausted))
+			}
+		})
+	}
+}
+
+func Test_PoolReserveAddress(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	pool, err := ipam.NewPool(infrav1.VSphereIPPoolSpec{CIDR: "10.0.0.0/24", Gateway: "10.0.0.1"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(pool.Contains("10.0.0.1")).To(gomega.BeFalse())
+	g.Expect(pool.Contains("10.0.1.5/24")).To(gomega.BeFalse())
+	g.Expect(pool.Contains("10.0.0.5/24")).To(gomega.BeTrue())
+
+	g.Expect(pool.ReserveAddress("10.0.0.5/24")).To(gomega.BeTrue())
+	g.Expect(pool.ReserveAddress("10.0.0.5")).To(gomega.BeFalse())
+	g.Expect(pool.ReserveAddress("10.0.1.5/24")).To(gomega.BeTrue())
+}
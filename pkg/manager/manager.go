@@ -22,10 +22,13 @@ import (
 	"os"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
 	bootstrapv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1alpha4"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 
 	infrav1a3 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
 	infrav1a4 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
@@ -59,6 +62,20 @@ func New(opts Options) (Manager, error) {
 		podName = DefaultPodName
 	}
 
+	// The controllers only read the ConfigMaps holding HAProxy configuration
+	// templates, so the other ConfigMaps of the cluster are not cached.
+	if opts.NewCache == nil {
+		configMapSelector, err := labels.Parse(infrav1a4.HAProxyConfigurationTemplateLabel)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse ConfigMap selector")
+		}
+		opts.NewCache = cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.ConfigMap{}: {Label: configMapSelector},
+			},
+		})
+	}
+
 	// Build the controller manager.
 	mgr, err := ctrl.NewManager(opts.KubeConfig, opts.Options)
 	if err != nil {
@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics defines the CAPV specific metrics, which are served by the
+// metrics endpoint of the manager along with the controller-runtime metrics.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	namespace = "capv"
+
+	// TaskOperationClone is the operation of the tasks creating a VM.
+	TaskOperationClone = "clone"
+	// TaskOperationPowerOn is the operation of the tasks powering on a VM.
+	TaskOperationPowerOn = "powerOn"
+	// TaskOperationReconfigure is the operation of the tasks reconfiguring a
+	// VM or its placement.
+	TaskOperationReconfigure = "reconfigure"
+	// TaskOperationDestroy is the operation of the tasks destroying a VM.
+	TaskOperationDestroy = "destroy"
+	// TaskOperationOther is the operation of any other task.
+	TaskOperationOther = "other"
+
+	// ResultSuccess labels a successful operation.
+	ResultSuccess = "success"
+	// ResultFailure labels a failed operation.
+	ResultFailure = "failure"
+)
+
+var (
+	// TaskDuration is the duration of the vSphere tasks tracked by
+	// VSphereVMs, from the time they are queued until they complete.
+	TaskDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "vsphere",
+			Name:      "task_duration_seconds",
+			Help:      "Duration of the vSphere tasks, from the time they are queued until they complete.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		[]string{"server", "datacenter", "operation"},
+	)
+
+	// TaskFailures is the number of failed vSphere tasks tracked by
+	// VSphereVMs.
+	TaskFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vsphere",
+			Name:      "task_failures_total",
+			Help:      "Number of failed vSphere tasks.",
+		},
+		[]string{"server", "datacenter", "operation"},
+	)
+
+	// VMProvisioningDuration is the time from the creation of a VSphereVM
+	// until its VMProvisionedCondition is true.
+	VMProvisioningDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "vspherevm",
+			Name:      "provisioning_duration_seconds",
+			Help:      "Time from the creation of a VSphereVM until it is provisioned.",
+			Buckets:   prometheus.ExponentialBuckets(15, 2, 10),
+		},
+		[]string{"server", "datacenter"},
+	)
+
+	// ActiveSessions is the number of cached vSphere sessions.
+	ActiveSessions = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "vsphere",
+			Name:      "sessions_active",
+			Help:      "Number of cached vSphere sessions.",
+		},
+	)
+
+	// HAProxyReconfigurations is the number of configurations posted to the
+	// HAProxy dataplane API.
+	HAProxyReconfigurations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "haproxy",
+			Name:      "dataplane_reconfigurations_total",
+			Help:      "Number of configurations posted to the HAProxy dataplane API.",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		TaskDuration,
+		TaskFailures,
+		VMProvisioningDuration,
+		ActiveSessions,
+		HAProxyReconfigurations,
+	)
+}
+
+// ObserveTask records the duration and the result of a completed task.
+func ObserveTask(server, datacenter, operation string, duration time.Duration, failed bool) {
+	TaskDuration.WithLabelValues(server, datacenter, operation).Observe(duration.Seconds())
+	if failed {
+		TaskFailures.WithLabelValues(server, datacenter, operation).Inc()
+	}
+}
+
+// TaskOperation returns the operation of a task from the ID of its
+// description, e.g. VirtualMachine.powerOn.
+func TaskOperation(descriptionID string) string {
+	switch descriptionID {
+	case "VirtualMachine.clone", "Folder.createVm":
+		return TaskOperationClone
+	case "VirtualMachine.powerOn":
+		return TaskOperationPowerOn
+	case "VirtualMachine.reconfigure", "VirtualMachine.relocate", "ClusterComputeResource.reconfigureEx":
+		return TaskOperationReconfigure
+	case "VirtualMachine.destroy":
+		return TaskOperationDestroy
+	default:
+		return TaskOperationOther
+	}
+}
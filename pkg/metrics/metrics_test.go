@@ -0,0 +1,38 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveTask(t *testing.T) {
+	g := NewWithT(t)
+
+	ObserveTask("vcenter", "dc", TaskOperation("VirtualMachine.clone"), time.Minute, false)
+	ObserveTask("vcenter", "dc", TaskOperation("VirtualMachine.powerOn"), time.Second, true)
+	ObserveTask("vcenter", "dc", TaskOperation("Folder.createVm"), time.Minute, true)
+
+	g.Expect(testutil.CollectAndCount(TaskDuration)).To(Equal(2))
+	g.Expect(testutil.ToFloat64(TaskFailures.WithLabelValues("vcenter", "dc", TaskOperationClone))).To(Equal(float64(1)))
+	g.Expect(testutil.ToFloat64(TaskFailures.WithLabelValues("vcenter", "dc", TaskOperationPowerOn))).To(Equal(float64(1)))
+	g.Expect(testutil.ToFloat64(TaskFailures.WithLabelValues("vcenter", "dc", TaskOperationDestroy))).To(Equal(float64(0)))
+}
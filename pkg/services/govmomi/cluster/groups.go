@@ -0,0 +1,284 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+type computeClusterContext interface {
+	context.Context
+	GetLogger() logr.Logger
+	GetSession() *session.Session
+}
+
+var (
+	computeClusterLocksMu sync.Mutex
+	computeClusterLocks   = map[types.ManagedObjectReference]*sync.Mutex{}
+)
+
+// lockComputeCluster serializes the changes to the members of the groups
+// and rules of a compute cluster. vSphere replaces the members of a group or
+// rule as a whole, so concurrent changes computed from the same
+// configuration would overwrite each other. The returned function releases
+// the lock.
+func lockComputeCluster(computeCluster *object.ClusterComputeResource) func() {
+	computeClusterLocksMu.Lock()
+	mu, ok := computeClusterLocks[computeCluster.Reference()]
+	if !ok {
+		mu = &sync.Mutex{}
+		computeClusterLocks[computeCluster.Reference()] = mu
+	}
+	computeClusterLocksMu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// FindHostGroup returns the host group with the provided name from the
+// configuration of the compute cluster, or nil if it does not exist.
+func FindHostGroup(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name string) (*types.ClusterHostGroup, error) {
+	group, err := findGroup(ctx, computeCluster, name)
+	if err != nil || group == nil {
+		return nil, err
+	}
+	hostGroup, ok := group.(*types.ClusterHostGroup)
+	if !ok {
+		return nil, errors.Errorf("group %q of compute cluster %s is not a host group", name, computeCluster.Reference())
+	}
+	return hostGroup, nil
+}
+
+// FindVMGroup returns the VM group with the provided name from the
+// configuration of the compute cluster, or nil if it does not exist.
+func FindVMGroup(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name string) (*types.ClusterVmGroup, error) {
+	group, err := findGroup(ctx, computeCluster, name)
+	if err != nil || group == nil {
+		return nil, err
+	}
+	vmGroup, ok := group.(*types.ClusterVmGroup)
+	if !ok {
+		return nil, errors.Errorf("group %q of compute cluster %s is not a VM group", name, computeCluster.Reference())
+	}
+	return vmGroup, nil
+}
+
+func findGroup(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name string) (types.BaseClusterGroupInfo, error) {
+	clusterConfig, err := computeCluster.Configuration(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get configuration of compute cluster %s", computeCluster.Reference())
+	}
+	for _, group := range clusterConfig.Group {
+		if group.GetClusterGroupInfo().Name == name {
+			return group, nil
+		}
+	}
+	return nil, nil
+}
+
+// EnsureHostGroup creates the host group with the provided name, or updates
+// its members when they differ from the provided hosts.
+func EnsureHostGroup(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name string, hosts []types.ManagedObjectReference) error {
+	hostGroup, err := FindHostGroup(ctx, computeCluster, name)
+	if err != nil {
+		return err
+	}
+
+	operation := types.ArrayUpdateOperationAdd
+	if hostGroup != nil {
+		if sameReferences(hostGroup.Host, hosts) {
+			return nil
+		}
+		operation = types.ArrayUpdateOperationEdit
+	}
+
+	ctx.GetLogger().Info("configuring host group", "compute-cluster", computeCluster.Reference(), "host-group", name)
+	return reconfigure(ctx, computeCluster, &types.ClusterConfigSpecEx{
+		GroupSpec: []types.ClusterGroupSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: operation},
+				Info: &types.ClusterHostGroup{
+					ClusterGroupInfo: types.ClusterGroupInfo{Name: name},
+					Host:             hosts,
+				},
+			},
+		},
+	})
+}
+
+// EnsureVMGroup creates an empty VM group with the provided name if it does
+// not exist. The members of an existing VM group are left untouched.
+func EnsureVMGroup(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name string) error {
+	vmGroup, err := FindVMGroup(ctx, computeCluster, name)
+	if err != nil || vmGroup != nil {
+		return err
+	}
+
+	ctx.GetLogger().Info("creating VM group", "compute-cluster", computeCluster.Reference(), "vm-group", name)
+	return reconfigure(ctx, computeCluster, &types.ClusterConfigSpecEx{
+		GroupSpec: []types.ClusterGroupSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+				Info: &types.ClusterVmGroup{
+					ClusterGroupInfo: types.ClusterGroupInfo{Name: name},
+				},
+			},
+		},
+	})
+}
+
+// EnsureVMHostAffinityRule creates a non-mandatory rule with the provided
+// name which places the VMs of the VM group on the hosts of the host group.
+func EnsureVMHostAffinityRule(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name, vmGroupName, hostGroupName string) error {
+	clusterConfig, err := computeCluster.Configuration(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get configuration of compute cluster %s", computeCluster.Reference())
+	}
+
+	rule := &types.ClusterVmHostRuleInfo{
+		ClusterRuleInfo: types.ClusterRuleInfo{
+			Name:      name,
+			Enabled:   pointer.Bool(true),
+			Mandatory: pointer.Bool(false),
+		},
+		VmGroupName:         vmGroupName,
+		AffineHostGroupName: hostGroupName,
+	}
+	operation := types.ArrayUpdateOperationAdd
+	for _, r := range clusterConfig.Rule {
+		existing, ok := r.(*types.ClusterVmHostRuleInfo)
+		if !ok || existing.Name != name {
+			continue
+		}
+		if existing.VmGroupName == vmGroupName && existing.AffineHostGroupName == hostGroupName {
+			return nil
+		}
+		rule.Key = existing.Key
+		operation = types.ArrayUpdateOperationEdit
+		break
+	}
+
+	ctx.GetLogger().Info("configuring VM-host affinity rule", "compute-cluster", computeCluster.Reference(), "rule", name)
+	return reconfigure(ctx, computeCluster, &types.ClusterConfigSpecEx{
+		RulesSpec: []types.ClusterRuleSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: operation},
+				Info:            rule,
+			},
+		},
+	})
+}
+
+// AddVMToGroup adds the VM to the VM group with the provided name, if it is
+// not a member of the group yet.
+func AddVMToGroup(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name string, vm types.ManagedObjectReference) error {
+	unlock := lockComputeCluster(computeCluster)
+	defer unlock()
+
+	vmGroup, err := FindVMGroup(ctx, computeCluster, name)
+	if err != nil {
+		return err
+	}
+	if vmGroup == nil {
+		return errors.Errorf("unable to find VM group %q in compute cluster %s", name, computeCluster.Reference())
+	}
+	for _, ref := range vmGroup.Vm {
+		if ref == vm {
+			return nil
+		}
+	}
+
+	vmGroup.Vm = append(vmGroup.Vm, vm)
+	ctx.GetLogger().Info("adding vm to VM group", "compute-cluster", computeCluster.Reference(), "vm-group", name, "vm", vm)
+	return reconfigure(ctx, computeCluster, &types.ClusterConfigSpecEx{
+		GroupSpec: []types.ClusterGroupSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationEdit},
+				Info:            vmGroup,
+			},
+		},
+	})
+}
+
+// RemoveVMFromGroup removes the VM from the VM group with the provided name,
+// if it is a member of the group.
+func RemoveVMFromGroup(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name string, vm types.ManagedObjectReference) error {
+	unlock := lockComputeCluster(computeCluster)
+	defer unlock()
+
+	vmGroup, err := FindVMGroup(ctx, computeCluster, name)
+	if err != nil || vmGroup == nil {
+		return err
+	}
+
+	vms := make([]types.ManagedObjectReference, 0, len(vmGroup.Vm))
+	for _, ref := range vmGroup.Vm {
+		if ref != vm {
+			vms = append(vms, ref)
+		}
+	}
+	if len(vms) == len(vmGroup.Vm) {
+		return nil
+	}
+
+	vmGroup.Vm = vms
+	ctx.GetLogger().Info("removing vm from VM group", "compute-cluster", computeCluster.Reference(), "vm-group", name, "vm", vm)
+	return reconfigure(ctx, computeCluster, &types.ClusterConfigSpecEx{
+		GroupSpec: []types.ClusterGroupSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationEdit},
+				Info:            vmGroup,
+			},
+		},
+	})
+}
+
+func reconfigure(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, spec *types.ClusterConfigSpecEx) error {
+	task, err := computeCluster.Reconfigure(ctx, spec, true)
+	if err != nil {
+		return errors.Wrapf(err, "unable to reconfigure compute cluster %s", computeCluster.Reference())
+	}
+	if err := task.Wait(ctx); err != nil {
+		return errors.Wrapf(err, "failed to reconfigure compute cluster %s", computeCluster.Reference())
+	}
+	return nil
+}
+
+func sameReferences(a, b []types.ManagedObjectReference) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	refs := make(map[types.ManagedObjectReference]struct{}, len(a))
+	for _, ref := range a {
+		refs[ref] = struct{}{}
+	}
+	for _, ref := range b {
+		if _, ok := refs[ref]; !ok {
+			return false
+		}
+	}
+	return true
+}
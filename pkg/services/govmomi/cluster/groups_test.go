@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+type testContext struct {
+	context.Context
+	session *session.Session
+}
+
+func (c *testContext) GetLogger() logr.Logger {
+	return logr.Discard()
+}
+
+func (c *testContext) GetSession() *session.Session {
+	return c.session
+}
+
+// newTestContext returns a context connected to a simulated vCenter, along
+// with its compute cluster and a VM running in the compute cluster.
+func newTestContext(t *testing.T) (*testContext, *object.ClusterComputeResource, types.ManagedObjectReference) {
+	g := NewWithT(t)
+
+	model := simulator.VPX()
+	g.Expect(model.Create()).To(Succeed())
+	t.Cleanup(model.Remove)
+	model.Service.TLS = new(tls.Config)
+
+	s := model.Service.NewServer()
+	t.Cleanup(s.Close)
+	pass, _ := s.URL.User.Password()
+
+	ctx := &testContext{Context: context.Background()}
+	var err error
+	ctx.session, err = session.GetOrCreate(ctx, session.NewParams().
+		WithServer(s.URL.Host).
+		WithUserInfo(s.URL.User.Username(), pass))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	computeCluster, err := ctx.session.Finder.ClusterComputeResource(ctx, "DC0_C0")
+	g.Expect(err).NotTo(HaveOccurred())
+	vm, err := ctx.session.Finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+	g.Expect(err).NotTo(HaveOccurred())
+	return ctx, computeCluster, vm.Reference()
+}
+
+func TestVMGroupMembership(t *testing.T) {
+	g := NewWithT(t)
+	ctx, computeCluster, vm := newTestContext(t)
+
+	g.Expect(AddVMToGroup(ctx, computeCluster, "zone-a-vms", vm)).To(MatchError(ContainSubstring("unable to find VM group")))
+
+	g.Expect(EnsureVMGroup(ctx, computeCluster, "zone-a-vms")).To(Succeed())
+	g.Expect(AddVMToGroup(ctx, computeCluster, "zone-a-vms", vm)).To(Succeed())
+
+	// Adding a member of the group is a no-op.
+	g.Expect(AddVMToGroup(ctx, computeCluster, "zone-a-vms", vm)).To(Succeed())
+	vmGroup, err := FindVMGroup(ctx, computeCluster, "zone-a-vms")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(vmGroup.Vm).To(ConsistOf(vm))
+
+	g.Expect(RemoveVMFromGroup(ctx, computeCluster, "zone-a-vms", vm)).To(Succeed())
+	vmGroup, err = FindVMGroup(ctx, computeCluster, "zone-a-vms")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(vmGroup.Vm).To(BeEmpty())
+
+	// Removing a VM which is not a member of the group, or from a group
+	// which does not exist, is a no-op.
+	g.Expect(RemoveVMFromGroup(ctx, computeCluster, "zone-a-vms", vm)).To(Succeed())
+	g.Expect(RemoveVMFromGroup(ctx, computeCluster, "zone-b-vms", vm)).To(Succeed())
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/utils/pointer"
+)
+
+// FindComputeClusterOfVM returns the compute cluster of the host the VM runs
+// on, or nil if the host is a standalone host.
+func FindComputeClusterOfVM(ctx computeClusterContext, vm types.ManagedObjectReference) (*object.ClusterComputeResource, error) {
+	c := ctx.GetSession().Client.Client
+
+	var vmObj mo.VirtualMachine
+	if err := object.NewVirtualMachine(c, vm).Properties(ctx, vm, []string{"runtime.host"}, &vmObj); err != nil {
+		return nil, errors.Wrapf(err, "unable to get host of vm %s", vm)
+	}
+	if vmObj.Runtime.Host == nil {
+		return nil, errors.Errorf("vm %s is not placed on a host", vm)
+	}
+
+	var hostObj mo.HostSystem
+	if err := object.NewHostSystem(c, *vmObj.Runtime.Host).Properties(ctx, *vmObj.Runtime.Host, []string{"parent"}, &hostObj); err != nil {
+		return nil, errors.Wrapf(err, "unable to get parent of host %s", *vmObj.Runtime.Host)
+	}
+	if hostObj.Parent == nil || hostObj.Parent.Type != "ClusterComputeResource" {
+		return nil, nil
+	}
+	return object.NewClusterComputeResource(c, *hostObj.Parent), nil
+}
+
+// FindAntiAffinityRule returns the VM-VM anti-affinity rule with the provided
+// name from the configuration of the compute cluster, or nil if it does not
+// exist.
+func FindAntiAffinityRule(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name string) (*types.ClusterAntiAffinityRuleSpec, error) {
+	clusterConfig, err := computeCluster.Configuration(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get configuration of compute cluster %s", computeCluster.Reference())
+	}
+	for _, r := range clusterConfig.Rule {
+		if r.GetClusterRuleInfo().Name != name {
+			continue
+		}
+		rule, ok := r.(*types.ClusterAntiAffinityRuleSpec)
+		if !ok {
+			return nil, errors.Errorf("rule %q of compute cluster %s is not a VM anti-affinity rule", name, computeCluster.Reference())
+		}
+		return rule, nil
+	}
+	return nil, nil
+}
+
+// AddVMToAntiAffinityRule adds the VM to the non-mandatory VM-VM
+// anti-affinity rule with the provided name, creating the rule if it does not
+// exist.
+func AddVMToAntiAffinityRule(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name string, vm types.ManagedObjectReference) error {
+	unlock := lockComputeCluster(computeCluster)
+	defer unlock()
+
+	rule, err := FindAntiAffinityRule(ctx, computeCluster, name)
+	if err != nil {
+		return err
+	}
+
+	operation := types.ArrayUpdateOperationEdit
+	if rule == nil {
+		operation = types.ArrayUpdateOperationAdd
+		rule = &types.ClusterAntiAffinityRuleSpec{
+			ClusterRuleInfo: types.ClusterRuleInfo{
+				Name:      name,
+				Enabled:   pointer.Bool(true),
+				Mandatory: pointer.Bool(false),
+			},
+		}
+	}
+	for _, ref := range rule.Vm {
+		if ref == vm {
+			return nil
+		}
+	}
+
+	rule.Vm = append(rule.Vm, vm)
+	ctx.GetLogger().Info("adding vm to anti-affinity rule", "compute-cluster", computeCluster.Reference(), "rule", name, "vm", vm)
+	return reconfigure(ctx, computeCluster, &types.ClusterConfigSpecEx{
+		RulesSpec: []types.ClusterRuleSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: operation},
+				Info:            rule,
+			},
+		},
+	})
+}
+
+// RemoveVMFromAntiAffinityRule removes the VM from the VM-VM anti-affinity
+// rule with the provided name. The rule is removed along with its last
+// member.
+func RemoveVMFromAntiAffinityRule(ctx computeClusterContext, computeCluster *object.ClusterComputeResource, name string, vm types.ManagedObjectReference) error {
+	unlock := lockComputeCluster(computeCluster)
+	defer unlock()
+
+	rule, err := FindAntiAffinityRule(ctx, computeCluster, name)
+	if err != nil || rule == nil {
+		return err
+	}
+
+	vms := make([]types.ManagedObjectReference, 0, len(rule.Vm))
+	for _, ref := range rule.Vm {
+		if ref != vm {
+			vms = append(vms, ref)
+		}
+	}
+	if len(vms) == len(rule.Vm) {
+		return nil
+	}
+
+	if len(vms) == 0 {
+		ctx.GetLogger().Info("removing anti-affinity rule", "compute-cluster", computeCluster.Reference(), "rule", name)
+		return reconfigure(ctx, computeCluster, &types.ClusterConfigSpecEx{
+			RulesSpec: []types.ClusterRuleSpec{
+				{
+					ArrayUpdateSpec: types.ArrayUpdateSpec{
+						Operation: types.ArrayUpdateOperationRemove,
+						RemoveKey: rule.Key,
+					},
+				},
+			},
+		})
+	}
+
+	rule.Vm = vms
+	ctx.GetLogger().Info("removing vm from anti-affinity rule", "compute-cluster", computeCluster.Reference(), "rule", name, "vm", vm)
+	return reconfigure(ctx, computeCluster, &types.ClusterConfigSpecEx{
+		RulesSpec: []types.ClusterRuleSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationEdit},
+				Info:            rule,
+			},
+		},
+	})
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestFindComputeClusterOfVM(t *testing.T) {
+	g := NewWithT(t)
+	ctx, computeCluster, vm := newTestContext(t)
+
+	found, err := FindComputeClusterOfVM(ctx, vm)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(found).NotTo(BeNil())
+	g.Expect(found.Reference()).To(Equal(computeCluster.Reference()))
+
+	// A VM running on a standalone host has no compute cluster.
+	standaloneVM, err := ctx.session.Finder.VirtualMachine(ctx, "DC0_H0_VM0")
+	g.Expect(err).NotTo(HaveOccurred())
+	found, err = FindComputeClusterOfVM(ctx, standaloneVM.Reference())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(found).To(BeNil())
+}
+
+func TestAntiAffinityRuleMembership(t *testing.T) {
+	g := NewWithT(t)
+	ctx, computeCluster, vm := newTestContext(t)
+	otherVM, err := ctx.session.Finder.VirtualMachine(ctx, "DC0_C0_RP0_VM1")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	rule, err := FindAntiAffinityRule(ctx, computeCluster, "control-plane")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rule).To(BeNil())
+
+	// The rule is created along with its first member.
+	g.Expect(AddVMToAntiAffinityRule(ctx, computeCluster, "control-plane", vm)).To(Succeed())
+	rule, err = FindAntiAffinityRule(ctx, computeCluster, "control-plane")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rule).NotTo(BeNil())
+	g.Expect(*rule.Mandatory).To(BeFalse())
+	g.Expect(rule.Vm).To(ConsistOf(vm))
+
+	g.Expect(AddVMToAntiAffinityRule(ctx, computeCluster, "control-plane", otherVM.Reference())).To(Succeed())
+
+	// Adding a member of the rule is a no-op.
+	g.Expect(AddVMToAntiAffinityRule(ctx, computeCluster, "control-plane", vm)).To(Succeed())
+	rule, err = FindAntiAffinityRule(ctx, computeCluster, "control-plane")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rule.Vm).To(ConsistOf(vm, otherVM.Reference()))
+
+	g.Expect(RemoveVMFromAntiAffinityRule(ctx, computeCluster, "control-plane", vm)).To(Succeed())
+	rule, err = FindAntiAffinityRule(ctx, computeCluster, "control-plane")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rule.Vm).To(ConsistOf(otherVM.Reference()))
+
+	// Removing a VM which is not a member of the rule, or from a rule which
+	// does not exist, is a no-op.
+	g.Expect(RemoveVMFromAntiAffinityRule(ctx, computeCluster, "control-plane", vm)).To(Succeed())
+	g.Expect(RemoveVMFromAntiAffinityRule(ctx, computeCluster, "workers", vm)).To(Succeed())
+
+	// The rule is removed along with its last member.
+	g.Expect(RemoveVMFromAntiAffinityRule(ctx, computeCluster, "control-plane", otherVM.Reference())).To(Succeed())
+	rule, err = FindAntiAffinityRule(ctx, computeCluster, "control-plane")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rule).To(BeNil())
+}
+
+func TestConcurrentAntiAffinityRuleMembership(t *testing.T) {
+	g := NewWithT(t)
+	ctx, computeCluster, _ := newTestContext(t)
+	vms, err := ctx.session.Finder.VirtualMachineList(ctx, "DC0_C0_RP0_VM*")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// VMs joining the rule at the same time neither create the rule twice
+	// nor drop each other from its members.
+	var wg sync.WaitGroup
+	errs := make(chan error, len(vms))
+	refs := make([]interface{}, 0, len(vms))
+	for _, vm := range vms {
+		refs = append(refs, vm.Reference())
+		wg.Add(1)
+		go func(vm types.ManagedObjectReference) {
+			defer wg.Done()
+			errs <- AddVMToAntiAffinityRule(ctx, computeCluster, "control-plane", vm)
+		}(vm.Reference())
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+
+	clusterConfig, err := computeCluster.Configuration(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clusterConfig.Rule).To(HaveLen(1))
+	rule, err := FindAntiAffinityRule(ctx, computeCluster, "control-plane")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rule.Vm).To(ConsistOf(refs...))
+}
+
+func TestFindAntiAffinityRuleOfAnotherType(t *testing.T) {
+	g := NewWithT(t)
+	ctx, computeCluster, vm := newTestContext(t)
+
+	task, err := computeCluster.Reconfigure(ctx, &types.ClusterConfigSpecEx{
+		RulesSpec: []types.ClusterRuleSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+				Info: &types.ClusterAffinityRuleSpec{
+					ClusterRuleInfo: types.ClusterRuleInfo{Name: "control-plane"},
+					Vm:              []types.ManagedObjectReference{vm},
+				},
+			},
+		},
+	}, true)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(task.Wait(ctx)).To(Succeed())
+
+	_, err = FindAntiAffinityRule(ctx, computeCluster, "control-plane")
+	g.Expect(err).To(MatchError(ContainSubstring("is not a VM anti-affinity rule")))
+	g.Expect(AddVMToAntiAffinityRule(ctx, computeCluster, "control-plane", vm)).NotTo(Succeed())
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+)
+
+// associableTypes maps the type of a failure domain to the type of vSphere
+// object the tags of its category may be attached to.
+var associableTypes = map[infrav1.FailureDomainType]string{
+	infrav1.DatacenterFailureDomain:     "Datacenter",
+	infrav1.ComputeClusterFailureDomain: "ClusterComputeResource",
+	infrav1.HostGroupFailureDomain:      "HostSystem",
+}
+
+// EnsureTag creates the tag category and the tag described by the failure
+// domain if they do not exist, and returns the ID of the tag.
+func EnsureTag(ctx computeClusterContext, failureDomain infrav1.FailureDomain) (string, error) {
+	manager, err := tagManager(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	categoryID, err := ensureCategory(ctx, manager, failureDomain)
+	if err != nil {
+		return "", err
+	}
+
+	existingTags, err := manager.GetTagsForCategory(ctx, categoryID)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to list tags of category %q", failureDomain.TagCategory)
+	}
+	for _, tag := range existingTags {
+		if tag.Name == failureDomain.Name {
+			return tag.ID, nil
+		}
+	}
+
+	ctx.GetLogger().Info("creating tag", "category", failureDomain.TagCategory, "tag", failureDomain.Name)
+	tagID, err := manager.CreateTag(ctx, &tags.Tag{
+		Name:       failureDomain.Name,
+		CategoryID: categoryID,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to create tag %q in category %q", failureDomain.Name, failureDomain.TagCategory)
+	}
+	return tagID, nil
+}
+
+func ensureCategory(ctx computeClusterContext, manager *tags.Manager, failureDomain infrav1.FailureDomain) (string, error) {
+	categories, err := manager.GetCategories(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to list tag categories")
+	}
+	for _, category := range categories {
+		if category.Name == failureDomain.TagCategory {
+			return category.ID, nil
+		}
+	}
+
+	associableType, ok := associableTypes[failureDomain.Type]
+	if !ok {
+		return "", errors.Errorf("unsupported failure domain type %q", failureDomain.Type)
+	}
+
+	ctx.GetLogger().Info("creating tag category", "category", failureDomain.TagCategory)
+	categoryID, err := manager.CreateCategory(ctx, &tags.Category{
+		Name:            failureDomain.TagCategory,
+		Cardinality:     "SINGLE",
+		AssociableTypes: []string{associableType},
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to create tag category %q", failureDomain.TagCategory)
+	}
+	return categoryID, nil
+}
+
+// AttachTag attaches the tag to the object if it is not attached yet.
+func AttachTag(ctx computeClusterContext, tagID string, ref mo.Reference) error {
+	manager, err := tagManager(ctx)
+	if err != nil {
+		return err
+	}
+
+	attachedTags, err := manager.GetAttachedTags(ctx, ref)
+	if err != nil {
+		return errors.Wrapf(err, "unable to list tags attached to %s", ref.Reference())
+	}
+	for _, tag := range attachedTags {
+		if tag.ID == tagID {
+			return nil
+		}
+	}
+
+	ctx.GetLogger().Info("attaching tag", "tag", tagID, "object", ref.Reference())
+	if err := manager.AttachTag(ctx, tagID, ref); err != nil {
+		return errors.Wrapf(err, "unable to attach tag %s to %s", tagID, ref.Reference())
+	}
+	return nil
+}
+
+// ListTaggedObjects returns the references of the objects the tag is
+// attached to.
+func ListTaggedObjects(ctx computeClusterContext, tagID string) ([]mo.Reference, error) {
+	manager, err := tagManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := manager.ListAttachedObjects(ctx, tagID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list objects attached to tag %s", tagID)
+	}
+	return refs, nil
+}
+
+func tagManager(ctx computeClusterContext) (*tags.Manager, error) {
+	manager, err := ctx.GetSession().TagManager(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "tagging is only supported when connected to vCenter")
+	}
+	return manager, nil
+}
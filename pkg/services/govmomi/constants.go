@@ -20,10 +20,34 @@ const (
 	morefTypeTask = "Task"
 )
 
+// The categories and the names of the tags which identify the cluster, the
+// namespace and the role of a VM.
+const (
+	tagCategoryCluster   = "capv-cluster"
+	tagCategoryNamespace = "capv-namespace"
+	tagCategoryRole      = "capv-role"
+
+	roleControlPlane = "control-plane"
+	roleWorker       = "worker"
+)
+
+// customizationEventTypes are the types of the events which report the
+// progress of the guest customization of a VM.
+var customizationEventTypes = []string{
+	"CustomizationStartedEvent",
+	"CustomizationSucceeded",
+	"CustomizationFailed",
+	"CustomizationLinuxIdentityFailed",
+	"CustomizationNetworkSetupFailed",
+	"CustomizationSysprepFailed",
+	"CustomizationUnknownFailure",
+}
+
 // nolint
 const (
 	guestInfoKeyMetadata    = "guestinfo.metadata"
 	guestInfoKeyMetadataEnc = "guestinfo.metadata.encoding"
 	guestInfoKeyUserdata    = "guestinfo.userdata"
 	guestInfoKeyUserdataEnc = "guestinfo.userdata.encoding"
+	guestInfoKeyIgnition    = "guestinfo.ignition.config.data"
 )
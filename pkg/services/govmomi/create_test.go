@@ -22,9 +22,15 @@ import (
 
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/simulator"
+	_ "github.com/vmware/govmomi/vapi/simulator"
 	"github.com/vmware/govmomi/vim25/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
 
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
 )
 
@@ -38,6 +44,7 @@ func TestCreate(t *testing.T) {
 		t.Fatal(err)
 	}
 	model.Service.TLS = new(tls.Config)
+	model.Service.RegisterEndpoints = true
 
 	s := model.Service.NewServer()
 	defer s.Close()
@@ -62,7 +69,7 @@ func TestCreate(t *testing.T) {
 	disk := object.VirtualDeviceList(vm.Config.Hardware.Device).SelectByType((*types.VirtualDisk)(nil))[0].(*types.VirtualDisk)
 	disk.CapacityInKB = int64(vmContext.VSphereVM.Spec.DiskGiB) * 1024 * 1024
 
-	if err := createVM(vmContext, []byte("")); err != nil {
+	if err := createVM(vmContext, []byte(""), extra.CloudConfig); err != nil {
 		t.Fatal(err)
 	}
 
@@ -70,3 +77,154 @@ func TestCreate(t *testing.T) {
 		t.Error("failed to clone vm")
 	}
 }
+
+func TestCreateESXi(t *testing.T) {
+	model := simulator.ESX()
+
+	defer model.Remove()
+	err := model.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+
+	s := model.Service.NewServer()
+	defer s.Close()
+	pass, _ := s.URL.User.Password()
+
+	vmContext := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+	vmContext.VSphereVM.Spec.Server = s.URL.Host
+
+	authSession, err := session.GetOrCreate(
+		vmContext.Context,
+		session.NewParams().
+			WithServer(vmContext.VSphereVM.Spec.Server).
+			WithUserInfo(s.URL.User.Username(), pass))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vmContext.Session = authSession
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	vmContext.VSphereVM.Spec.Template = vm.Name
+
+	// The simulator does not implement the extension of the copied disks.
+	vmContext.VSphereVM.Spec.DiskGiB = 0
+
+	datastore, err := authSession.Finder.DefaultDatastore(vmContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	directoryExists := func() bool {
+		_, err := datastore.Stat(vmContext, vmContext.VSphereVM.Name)
+		return err == nil
+	}
+
+	// The disks of the template are copied before the VM is created, each
+	// copy being tracked as the task of the VSphereVM.
+	createESXiVM := func(maxTasks int) bool {
+		for i := 0; i < maxTasks; i++ {
+			if err := createVM(vmContext, []byte(""), extra.CloudConfig); err != nil {
+				t.Fatal(err)
+			}
+			if model.Machine+1 == model.Count().Machine {
+				return true
+			}
+			waitForTask(t, vmContext)
+		}
+		return false
+	}
+
+	if createESXiVM(1) {
+		t.Fatal("created vm before copying the template disks")
+	}
+	if !directoryExists() {
+		t.Fatal("failed to copy the template disks")
+	}
+
+	// The copied disks are deleted after a task of the VSphereVM failed,
+	// since they may be incomplete.
+	conditions.MarkFalse(vmContext.VSphereVM, infrav1.VMProvisionedCondition, infrav1.TaskFailure, clusterv1.ConditionSeverityInfo, "")
+	if err := createVM(vmContext, []byte(""), extra.CloudConfig); err != nil {
+		t.Fatal(err)
+	}
+	waitForTask(t, vmContext)
+	if directoryExists() {
+		t.Error("failed to delete the copied disks after a failed task")
+	}
+	if reason := conditions.GetReason(vmContext.VSphereVM, infrav1.VMProvisionedCondition); reason != infrav1.CloningReason {
+		t.Errorf("expected reason %q, got %q", infrav1.CloningReason, reason)
+	}
+
+	if !createESXiVM(10) {
+		t.Error("failed to create vm")
+	}
+}
+
+func TestDeleteDirectoryESXi(t *testing.T) {
+	model := simulator.ESX()
+
+	defer model.Remove()
+	err := model.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+
+	s := model.Service.NewServer()
+	defer s.Close()
+	pass, _ := s.URL.User.Password()
+
+	vmContext := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+	vmContext.VSphereVM.Spec.Server = s.URL.Host
+
+	authSession, err := session.GetOrCreate(
+		vmContext.Context,
+		session.NewParams().
+			WithServer(vmContext.VSphereVM.Spec.Server).
+			WithUserInfo(s.URL.User.Username(), pass))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vmContext.Session = authSession
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	vmContext.VSphereVM.Spec.Template = vm.Name
+
+	// Copy the first disk of the template, then delete the VSphereVM before
+	// the VM is created.
+	if err := createVM(vmContext, []byte(""), extra.CloudConfig); err != nil {
+		t.Fatal(err)
+	}
+	waitForTask(t, vmContext)
+
+	vms := &VMService{}
+	if _, err := vms.DestroyVM(vmContext); err != nil {
+		t.Fatal(err)
+	}
+	if vmContext.VSphereVM.Status.TaskRef == "" {
+		t.Fatal("failed to delete the directory of the vm")
+	}
+	waitForTask(t, vmContext)
+
+	vmState, err := vms.DestroyVM(vmContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vmState.State != infrav1.VirtualMachineStateNotFound {
+		t.Errorf("expected state %q, got %q", infrav1.VirtualMachineStateNotFound, vmState.State)
+	}
+}
+
+// waitForTask waits for the task of the VSphereVM to complete, and clears its
+// reference like the next reconcile of the VSphereVM does.
+func waitForTask(t *testing.T, ctx *context.VMContext) {
+	if ctx.VSphereVM.Status.TaskRef == "" {
+		t.Fatal("expected a task")
+	}
+	task := object.NewTask(ctx.Session.Client.Client, types.ManagedObjectReference{Type: morefTypeTask, Value: ctx.VSphereVM.Status.TaskRef})
+	if err := task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ctx.VSphereVM.Status.TaskRef = ""
+}
@@ -17,12 +17,505 @@ limitations under the License.
 package esxi
 
 import (
+	"fmt"
+	"path"
+
 	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
 
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/template"
 )
 
-// Clone kicks off a clone operation on ESXi to create a new virtual machine.
-func Clone(ctx *context.VMContext, bootstrapData []byte) error {
-	return errors.New("temporarily disabled esxi support")
+const ethCardType = "vmxnet3"
+
+// Clone creates a new virtual machine on a standalone ESXi host. ESXi cannot
+// clone virtual machines, so the disks of the template are copied with the
+// VirtualDiskManager and a new virtual machine is created with the copies.
+// Each copy, like the creation of the virtual machine, is tracked as the task
+// of the VSphereVM, so that Clone is called again once the task completes.
+func Clone(ctx *context.VMContext, bootstrapData []byte, format extra.BootstrapFormat) error {
+	ctx = &context.VMContext{
+		ControllerContext: ctx.ControllerContext,
+		VSphereVM:         ctx.VSphereVM,
+		Session:           ctx.Session,
+		Logger:            ctx.Logger.WithName("esxi"),
+		PatchHelper:       ctx.PatchHelper,
+	}
+	ctx.Logger.Info("starting clone process")
+
+	if err := validateCloneSpec(ctx.VSphereVM.Spec.VirtualMachineCloneSpec); err != nil {
+		return err
+	}
+
+	var extraConfig extra.Config
+	if len(bootstrapData) > 0 {
+		ctx.Logger.Info("applied bootstrap data to VM config spec")
+		if err := extraConfig.SetUserData(bootstrapData, format); err != nil {
+			return err
+		}
+	}
+	if ctx.VSphereVM.Spec.CustomVMXKeys != nil {
+		ctx.Logger.Info("applied custom vmx keys to VM config spec")
+		if err := extraConfig.SetCustomVMXKeys(ctx.VSphereVM.Spec.CustomVMXKeys); err != nil {
+			return err
+		}
+	}
+
+	tpl, err := template.FindTemplate(ctx, ctx.VSphereVM.Spec.Template)
+	if err != nil {
+		return err
+	}
+	var tplObj mo.VirtualMachine
+	if err := tpl.Properties(ctx, tpl.Reference(), []string{"config"}, &tplObj); err != nil {
+		return errors.Wrapf(err, "error getting config of template %s", ctx.VSphereVM.Spec.Template)
+	}
+	if tplObj.Config == nil {
+		return errors.Errorf("template %s has no config", ctx.VSphereVM.Spec.Template)
+	}
+
+	// Disks are always copied, so linked clones are not possible.
+	ctx.VSphereVM.Status.CloneMode = infrav1.FullClone
+
+	datacenter, err := ctx.Session.Finder.DefaultDatacenter(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get datacenter for %q", ctx)
+	}
+
+	folder, err := ctx.Session.Finder.FolderOrDefault(ctx, ctx.VSphereVM.Spec.Folder)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get folder for %q", ctx)
+	}
+
+	pool, err := ctx.Session.Finder.ResourcePoolOrDefault(ctx, ctx.VSphereVM.Spec.ResourcePool)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get resource pool for %q", ctx)
+	}
+
+	datastore, err := ctx.Session.Finder.DatastoreOrDefault(ctx, ctx.VSphereVM.Spec.Datastore)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get datastore for %q", ctx)
+	}
+
+	// The disks copied before a task of the VSphereVM failed may be
+	// incomplete, so the directory of the new virtual machine is deleted and
+	// the disks are copied again.
+	if conditions.GetReason(ctx.VSphereVM, infrav1.VMProvisionedCondition) == infrav1.TaskFailure {
+		task, err := deleteDirectory(ctx, datacenter, datastore)
+		if err != nil {
+			return err
+		}
+		conditions.MarkFalse(ctx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.CloningReason, clusterv1.ConditionSeverityInfo, "")
+		if task != nil {
+			ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+			if err := ctx.Patch(); err != nil {
+				ctx.Logger.Error(err, "patch failed", "vspherevm", ctx.VSphereVM)
+			}
+			return nil
+		}
+	}
+
+	// The disks of the template are copied into the directory of the new
+	// virtual machine.
+	vmDirectory := datastore.Path(ctx.VSphereVM.Name)
+	if err := makeDirectory(ctx, datacenter, vmDirectory); err != nil {
+		return err
+	}
+
+	devices := object.VirtualDeviceList(tplObj.Config.Hardware.Device)
+	task, err := copyDisks(ctx, datacenter, datastore, devices)
+	if err != nil {
+		return errors.Wrapf(err, "error copying template disks for %q", ctx)
+	}
+	if task != nil {
+		ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+		if err := ctx.Patch(); err != nil {
+			ctx.Logger.Error(err, "patch failed", "vspherevm", ctx.VSphereVM)
+		}
+		return nil
+	}
+
+	deviceSpecs, err := getStorageSpecs(ctx, datastore, devices)
+	if err != nil {
+		return errors.Wrapf(err, "error getting storage specs for %q", ctx)
+	}
+
+	networkSpecs, err := getNetworkSpecs(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error getting network specs for %q", ctx)
+	}
+	deviceSpecs = append(deviceSpecs, networkSpecs...)
+
+	numCPUs := ctx.VSphereVM.Spec.NumCPUs
+	if numCPUs < 2 {
+		numCPUs = 2
+	}
+	numCoresPerSocket := ctx.VSphereVM.Spec.NumCoresPerSocket
+	if numCoresPerSocket == 0 {
+		numCoresPerSocket = numCPUs
+	}
+	memMiB := ctx.VSphereVM.Spec.MemoryMiB
+	if memMiB == 0 {
+		memMiB = 2048
+	}
+
+	spec := types.VirtualMachineConfigSpec{
+		Name: ctx.VSphereVM.Name,
+		// Assign the new VM's InstanceUUID the value of the Kubernetes Machine
+		// object's UID. This allows lookup of the VM prior to knowing the
+		// VM's UUID.
+		InstanceUuid:      string(ctx.VSphereVM.UID),
+		GuestId:           tplObj.Config.GuestId,
+		Version:           tplObj.Config.Version,
+		Firmware:          tplObj.Config.Firmware,
+		Files:             &types.VirtualMachineFileInfo{VmPathName: datastore.Path(fmt.Sprintf("%s/%s.vmx", ctx.VSphereVM.Name, ctx.VSphereVM.Name))},
+		Flags:             newVMFlagInfo(),
+		DeviceChange:      deviceSpecs,
+		ExtraConfig:       extraConfig,
+		NumCPUs:           numCPUs,
+		NumCoresPerSocket: numCoresPerSocket,
+		MemoryMB:          memMiB,
+	}
+
+	// The VM is created powered off, so that the MAC address(es) used to
+	// build and inject the VM with cloud-init metadata are generated before
+	// it boots.
+	ctx.Logger.Info("creating machine", "namespace", ctx.VSphereVM.Namespace, "name", ctx.VSphereVM.Name, "datastore", datastore.Name())
+	task, err = folder.CreateVM(ctx, spec, pool, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error trigging create op for machine %s", ctx)
+	}
+
+	ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+
+	// patch the vsphereVM early to ensure that the task is
+	// reflected in the status right away, this avoid situations
+	// of concurrent clones
+	if err := ctx.Patch(); err != nil {
+		ctx.Logger.Error(err, "patch failed", "vspherevm", ctx.VSphereVM)
+	}
+	return nil
+}
+
+// validateCloneSpec returns an error for the fields of the clone spec which
+// require vCenter.
+func validateCloneSpec(spec infrav1.VirtualMachineCloneSpec) error {
+	switch {
+	case spec.StoragePolicyName != "":
+		return errors.New("storage policies are not supported on ESXi")
+	case len(spec.TemplateDisks) > 0:
+		return errors.New("template disk overrides are not supported on ESXi")
+	case len(spec.AdditionalDisks) > 0:
+		return errors.New("additional disks are not supported on ESXi")
+	case spec.Customization != nil:
+		return errors.New("guest customization is not supported on ESXi")
+	}
+	return nil
+}
+
+func makeDirectory(ctx *context.VMContext, datacenter *object.Datacenter, name string) error {
+	fileManager := object.NewFileManager(ctx.Session.Client.Client)
+	if err := fileManager.MakeDirectory(ctx, name, datacenter, true); err != nil {
+		// The directory exists once the first disk is copied, in which
+		// case the disks which were copied are kept.
+		if soap.IsSoapFault(err) {
+			if _, ok := soap.ToSoapFault(err).VimFault().(types.FileAlreadyExists); ok {
+				return nil
+			}
+		}
+		return errors.Wrapf(err, "unable to create directory %s", name)
+	}
+	return nil
+}
+
+// DeleteDirectory starts the deletion of the directory of the virtual machine
+// of the VSphereVM, which holds the disks copied before the virtual machine
+// is created. The returned task is nil if the directory does not exist.
+func DeleteDirectory(ctx *context.VMContext) (*object.Task, error) {
+	datacenter, err := ctx.Session.Finder.DefaultDatacenter(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get datacenter for %q", ctx)
+	}
+	datastore, err := ctx.Session.Finder.DatastoreOrDefault(ctx, ctx.VSphereVM.Spec.Datastore)
+	if err != nil {
+		// No disk was copied to a datastore which does not exist.
+		if _, ok := err.(*find.NotFoundError); ok {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to get datastore for %q", ctx)
+	}
+	return deleteDirectory(ctx, datacenter, datastore)
+}
+
+func deleteDirectory(ctx *context.VMContext, datacenter *object.Datacenter, datastore *object.Datastore) (*object.Task, error) {
+	if _, err := datastore.Stat(ctx, ctx.VSphereVM.Name); err != nil {
+		switch err.(type) {
+		case object.DatastoreNoSuchDirectoryError, object.DatastoreNoSuchFileError:
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to get directory %s", datastore.Path(ctx.VSphereVM.Name))
+	}
+
+	ctx.Logger.Info("deleting directory", "directory", datastore.Path(ctx.VSphereVM.Name))
+	fileManager := object.NewFileManager(ctx.Session.Client.Client)
+	task, err := fileManager.DeleteDatastoreFile(ctx, datastore.Path(ctx.VSphereVM.Name), datacenter)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to delete directory %s", datastore.Path(ctx.VSphereVM.Name))
+	}
+	return task, nil
+}
+
+// copyDisks starts the copy of the first disk of the template which has not
+// been copied yet, or the extension of the copy of the first disk according
+// to DiskGiB. The returned task is nil once all the disks are copied.
+func copyDisks(
+	ctx *context.VMContext,
+	datacenter *object.Datacenter,
+	datastore *object.Datastore,
+	devices object.VirtualDeviceList) (*object.Task, error) {
+
+	virtualDiskManager := object.NewVirtualDiskManager(ctx.Session.Client.Client)
+	disks := devices.SelectByType((*types.VirtualDisk)(nil))
+	if len(disks) == 0 {
+		return nil, errors.Errorf("invalid disk count: %d", len(disks))
+	}
+	for i := range disks {
+		disk := disks[i].(*types.VirtualDisk)
+		backing, ok := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+		if !ok {
+			return nil, errors.Errorf("unsupported backing %T of template disk %d", disk.Backing, disk.Key)
+		}
+
+		destination := diskPath(ctx, i)
+		info, err := statDisk(ctx, datastore, destination)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil {
+			ctx.Logger.Info("copying template disk", "source", backing.FileName, "destination", datastore.Path(destination))
+			task, err := virtualDiskManager.CopyVirtualDisk(ctx, backing.FileName, datacenter, datastore.Path(destination), datacenter, getVirtualDiskSpec(devices, disk, backing), true)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to copy template disk %s", backing.FileName)
+			}
+			return task, nil
+		}
+
+		if i == 0 && ctx.VSphereVM.Spec.DiskGiB > 0 {
+			capacityKB := int64(ctx.VSphereVM.Spec.DiskGiB) * 1024 * 1024
+			if disk.CapacityInKB > capacityKB {
+				return nil, errors.Errorf(
+					"can't resize template disk down, initial capacity is larger: %dKiB > %dKiB",
+					disk.CapacityInKB, capacityKB)
+			}
+			if info.CapacityKb < capacityKB {
+				ctx.Logger.Info("extending disk", "disk", datastore.Path(destination), "capacityKB", capacityKB)
+				datacenterRef := datacenter.Reference()
+				res, err := methods.ExtendVirtualDisk_Task(ctx, ctx.Session.Client.Client, &types.ExtendVirtualDisk_Task{
+					This:          virtualDiskManager.Reference(),
+					Name:          datastore.Path(destination),
+					Datacenter:    &datacenterRef,
+					NewCapacityKb: capacityKB,
+				})
+				if err != nil {
+					return nil, errors.Wrapf(err, "unable to extend disk %s", datastore.Path(destination))
+				}
+				return object.NewTask(ctx.Session.Client.Client, res.Returnval), nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// diskPath returns the path of the copy of the template disk with the
+// provided index, relative to the datastore of the new virtual machine.
+func diskPath(ctx *context.VMContext, i int) string {
+	fileName := ctx.VSphereVM.Name
+	if i > 0 {
+		fileName = fmt.Sprintf("%s_%d", fileName, i)
+	}
+	return fmt.Sprintf("%s/%s.vmdk", ctx.VSphereVM.Name, fileName)
+}
+
+// statDisk returns the info of the disk with the provided path relative to
+// the datastore, or nil if the disk does not exist.
+func statDisk(ctx *context.VMContext, datastore *object.Datastore, name string) (*types.VmDiskFileInfo, error) {
+	browser, err := datastore.Browser(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get browser of datastore %s", datastore.Name())
+	}
+
+	task, err := browser.SearchDatastore(ctx, datastore.Path(path.Dir(name)), &types.HostDatastoreBrowserSearchSpec{
+		Query: []types.BaseFileQuery{
+			&types.VmDiskFileQuery{Details: &types.VmDiskFileQueryFlags{CapacityKb: true}},
+		},
+		Details:      &types.FileQueryFlags{FileType: true},
+		MatchPattern: []string{path.Base(name)},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to search disk %s", datastore.Path(name))
+	}
+	info, err := task.WaitForResult(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error searching disk %s", datastore.Path(name))
+	}
+
+	results := info.Result.(types.HostDatastoreBrowserSearchResults)
+	for _, file := range results.File {
+		if diskInfo, ok := file.(*types.VmDiskFileInfo); ok {
+			return diskInfo, nil
+		}
+	}
+	return nil, nil
+}
+
+// getStorageSpecs returns the device specs adding the storage controllers of
+// the template and the copies of its disks to the new virtual machine.
+func getStorageSpecs(
+	ctx *context.VMContext,
+	datastore *object.Datastore,
+	devices object.VirtualDeviceList) ([]types.BaseVirtualDeviceConfigSpec, error) {
+
+	deviceSpecs := []types.BaseVirtualDeviceConfigSpec{}
+
+	// Assign temporary device keys to the controllers, and keep track of
+	// them for the disks attached to the controllers. Disks attached to the
+	// default controllers of a virtual machine, such as the IDE controllers,
+	// keep their controller key.
+	key := int32(-100)
+	controllerKeys := map[int32]int32{}
+	for _, device := range devices {
+		switch device.(type) {
+		case types.BaseVirtualSCSIController, *types.VirtualAHCIController, *types.VirtualNVMEController:
+		default:
+			continue
+		}
+		controller := device.(types.BaseVirtualController).GetVirtualController()
+		controllerKeys[controller.Key] = key
+		controller.Key = key
+		controller.Device = nil
+		deviceSpecs = append(deviceSpecs, &types.VirtualDeviceConfigSpec{
+			Operation: types.VirtualDeviceConfigSpecOperationAdd,
+			Device:    device,
+		})
+		key--
+	}
+
+	disks := devices.SelectByType((*types.VirtualDisk)(nil))
+	for i := range disks {
+		disk := disks[i].(*types.VirtualDisk)
+		backing := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+
+		if i == 0 && ctx.VSphereVM.Spec.DiskGiB > 0 {
+			disk.CapacityInKB = int64(ctx.VSphereVM.Spec.DiskGiB) * 1024 * 1024
+		}
+		disk.Key = key
+		if controllerKey, ok := controllerKeys[disk.ControllerKey]; ok {
+			disk.ControllerKey = controllerKey
+		}
+		disk.Backing = &types.VirtualDiskFlatVer2BackingInfo{
+			VirtualDeviceFileBackingInfo: types.VirtualDeviceFileBackingInfo{
+				FileName: datastore.Path(diskPath(ctx, i)),
+			},
+			DiskMode:        backing.DiskMode,
+			ThinProvisioned: backing.ThinProvisioned,
+			EagerlyScrub:    backing.EagerlyScrub,
+		}
+		deviceSpecs = append(deviceSpecs, &types.VirtualDeviceConfigSpec{
+			Operation: types.VirtualDeviceConfigSpecOperationAdd,
+			Device:    disk,
+		})
+		key--
+	}
+
+	return deviceSpecs, nil
+}
+
+// getVirtualDiskSpec returns the spec of the copy of a template disk, which
+// keeps the provisioning type of the template disk and the adapter type of
+// its controller.
+func getVirtualDiskSpec(devices object.VirtualDeviceList, disk *types.VirtualDisk, backing *types.VirtualDiskFlatVer2BackingInfo) *types.VirtualDiskSpec {
+	diskType := types.VirtualDiskTypePreallocated
+	switch {
+	case backing.ThinProvisioned != nil && *backing.ThinProvisioned:
+		diskType = types.VirtualDiskTypeThin
+	case backing.EagerlyScrub != nil && *backing.EagerlyScrub:
+		diskType = types.VirtualDiskTypeEagerZeroedThick
+	}
+
+	// The adapter type of the disks of the other SCSI, SATA and NVMe
+	// controllers is lsiLogic.
+	adapterType := types.VirtualDiskAdapterTypeLsiLogic
+	switch devices.FindByKey(disk.ControllerKey).(type) {
+	case *types.VirtualIDEController:
+		adapterType = types.VirtualDiskAdapterTypeIde
+	case *types.VirtualBusLogicController:
+		adapterType = types.VirtualDiskAdapterTypeBusLogic
+	}
+
+	return &types.VirtualDiskSpec{
+		AdapterType: string(adapterType),
+		DiskType:    string(diskType),
+	}
+}
+
+func getNetworkSpecs(ctx *context.VMContext) ([]types.BaseVirtualDeviceConfigSpec, error) {
+	deviceSpecs := []types.BaseVirtualDeviceConfigSpec{}
+
+	// Add the NICs based on the machine config.
+	key := int32(-1000)
+	for i := range ctx.VSphereVM.Spec.Network.Devices {
+		netSpec := &ctx.VSphereVM.Spec.Network.Devices[i]
+		ref, err := ctx.Session.Finder.Network(ctx, netSpec.NetworkName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to find network %q", netSpec.NetworkName)
+		}
+		backing, err := ref.EthernetCardBackingInfo(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create new ethernet card backing info for network %q on %q", netSpec.NetworkName, ctx)
+		}
+		dev, err := object.EthernetCardTypes().CreateEthernetCard(ethCardType, backing)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create new ethernet card %q for network %q on %q", ethCardType, netSpec.NetworkName, ctx)
+		}
+
+		// Get the actual NIC object. This is safe to assert without a check
+		// because "object.EthernetCardTypes().CreateEthernetCard" returns a
+		// "types.BaseVirtualEthernetCard" as a "types.BaseVirtualDevice".
+		nic := dev.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+
+		if netSpec.MACAddr != "" {
+			nic.MacAddress = netSpec.MACAddr
+			nic.AddressType = string(types.VirtualEthernetCardMacTypeManual)
+			ctx.Logger.V(4).Info("configured manual mac address", "mac-addr", nic.MacAddress)
+		}
+
+		// Assign a temporary device key to ensure that a unique one will be
+		// generated when the device is created.
+		nic.Key = key
+
+		deviceSpecs = append(deviceSpecs, &types.VirtualDeviceConfigSpec{
+			Device:    dev,
+			Operation: types.VirtualDeviceConfigSpecOperationAdd,
+		})
+		ctx.Logger.V(4).Info("created network device", "eth-card-type", ethCardType, "network-spec", netSpec)
+		key--
+	}
+
+	return deviceSpecs, nil
+}
+
+func newVMFlagInfo() *types.VirtualMachineFlagInfo {
+	diskUUIDEnabled := true
+	return &types.VirtualMachineFlagInfo{
+		DiskUuidEnabled: &diskUUIDEnabled,
+	}
 }
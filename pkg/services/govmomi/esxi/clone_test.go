@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package esxi
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/utils/pointer"
+)
+
+func TestGetVirtualDiskSpec(t *testing.T) {
+	devices := object.VirtualDeviceList{
+		&types.VirtualIDEController{VirtualController: types.VirtualController{VirtualDevice: types.VirtualDevice{Key: 200}}},
+		&types.VirtualBusLogicController{VirtualSCSIController: types.VirtualSCSIController{VirtualController: types.VirtualController{VirtualDevice: types.VirtualDevice{Key: 1000}}}},
+		&types.ParaVirtualSCSIController{VirtualSCSIController: types.VirtualSCSIController{VirtualController: types.VirtualController{VirtualDevice: types.VirtualDevice{Key: 1001}}}},
+	}
+
+	testCases := []struct {
+		name          string
+		controllerKey int32
+		backing       types.VirtualDiskFlatVer2BackingInfo
+		expected      types.VirtualDiskSpec
+	}{
+		{
+			name:          "thick disk of an IDE controller",
+			controllerKey: 200,
+			expected: types.VirtualDiskSpec{
+				AdapterType: string(types.VirtualDiskAdapterTypeIde),
+				DiskType:    string(types.VirtualDiskTypePreallocated),
+			},
+		},
+		{
+			name:          "thin disk of a BusLogic controller",
+			controllerKey: 1000,
+			backing:       types.VirtualDiskFlatVer2BackingInfo{ThinProvisioned: pointer.BoolPtr(true)},
+			expected: types.VirtualDiskSpec{
+				AdapterType: string(types.VirtualDiskAdapterTypeBusLogic),
+				DiskType:    string(types.VirtualDiskTypeThin),
+			},
+		},
+		{
+			name:          "eager zeroed disk of a paravirtual controller",
+			controllerKey: 1001,
+			backing:       types.VirtualDiskFlatVer2BackingInfo{EagerlyScrub: pointer.BoolPtr(true)},
+			expected: types.VirtualDiskSpec{
+				AdapterType: string(types.VirtualDiskAdapterTypeLsiLogic),
+				DiskType:    string(types.VirtualDiskTypeEagerZeroedThick),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			disk := &types.VirtualDisk{VirtualDevice: types.VirtualDevice{ControllerKey: tc.controllerKey}}
+			g.Expect(*getVirtualDiskSpec(devices, disk, &tc.backing)).To(Equal(tc.expected))
+		})
+	}
+}
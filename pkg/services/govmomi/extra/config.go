@@ -19,12 +19,38 @@ package extra
 import (
 	"encoding/base64"
 
+	"github.com/pkg/errors"
 	"github.com/vmware/govmomi/vim25/types"
 )
 
 // Config is data used with a VM's guestInfo RPC interface.
 type Config []types.BaseOptionValue
 
+// BootstrapFormat is the format of the bootstrap data of a VM, which
+// determines the guestinfo keys the bootstrap data is set at.
+type BootstrapFormat string
+
+const (
+	// CloudConfig is the format of bootstrap data consumed by cloud-init.
+	CloudConfig BootstrapFormat = "cloud-config"
+
+	// Ignition is the format of bootstrap data consumed by Ignition, e.g. on
+	// Flatcar Container Linux and Fedora CoreOS.
+	Ignition BootstrapFormat = "ignition"
+)
+
+// SetUserData sets the bootstrap data at the guestinfo keys of its format.
+func (e *Config) SetUserData(data []byte, format BootstrapFormat) error {
+	switch format {
+	case CloudConfig, "":
+		return e.SetCloudInitUserData(data)
+	case Ignition:
+		return e.SetIgnitionUserData(data)
+	default:
+		return errors.Errorf("unsupported bootstrap data format %q", format)
+	}
+}
+
 // SetCustomVMXKeys sets the custom VMX keys as
 // OptionValues in extraConfig
 func (e *Config) SetCustomVMXKeys(customKeys map[string]string) error {
@@ -38,7 +64,8 @@ func (e *Config) SetCustomVMXKeys(customKeys map[string]string) error {
 }
 
 // SetCloudInitUserData sets the cloud init user data at the key
-// "guestinfo.userdata" as a base64-encoded string.
+// "guestinfo.userdata" as a base64-encoded string. The key and its encoding
+// are also read by the VMware guestinfo service of cloudbase-init on Windows.
 func (e *Config) SetCloudInitUserData(data []byte) error {
 	*e = append(*e,
 		&types.OptionValue{
@@ -54,7 +81,8 @@ func (e *Config) SetCloudInitUserData(data []byte) error {
 }
 
 // SetCloudInitMetadata sets the cloud init user data at the key
-// "guestinfo.metadata" as a base64-encoded string.
+// "guestinfo.metadata" as a base64-encoded string. The key and its encoding
+// are also read by the VMware guestinfo service of cloudbase-init on Windows.
 func (e *Config) SetCloudInitMetadata(data []byte) error {
 	*e = append(*e,
 		&types.OptionValue{
@@ -70,6 +98,22 @@ func (e *Config) SetCloudInitMetadata(data []byte) error {
 	return nil
 }
 
+// SetIgnitionUserData sets the Ignition config at the key
+// "guestinfo.ignition.config.data" as a base64-encoded string.
+func (e *Config) SetIgnitionUserData(data []byte) error {
+	*e = append(*e,
+		&types.OptionValue{
+			Key:   "guestinfo.ignition.config.data",
+			Value: e.encode(data),
+		},
+		&types.OptionValue{
+			Key:   "guestinfo.ignition.config.data.encoding",
+			Value: "base64",
+		},
+	)
+	return nil
+}
+
 // encode first attempts to decode the data as many times as necessary
 // to ensure it is plain-text before returning the result as a base64
 // encoded string
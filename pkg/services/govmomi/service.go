@@ -18,12 +18,14 @@ package govmomi
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 
 	"github.com/pkg/errors"
 	"github.com/vmware/govmomi/pbm"
 	pbmTypes "github.com/vmware/govmomi/pbm/types"
 
+	"github.com/vmware/govmomi/event"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/property"
 	"github.com/vmware/govmomi/vim25/mo"
@@ -37,8 +39,11 @@ import (
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/cluster"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/esxi"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/net"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
 )
 
@@ -68,7 +73,7 @@ func (vms *VMService) ReconcileVM(ctx *context.VMContext) (vm infrav1.VirtualMac
 	// VSphereVM resource once its associated task completes. If
 	// there is no task for the VSphereVM resource then no reconcile
 	// event is triggered.
-	defer reconcileVSphereVMOnTaskCompletion(ctx)
+	defer watchTask(ctx)
 
 	// Before going further, we need the VM's managed object reference.
 	vmRef, err := findVM(ctx)
@@ -92,14 +97,14 @@ func (vms *VMService) ReconcileVM(ctx *context.VMContext) (vm infrav1.VirtualMac
 		}
 
 		// Get the bootstrap data.
-		bootstrapData, err := vms.getBootstrapData(ctx)
+		bootstrapData, format, err := vms.getBootstrapData(ctx)
 		if err != nil {
 			conditions.MarkFalse(ctx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.CloningFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
 			return vm, err
 		}
 
 		// Create the VM.
-		err = createVM(ctx, bootstrapData)
+		err = createVM(ctx, bootstrapData, format)
 		if err != nil {
 			conditions.MarkFalse(ctx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.CloningFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
 		}
@@ -110,6 +115,11 @@ func (vms *VMService) ReconcileVM(ctx *context.VMContext) (vm infrav1.VirtualMac
 	// At this point we know the VM exists, so it needs to be updated.
 	//
 
+	// Changes of the power state, the network and the metadata of the VM
+	// trigger a reconcile event for the VSphereVM resource, e.g. once the
+	// VM reports IP addresses.
+	watchVM(ctx, vmRef)
+
 	// Create a new virtualMachineContext to reconcile the VM.
 	vmCtx := &virtualMachineContext{
 		VMContext: *ctx,
@@ -132,10 +142,32 @@ func (vms *VMService) ReconcileVM(ctx *context.VMContext) (vm infrav1.VirtualMac
 		return vm, err
 	}
 
+	if err := vms.reconcileTags(vmCtx); err != nil {
+		return vm, err
+	}
+
+	if err := vms.reconcileMachineNameAttribute(vmCtx); err != nil {
+		return vm, err
+	}
+
+	if err := vms.reconcileVMGroupInfo(vmCtx); err != nil {
+		return vm, err
+	}
+
+	vms.reconcileAntiAffinityRule(vmCtx)
+
+	if ok, err := vms.reconcileDeployedVMCustomization(vmCtx); err != nil || !ok {
+		return vm, err
+	}
+
 	if ok, err := vms.reconcilePowerState(vmCtx); err != nil || !ok {
 		return vm, err
 	}
 
+	if ok, err := vms.reconcileGuestCustomization(vmCtx); err != nil || !ok {
+		return vm, err
+	}
+
 	vm.State = infrav1.VirtualMachineStateReady
 	return vm, nil
 }
@@ -158,18 +190,42 @@ func (vms *VMService) DestroyVM(ctx *context.VMContext) (infrav1.VirtualMachine,
 	// VSphereVM resource once its associated task completes. If
 	// there is no task for the VSphereVM resource then no reconcile
 	// event is triggered.
-	defer reconcileVSphereVMOnTaskCompletion(ctx)
+	defer watchTask(ctx)
 
 	// Before going further, we need the VM's managed object reference.
 	vmRef, err := findVM(ctx)
 	if err != nil {
 		// If the VM's MoRef could not be found then the VM no longer exists. This
 		// is the desired state.
-		if isNotFound(err) || isFolderNotFound(err) {
+		if !isNotFound(err) && !isFolderNotFound(err) {
+			return vm, err
+		}
+
+		// A VM deployed from a content library item is named after the
+		// UID of the VSphereVM until it is configured.
+		deployedVM, err := vcenter.FindDeployedVM(ctx)
+		if err != nil {
+			return vm, err
+		}
+		if deployedVM == nil {
+			// The disks copied to create a VM on ESXi are deleted along
+			// with the VM, or along with their directory if the VM was
+			// not created.
+			if !ctx.Session.IsVC() {
+				task, err := esxi.DeleteDirectory(ctx)
+				if err != nil {
+					return vm, err
+				}
+				if task != nil {
+					ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+					ctx.Logger.Info("wait for the directory of the VM to be deleted")
+					return vm, nil
+				}
+			}
 			vm.State = infrav1.VirtualMachineStateNotFound
 			return vm, nil
 		}
-		return vm, err
+		vmRef = deployedVM.Reference()
 	}
 
 	//
@@ -203,6 +259,19 @@ func (vms *VMService) DestroyVM(ctx *context.VMContext) (infrav1.VirtualMachine,
 		return vm, nil
 	}
 
+	// Remove the VM from the VM group of its failure domain, so the group
+	// does not reference the VM while it is destroyed. A failure does not
+	// block the deletion.
+	if err := vms.removeFromVMGroup(vmCtx); err != nil {
+		ctx.Logger.Error(err, "unable to remove vm from VM group")
+	}
+
+	// Remove the VM from its anti-affinity rule, so the rule is removed
+	// along with its last member. A failure does not block the deletion.
+	if err := vms.removeFromAntiAffinityRule(vmCtx); err != nil {
+		ctx.Logger.Error(err, "unable to remove vm from anti-affinity rule", "rule", ctx.AntiAffinityRuleName)
+	}
+
 	// At this point the VM is not powered on and can be destroyed. Store the
 	// destroy task's reference and return a requeue error.
 	ctx.Logger.Info("destroying vm")
@@ -225,11 +294,24 @@ func (vms *VMService) reconcileNetworkStatus(ctx *virtualMachineContext) error {
 }
 
 func (vms *VMService) reconcileMetadata(ctx *virtualMachineContext) (bool, error) {
-	existingMetadata, err := vms.getMetadata(ctx)
+	guestInfo, err := vms.getGuestInfo(ctx)
 	if err != nil {
 		return false, err
 	}
 
+	// The hostname and the network of a VM whose guest is customized are
+	// configured by the guest customization instead of by the metadata.
+	if ctx.VSphereVM.Spec.Customization != nil {
+		return true, nil
+	}
+
+	// The metadata of a VM bootstrapped with Ignition is part of its
+	// Ignition config.
+	if _, ok := guestInfo[guestInfoKeyIgnition]; ok {
+		return vms.reconcileIgnitionConfig(ctx, guestInfo[guestInfoKeyIgnition])
+	}
+	existingMetadata := guestInfo[guestInfoKeyMetadata]
+
 	newMetadata, err := util.GetMachineMetadata(ctx.VSphereVM.Name, *ctx.VSphereVM, ctx.State.Network...)
 	if err != nil {
 		return false, err
@@ -251,6 +333,75 @@ func (vms *VMService) reconcileMetadata(ctx *virtualMachineContext) (bool, error
 	return false, nil
 }
 
+// reconcileIgnitionConfig extends the Ignition config of the bootstrap data
+// with the files configuring the hostname and the network of the VM. As
+// Ignition only runs on the first boot, the config is not updated once the
+// VM is powered on.
+func (vms *VMService) reconcileIgnitionConfig(ctx *virtualMachineContext, existingConfig string) (bool, error) {
+	powerState, err := vms.getPowerState(ctx)
+	if err != nil {
+		return false, err
+	}
+	if powerState == infrav1.VirtualMachinePowerStatePoweredOn {
+		return true, nil
+	}
+
+	bootstrapData, _, err := vms.getBootstrapData(&ctx.VMContext)
+	if err != nil {
+		return false, err
+	}
+	newConfig, err := util.GetMachineIgnitionConfig(ctx.VSphereVM.Name, *ctx.VSphereVM, bootstrapData, ctx.State.Network...)
+	if err != nil {
+		return false, err
+	}
+
+	// If the config is the same then return early.
+	if string(newConfig) == existingConfig {
+		return true, nil
+	}
+
+	// A task of the VM must complete before the VM is reconfigured, so that
+	// its reference is not overwritten.
+	if ctx.VSphereVM.Status.TaskRef != "" {
+		return false, nil
+	}
+
+	var extraConfig extra.Config
+	if err := extraConfig.SetIgnitionUserData(newConfig); err != nil {
+		return false, errors.Wrapf(err, "unable to set Ignition config on vm %s", ctx)
+	}
+
+	ctx.Logger.Info("updating Ignition config")
+	task, err := ctx.Obj.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+		ExtraConfig: extraConfig,
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to set Ignition config on vm %s", ctx)
+	}
+
+	ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+	ctx.Logger.Info("wait for VM Ignition config to be updated")
+	return false, nil
+}
+
+// reconcileDeployedVMCustomization starts the guest customization of a VM
+// deployed from a content library item before the VM is powered on. False is
+// returned while the customization is being started.
+func (vms *VMService) reconcileDeployedVMCustomization(ctx *virtualMachineContext) (bool, error) {
+	task, err := vcenter.CustomizeDeployedVM(&ctx.VMContext, ctx.Obj)
+	if err != nil {
+		conditions.MarkFalse(ctx.VSphereVM, infrav1.GuestCustomizationSucceededCondition, infrav1.GuestCustomizationFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return false, err
+	}
+	if task == nil {
+		return true, nil
+	}
+
+	ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+	ctx.Logger.Info("wait for the customization spec to be applied to the VM")
+	return false, nil
+}
+
 func (vms *VMService) reconcilePowerState(ctx *virtualMachineContext) (bool, error) {
 	powerState, err := vms.getPowerState(ctx)
 	if err != nil {
@@ -273,10 +424,6 @@ func (vms *VMService) reconcilePowerState(ctx *virtualMachineContext) (bool, err
 			return false, err
 		}
 
-		// Once the VM is successfully powered on, a reconcile request should be
-		// triggered once the VM reports IP addresses are available.
-		reconcileVSphereVMWhenNetworkIsReady(ctx, task)
-
 		ctx.Logger.Info("wait for VM to be powered on")
 		return false, nil
 	case infrav1.VirtualMachinePowerStatePoweredOn:
@@ -287,6 +434,55 @@ func (vms *VMService) reconcilePowerState(ctx *virtualMachineContext) (bool, err
 	}
 }
 
+// reconcileGuestCustomization waits for the guest customization of the VM
+// to complete once the VM is powered on. The completion is tracked through
+// the customization events of the VM. The guest reports its network once it
+// is customized, which triggers a reconcile. False is returned until the
+// customization succeeds.
+func (vms *VMService) reconcileGuestCustomization(ctx *virtualMachineContext) (bool, error) {
+	if ctx.VSphereVM.Spec.Customization == nil {
+		conditions.Delete(ctx.VSphereVM, infrav1.GuestCustomizationSucceededCondition)
+		return true, nil
+	}
+	if conditions.IsTrue(ctx.VSphereVM, infrav1.GuestCustomizationSucceededCondition) {
+		return true, nil
+	}
+
+	events, err := event.NewManager(ctx.Session.Client.Client).QueryEvents(ctx, types.EventFilterSpec{
+		Entity: &types.EventFilterSpecByEntity{
+			Entity:    ctx.Ref,
+			Recursion: types.EventFilterSpecRecursionOptionSelf,
+		},
+		EventTypeId: customizationEventTypes,
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to query customization events of vm %s", ctx)
+	}
+
+	// The latest event reflects the state of the customization.
+	var latest types.BaseEvent
+	for _, e := range events {
+		if latest == nil || e.GetEvent().Key > latest.GetEvent().Key {
+			latest = e
+		}
+	}
+	switch e := latest.(type) {
+	case *types.CustomizationSucceeded:
+		ctx.Logger.Info("guest customization succeeded")
+		conditions.MarkTrue(ctx.VSphereVM, infrav1.GuestCustomizationSucceededCondition)
+		return true, nil
+	case types.BaseCustomizationFailed:
+		msg := e.GetCustomizationFailed().FullFormattedMessage
+		ctx.Logger.Info("guest customization failed", "reason", msg)
+		conditions.MarkFalse(ctx.VSphereVM, infrav1.GuestCustomizationSucceededCondition, infrav1.GuestCustomizationFailedReason, clusterv1.ConditionSeverityError, msg)
+		return false, nil
+	default:
+		ctx.Logger.Info("wait for guest customization to complete")
+		conditions.MarkFalse(ctx.VSphereVM, infrav1.GuestCustomizationSucceededCondition, infrav1.GuestCustomizationPendingReason, clusterv1.ConditionSeverityInfo, "")
+		return false, nil
+	}
+}
+
 func (vms *VMService) reconcileStoragePolicy(ctx *virtualMachineContext) error {
 	if ctx.VSphereVM.Spec.StoragePolicyName == "" {
 		ctx.Logger.Info("storage policy not defined. skipping reconcile storage policy")
@@ -316,6 +512,29 @@ func (vms *VMService) reconcileStoragePolicy(ctx *virtualMachineContext) error {
 		return err
 	}
 
+	// Template and additional disks with their own storage policy keep it.
+	diskStoragePolicies := make([]string, 0, len(ctx.VSphereVM.Spec.TemplateDisks)+len(ctx.VSphereVM.Spec.AdditionalDisks))
+	for _, disk := range ctx.VSphereVM.Spec.TemplateDisks {
+		diskStoragePolicies = append(diskStoragePolicies, disk.StoragePolicyName)
+	}
+	for _, disk := range ctx.VSphereVM.Spec.AdditionalDisks {
+		diskStoragePolicies = append(diskStoragePolicies, disk.StoragePolicyName)
+	}
+	for _, storagePolicyName := range diskStoragePolicies {
+		if storagePolicyName == "" || storagePolicyName == ctx.VSphereVM.Spec.StoragePolicyName {
+			continue
+		}
+		diskProfileID, err := pbmClient.ProfileIDByName(ctx, storagePolicyName)
+		if err != nil {
+			return errors.Wrapf(err, "unable to retrieve storage profile ID of %s", storagePolicyName)
+		}
+		diskEntities, err := pbmClient.QueryAssociatedEntity(ctx, pbmTypes.PbmProfileId{UniqueId: diskProfileID}, "virtualDiskId")
+		if err != nil {
+			return err
+		}
+		entities = append(entities, diskEntities...)
+	}
+
 	var changes []types.BaseVirtualDeviceConfigSpec
 	devices, err := ctx.Obj.Device(ctx)
 	if err != nil {
@@ -363,6 +582,88 @@ func (vms *VMService) reconcileStoragePolicy(ctx *virtualMachineContext) error {
 	return nil
 }
 
+// reconcileVMGroupInfo adds the VM to the VM group of its failure domain.
+func (vms *VMService) reconcileVMGroupInfo(ctx *virtualMachineContext) error {
+	failureDomain := ctx.VSphereFailureDomain
+	if failureDomain == nil || failureDomain.Spec.Topology.HostGroup == nil || failureDomain.Spec.Topology.HostGroup.VMGroupName == "" {
+		return nil
+	}
+
+	computeCluster, err := vmGroupComputeCluster(ctx)
+	if err != nil {
+		return err
+	}
+	return cluster.AddVMToGroup(ctx, computeCluster, failureDomain.Spec.Topology.HostGroup.VMGroupName, ctx.Ref)
+}
+
+// removeFromVMGroup removes the VM from the VM group of its failure domain.
+func (vms *VMService) removeFromVMGroup(ctx *virtualMachineContext) error {
+	failureDomain := ctx.VSphereFailureDomain
+	if failureDomain == nil || failureDomain.Spec.Topology.HostGroup == nil || failureDomain.Spec.Topology.HostGroup.VMGroupName == "" {
+		return nil
+	}
+
+	computeCluster, err := vmGroupComputeCluster(ctx)
+	if err != nil {
+		return err
+	}
+	return cluster.RemoveVMFromGroup(ctx, computeCluster, failureDomain.Spec.Topology.HostGroup.VMGroupName, ctx.Ref)
+}
+
+// vmGroupComputeCluster returns the compute cluster of the VM group of the
+// failure domain of the VM.
+func vmGroupComputeCluster(ctx *virtualMachineContext) (*object.ClusterComputeResource, error) {
+	failureDomain := ctx.VSphereFailureDomain
+	topology := failureDomain.Spec.Topology
+	if topology.ComputeCluster == nil {
+		return nil, errors.Errorf("VM group %q of failure domain %s requires a compute cluster", topology.HostGroup.VMGroupName, failureDomain.Name)
+	}
+	computeCluster, err := ctx.Session.Finder.ClusterComputeResource(ctx, *topology.ComputeCluster)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find compute cluster %q for vm %s", *topology.ComputeCluster, ctx)
+	}
+	return computeCluster, nil
+}
+
+// reconcileAntiAffinityRule adds the VM to its DRS anti-affinity rule. A VM
+// whose rule cannot be configured is provisioned nevertheless, the failure
+// being reported by the AntiAffinityRuleConfigured condition.
+func (vms *VMService) reconcileAntiAffinityRule(ctx *virtualMachineContext) {
+	name := ctx.AntiAffinityRuleName
+	if name == "" {
+		conditions.Delete(ctx.VSphereVM, infrav1.AntiAffinityRuleConfiguredCondition)
+		return
+	}
+
+	computeCluster, err := cluster.FindComputeClusterOfVM(ctx, ctx.Ref)
+	if err == nil && computeCluster == nil {
+		err = errors.Errorf("vm %s does not run in a compute cluster", ctx)
+	}
+	if err == nil {
+		err = cluster.AddVMToAntiAffinityRule(ctx, computeCluster, name, ctx.Ref)
+	}
+	if err != nil {
+		ctx.Logger.Error(err, "unable to configure anti-affinity rule", "rule", name)
+		conditions.MarkFalse(ctx.VSphereVM, infrav1.AntiAffinityRuleConfiguredCondition, infrav1.AntiAffinityRuleFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+	conditions.MarkTrue(ctx.VSphereVM, infrav1.AntiAffinityRuleConfiguredCondition)
+}
+
+// removeFromAntiAffinityRule removes the VM from its DRS anti-affinity rule.
+func (vms *VMService) removeFromAntiAffinityRule(ctx *virtualMachineContext) error {
+	name := ctx.AntiAffinityRuleName
+	if name == "" {
+		return nil
+	}
+
+	computeCluster, err := cluster.FindComputeClusterOfVM(ctx, ctx.Ref)
+	if err != nil || computeCluster == nil {
+		return err
+	}
+	return cluster.RemoveVMFromAntiAffinityRule(ctx, computeCluster, name, ctx.Ref)
+}
+
 func (vms *VMService) reconcileUUID(ctx *virtualMachineContext) {
 	ctx.State.BiosUUID = ctx.Obj.UUID(ctx)
 }
@@ -385,7 +686,9 @@ func (vms *VMService) getPowerState(ctx *virtualMachineContext) (infrav1.Virtual
 	}
 }
 
-func (vms *VMService) getMetadata(ctx *virtualMachineContext) (string, error) {
+// getGuestInfo returns the decoded values of the guestinfo keys of the
+// metadata and the Ignition config of the VM.
+func (vms *VMService) getGuestInfo(ctx *virtualMachineContext) (map[string]string, error) {
 	var (
 		obj mo.VirtualMachine
 
@@ -394,39 +697,34 @@ func (vms *VMService) getMetadata(ctx *virtualMachineContext) (string, error) {
 	)
 
 	if err := pc.RetrieveOne(ctx, ctx.Ref, props, &obj); err != nil {
-		return "", errors.Wrapf(err, "unable to fetch props %v for vm %s", props, ctx)
+		return nil, errors.Wrapf(err, "unable to fetch props %v for vm %s", props, ctx)
 	}
+	guestInfo := map[string]string{}
 	if obj.Config == nil {
-		return "", nil
+		return guestInfo, nil
 	}
 
-	var metadataBase64 string
 	for _, ec := range obj.Config.ExtraConfig {
-		if optVal := ec.GetOptionValue(); optVal != nil {
-			// TODO(akutz) Using a switch instead of if in case we ever
-			//             want to check the metadata encoding as well.
-			//             Since the image stamped images always use
-			//             base64, it should be okay to not check.
-			// nolint
-			switch optVal.Key {
-			case guestInfoKeyMetadata:
-				if v, ok := optVal.Value.(string); ok {
-					metadataBase64 = v
-				}
+		optVal := ec.GetOptionValue()
+		if optVal == nil {
+			continue
+		}
+		// Since the image stamped images and Ignition always use base64,
+		// it is okay to not check the encoding.
+		switch optVal.Key {
+		case guestInfoKeyMetadata, guestInfoKeyIgnition:
+			v, ok := optVal.Value.(string)
+			if !ok {
+				continue
+			}
+			buf, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to decode %s for %s", optVal.Key, ctx)
 			}
+			guestInfo[optVal.Key] = string(buf)
 		}
 	}
-
-	if metadataBase64 == "" {
-		return "", nil
-	}
-
-	metadataBuf, err := base64.StdEncoding.DecodeString(metadataBase64)
-	if err != nil {
-		return "", errors.Wrapf(err, "unable to decode metadata for %s", ctx)
-	}
-
-	return string(metadataBuf), nil
+	return guestInfo, nil
 }
 
 func (vms *VMService) setMetadata(ctx *virtualMachineContext, metadata []byte) (string, error) {
@@ -463,10 +761,13 @@ func (vms *VMService) getNetworkStatus(ctx *virtualMachineContext) ([]infrav1.Ne
 	return apiNetStatus, nil
 }
 
-func (vms *VMService) getBootstrapData(ctx *context.VMContext) ([]byte, error) {
+// getBootstrapData returns the bootstrap data and its format. The format is
+// read from the bootstrap data secret, and defaults to Ignition for bootstrap
+// data which looks like an Ignition config.
+func (vms *VMService) getBootstrapData(ctx *context.VMContext) ([]byte, extra.BootstrapFormat, error) {
 	if ctx.VSphereVM.Spec.BootstrapRef == nil {
 		ctx.Logger.Info("VM has no bootstrap data")
-		return nil, nil
+		return nil, "", nil
 	}
 
 	secret := &corev1.Secret{}
@@ -475,13 +776,29 @@ func (vms *VMService) getBootstrapData(ctx *context.VMContext) ([]byte, error) {
 		Name:      ctx.VSphereVM.Spec.BootstrapRef.Name,
 	}
 	if err := ctx.Client.Get(ctx, secretKey, secret); err != nil {
-		return nil, errors.Wrapf(err, "failed to retrieve bootstrap data secret for %s", ctx)
+		return nil, "", errors.Wrapf(err, "failed to retrieve bootstrap data secret for %s", ctx)
 	}
 
 	value, ok := secret.Data["value"]
 	if !ok {
-		return nil, errors.New("error retrieving bootstrap data: secret value key is missing")
+		return nil, "", errors.New("error retrieving bootstrap data: secret value key is missing")
 	}
 
-	return value, nil
+	format := extra.BootstrapFormat(secret.Data["format"])
+	if format == "" {
+		format = extra.CloudConfig
+		if isIgnitionConfig(value) {
+			format = extra.Ignition
+		}
+	}
+	return value, format, nil
+}
+
+// isIgnitionConfig returns whether the data is a JSON object with an
+// "ignition" section, which cloud-init user data never is.
+func isIgnitionConfig(data []byte) bool {
+	var config struct {
+		Ignition *json.RawMessage `json:"ignition"`
+	}
+	return json.Unmarshal(data, &config) == nil && config.Ignition != nil
 }
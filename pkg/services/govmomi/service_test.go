@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"crypto/tls"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/event"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+func TestReconcileGuestCustomization(t *testing.T) {
+	g := NewWithT(t)
+
+	model := simulator.VPX()
+	defer model.Remove()
+	g.Expect(model.Create()).To(Succeed())
+	model.Service.TLS = new(tls.Config)
+
+	s := model.Service.NewServer()
+	defer s.Close()
+	pass, _ := s.URL.User.Password()
+
+	vmContext := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+	vmContext.VSphereVM.Spec.Server = s.URL.Host
+
+	authSession, err := session.GetOrCreate(
+		vmContext.Context,
+		session.NewParams().
+			WithServer(vmContext.VSphereVM.Spec.Server).
+			WithUserInfo(s.URL.User.Username(), pass))
+	g.Expect(err).NotTo(HaveOccurred())
+	vmContext.Session = authSession
+
+	vms := simulator.Map.All("VirtualMachine")
+	vm, otherVM := vms[0].Reference(), vms[1].Reference()
+	vmCtx := &virtualMachineContext{
+		VMContext: *vmContext,
+		Obj:       object.NewVirtualMachine(authSession.Client.Client, vm),
+		Ref:       vm,
+	}
+
+	manager := event.NewManager(authSession.Client.Client)
+	postEvent := func(ref types.ManagedObjectReference, e types.BaseEvent) {
+		e.GetEvent().Vm = &types.VmEventArgument{Vm: ref}
+		g.Expect(manager.PostEvent(vmCtx, e)).To(Succeed())
+	}
+
+	vmService := &VMService{}
+
+	// A VM which is not customized does not have the condition.
+	conditions.MarkTrue(vmCtx.VSphereVM, infrav1.GuestCustomizationSucceededCondition)
+	ok, err := vmService.reconcileGuestCustomization(vmCtx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ok).To(BeTrue())
+	g.Expect(conditions.Has(vmCtx.VSphereVM, infrav1.GuestCustomizationSucceededCondition)).To(BeFalse())
+
+	// The customization is pending until it completes, regardless of the
+	// events of other VMs.
+	vmCtx.VSphereVM.Spec.Customization = &infrav1.GuestCustomizationSpec{Type: infrav1.LinuxGuestCustomization}
+	postEvent(vm, &types.CustomizationStartedEvent{})
+	postEvent(otherVM, &types.CustomizationSucceeded{})
+	ok, err = vmService.reconcileGuestCustomization(vmCtx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ok).To(BeFalse())
+	g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.GuestCustomizationSucceededCondition)).To(Equal(infrav1.GuestCustomizationPendingReason))
+
+	// The latest event reflects the state of the customization.
+	postEvent(vm, &types.CustomizationLinuxIdentityFailed{})
+	ok, err = vmService.reconcileGuestCustomization(vmCtx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ok).To(BeFalse())
+	g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.GuestCustomizationSucceededCondition)).To(Equal(infrav1.GuestCustomizationFailedReason))
+	g.Expect(*conditions.GetSeverity(vmCtx.VSphereVM, infrav1.GuestCustomizationSucceededCondition)).To(Equal(clusterv1.ConditionSeverityError))
+
+	postEvent(vm, &types.CustomizationSucceeded{})
+	ok, err = vmService.reconcileGuestCustomization(vmCtx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ok).To(BeTrue())
+	g.Expect(conditions.IsTrue(vmCtx.VSphereVM, infrav1.GuestCustomizationSucceededCondition)).To(BeTrue())
+}
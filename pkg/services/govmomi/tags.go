@@ -0,0 +1,210 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+// vmTag is a tag which identifies the cluster, the namespace or the role of
+// a VM.
+type vmTag struct {
+	category string
+	name     string
+}
+
+// reconcileTags attaches the tags of the clone spec and the tags identifying
+// the cluster, the namespace and the role of the VM. A VM may only have one
+// tag of each category of the tags identifying it, so tags of these
+// categories which no longer apply are detached.
+func (vms *VMService) reconcileTags(ctx *virtualMachineContext) error {
+	if !ctx.Session.IsVC() {
+		if len(ctx.VSphereVM.Spec.TagIDs) > 0 {
+			return errors.Errorf("unable to attach tags to vm %s: tagging is only supported when connected to vCenter", ctx)
+		}
+		return nil
+	}
+	manager, err := ctx.Session.TagManager(ctx)
+	if err != nil {
+		return err
+	}
+
+	attachedTags, err := manager.GetAttachedTags(ctx, ctx.Ref)
+	if err != nil {
+		return errors.Wrapf(err, "unable to list tags attached to vm %s", ctx)
+	}
+	attachedTagIDs := make(map[string]struct{}, len(attachedTags))
+	for _, tag := range attachedTags {
+		attachedTagIDs[tag.ID] = struct{}{}
+	}
+
+	for _, tagID := range ctx.VSphereVM.Spec.TagIDs {
+		if _, ok := attachedTagIDs[tagID]; ok {
+			continue
+		}
+		ctx.Logger.Info("attaching tag", "tag", tagID)
+		if err := manager.AttachTag(ctx, tagID, ctx.Ref); err != nil {
+			return errors.Wrapf(err, "unable to attach tag %s to vm %s", tagID, ctx)
+		}
+	}
+
+	categories, err := manager.GetCategories(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to list tag categories")
+	}
+	categoryIDs := make(map[string]string, len(categories))
+	for _, category := range categories {
+		categoryIDs[category.Name] = category.ID
+	}
+
+	for _, desired := range getVMTags(ctx) {
+		categoryID, ok := categoryIDs[desired.category]
+		if ok && hasTag(attachedTags, categoryID, desired.name) {
+			continue
+		}
+		if !ok {
+			if categoryID, err = createVMTagCategory(ctx, manager, desired.category); err != nil {
+				return err
+			}
+		}
+		tagID, err := ensureVMTag(ctx, manager, categoryID, desired)
+		if err != nil {
+			return err
+		}
+
+		for _, tag := range attachedTags {
+			if tag.CategoryID != categoryID || tag.ID == tagID {
+				continue
+			}
+			ctx.Logger.Info("detaching tag", "category", desired.category, "tag", tag.Name)
+			if err := manager.DetachTag(ctx, tag.ID, ctx.Ref); err != nil {
+				return errors.Wrapf(err, "unable to detach tag %s from vm %s", tag.ID, ctx)
+			}
+		}
+		ctx.Logger.Info("attaching tag", "category", desired.category, "tag", desired.name)
+		if err := manager.AttachTag(ctx, tagID, ctx.Ref); err != nil {
+			return errors.Wrapf(err, "unable to attach tag %s to vm %s", tagID, ctx)
+		}
+	}
+	return nil
+}
+
+// getVMTags returns the tags which identify the cluster, the namespace and
+// the role of the VM.
+func getVMTags(ctx *virtualMachineContext) []vmTag {
+	vmTags := []vmTag{{category: tagCategoryNamespace, name: ctx.VSphereVM.Namespace}}
+	if clusterName := ctx.VSphereVM.Labels[clusterv1.ClusterLabelName]; clusterName != "" {
+		vmTags = append(vmTags, vmTag{category: tagCategoryCluster, name: clusterName})
+	}
+	if _, ok := ctx.VSphereVM.Labels[clusterv1.MachineControlPlaneLabelName]; ok {
+		vmTags = append(vmTags, vmTag{category: tagCategoryRole, name: roleControlPlane})
+	} else if ctx.MachineName != "" {
+		vmTags = append(vmTags, vmTag{category: tagCategoryRole, name: roleWorker})
+	}
+	return vmTags
+}
+
+func hasTag(attachedTags []tags.Tag, categoryID, name string) bool {
+	for _, tag := range attachedTags {
+		if tag.CategoryID == categoryID && tag.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func createVMTagCategory(ctx *virtualMachineContext, manager *tags.Manager, name string) (string, error) {
+	ctx.Logger.Info("creating tag category", "category", name)
+	categoryID, err := manager.CreateCategory(ctx, &tags.Category{
+		Name:            name,
+		Cardinality:     "SINGLE",
+		AssociableTypes: []string{"VirtualMachine"},
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to create tag category %q", name)
+	}
+	return categoryID, nil
+}
+
+func ensureVMTag(ctx *virtualMachineContext, manager *tags.Manager, categoryID string, desired vmTag) (string, error) {
+	existingTags, err := manager.GetTagsForCategory(ctx, categoryID)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to list tags of category %q", desired.category)
+	}
+	for _, tag := range existingTags {
+		if tag.Name == desired.name {
+			return tag.ID, nil
+		}
+	}
+
+	ctx.Logger.Info("creating tag", "category", desired.category, "tag", desired.name)
+	tagID, err := manager.CreateTag(ctx, &tags.Tag{
+		Name:       desired.name,
+		CategoryID: categoryID,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to create tag %q in category %q", desired.name, desired.category)
+	}
+	return tagID, nil
+}
+
+// reconcileMachineNameAttribute sets the custom attribute of the clone spec
+// to the name of the Machine owning the VM.
+func (vms *VMService) reconcileMachineNameAttribute(ctx *virtualMachineContext) error {
+	name := ctx.VSphereVM.Spec.MachineNameAttribute
+	if name == "" || ctx.MachineName == "" {
+		return nil
+	}
+
+	manager, err := object.GetCustomFieldsManager(ctx.Session.Client.Client)
+	if err != nil {
+		return errors.Wrapf(err, "unable to set custom attribute %q of vm %s", name, ctx)
+	}
+	key, err := manager.FindKey(ctx, name)
+	if err == object.ErrKeyNameNotFound {
+		ctx.Logger.Info("defining custom attribute", "attribute", name)
+		def, addErr := manager.Add(ctx, name, "VirtualMachine", nil, nil)
+		if addErr != nil {
+			return errors.Wrapf(addErr, "unable to define custom attribute %q", name)
+		}
+		key, err = def.Key, nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "unable to find custom attribute %q", name)
+	}
+
+	var obj mo.VirtualMachine
+	if err := ctx.Obj.Properties(ctx, ctx.Ref, []string{"customValue"}, &obj); err != nil {
+		return errors.Wrapf(err, "unable to get custom attributes of vm %s", ctx)
+	}
+	for _, value := range obj.CustomValue {
+		if value, ok := value.(*types.CustomFieldStringValue); ok && value.Key == key && value.Value == ctx.MachineName {
+			return nil
+		}
+	}
+
+	ctx.Logger.Info("setting custom attribute", "attribute", name, "value", ctx.MachineName)
+	if err := manager.Set(ctx, ctx.Ref, key, ctx.MachineName); err != nil {
+		return errors.Wrapf(err, "unable to set custom attribute %q of vm %s", name, ctx)
+	}
+	return nil
+}
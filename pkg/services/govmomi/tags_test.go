@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"crypto/tls"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+func TestReconcileTags(t *testing.T) {
+	g := NewWithT(t)
+
+	model := simulator.VPX()
+	defer model.Remove()
+	g.Expect(model.Create()).To(Succeed())
+	model.Service.TLS = new(tls.Config)
+	model.Service.RegisterEndpoints = true
+
+	s := model.Service.NewServer()
+	defer s.Close()
+	pass, _ := s.URL.User.Password()
+
+	vmContext := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+	vmContext.VSphereVM.Spec.Server = s.URL.Host
+	vmContext.VSphereVM.Labels = map[string]string{
+		clusterv1.ClusterLabelName:             "my-cluster",
+		clusterv1.MachineControlPlaneLabelName: "",
+	}
+	vmContext.VSphereVM.Spec.MachineNameAttribute = "machine"
+	vmContext.MachineName = "my-machine"
+
+	authSession, err := session.GetOrCreate(
+		vmContext.Context,
+		session.NewParams().
+			WithServer(vmContext.VSphereVM.Spec.Server).
+			WithUserInfo(s.URL.User.Username(), pass))
+	g.Expect(err).NotTo(HaveOccurred())
+	vmContext.Session = authSession
+	manager, err := authSession.TagManager(vmContext)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	categoryID, err := manager.CreateCategory(vmContext, &tags.Category{Name: "backup", Cardinality: "SINGLE"})
+	g.Expect(err).NotTo(HaveOccurred())
+	tagID, err := manager.CreateTag(vmContext, &tags.Tag{Name: "daily", CategoryID: categoryID})
+	g.Expect(err).NotTo(HaveOccurred())
+	vmContext.VSphereVM.Spec.TagIDs = []string{tagID}
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	vmCtx := &virtualMachineContext{
+		VMContext: *vmContext,
+		Obj:       object.NewVirtualMachine(authSession.Client.Client, vm.Reference()),
+		Ref:       vm.Reference(),
+	}
+
+	vms := &VMService{}
+	// Reconciling tags which are already attached is a no-op.
+	for i := 0; i < 2; i++ {
+		g.Expect(vms.reconcileTags(vmCtx)).To(Succeed())
+		g.Expect(vms.reconcileMachineNameAttribute(vmCtx)).To(Succeed())
+	}
+
+	attachedTags, err := manager.GetAttachedTags(vmContext, vm.Reference())
+	g.Expect(err).NotTo(HaveOccurred())
+	names := []string{}
+	for _, tag := range attachedTags {
+		names = append(names, tag.Name)
+	}
+	g.Expect(names).To(ConsistOf("daily", vmContext.VSphereVM.Namespace, "my-cluster", roleControlPlane))
+
+	var obj mo.VirtualMachine
+	g.Expect(vmCtx.Obj.Properties(vmContext, vm.Reference(), []string{"customValue"}, &obj)).To(Succeed())
+	g.Expect(obj.CustomValue).To(HaveLen(1))
+	g.Expect(obj.CustomValue[0].(*types.CustomFieldStringValue).Value).To(Equal("my-machine"))
+}
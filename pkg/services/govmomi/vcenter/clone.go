@@ -41,7 +41,7 @@ const (
 
 // Clone kicks off a clone operation on vCenter to create a new virtual machine.
 // nolint:gocognit,gocyclo
-func Clone(ctx *context.VMContext, bootstrapData []byte) error {
+func Clone(ctx *context.VMContext, bootstrapData []byte, format extra.BootstrapFormat) error {
 	ctx = &context.VMContext{
 		ControllerContext: ctx.ControllerContext,
 		VSphereVM:         ctx.VSphereVM,
@@ -54,7 +54,7 @@ func Clone(ctx *context.VMContext, bootstrapData []byte) error {
 	var extraConfig extra.Config
 	if len(bootstrapData) > 0 {
 		ctx.Logger.Info("applied bootstrap data to VM clone spec")
-		if err := extraConfig.SetCloudInitUserData(bootstrapData); err != nil {
+		if err := extraConfig.SetUserData(bootstrapData, format); err != nil {
 			return err
 		}
 	}
@@ -65,6 +65,10 @@ func Clone(ctx *context.VMContext, bootstrapData []byte) error {
 		}
 	}
 
+	if ctx.VSphereVM.Spec.ContentLibrary != "" {
+		return deployLibraryItem(ctx, extraConfig)
+	}
+
 	tpl, err := template.FindTemplate(ctx, ctx.VSphereVM.Spec.Template)
 	if err != nil {
 		return err
@@ -126,13 +130,13 @@ func Clone(ctx *context.VMContext, bootstrapData []byte) error {
 	// Create a new list of device specs for cloning the VM.
 	deviceSpecs := []types.BaseVirtualDeviceConfigSpec{}
 
-	// Only non-linked clones may expand the size of the template's disk.
+	// Only non-linked clones may expand the size of the template's disks.
 	if snapshotRef == nil {
-		diskSpec, err := getDiskSpec(ctx, devices)
+		diskSpecs, err := getDiskSpecs(ctx, devices)
 		if err != nil {
 			return errors.Wrapf(err, "error getting disk spec for %q", ctx)
 		}
-		deviceSpecs = append(deviceSpecs, diskSpec)
+		deviceSpecs = append(deviceSpecs, diskSpecs...)
 	}
 
 	networkSpecs, err := getNetworkSpecs(ctx, devices)
@@ -141,32 +145,14 @@ func Clone(ctx *context.VMContext, bootstrapData []byte) error {
 	}
 	deviceSpecs = append(deviceSpecs, networkSpecs...)
 
-	numCPUs := ctx.VSphereVM.Spec.NumCPUs
-	if numCPUs < 2 {
-		numCPUs = 2
-	}
-	numCoresPerSocket := ctx.VSphereVM.Spec.NumCoresPerSocket
-	if numCoresPerSocket == 0 {
-		numCoresPerSocket = numCPUs
-	}
-	memMiB := ctx.VSphereVM.Spec.MemoryMiB
-	if memMiB == 0 {
-		memMiB = 2048
+	customizationSpec, err := getCustomizationSpec(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error getting customization spec for %q", ctx)
 	}
 
 	spec := types.VirtualMachineCloneSpec{
-		Config: &types.VirtualMachineConfigSpec{
-			// Assign the clone's InstanceUUID the value of the Kubernetes Machine
-			// object's UID. This allows lookup of the cloned VM prior to knowing
-			// the VM's UUID.
-			InstanceUuid:      string(ctx.VSphereVM.UID),
-			Flags:             newVMFlagInfo(),
-			DeviceChange:      deviceSpecs,
-			ExtraConfig:       extraConfig,
-			NumCPUs:           numCPUs,
-			NumCoresPerSocket: numCoresPerSocket,
-			MemoryMB:          memMiB,
-		},
+		Config:        newVMConfigSpec(ctx, deviceSpecs, extraConfig),
+		Customization: customizationSpec,
 		Location: types.VirtualMachineRelocateSpec{
 			DiskMoveType: string(diskMoveType),
 			Folder:       types.NewReference(folder.Reference()),
@@ -242,7 +228,16 @@ func Clone(ctx *context.VMContext, bootstrapData []byte) error {
 	}
 
 	disks := devices.SelectByType((*types.VirtualDisk)(nil))
-	spec.Location.Disk = getDiskLocators(disks, *datastoreRef)
+	spec.Location.Disk, err = getDiskLocators(ctx, disks, *datastoreRef)
+	if err != nil {
+		return errors.Wrapf(err, "error getting disk locators for %q", ctx)
+	}
+
+	additionalDiskSpecs, err := getAdditionalDiskSpecs(ctx, devices, *datastoreRef)
+	if err != nil {
+		return errors.Wrapf(err, "error getting additional disk specs for %q", ctx)
+	}
+	spec.Config.DeviceChange = append(spec.Config.DeviceChange, additionalDiskSpecs...)
 
 	ctx.Logger.Info("cloning machine", "namespace", ctx.VSphereVM.Namespace, "name", ctx.VSphereVM.Name, "cloneType", ctx.VSphereVM.Status.CloneMode)
 	task, err := tpl.Clone(ctx, folder, ctx.VSphereVM.Name, spec)
@@ -261,6 +256,39 @@ func Clone(ctx *context.VMContext, bootstrapData []byte) error {
 	return nil
 }
 
+// newVMConfigSpec returns the config spec applied to the new virtual machine.
+func newVMConfigSpec(
+	ctx *context.VMContext,
+	deviceSpecs []types.BaseVirtualDeviceConfigSpec,
+	extraConfig extra.Config) *types.VirtualMachineConfigSpec {
+
+	numCPUs := ctx.VSphereVM.Spec.NumCPUs
+	if numCPUs < 2 {
+		numCPUs = 2
+	}
+	numCoresPerSocket := ctx.VSphereVM.Spec.NumCoresPerSocket
+	if numCoresPerSocket == 0 {
+		numCoresPerSocket = numCPUs
+	}
+	memMiB := ctx.VSphereVM.Spec.MemoryMiB
+	if memMiB == 0 {
+		memMiB = 2048
+	}
+
+	return &types.VirtualMachineConfigSpec{
+		// Assign the clone's InstanceUUID the value of the Kubernetes Machine
+		// object's UID. This allows lookup of the cloned VM prior to knowing
+		// the VM's UUID.
+		InstanceUuid:      string(ctx.VSphereVM.UID),
+		Flags:             newVMFlagInfo(),
+		DeviceChange:      deviceSpecs,
+		ExtraConfig:       extraConfig,
+		NumCPUs:           numCPUs,
+		NumCoresPerSocket: numCoresPerSocket,
+		MemoryMB:          memMiB,
+	}
+}
+
 func newVMFlagInfo() *types.VirtualMachineFlagInfo {
 	diskUUIDEnabled := true
 	return &types.VirtualMachineFlagInfo{
@@ -268,7 +296,16 @@ func newVMFlagInfo() *types.VirtualMachineFlagInfo {
 	}
 }
 
-func getDiskLocators(disks object.VirtualDeviceList, datastoreRef types.ManagedObjectReference) []types.VirtualMachineRelocateSpecDiskLocator {
+func getDiskLocators(
+	ctx *context.VMContext,
+	disks object.VirtualDeviceList,
+	datastoreRef types.ManagedObjectReference) ([]types.VirtualMachineRelocateSpecDiskLocator, error) {
+
+	templateDisks, err := matchTemplateDisks(disks, ctx.VSphereVM.Spec.TemplateDisks)
+	if err != nil {
+		return nil, err
+	}
+
 	diskLocators := make([]types.VirtualMachineRelocateSpecDiskLocator, 0, len(disks))
 	for _, disk := range disks {
 		dl := types.VirtualMachineRelocateSpecDiskLocator{
@@ -277,37 +314,290 @@ func getDiskLocators(disks object.VirtualDeviceList, datastoreRef types.ManagedO
 			Datastore:    datastoreRef,
 		}
 
+		if templateDisk, ok := templateDisks[disk.GetVirtualDevice().Key]; ok {
+			if templateDisk.Datastore != "" {
+				datastore, err := ctx.Session.Finder.Datastore(ctx, templateDisk.Datastore)
+				if err != nil {
+					return nil, errors.Wrapf(err, "unable to get datastore %s for template disk %d", templateDisk.Datastore, disk.GetVirtualDevice().Key)
+				}
+				dl.Datastore = datastore.Reference()
+			}
+			if templateDisk.StoragePolicyName != "" {
+				storageProfileID, err := getStorageProfileID(ctx, templateDisk.StoragePolicyName)
+				if err != nil {
+					return nil, err
+				}
+				dl.Profile = []types.BaseVirtualMachineProfileSpec{
+					&types.VirtualMachineDefinedProfileSpec{ProfileId: storageProfileID},
+				}
+			}
+		}
+
 		if vmDiskBacking, ok := disk.(*types.VirtualDisk).Backing.(*types.VirtualDiskFlatVer2BackingInfo); ok {
 			dl.DiskBackingInfo = vmDiskBacking
 		}
 		diskLocators = append(diskLocators, dl)
 	}
 
-	return diskLocators
+	return diskLocators, nil
 }
 
-func getDiskSpec(
+// getDiskSpecs returns the device specs resizing the disks of the template.
+// The first disk is resized according to DiskGiB, unless its size is
+// overridden like the one of any other disk of the template.
+func getDiskSpecs(
 	ctx *context.VMContext,
-	devices object.VirtualDeviceList) (types.BaseVirtualDeviceConfigSpec, error) {
+	devices object.VirtualDeviceList) ([]types.BaseVirtualDeviceConfigSpec, error) {
 
 	disks := devices.SelectByType((*types.VirtualDisk)(nil))
-	if len(disks) != 1 {
+	if len(disks) == 0 {
 		return nil, errors.Errorf("invalid disk count: %d", len(disks))
 	}
 
-	disk := disks[0].(*types.VirtualDisk)
-	cloneCapacityKB := int64(ctx.VSphereVM.Spec.DiskGiB) * 1024 * 1024
-	if disk.CapacityInKB > cloneCapacityKB {
-		return nil, errors.Errorf(
-			"can't resize template disk down, initial capacity is larger: %dKiB > %dKiB",
-			disk.CapacityInKB, cloneCapacityKB)
+	templateDisks, err := matchTemplateDisks(disks, ctx.VSphereVM.Spec.TemplateDisks)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceSpecs := []types.BaseVirtualDeviceConfigSpec{}
+	for i := range disks {
+		disk := disks[i].(*types.VirtualDisk)
+
+		var sizeGiB int32
+		if i == 0 {
+			sizeGiB = ctx.VSphereVM.Spec.DiskGiB
+		}
+		if templateDisk, ok := templateDisks[disk.Key]; ok && templateDisk.SizeGiB > 0 {
+			sizeGiB = templateDisk.SizeGiB
+		}
+		if sizeGiB == 0 {
+			continue
+		}
+
+		cloneCapacityKB := int64(sizeGiB) * 1024 * 1024
+		if disk.CapacityInKB > cloneCapacityKB {
+			return nil, errors.Errorf(
+				"can't resize template disk down, initial capacity is larger: %dKiB > %dKiB",
+				disk.CapacityInKB, cloneCapacityKB)
+		}
+		disk.CapacityInKB = cloneCapacityKB
+
+		deviceSpecs = append(deviceSpecs, &types.VirtualDeviceConfigSpec{
+			Operation: types.VirtualDeviceConfigSpecOperationEdit,
+			Device:    disk,
+		})
+	}
+
+	return deviceSpecs, nil
+}
+
+// matchTemplateDisks returns the overrides of the template disks, keyed by
+// the device key of the disk they apply to. Each override must match exactly
+// one disk of the template. Unit numbers are only unique per controller, so a
+// disk is identified by its unit number along with the key of its controller,
+// which may be omitted if all the disks share the same controller.
+func matchTemplateDisks(disks object.VirtualDeviceList, templateDisks []infrav1.TemplateDiskSpec) (map[int32]*infrav1.TemplateDiskSpec, error) {
+	controllerKeys := map[int32]struct{}{}
+	for _, disk := range disks {
+		controllerKeys[disk.GetVirtualDevice().ControllerKey] = struct{}{}
+	}
+
+	matches := make(map[int32]*infrav1.TemplateDiskSpec, len(templateDisks))
+	for i := range templateDisks {
+		templateDisk := &templateDisks[i]
+		if templateDisk.UnitNumber == nil && templateDisk.Label == "" {
+			return nil, errors.Errorf("template disk %d must have a unit number or a label", i)
+		}
+		if templateDisk.UnitNumber != nil && templateDisk.ControllerKey == nil && len(controllerKeys) > 1 {
+			return nil, errors.Errorf("template disk %d must have a controller key along with its unit number, as the disks of the template are attached to %d controllers", i, len(controllerKeys))
+		}
+
+		var matched []int32
+		for _, disk := range disks {
+			device := disk.GetVirtualDevice()
+			if templateDisk.UnitNumber != nil && (device.UnitNumber == nil || *device.UnitNumber != *templateDisk.UnitNumber) {
+				continue
+			}
+			if templateDisk.ControllerKey != nil && device.ControllerKey != *templateDisk.ControllerKey {
+				continue
+			}
+			if templateDisk.Label != "" && disks.Name(disk) != templateDisk.Label && deviceLabel(device) != templateDisk.Label {
+				continue
+			}
+			matched = append(matched, device.Key)
+		}
+
+		switch {
+		case len(matched) == 0:
+			return nil, errors.Errorf("template disk %d does not match any disk of the template", i)
+		case len(matched) > 1:
+			return nil, errors.Errorf("template disk %d matches %d disks of the template", i, len(matched))
+		}
+		if _, ok := matches[matched[0]]; ok {
+			return nil, errors.Errorf("template disk %d matches a disk which is already overridden", i)
+		}
+		matches[matched[0]] = templateDisk
+	}
+	return matches, nil
+}
+
+func deviceLabel(device *types.VirtualDevice) string {
+	if device.DeviceInfo == nil {
+		return ""
+	}
+	return device.DeviceInfo.GetDescription().Label
+}
+
+func getStorageProfileID(ctx *context.VMContext, storagePolicyName string) (string, error) {
+	pbmClient, err := pbm.NewClient(ctx, ctx.Session.Client.Client)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to create pbm client for %q", ctx)
+	}
+	storageProfileID, err := pbmClient.ProfileIDByName(ctx, storagePolicyName)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get storageProfileID from name %s for %q", storagePolicyName, ctx)
+	}
+	return storageProfileID, nil
+}
+
+// getAdditionalDiskSpecs returns the device specs creating the additional
+// disks of the VM when it is cloned.
+func getAdditionalDiskSpecs(
+	ctx *context.VMContext,
+	devices object.VirtualDeviceList,
+	defaultDatastoreRef types.ManagedObjectReference) ([]types.BaseVirtualDeviceConfigSpec, error) {
+
+	deviceSpecs := []types.BaseVirtualDeviceConfigSpec{}
+
+	// Assign temporary device keys which do not collide with the ones of the
+	// network devices.
+	key := int32(-1000)
+	for i := range ctx.VSphereVM.Spec.AdditionalDisks {
+		diskSpec := &ctx.VSphereVM.Spec.AdditionalDisks[i]
+
+		controller, err := getDiskController(devices, diskSpec.ControllerBusNumber)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get controller for additional disk %d", i)
+		}
+		unitNumber, err := getDiskUnitNumber(devices, controller, diskSpec.UnitNumber)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get unit number for additional disk %d", i)
+		}
+
+		backing := &types.VirtualDiskFlatVer2BackingInfo{
+			DiskMode:        string(types.VirtualDiskModePersistent),
+			ThinProvisioned: types.NewBool(diskSpec.ProvisioningMode == "" || diskSpec.ProvisioningMode == infrav1.ThinProvisioningMode),
+			EagerlyScrub:    types.NewBool(diskSpec.ProvisioningMode == infrav1.EagerlyZeroedProvisioningMode),
+			VirtualDeviceFileBackingInfo: types.VirtualDeviceFileBackingInfo{
+				Datastore: types.NewReference(defaultDatastoreRef),
+			},
+		}
+		if diskSpec.Datastore != "" {
+			datastore, err := ctx.Session.Finder.Datastore(ctx, diskSpec.Datastore)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to get datastore %s for additional disk %d", diskSpec.Datastore, i)
+			}
+			// A file name consisting only of the datastore places the disk
+			// on that datastore in a folder named after the VM.
+			backing.FileName = fmt.Sprintf("[%s]", datastore.Name())
+			backing.Datastore = types.NewReference(datastore.Reference())
+		}
+
+		disk := &types.VirtualDisk{
+			VirtualDevice: types.VirtualDevice{
+				Key:           key,
+				ControllerKey: controller.GetVirtualSCSIController().Key,
+				UnitNumber:    &unitNumber,
+				Backing:       backing,
+			},
+			CapacityInKB: int64(diskSpec.SizeGiB) * 1024 * 1024,
+		}
+
+		config := &types.VirtualDeviceConfigSpec{
+			Operation:     types.VirtualDeviceConfigSpecOperationAdd,
+			FileOperation: types.VirtualDeviceConfigSpecFileOperationCreate,
+			Device:        disk,
+		}
+		if diskSpec.StoragePolicyName != "" {
+			storageProfileID, err := getStorageProfileID(ctx, diskSpec.StoragePolicyName)
+			if err != nil {
+				return nil, err
+			}
+			config.Profile = []types.BaseVirtualMachineProfileSpec{
+				&types.VirtualMachineDefinedProfileSpec{ProfileId: storageProfileID},
+			}
+		}
+		deviceSpecs = append(deviceSpecs, config)
+
+		// Track the new disk so the following disks are not assigned the
+		// same unit number.
+		devices = append(devices, disk)
+		key--
+	}
+
+	return deviceSpecs, nil
+}
+
+// getDiskController returns the SCSI controller with the provided bus
+// number. If no bus number is provided, the controller of the first disk of
+// the template is returned, or the first SCSI controller if the template
+// does not have any disk attached to a SCSI controller.
+func getDiskController(devices object.VirtualDeviceList, busNumber *int32) (types.BaseVirtualSCSIController, error) {
+	controllers := devices.SelectByType((*types.VirtualSCSIController)(nil))
+	if len(controllers) == 0 {
+		return nil, errors.New("no SCSI controller found")
 	}
-	disk.CapacityInKB = cloneCapacityKB
 
-	return &types.VirtualDeviceConfigSpec{
-		Operation: types.VirtualDeviceConfigSpecOperationEdit,
-		Device:    disk,
-	}, nil
+	if busNumber != nil {
+		for _, controller := range controllers {
+			scsiController := controller.(types.BaseVirtualSCSIController)
+			if scsiController.GetVirtualSCSIController().BusNumber == *busNumber {
+				return scsiController, nil
+			}
+		}
+		return nil, errors.Errorf("no SCSI controller found with bus number %d", *busNumber)
+	}
+
+	for _, disk := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+		if controller, ok := devices.FindByKey(disk.GetVirtualDevice().ControllerKey).(types.BaseVirtualSCSIController); ok {
+			return controller, nil
+		}
+	}
+	return controllers[0].(types.BaseVirtualSCSIController), nil
+}
+
+// maxSCSIUnitNumber is the number of devices which can be attached to a
+// SCSI controller, including the controller itself.
+const maxSCSIUnitNumber = 16
+
+// getDiskUnitNumber validates the provided unit number is available on the
+// controller, or returns the first available one if none is provided.
+func getDiskUnitNumber(devices object.VirtualDeviceList, controller types.BaseVirtualSCSIController, unitNumber *int32) (int32, error) {
+	scsiController := controller.GetVirtualSCSIController()
+	used := map[int32]bool{scsiController.ScsiCtlrUnitNumber: true}
+	for _, device := range devices {
+		d := device.GetVirtualDevice()
+		if d.ControllerKey == scsiController.Key && d.UnitNumber != nil {
+			used[*d.UnitNumber] = true
+		}
+	}
+
+	if unitNumber != nil {
+		if *unitNumber < 0 || *unitNumber >= maxSCSIUnitNumber {
+			return 0, errors.Errorf("invalid unit number %d", *unitNumber)
+		}
+		if used[*unitNumber] {
+			return 0, errors.Errorf("unit number %d of SCSI controller %d is already in use", *unitNumber, scsiController.BusNumber)
+		}
+		return *unitNumber, nil
+	}
+
+	for i := int32(0); i < maxSCSIUnitNumber; i++ {
+		if !used[i] {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("no free unit number on SCSI controller %d", scsiController.BusNumber)
 }
 
 const ethCardType = "vmxnet3"
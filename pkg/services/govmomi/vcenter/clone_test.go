@@ -23,9 +23,12 @@ import (
 
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/simulator"
+	_ "github.com/vmware/govmomi/vapi/simulator"
 	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/utils/pointer"
 	"sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
 )
 
@@ -52,9 +55,25 @@ func TestGetDiskSpec(t *testing.T) {
 		t.Fatalf("Can't resize disk for specified size")
 	}
 
+	secondDisk := *disk
+	secondDisk.Key = disk.Key + 1
+	secondDisk.UnitNumber = pointer.Int32Ptr(1)
+	secondDisk.CapacityInKB = 1024 * 1024 // GiB
+	multipleDisks := append(object.VirtualDeviceList{}, defaultDisks...)
+	multipleDisks = append(multipleDisks, &secondDisk)
+
+	// The third disk has the same unit number as the second disk, on
+	// another controller.
+	thirdDisk := secondDisk
+	thirdDisk.Key = disk.Key + 2
+	thirdDisk.ControllerKey = disk.ControllerKey + 1
+	multipleControllers := append(object.VirtualDeviceList{}, multipleDisks...)
+	multipleControllers = append(multipleControllers, &thirdDisk)
+
 	testCases := []struct {
-		expectDevice  bool
+		expectedSizes []int32
 		cloneDiskSize int32
+		templateDisks []v1alpha4.TemplateDiskSpec
 		name          string
 		disks         object.VirtualDeviceList
 		err           string
@@ -63,7 +82,7 @@ func TestGetDiskSpec(t *testing.T) {
 			name:          "Successfully clone template with correct disk requirements",
 			disks:         defaultDisks,
 			cloneDiskSize: defaultSizeGiB,
-			expectDevice:  true,
+			expectedSizes: []int32{defaultSizeGiB},
 		},
 		{
 			name:  "Fail to clone template without disk devices",
@@ -71,15 +90,50 @@ func TestGetDiskSpec(t *testing.T) {
 			err:   "invalid disk count: 0",
 		},
 		{
-			name:  "Fail to clone template with multiple disk devices",
-			disks: append(defaultDisks, defaultDisks...),
-			err:   "invalid disk count: 2",
+			name:  "Successfully clone template with multiple disk devices",
+			disks: multipleDisks,
+			templateDisks: []v1alpha4.TemplateDiskSpec{
+				{UnitNumber: pointer.Int32Ptr(1), SizeGiB: 2},
+			},
+			expectedSizes: []int32{2},
+		},
+		{
+			name:  "Fail to clone template with a disk override matching no disk",
+			disks: multipleDisks,
+			templateDisks: []v1alpha4.TemplateDiskSpec{
+				{UnitNumber: pointer.Int32Ptr(5), SizeGiB: 2},
+			},
+			err: "template disk 0 does not match any disk of the template",
+		},
+		{
+			name:  "Successfully clone template with disks on multiple controllers",
+			disks: multipleControllers,
+			templateDisks: []v1alpha4.TemplateDiskSpec{
+				{UnitNumber: pointer.Int32Ptr(1), ControllerKey: pointer.Int32Ptr(thirdDisk.ControllerKey), SizeGiB: 3},
+			},
+			expectedSizes: []int32{3},
+		},
+		{
+			name:  "Fail to clone template with disks on multiple controllers with a disk override without controller key",
+			disks: multipleControllers,
+			templateDisks: []v1alpha4.TemplateDiskSpec{
+				{UnitNumber: pointer.Int32Ptr(1), SizeGiB: 3},
+			},
+			err: "template disk 0 must have a controller key along with its unit number, as the disks of the template are attached to 2 controllers",
+		},
+		{
+			name:  "Fail to clone template with a disk override without unit number or label",
+			disks: multipleDisks,
+			templateDisks: []v1alpha4.TemplateDiskSpec{
+				{SizeGiB: 2},
+			},
+			err: "template disk 0 must have a unit number or a label",
 		},
 		{
 			name:          "Successfully clone template and increase disk requirements",
 			disks:         defaultDisks,
 			cloneDiskSize: defaultSizeGiB + 1,
-			expectDevice:  true,
+			expectedSizes: []int32{defaultSizeGiB + 1},
 		},
 		{
 			name:          "Fail to clone template with lower disk requirements then on template",
@@ -93,7 +147,8 @@ func TestGetDiskSpec(t *testing.T) {
 		tc := test
 		t.Run(tc.name, func(t *testing.T) {
 			cloneSpec := v1alpha4.VirtualMachineCloneSpec{
-				DiskGiB: tc.cloneDiskSize,
+				DiskGiB:       tc.cloneDiskSize,
+				TemplateDisks: tc.templateDisks,
 			}
 			vsphereVM := &v1alpha4.VSphereVM{
 				Spec: v1alpha4.VSphereVMSpec{
@@ -101,21 +156,21 @@ func TestGetDiskSpec(t *testing.T) {
 				},
 			}
 			vmContext := &context.VMContext{VSphereVM: vsphereVM}
-			device, err := getDiskSpec(vmContext, tc.disks)
+			devices, err := getDiskSpecs(vmContext, tc.disks)
 			switch {
 			case tc.err != "" && err == nil:
 				fallthrough
 			case tc.err == "" && err != nil:
 				fallthrough
 			case err != nil && tc.err != err.Error():
-				t.Fatalf("Expected to get '%v' error from getDiskSpec, got: '%v'", tc.err, err)
+				t.Fatalf("Expected to get '%v' error from getDiskSpecs, got: '%v'", tc.err, err)
 			}
-			if deviceFound := device != nil; tc.expectDevice != deviceFound {
-				t.Fatalf("Expected to get a device: %v, but got: '%#v'", tc.expectDevice, device)
+			if len(devices) != len(tc.expectedSizes) {
+				t.Fatalf("Expected to get %d devices, but got: '%#v'", len(tc.expectedSizes), devices)
 			}
-			if tc.expectDevice {
+			for i, device := range devices {
 				disk := device.GetVirtualDeviceConfigSpec().Device.(*types.VirtualDisk)
-				expectedSizeKB := int64(tc.cloneDiskSize) * 1024 * 1024
+				expectedSizeKB := int64(tc.expectedSizes[i]) * 1024 * 1024
 				if device.GetVirtualDeviceConfigSpec().Operation != types.VirtualDeviceConfigSpecOperationEdit {
 					t.Errorf("Disk operation does not match '%s', got: %s",
 						types.VirtualDeviceConfigSpecOperationEdit, device.GetVirtualDeviceConfigSpec().Operation)
@@ -128,6 +183,106 @@ func TestGetDiskSpec(t *testing.T) {
 	}
 }
 
+func TestGetAdditionalDiskSpecs(t *testing.T) {
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	machine := object.NewVirtualMachine(session.Client.Client, vm.Reference())
+
+	devices, err := machine.Device(ctx.TODO())
+	if err != nil {
+		t.Fatalf("Failed to obtain vm devices: %v", err)
+	}
+	templateDisk := devices.SelectByType((*types.VirtualDisk)(nil))[0].GetVirtualDevice()
+	datastore, err := session.Finder.Datastore(ctx.TODO(), "LocalDS_0")
+	if err != nil {
+		t.Fatalf("Failed to find datastore: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		disks           []v1alpha4.VirtualDiskSpec
+		expectedUnits   []int32
+		expectedThin    bool
+		expectedEager   bool
+		expectedFile    string
+		expectedSizeKiB int64
+		err             string
+	}{
+		{
+			name:            "Successfully add disks next to the template disk",
+			disks:           []v1alpha4.VirtualDiskSpec{{SizeGiB: 10}, {SizeGiB: 10}},
+			expectedUnits:   []int32{1, 2},
+			expectedThin:    true,
+			expectedSizeKiB: 10 * 1024 * 1024,
+		},
+		{
+			name:            "Successfully add an eagerly zeroed disk on a datastore",
+			disks:           []v1alpha4.VirtualDiskSpec{{SizeGiB: 5, ProvisioningMode: v1alpha4.EagerlyZeroedProvisioningMode, Datastore: "LocalDS_0", UnitNumber: pointer.Int32Ptr(3)}},
+			expectedUnits:   []int32{3},
+			expectedEager:   true,
+			expectedFile:    "[LocalDS_0]",
+			expectedSizeKiB: 5 * 1024 * 1024,
+		},
+		{
+			name:  "Fail to add a disk on a unit number in use",
+			disks: []v1alpha4.VirtualDiskSpec{{SizeGiB: 10, UnitNumber: templateDisk.UnitNumber}},
+			err:   "unable to get unit number for additional disk 0: unit number 0 of SCSI controller 0 is already in use",
+		},
+		{
+			name:  "Fail to add a disk on a missing controller",
+			disks: []v1alpha4.VirtualDiskSpec{{SizeGiB: 10, ControllerBusNumber: pointer.Int32Ptr(3)}},
+			err:   "unable to get controller for additional disk 0: no SCSI controller found with bus number 3",
+		},
+	}
+
+	for _, test := range testCases {
+		tc := test
+		t.Run(tc.name, func(t *testing.T) {
+			vmContext := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+			vmContext.VSphereVM.Spec.AdditionalDisks = tc.disks
+			vmContext.Session = session
+			deviceSpecs, err := getAdditionalDiskSpecs(vmContext, devices, datastore.Reference())
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Expected to get '%v' error from getAdditionalDiskSpecs, got: '%v'", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error from getAdditionalDiskSpecs: %v", err)
+			}
+			if len(deviceSpecs) != len(tc.expectedUnits) {
+				t.Fatalf("Expected %d device specs, got %d", len(tc.expectedUnits), len(deviceSpecs))
+			}
+			for i, deviceSpec := range deviceSpecs {
+				spec := deviceSpec.GetVirtualDeviceConfigSpec()
+				if spec.Operation != types.VirtualDeviceConfigSpecOperationAdd || spec.FileOperation != types.VirtualDeviceConfigSpecFileOperationCreate {
+					t.Errorf("Unexpected disk operation %q/%q", spec.Operation, spec.FileOperation)
+				}
+				disk := spec.Device.(*types.VirtualDisk)
+				if disk.ControllerKey != templateDisk.ControllerKey {
+					t.Errorf("Expected controller key %d, got %d", templateDisk.ControllerKey, disk.ControllerKey)
+				}
+				if *disk.UnitNumber != tc.expectedUnits[i] {
+					t.Errorf("Expected unit number %d, got %d", tc.expectedUnits[i], *disk.UnitNumber)
+				}
+				if disk.CapacityInKB != tc.expectedSizeKiB {
+					t.Errorf("Disk size does not match: expected %d, got %d", tc.expectedSizeKiB, disk.CapacityInKB)
+				}
+				backing := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+				if *backing.ThinProvisioned != tc.expectedThin || *backing.EagerlyScrub != tc.expectedEager {
+					t.Errorf("Unexpected provisioning: thin %v, eagerly scrub %v", *backing.ThinProvisioned, *backing.EagerlyScrub)
+				}
+				if backing.FileName != tc.expectedFile {
+					t.Errorf("Expected file name %q, got %q", tc.expectedFile, backing.FileName)
+				}
+			}
+		})
+	}
+}
+
 func initSimulator(t *testing.T) (*simulator.Model, *session.Session, *simulator.Server) {
 	model := simulator.VPX()
 	model.Host = 0
@@ -152,3 +307,113 @@ func initSimulator(t *testing.T) (*simulator.Model, *session.Session, *simulator
 
 	return model, authSession, server
 }
+
+func TestGetCustomizationSpec(t *testing.T) {
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	manager := object.NewCustomizationSpecManager(session.Client.Client)
+	err := manager.CreateCustomizationSpec(ctx.TODO(), types.CustomizationSpecItem{
+		Info: types.CustomizationSpecInfo{Name: "prompted", Type: "Linux"},
+		Spec: types.CustomizationSpec{
+			Identity: &types.CustomizationLinuxPrep{HostName: &types.CustomizationUnknownName{}, Domain: "example.com"},
+			NicSettingMap: []types.CustomizationAdapterMapping{
+				{Adapter: types.CustomizationIPSettings{Ip: &types.CustomizationUnknownIpGenerator{}}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create customization spec: %v", err)
+	}
+
+	devices := []v1alpha4.NetworkDeviceSpec{
+		{
+			IPAddrs:     []string{"192.168.1.10/24", "fd00::10/64"},
+			Gateway4:    "192.168.1.1",
+			Nameservers: []string{"192.168.1.2"},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		customization v1alpha4.GuestCustomizationSpec
+		devices       []v1alpha4.NetworkDeviceSpec
+		err           string
+	}{
+		{
+			name:          "Successfully build a Linux customization spec",
+			customization: v1alpha4.GuestCustomizationSpec{Type: v1alpha4.LinuxGuestCustomization, Domain: "example.com"},
+			devices:       devices,
+		},
+		{
+			name:          "Successfully build a Sysprep customization spec",
+			customization: v1alpha4.GuestCustomizationSpec{Type: v1alpha4.SysprepGuestCustomization, TimeZone: "4"},
+			devices:       devices,
+		},
+		{
+			name:          "Successfully fill the prompted values of a stored customization spec",
+			customization: v1alpha4.GuestCustomizationSpec{SpecName: "prompted"},
+			devices:       devices,
+		},
+		{
+			name:          "Fail to build a customization spec with two IPv4 addresses",
+			customization: v1alpha4.GuestCustomizationSpec{Type: v1alpha4.LinuxGuestCustomization},
+			devices:       []v1alpha4.NetworkDeviceSpec{{IPAddrs: []string{"192.168.1.10/24", "192.168.1.11/24"}}},
+			err:           "unable to customize network device 0: guest customization supports a single IPv4 address, got [192.168.1.10/24 192.168.1.11/24]",
+		},
+		{
+			name:          "Fail to fill the prompted IPv4 address of a device using DHCP",
+			customization: v1alpha4.GuestCustomizationSpec{SpecName: "prompted"},
+			devices:       []v1alpha4.NetworkDeviceSpec{{DHCP4: true}},
+			err:           `customization spec "prompted" prompts for the IPv4 address of network device 0 which has none`,
+		},
+	}
+
+	for _, test := range testCases {
+		tc := test
+		t.Run(tc.name, func(t *testing.T) {
+			customization := tc.customization
+			vmContext := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+			vmContext.VSphereVM.Name = "machine-0"
+			vmContext.VSphereVM.Spec.Network = v1alpha4.NetworkSpec{Devices: tc.devices}
+			vmContext.VSphereVM.Spec.Customization = &customization
+			vmContext.Session = session
+			spec, err := getCustomizationSpec(vmContext)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Expected to get '%v' error from getCustomizationSpec, got: '%v'", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error from getCustomizationSpec: %v", err)
+			}
+
+			var hostname types.BaseCustomizationName
+			switch identity := spec.Identity.(type) {
+			case *types.CustomizationLinuxPrep:
+				hostname = identity.HostName
+			case *types.CustomizationSysprep:
+				hostname = identity.UserData.ComputerName
+				if identity.GuiUnattended.TimeZone != 4 {
+					t.Errorf("Expected time zone 4, got %d", identity.GuiUnattended.TimeZone)
+				}
+			}
+			if name, ok := hostname.(*types.CustomizationFixedName); !ok || name.Name != "machine-0" {
+				t.Errorf("Expected hostname machine-0, got %#v", hostname)
+			}
+
+			if len(spec.NicSettingMap) != 1 {
+				t.Fatalf("Expected 1 network adapter, got %d", len(spec.NicSettingMap))
+			}
+			adapter := spec.NicSettingMap[0].Adapter
+			if ip, ok := adapter.Ip.(*types.CustomizationFixedIp); !ok || ip.IpAddress != "192.168.1.10" {
+				t.Errorf("Expected IPv4 address 192.168.1.10, got %#v", adapter.Ip)
+			}
+			if adapter.SubnetMask != "255.255.255.0" {
+				t.Errorf("Expected subnet mask 255.255.255.0, got %q", adapter.SubnetMask)
+			}
+		})
+	}
+}
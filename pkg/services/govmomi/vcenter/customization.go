@@ -0,0 +1,218 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+const (
+	defaultLinuxTimeZone = "Etc/UTC"
+
+	// defaultSysprepTimeZone is the index of the Microsoft time zone
+	// "(GMT) Greenwich Mean Time : Dublin, Edinburgh, Lisbon, London".
+	defaultSysprepTimeZone = 85
+
+	defaultWorkgroup = "WORKGROUP"
+
+	sysprepFullName = "Administrator"
+	sysprepOrgName  = "Cluster API Provider vSphere"
+)
+
+// getCustomizationSpec returns the guest customization spec applied to the
+// new virtual machine, or nil if its guest is not customized.
+func getCustomizationSpec(ctx *context.VMContext) (*types.CustomizationSpec, error) {
+	customization := ctx.VSphereVM.Spec.Customization
+	if customization == nil {
+		return nil, nil
+	}
+	if customization.SpecName != "" {
+		return getStoredCustomizationSpec(ctx, customization.SpecName)
+	}
+
+	hostname := &types.CustomizationFixedName{Name: ctx.VSphereVM.Name}
+	spec := &types.CustomizationSpec{}
+	switch customization.Type {
+	case infrav1.LinuxGuestCustomization:
+		timeZone := customization.TimeZone
+		if timeZone == "" {
+			timeZone = defaultLinuxTimeZone
+		}
+		spec.Identity = &types.CustomizationLinuxPrep{
+			HostName:   hostname,
+			Domain:     customization.Domain,
+			TimeZone:   timeZone,
+			HwClockUTC: types.NewBool(true),
+		}
+	case infrav1.SysprepGuestCustomization:
+		timeZone := defaultSysprepTimeZone
+		if customization.TimeZone != "" {
+			var err error
+			if timeZone, err = strconv.Atoi(customization.TimeZone); err != nil {
+				return nil, errors.Wrapf(err, "invalid Sysprep time zone %q", customization.TimeZone)
+			}
+		}
+		workgroup := customization.Workgroup
+		if workgroup == "" {
+			workgroup = defaultWorkgroup
+		}
+		spec.Identity = &types.CustomizationSysprep{
+			GuiUnattended: types.CustomizationGuiUnattended{
+				TimeZone: int32(timeZone),
+			},
+			UserData: types.CustomizationUserData{
+				FullName:     sysprepFullName,
+				OrgName:      sysprepOrgName,
+				ComputerName: hostname,
+			},
+			Identification: types.CustomizationIdentification{
+				JoinWorkgroup: workgroup,
+			},
+		}
+	default:
+		return nil, errors.Errorf("unsupported guest customization type %q", customization.Type)
+	}
+
+	devices := ctx.VSphereVM.Spec.Network.Devices
+	for i := range devices {
+		adapter, err := getCustomizationIPSettings(&devices[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to customize network device %d", i)
+		}
+		spec.NicSettingMap = append(spec.NicSettingMap, types.CustomizationAdapterMapping{Adapter: *adapter})
+		spec.GlobalIPSettings.DnsServerList = appendUnique(spec.GlobalIPSettings.DnsServerList, devices[i].Nameservers...)
+		spec.GlobalIPSettings.DnsSuffixList = appendUnique(spec.GlobalIPSettings.DnsSuffixList, devices[i].SearchDomains...)
+	}
+	return spec, nil
+}
+
+// getStoredCustomizationSpec returns a customization spec stored in vCenter.
+// The hostname and the IPv4 addresses which the spec prompts for are set to
+// the name of the virtual machine and to the IPv4 addresses of the matching
+// network devices.
+func getStoredCustomizationSpec(ctx *context.VMContext, name string) (*types.CustomizationSpec, error) {
+	manager := object.NewCustomizationSpecManager(ctx.Session.Client.Client)
+	item, err := manager.GetCustomizationSpec(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get customization spec %q", name)
+	}
+	spec := item.Spec
+
+	hostname := &types.CustomizationFixedName{Name: ctx.VSphereVM.Name}
+	switch identity := spec.Identity.(type) {
+	case *types.CustomizationLinuxPrep:
+		if _, ok := identity.HostName.(*types.CustomizationUnknownName); ok {
+			identity.HostName = hostname
+		}
+	case *types.CustomizationSysprep:
+		if _, ok := identity.UserData.ComputerName.(*types.CustomizationUnknownName); ok {
+			identity.UserData.ComputerName = hostname
+		}
+	}
+
+	devices := ctx.VSphereVM.Spec.Network.Devices
+	if len(spec.NicSettingMap) != len(devices) {
+		return nil, errors.Errorf("customization spec %q has %d network adapters while the vm has %d network devices", name, len(spec.NicSettingMap), len(devices))
+	}
+	for i := range spec.NicSettingMap {
+		adapter := &spec.NicSettingMap[i].Adapter
+		if _, ok := adapter.Ip.(*types.CustomizationUnknownIpGenerator); !ok {
+			continue
+		}
+		settings, err := getCustomizationIPSettings(&devices[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to customize network device %d", i)
+		}
+		if _, ok := settings.Ip.(*types.CustomizationFixedIp); !ok {
+			return nil, errors.Errorf("customization spec %q prompts for the IPv4 address of network device %d which has none", name, i)
+		}
+		adapter.Ip = settings.Ip
+		adapter.SubnetMask = settings.SubnetMask
+	}
+	return &spec, nil
+}
+
+// getCustomizationIPSettings returns the IP settings of a network adapter
+// for the network device. Guest customization supports one IPv4 address per
+// network adapter, IPv4 falling back to DHCP when the device has none.
+func getCustomizationIPSettings(device *infrav1.NetworkDeviceSpec) (*types.CustomizationIPSettings, error) {
+	settings := &types.CustomizationIPSettings{
+		DnsServerList: device.Nameservers,
+	}
+	for _, addr := range device.IPAddrs {
+		ip, ipNet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid ip address %q", addr)
+		}
+		if ip.To4() != nil {
+			if settings.Ip != nil {
+				return nil, errors.Errorf("guest customization supports a single IPv4 address, got %v", device.IPAddrs)
+			}
+			settings.Ip = &types.CustomizationFixedIp{IpAddress: ip.String()}
+			settings.SubnetMask = net.IP(ipNet.Mask).String()
+			continue
+		}
+		if settings.IpV6Spec == nil {
+			settings.IpV6Spec = &types.CustomizationIPSettingsIpV6AddressSpec{}
+		}
+		ones, _ := ipNet.Mask.Size()
+		settings.IpV6Spec.Ip = append(settings.IpV6Spec.Ip, &types.CustomizationFixedIpV6{
+			IpAddress:  ip.String(),
+			SubnetMask: int32(ones),
+		})
+	}
+
+	if settings.Ip == nil {
+		settings.Ip = &types.CustomizationDhcpIpGenerator{}
+	}
+	if device.Gateway4 != "" {
+		settings.Gateway = []string{device.Gateway4}
+	}
+	if device.DHCP6 && settings.IpV6Spec == nil {
+		settings.IpV6Spec = &types.CustomizationIPSettingsIpV6AddressSpec{
+			Ip: []types.BaseCustomizationIpV6Generator{&types.CustomizationDhcpIpV6Generator{}},
+		}
+	}
+	if device.Gateway6 != "" && settings.IpV6Spec != nil {
+		settings.IpV6Spec.Gateway = []string{device.Gateway6}
+	}
+	return settings, nil
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,490 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"path"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	vimevent "github.com/vmware/govmomi/event"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/library"
+	"github.com/vmware/govmomi/vapi/rest"
+	vapivcenter "github.com/vmware/govmomi/vapi/vcenter"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+)
+
+const (
+	libraryItemTypeOVF  = "ovf"
+	libraryItemTypeVMTX = "vm-template"
+
+	useSpecifiedPolicy = "USE_SPECIFIED_POLICY"
+)
+
+// deployments are the deployments of content library items which are in
+// progress, or complete but not yet reconciled, keyed by the UID of their
+// VSphereVM.
+var (
+	deployments   = map[apitypes.UID]*deployment{}
+	deploymentsMu sync.Mutex
+)
+
+// deployment is the deployment of a content library item for a VSphereVM.
+// The content library API deploys the item synchronously, so the deployment
+// runs in the background and the VSphereVM is reconciled again once the
+// deployment is complete.
+type deployment struct {
+	item             *library.Item
+	folder           *object.Folder
+	pool             *object.ResourcePool
+	datastoreID      string
+	storageProfileID string
+
+	// done, vm and err are guarded by deploymentsMu.
+	done bool
+	vm   *object.VirtualMachine
+	err  error
+}
+
+// deployLibraryItem deploys the virtual machine from an item of a content
+// library. Once the item is deployed, the new virtual machine is
+// reconfigured the same way a cloned virtual machine is configured by the
+// clone spec. The reconfiguration is tracked as the task of the VSphereVM.
+//
+// The item is deployed as a virtual machine named after the UID of the
+// VSphereVM, which is renamed by the reconfiguration. A deployment
+// interrupted before the virtual machine is reconfigured, e.g. by a restart
+// of the controller, is therefore resumed instead of orphaning the virtual
+// machine, or leaving it unconfigured once found by its name.
+func deployLibraryItem(ctx *context.VMContext, extraConfig extra.Config) error {
+	deploymentsMu.Lock()
+	d, ok := deployments[ctx.VSphereVM.UID]
+	var done bool
+	var vm *object.VirtualMachine
+	var err error
+	if ok {
+		done, vm, err = d.done, d.vm, d.err
+		if done {
+			delete(deployments, ctx.VSphereVM.UID)
+		}
+	}
+	deploymentsMu.Unlock()
+
+	switch {
+	case !ok:
+		return startDeployment(ctx)
+	case !done:
+		ctx.Logger.Info("waiting for content library item to be deployed")
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if err := reconfigureDeployedVM(ctx, vm, extraConfig); err != nil {
+		return err
+	}
+
+	// patch the vsphereVM early to ensure that the task is
+	// reflected in the status right away, this avoid situations
+	// of concurrent clones
+	if err := ctx.Patch(); err != nil {
+		ctx.Logger.Error(err, "patch failed", "vspherevm", ctx.VSphereVM)
+	}
+	return nil
+}
+
+// startDeployment starts to deploy the content library item of the
+// VSphereVM in the background. The VSphereVM is enqueued once the
+// deployment is complete.
+func startDeployment(ctx *context.VMContext) error {
+	restClient, err := ctx.Session.RestClient(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "unable to deploy from content library %q", ctx.VSphereVM.Spec.ContentLibrary)
+	}
+
+	d := &deployment{}
+	d.item, err = findLibraryItem(ctx, restClient, ctx.VSphereVM.Spec.ContentLibrary, ctx.VSphereVM.Spec.Template)
+	if err != nil {
+		return err
+	}
+
+	// The disks of a deployed item are never shared with the library item.
+	ctx.VSphereVM.Status.CloneMode = infrav1.FullClone
+
+	d.folder, err = ctx.Session.Finder.FolderOrDefault(ctx, ctx.VSphereVM.Spec.Folder)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get folder for %q", ctx)
+	}
+
+	d.pool, err = ctx.Session.Finder.ResourcePoolOrDefault(ctx, ctx.VSphereVM.Spec.ResourcePool)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get resource pool for %q", ctx)
+	}
+
+	if ctx.VSphereVM.Spec.Datastore != "" {
+		datastore, err := ctx.Session.Finder.Datastore(ctx, ctx.VSphereVM.Spec.Datastore)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get datastore %s for %q", ctx.VSphereVM.Spec.Datastore, ctx)
+		}
+		d.datastoreID = datastore.Reference().Value
+	}
+
+	if ctx.VSphereVM.Spec.StoragePolicyName != "" {
+		d.storageProfileID, err = getStorageProfileID(ctx, ctx.VSphereVM.Spec.StoragePolicyName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.datastoreID == "" && d.storageProfileID == "" {
+		// if no datastore defined through VM spec or storage policy, use default
+		datastore, err := ctx.Session.Finder.DefaultDatastore(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get default datastore for %q", ctx)
+		}
+		d.datastoreID = datastore.Reference().Value
+	}
+
+	deploymentsMu.Lock()
+	deployments[ctx.VSphereVM.UID] = d
+	deploymentsMu.Unlock()
+
+	obj := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ctx.VSphereVM.Namespace,
+			Name:      ctx.VSphereVM.Name,
+		},
+	}
+	go func() {
+		vm, err := d.run(ctx, restClient)
+		if err != nil {
+			ctx.Logger.Error(err, "error deploying content library item", "item", d.item.Name)
+		}
+
+		deploymentsMu.Lock()
+		d.done, d.vm, d.err = true, vm, err
+		deploymentsMu.Unlock()
+
+		select {
+		case ctx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereVM")) <- event.GenericEvent{Object: obj}:
+		case <-ctx.Done():
+		}
+	}()
+	return nil
+}
+
+// run deploys the content library item unless a virtual machine deployed
+// for the VSphereVM already exists, and relocates the disks of the virtual
+// machine which are placed by the clone spec.
+func (d *deployment) run(ctx *context.VMContext, restClient *rest.Client) (*object.VirtualMachine, error) {
+	name := deployedVMName(ctx)
+	vm, err := findDeployedVMInFolder(ctx, d.folder)
+	if err != nil {
+		return nil, err
+	}
+
+	if vm != nil {
+		ctx.Logger.Info("resuming deployment of machine from content library", "vmref", vm.Reference())
+	} else {
+		ctx.Logger.Info("deploying machine from content library",
+			"namespace", ctx.VSphereVM.Namespace, "name", ctx.VSphereVM.Name,
+			"library", ctx.VSphereVM.Spec.ContentLibrary, "item", d.item.Name, "itemType", d.item.Type)
+
+		manager := vapivcenter.NewManager(restClient)
+		var ref *types.ManagedObjectReference
+		switch d.item.Type {
+		case libraryItemTypeOVF:
+			ref, err = manager.DeployLibraryItem(ctx, d.item.ID, vapivcenter.Deploy{
+				DeploymentSpec: vapivcenter.DeploymentSpec{
+					Name:               name,
+					DefaultDatastoreID: d.datastoreID,
+					StorageProfileID:   d.storageProfileID,
+					AcceptAllEULA:      true,
+				},
+				Target: vapivcenter.Target{
+					ResourcePoolID: d.pool.Reference().Value,
+					FolderID:       d.folder.Reference().Value,
+				},
+			})
+		case libraryItemTypeVMTX:
+			storage := &vapivcenter.DiskStorage{Datastore: d.datastoreID}
+			if d.storageProfileID != "" {
+				storage.StoragePolicy = &vapivcenter.StoragePolicy{
+					Policy: d.storageProfileID,
+					Type:   useSpecifiedPolicy,
+				}
+			}
+			ref, err = manager.DeployTemplateLibraryItem(ctx, d.item.ID, vapivcenter.DeployTemplate{
+				Name:          name,
+				DiskStorage:   storage,
+				VMHomeStorage: storage,
+				Placement: &vapivcenter.Placement{
+					ResourcePool: d.pool.Reference().Value,
+					Folder:       d.folder.Reference().Value,
+				},
+				// The VM must not be powered on before its virtual hardware is
+				// reconfigured and the MAC address(es) used to build and inject
+				// the VM with cloud-init metadata are generated.
+				PoweredOn: false,
+			})
+		default:
+			return nil, errors.Errorf("unsupported type %q of content library item %q", d.item.Type, d.item.Name)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error deploying content library item %q for %q", d.item.Name, ctx)
+		}
+		vm = object.NewVirtualMachine(ctx.Session.Client.Client, *ref)
+	}
+
+	// Per-disk placement overrides require the disks to be relocated, as the
+	// deployment places all the disks of the item on the same datastore.
+	// Relocating disks which are already placed is a no-op, so the disks of
+	// a resumed deployment are relocated again.
+	if !hasDiskPlacementOverrides(ctx.VSphereVM.Spec.TemplateDisks) {
+		return vm, nil
+	}
+	var obj mo.VirtualMachine
+	if err := vm.Properties(ctx, vm.Reference(), []string{"config.hardware.device", "datastore"}, &obj); err != nil {
+		return nil, errors.Wrapf(err, "error getting properties of deployed machine %s", ctx)
+	}
+	if len(obj.Datastore) == 0 {
+		return nil, errors.Errorf("deployed machine %s has no datastore", ctx)
+	}
+	disks := object.VirtualDeviceList(obj.Config.Hardware.Device).SelectByType((*types.VirtualDisk)(nil))
+	diskLocators, err := getDiskLocators(ctx, disks, obj.Datastore[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting disk locators for %q", ctx)
+	}
+	ctx.Logger.Info("relocating disks of deployed machine")
+	task, err := vm.Relocate(ctx, types.VirtualMachineRelocateSpec{Disk: diskLocators}, types.VirtualMachineMovePriorityDefaultPriority)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error trigging relocate op for machine %s", ctx)
+	}
+	if err := task.Wait(ctx); err != nil {
+		return nil, errors.Wrapf(err, "error relocating disks of machine %s", ctx)
+	}
+	return vm, nil
+}
+
+// FindDeployedVM returns the virtual machine deployed for the VSphereVM from
+// a content library item, which is not configured yet. It returns nil if
+// there is no such virtual machine, and an error while the item is still
+// being deployed.
+func FindDeployedVM(ctx *context.VMContext) (*object.VirtualMachine, error) {
+	if ctx.VSphereVM.Spec.ContentLibrary == "" {
+		return nil, nil
+	}
+
+	deploymentsMu.Lock()
+	d, deploying := deployments[ctx.VSphereVM.UID]
+	if deploying && d.done {
+		deploying = false
+		delete(deployments, ctx.VSphereVM.UID)
+	}
+	deploymentsMu.Unlock()
+	if deploying {
+		return nil, errors.Errorf("content library item %q is being deployed for %s", d.item.Name, ctx)
+	}
+
+	folder, err := ctx.Session.Finder.FolderOrDefault(ctx, ctx.VSphereVM.Spec.Folder)
+	if err != nil {
+		if _, notFound := err.(*find.NotFoundError); notFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to get folder for %q", ctx)
+	}
+	return findDeployedVMInFolder(ctx, folder)
+}
+
+func findDeployedVMInFolder(ctx *context.VMContext, folder *object.Folder) (*object.VirtualMachine, error) {
+	vm, err := ctx.Session.Finder.VirtualMachine(ctx, path.Join(folder.InventoryPath, deployedVMName(ctx)))
+	if err != nil {
+		if _, notFound := err.(*find.NotFoundError); notFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to find deployed machine %s", ctx)
+	}
+	return vm, nil
+}
+
+// deployedVMName is the name of a virtual machine deployed for the
+// VSphereVM until it is configured.
+func deployedVMName(ctx *context.VMContext) string {
+	return string(ctx.VSphereVM.UID)
+}
+
+// reconfigureDeployedVM applies the overrides of the clone spec to the
+// deployed virtual machine.
+func reconfigureDeployedVM(ctx *context.VMContext, vm *object.VirtualMachine, extraConfig extra.Config) error {
+	var obj mo.VirtualMachine
+	if err := vm.Properties(ctx, vm.Reference(), []string{"config.hardware.device", "datastore"}, &obj); err != nil {
+		return errors.Wrapf(err, "error getting properties of deployed machine %s", ctx)
+	}
+	if len(obj.Datastore) == 0 {
+		return errors.Errorf("deployed machine %s has no datastore", ctx)
+	}
+	datastoreRef := obj.Datastore[0]
+	devices := object.VirtualDeviceList(obj.Config.Hardware.Device)
+
+	deviceSpecs, err := getDiskSpecs(ctx, devices)
+	if err != nil {
+		return errors.Wrapf(err, "error getting disk spec for %q", ctx)
+	}
+
+	networkSpecs, err := getNetworkSpecs(ctx, devices)
+	if err != nil {
+		return errors.Wrapf(err, "error getting network specs for %q", ctx)
+	}
+	deviceSpecs = append(deviceSpecs, networkSpecs...)
+
+	additionalDiskSpecs, err := getAdditionalDiskSpecs(ctx, devices, datastoreRef)
+	if err != nil {
+		return errors.Wrapf(err, "error getting additional disk specs for %q", ctx)
+	}
+	deviceSpecs = append(deviceSpecs, additionalDiskSpecs...)
+
+	ctx.Logger.Info("reconfiguring deployed machine", "namespace", ctx.VSphereVM.Namespace, "name", ctx.VSphereVM.Name)
+	// The virtual machine is renamed along with the assignment of its
+	// instance UUID, after which it is found like a cloned virtual machine.
+	spec := newVMConfigSpec(ctx, deviceSpecs, extraConfig)
+	spec.Name = ctx.VSphereVM.Name
+	task, err := vm.Reconfigure(ctx, *spec)
+	if err != nil {
+		return errors.Wrapf(err, "error trigging reconfigure op for machine %s", ctx)
+	}
+
+	ctx.VSphereVM.Status.TaskRef = task.Reference().Value
+	return nil
+}
+
+// CustomizeDeployedVM starts the guest customization of a virtual machine
+// deployed from a content library item. The customization requires the
+// network devices of the clone spec, so it is started once the machine is
+// reconfigured and before it is powered on. The returned task is nil if the
+// machine is not customized, or if its customization was already started.
+func CustomizeDeployedVM(ctx *context.VMContext, vm *object.VirtualMachine) (*object.Task, error) {
+	if ctx.VSphereVM.Spec.ContentLibrary == "" || ctx.VSphereVM.Spec.Customization == nil {
+		return nil, nil
+	}
+
+	var obj mo.VirtualMachine
+	if err := vm.Properties(ctx, vm.Reference(), []string{"runtime.powerState", "config.tools"}, &obj); err != nil {
+		return nil, errors.Wrapf(err, "error getting properties of deployed machine %s", ctx)
+	}
+	// A pending customization is applied when the machine is powered on.
+	if obj.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOff ||
+		obj.Config == nil || obj.Config.Tools == nil || obj.Config.Tools.PendingCustomization != "" {
+		return nil, nil
+	}
+
+	// The customization, once applied, is not pending anymore.
+	events, err := vimevent.NewManager(ctx.Session.Client.Client).QueryEvents(ctx, types.EventFilterSpec{
+		Entity: &types.EventFilterSpecByEntity{
+			Entity:    vm.Reference(),
+			Recursion: types.EventFilterSpecRecursionOptionSelf,
+		},
+		EventTypeId: []string{"CustomizationStartedEvent"},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query customization events of machine %s", ctx)
+	}
+	if len(events) > 0 {
+		return nil, nil
+	}
+
+	customizationSpec, err := getCustomizationSpec(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting customization spec for %q", ctx)
+	}
+
+	ctx.Logger.Info("customizing deployed machine", "namespace", ctx.VSphereVM.Namespace, "name", ctx.VSphereVM.Name)
+	task, err := vm.Customize(ctx, *customizationSpec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error trigging customize op for machine %s", ctx)
+	}
+	return task, nil
+}
+
+// findLibraryItem finds an item of a content library. Both the library and
+// the item may be referenced either by ID or by name.
+func findLibraryItem(ctx *context.VMContext, restClient *rest.Client, libraryID, itemID string) (*library.Item, error) {
+	manager := library.NewManager(restClient)
+
+	var lib *library.Library
+	var err error
+	if isValidUUID(libraryID) {
+		lib, err = manager.GetLibraryByID(ctx, libraryID)
+	} else {
+		lib, err = manager.GetLibraryByName(ctx, libraryID)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find content library %q", libraryID)
+	}
+
+	if isValidUUID(itemID) {
+		item, err := manager.GetLibraryItem(ctx, itemID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to find item %q of content library %q", itemID, libraryID)
+		}
+		if item.LibraryID != lib.ID {
+			return nil, errors.Errorf("item %q does not belong to content library %q", itemID, libraryID)
+		}
+		return item, nil
+	}
+
+	ids, err := manager.FindLibraryItems(ctx, library.FindItem{LibraryID: lib.ID, Name: itemID})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find item %q of content library %q", itemID, libraryID)
+	}
+	switch len(ids) {
+	case 0:
+		return nil, errors.Errorf("unable to find item %q of content library %q", itemID, libraryID)
+	case 1:
+	default:
+		return nil, errors.Errorf("found %d items named %q in content library %q", len(ids), itemID, libraryID)
+	}
+	item, err := manager.GetLibraryItem(ctx, ids[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get item %q of content library %q", itemID, libraryID)
+	}
+	return item, nil
+}
+
+func hasDiskPlacementOverrides(templateDisks []infrav1.TemplateDiskSpec) bool {
+	for _, templateDisk := range templateDisks {
+		if templateDisk.Datastore != "" || templateDisk.StoragePolicyName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidUUID(str string) bool {
+	_, err := uuid.Parse(str)
+	return err == nil
+}
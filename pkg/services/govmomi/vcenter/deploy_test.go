@@ -0,0 +1,218 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/library"
+	vapivcenter "github.com/vmware/govmomi/vapi/vcenter"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestDeployLibraryItem(t *testing.T) {
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	vmCtx := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+	vmCtx.Session = session
+	vmCtx.VSphereVM.Spec.ContentLibrary = "capv"
+	vmCtx.VSphereVM.Spec.Template = "ubuntu"
+	createTemplateLibraryItem(t, vmCtx, "capv", "ubuntu")
+
+	events := vmCtx.GetGenericEventChannelFor(v1alpha4.GroupVersion.WithKind("VSphereVM"))
+	waitForDeployment := func() {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.Object.GetName() != vmCtx.VSphereVM.Name {
+				t.Fatalf("Expected VSphereVM %q to be enqueued, got %q", vmCtx.VSphereVM.Name, e.Object.GetName())
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatal("Timed out waiting for the content library item to be deployed")
+		}
+	}
+
+	// The item is deployed in the background.
+	if err := deployLibraryItem(vmCtx, nil); err != nil {
+		t.Fatalf("Failed to deploy content library item: %v", err)
+	}
+	if vmCtx.VSphereVM.Status.TaskRef != "" {
+		t.Fatalf("Expected no task while the item is deployed, got %q", vmCtx.VSphereVM.Status.TaskRef)
+	}
+	waitForDeployment()
+
+	// The deployed VM is found before it is configured. Finding it discards
+	// the completed deployment, like a restart of the controller would.
+	deployedVM, err := FindDeployedVM(vmCtx)
+	if err != nil {
+		t.Fatalf("Failed to find deployed VM: %v", err)
+	}
+	if deployedVM == nil {
+		t.Fatal("Expected to find the deployed VM")
+	}
+	// The simulator deploys VM template items as templates, which can only
+	// be renamed.
+	pool, err := session.Finder.DefaultResourcePool(vmCtx)
+	if err != nil {
+		t.Fatalf("Failed to find resource pool: %v", err)
+	}
+	if err := deployedVM.MarkAsVirtualMachine(vmCtx, *pool, nil); err != nil {
+		t.Fatalf("Failed to mark deployed VM as a VM: %v", err)
+	}
+
+	// The deployment is resumed with the deployed VM instead of deploying
+	// the item again.
+	if err := deployLibraryItem(vmCtx, nil); err != nil {
+		t.Fatalf("Failed to resume deployment of content library item: %v", err)
+	}
+	waitForDeployment()
+	if err := deployLibraryItem(vmCtx, nil); err != nil {
+		t.Fatalf("Failed to reconfigure deployed VM: %v", err)
+	}
+	if vmCtx.VSphereVM.Status.TaskRef == "" {
+		t.Fatal("Expected the reconfiguration of the deployed VM to be the task of the VSphereVM")
+	}
+	taskRef := types.ManagedObjectReference{Type: "Task", Value: vmCtx.VSphereVM.Status.TaskRef}
+	if err := object.NewTask(session.Client.Client, taskRef).Wait(vmCtx); err != nil {
+		t.Fatalf("Failed to reconfigure deployed VM: %v", err)
+	}
+
+	// The configured VM is renamed and has the UID of the VSphereVM as its
+	// instance UUID.
+	var obj mo.VirtualMachine
+	if err := deployedVM.Properties(vmCtx, deployedVM.Reference(), []string{"name", "config.instanceUuid"}, &obj); err != nil {
+		t.Fatalf("Failed to get properties of deployed VM: %v", err)
+	}
+	if obj.Name != vmCtx.VSphereVM.Name {
+		t.Fatalf("Expected deployed VM to be named %q, got %q", vmCtx.VSphereVM.Name, obj.Name)
+	}
+	if obj.Config.InstanceUuid != string(vmCtx.VSphereVM.UID) {
+		t.Fatalf("Expected deployed VM to have instance UUID %q, got %q", vmCtx.VSphereVM.UID, obj.Config.InstanceUuid)
+	}
+	if deployedVM, err = FindDeployedVM(vmCtx); err != nil || deployedVM != nil {
+		t.Fatalf("Expected no deployed VM once it is configured, got %v, %v", deployedVM, err)
+	}
+}
+
+func TestCustomizeDeployedVM(t *testing.T) {
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	vmCtx := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+	vmCtx.Session = session
+	vmCtx.VSphereVM.Spec.ContentLibrary = "capv"
+	vmCtx.VSphereVM.Spec.Customization = &v1alpha4.GuestCustomizationSpec{Type: v1alpha4.LinuxGuestCustomization}
+
+	vm, err := session.Finder.VirtualMachine(vmCtx, "DC0_C0_RP0_VM0")
+	if err != nil {
+		t.Fatalf("Failed to find VM: %v", err)
+	}
+
+	// A powered on VM is not customized.
+	task, err := CustomizeDeployedVM(vmCtx, vm)
+	if err != nil || task != nil {
+		t.Fatalf("Expected no customization of a powered on VM, got %v, %v", task, err)
+	}
+
+	// The simulator requires a customization for each network adapter of
+	// the guest.
+	var obj mo.VirtualMachine
+	if err := vm.Properties(vmCtx, vm.Reference(), []string{"guest.net"}, &obj); err != nil {
+		t.Fatalf("Failed to get properties of VM: %v", err)
+	}
+	vmCtx.VSphereVM.Spec.Network.Devices = nil
+	for range obj.Guest.Net {
+		vmCtx.VSphereVM.Spec.Network.Devices = append(vmCtx.VSphereVM.Spec.Network.Devices, v1alpha4.NetworkDeviceSpec{DHCP4: true})
+	}
+
+	powerOff, err := vm.PowerOff(vmCtx)
+	if err != nil {
+		t.Fatalf("Failed to power off VM: %v", err)
+	}
+	if err := powerOff.Wait(vmCtx); err != nil {
+		t.Fatalf("Failed to power off VM: %v", err)
+	}
+	task, err = CustomizeDeployedVM(vmCtx, vm)
+	if err != nil {
+		t.Fatalf("Failed to customize deployed VM: %v", err)
+	}
+	if task == nil {
+		t.Fatal("Expected a customization task")
+	}
+	if err := task.Wait(vmCtx); err != nil {
+		t.Fatalf("Failed to customize deployed VM: %v", err)
+	}
+
+	// A pending customization is not started again.
+	task, err = CustomizeDeployedVM(vmCtx, vm)
+	if err != nil || task != nil {
+		t.Fatalf("Expected no customization of a VM with a pending customization, got %v, %v", task, err)
+	}
+}
+
+// createTemplateLibraryItem creates a content library with a VM template
+// item, cloned from a VM of the simulator.
+func createTemplateLibraryItem(t *testing.T, ctx *context.VMContext, libraryName, itemName string) {
+	t.Helper()
+
+	restClient, err := ctx.Session.RestClient(ctx)
+	if err != nil {
+		t.Fatalf("Failed to log in to the REST API: %v", err)
+	}
+	datastore, err := ctx.Session.Finder.DefaultDatastore(ctx)
+	if err != nil {
+		t.Fatalf("Failed to find datastore: %v", err)
+	}
+	folder, err := ctx.Session.Finder.DefaultFolder(ctx)
+	if err != nil {
+		t.Fatalf("Failed to find folder: %v", err)
+	}
+	vm, err := ctx.Session.Finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+	if err != nil {
+		t.Fatalf("Failed to find VM: %v", err)
+	}
+
+	libraryID, err := library.NewManager(restClient).CreateLibrary(ctx, library.Library{
+		Name: libraryName,
+		Type: "LOCAL",
+		Storage: []library.StorageBackings{
+			{DatastoreID: datastore.Reference().Value, Type: "DATASTORE"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create content library: %v", err)
+	}
+	_, err = vapivcenter.NewManager(restClient).CreateTemplate(ctx, vapivcenter.Template{
+		Name:      itemName,
+		Library:   libraryID,
+		SourceVM:  vm.Reference().Value,
+		Placement: &vapivcenter.Placement{Folder: folder.Reference().Value},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create VM template library item: %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	goctx "context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+var (
+	// vmWatchedProperties are the properties of the VMs whose changes
+	// trigger a reconcile of the VSphereVM.
+	vmWatchedProperties = []string{"runtime.powerState", "guest.net", "config.extraConfig"}
+
+	// taskWatchedProperties are the properties of the tasks whose changes
+	// trigger a reconcile of the VSphereVM once the task completes.
+	taskWatchedProperties = []string{"info.state"}
+
+	// watcherMaxWaitSeconds is how long a call to WaitForUpdatesEx waits for
+	// updates before it returns.
+	watcherMaxWaitSeconds int32 = 60
+
+	vmWatchers   = map[*govmomi.Client]*vmWatcher{}
+	vmWatchersMU sync.Mutex
+
+	// errWatcherStopped is returned when watching an object with a watcher
+	// which stopped after its last object was unwatched.
+	errWatcherStopped = errors.New("watcher stopped")
+)
+
+// vmWatcher watches the VMs and the tasks of the VSphereVMs reconciled with a
+// vSphere session, and enqueues the VSphereVM affected by each update. The
+// watcher uses a dedicated property collector with one filter per watched
+// object, so that a single long-lived WaitForUpdatesEx call per session
+// replaces polling the objects.
+type vmWatcher struct {
+	key       *govmomi.Client
+	client    *vim25.Client
+	collector types.ManagedObjectReference
+	events    chan<- event.GenericEvent
+	logger    logr.Logger
+	// release releases the session, which is held by the watcher so that it
+	// is not evicted from the session cache while the watcher runs.
+	release func()
+	// cancel stops the watcher.
+	cancel goctx.CancelFunc
+
+	mu sync.Mutex
+	// stopped is true once the last watched object was unwatched.
+	stopped bool
+	// filters maps the filters of the property collector to the watched
+	// objects.
+	filters map[types.ManagedObjectReference]watchedObject
+	// objects maps the watched objects to their filter.
+	objects map[types.ManagedObjectReference]types.ManagedObjectReference
+}
+
+// watchedObject is a vSphere object watched for a VSphereVM.
+type watchedObject struct {
+	ref       types.ManagedObjectReference
+	vsphereVM client.ObjectKey
+}
+
+// watchVM ensures that changes of the VM trigger a reconcile of the
+// VSphereVM.
+func watchVM(ctx *context.VMContext, vmRef types.ManagedObjectReference) {
+	watch(ctx, vmRef, vmWatchedProperties)
+}
+
+// watchTask ensures that the completion of the task of the VSphereVM, if any,
+// triggers a reconcile of the VSphereVM.
+func watchTask(ctx *context.VMContext) {
+	if ctx.VSphereVM.Status.TaskRef == "" {
+		return
+	}
+	taskRef := types.ManagedObjectReference{
+		Type:  morefTypeTask,
+		Value: ctx.VSphereVM.Status.TaskRef,
+	}
+	watch(ctx, taskRef, taskWatchedProperties)
+}
+
+func watch(ctx *context.VMContext, ref types.ManagedObjectReference, pathSet []string) {
+	var err error
+	for {
+		var w *vmWatcher
+		if w, err = getVMWatcher(ctx); err == nil {
+			err = w.watch(ctx, ref, pathSet, client.ObjectKey{Namespace: ctx.VSphereVM.Namespace, Name: ctx.VSphereVM.Name})
+		}
+		// A watcher stopping concurrently is replaced by a new one.
+		if err != errWatcherStopped {
+			break
+		}
+	}
+	if err != nil {
+		// The VSphereVM is still reconciled on resync.
+		ctx.Logger.Error(err, "unable to watch vSphere object", "ref", ref)
+	}
+}
+
+// getVMWatcher returns the watcher of the session of the context, starting
+// it if needed.
+func getVMWatcher(ctx *context.VMContext) (*vmWatcher, error) {
+	vmWatchersMU.Lock()
+	defer vmWatchersMU.Unlock()
+
+	if w, ok := vmWatchers[ctx.Session.Client]; ok {
+		return w, nil
+	}
+
+	c := ctx.Session.Client.Client
+	res, err := methods.CreatePropertyCollector(ctx, c, &types.CreatePropertyCollector{
+		This: c.ServiceContent.PropertyCollector,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create property collector for %s", ctx.Session.URL().Host)
+	}
+
+	runCtx, cancel := goctx.WithCancel(ctx.ControllerManagerContext)
+	w := &vmWatcher{
+		key:       ctx.Session.Client,
+		client:    c,
+		collector: res.Returnval,
+		events:    ctx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereVM")),
+		logger:    ctx.ControllerManagerContext.Logger.WithName("vm-watcher").WithValues("server", ctx.Session.URL().Host),
+		filters:   map[types.ManagedObjectReference]watchedObject{},
+		objects:   map[types.ManagedObjectReference]types.ManagedObjectReference{},
+		release:   ctx.Session.Hold(),
+		cancel:    cancel,
+	}
+	vmWatchers[ctx.Session.Client] = w
+
+	// The watcher runs as long as the manager, until the session expires, or
+	// until it no longer watches any object.
+	go w.run(runCtx)
+
+	w.logger.V(2).Info("started watching vSphere objects")
+	return w, nil
+}
+
+func (w *vmWatcher) watch(
+	ctx goctx.Context,
+	ref types.ManagedObjectReference,
+	pathSet []string,
+	vsphereVM client.ObjectKey) error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped {
+		return errWatcherStopped
+	}
+	if _, ok := w.objects[ref]; ok {
+		return nil
+	}
+
+	res, err := methods.CreateFilter(ctx, w.client, &types.CreateFilter{
+		This: w.collector,
+		Spec: types.PropertyFilterSpec{
+			ObjectSet: []types.ObjectSpec{{Obj: ref}},
+			PropSet:   []types.PropertySpec{{Type: ref.Type, PathSet: pathSet}},
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to create property filter for %s", ref)
+	}
+
+	w.filters[res.Returnval] = watchedObject{ref: ref, vsphereVM: vsphereVM}
+	w.objects[ref] = res.Returnval
+	w.logger.V(4).Info("watching vSphere object", "ref", ref, "vspherevm", vsphereVM)
+	return nil
+}
+
+func (w *vmWatcher) unwatch(ctx goctx.Context, filter types.ManagedObjectReference) {
+	w.mu.Lock()
+	watched, ok := w.filters[filter]
+	delete(w.filters, filter)
+	if ok {
+		delete(w.objects, watched.ref)
+	}
+	stop := ok && len(w.filters) == 0
+	if stop {
+		w.stopped = true
+	}
+	w.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	if stop {
+		// The property collector is destroyed along with its filters when
+		// the watcher stops.
+		w.logger.V(2).Info("stopping watcher without watched vSphere objects")
+		w.remove()
+		w.cancel()
+		return
+	}
+	if _, err := methods.DestroyPropertyFilter(ctx, w.client, &types.DestroyPropertyFilter{This: filter}); err != nil {
+		w.logger.Error(err, "unable to destroy property filter", "ref", watched.ref)
+	}
+}
+
+func (w *vmWatcher) run(ctx goctx.Context) {
+	defer w.stop(ctx)
+
+	version := ""
+	for {
+		res, err := methods.WaitForUpdatesEx(ctx, w.client, &types.WaitForUpdatesEx{
+			This:    w.collector,
+			Version: version,
+			Options: &types.WaitOptions{MaxWaitSeconds: &watcherMaxWaitSeconds},
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				w.logger.Error(err, "stopped watching vSphere objects")
+			}
+			return
+		}
+
+		// No update happened while waiting.
+		updateSet := res.Returnval
+		if updateSet == nil {
+			continue
+		}
+
+		version = updateSet.Version
+		for _, filterUpdate := range updateSet.FilterSet {
+			w.handle(ctx, filterUpdate)
+		}
+	}
+}
+
+func (w *vmWatcher) handle(ctx goctx.Context, filterUpdate types.PropertyFilterUpdate) {
+	w.mu.Lock()
+	watched, ok := w.filters[filterUpdate.Filter]
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	for _, objectUpdate := range filterUpdate.ObjectSet {
+		unwatch := false
+		switch {
+		case objectUpdate.Kind == types.ObjectUpdateKindLeave:
+			// The object was destroyed.
+			unwatch = true
+		case watched.ref.Type == morefTypeTask:
+			// Only the completion of a task is relevant, which may have
+			// happened before the task was watched.
+			if !isTaskCompleted(objectUpdate.ChangeSet) {
+				continue
+			}
+			unwatch = true
+		case objectUpdate.Kind == types.ObjectUpdateKindEnter:
+			// The initial values of the properties of a VM were read by the
+			// reconcile which started watching it.
+			continue
+		}
+
+		w.logger.V(4).Info("enqueuing VSphereVM on update", "ref", watched.ref, "vspherevm", watched.vsphereVM, "kind", objectUpdate.Kind)
+		w.enqueue(ctx, watched.vsphereVM)
+
+		// The VSphereVM is enqueued first, since unwatching the last
+		// watched object stops the watcher.
+		if unwatch {
+			w.unwatch(ctx, filterUpdate.Filter)
+		}
+	}
+}
+
+// remove removes the watcher of the session, so that the next object is
+// watched by a new watcher.
+func (w *vmWatcher) remove() {
+	vmWatchersMU.Lock()
+	defer vmWatchersMU.Unlock()
+	if vmWatchers[w.key] == w {
+		delete(vmWatchers, w.key)
+	}
+}
+
+// stop removes the watcher of the session, releases the session and enqueues
+// the VSphereVMs it watched, whose reconciliation starts watching them again.
+func (w *vmWatcher) stop(ctx goctx.Context) {
+	w.remove()
+	defer w.cancel()
+	defer w.release()
+
+	destroyCtx, cancel := goctx.WithTimeout(goctx.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := methods.DestroyPropertyCollector(destroyCtx, w.client, &types.DestroyPropertyCollector{This: w.collector}); err != nil {
+		w.logger.V(4).Info("unable to destroy property collector", "error", err.Error())
+	}
+
+	w.mu.Lock()
+	vsphereVMs := map[client.ObjectKey]struct{}{}
+	for _, watched := range w.filters {
+		vsphereVMs[watched.vsphereVM] = struct{}{}
+	}
+	w.mu.Unlock()
+
+	for vsphereVM := range vsphereVMs {
+		w.enqueue(ctx, vsphereVM)
+	}
+}
+
+func (w *vmWatcher) enqueue(ctx goctx.Context, key client.ObjectKey) {
+	obj := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+		},
+	}
+	select {
+	case w.events <- event.GenericEvent{Object: obj}:
+	case <-ctx.Done():
+	}
+}
+
+func isTaskCompleted(changes []types.PropertyChange) bool {
+	for _, change := range changes {
+		if change.Name != "info.state" {
+			continue
+		}
+		if state, ok := change.Val.(types.TaskInfoState); ok {
+			return state == types.TaskInfoStateSuccess || state == types.TaskInfoStateError
+		}
+	}
+	return false
+}
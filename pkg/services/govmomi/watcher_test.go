@@ -0,0 +1,177 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// newWatcherTestContext returns a VM context with a session of a simulated
+// vCenter, along with the channel of the events enqueuing its VSphereVM.
+func newWatcherTestContext(t *testing.T) (*context.VMContext, <-chan event.GenericEvent) {
+	g := NewWithT(t)
+
+	model := simulator.VPX()
+	t.Cleanup(model.Remove)
+	g.Expect(model.Create()).To(Succeed())
+	model.Service.TLS = new(tls.Config)
+	model.Service.RegisterEndpoints = true
+
+	s := model.Service.NewServer()
+	t.Cleanup(s.Close)
+	pass, _ := s.URL.User.Password()
+
+	vmContext := fake.NewVMContext(fake.NewControllerContext(fake.NewControllerManagerContext()))
+	vmContext.VSphereVM.Spec.Server = s.URL.Host
+
+	authSession, err := session.GetOrCreate(
+		vmContext.Context,
+		session.NewParams().
+			WithServer(vmContext.VSphereVM.Spec.Server).
+			WithUserInfo(s.URL.User.Username(), pass))
+	g.Expect(err).NotTo(HaveOccurred())
+	vmContext.Session = authSession
+
+	return vmContext, vmContext.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereVM"))
+}
+
+func TestWatchVM(t *testing.T) {
+	g := NewWithT(t)
+	vmContext, events := newWatcherTestContext(t)
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+
+	watchVM(vmContext, vm.Reference())
+
+	// The initial state of the VM does not trigger a reconcile.
+	g.Consistently(events, time.Second).ShouldNot(Receive())
+
+	task, err := object.NewVirtualMachine(vmContext.Session.Client.Client, vm.Reference()).PowerOff(vmContext)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(task.Wait(vmContext)).To(Succeed())
+
+	var e event.GenericEvent
+	g.Eventually(events, 10*time.Second).Should(Receive(&e))
+	g.Expect(e.Object.GetNamespace()).To(Equal(vmContext.VSphereVM.Namespace))
+	g.Expect(e.Object.GetName()).To(Equal(vmContext.VSphereVM.Name))
+}
+
+func TestWatchTask(t *testing.T) {
+	g := NewWithT(t)
+	vmContext, events := newWatcherTestContext(t)
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	task, err := object.NewVirtualMachine(vmContext.Session.Client.Client, vm.Reference()).PowerOff(vmContext)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(task.Wait(vmContext)).To(Succeed())
+
+	w, err := getVMWatcher(vmContext)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// A task which completed before it is watched triggers a reconcile.
+	vmContext.VSphereVM.Status.TaskRef = task.Reference().Value
+	watchTask(vmContext)
+	var e event.GenericEvent
+	g.Eventually(events, 10*time.Second).Should(Receive(&e))
+	g.Expect(e.Object.GetName()).To(Equal(vmContext.VSphereVM.Name))
+
+	// A completed task is not watched anymore, and the watcher stops along
+	// with its last watched object.
+	g.Eventually(func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		_, ok := w.objects[task.Reference()]
+		return ok || !w.stopped
+	}).Should(BeFalse())
+	vmWatchersMU.Lock()
+	g.Expect(vmWatchers).NotTo(HaveKey(vmContext.Session.Client))
+	vmWatchersMU.Unlock()
+
+	// Watching an object starts a new watcher.
+	watchVM(vmContext, vm.Reference())
+	next, err := getVMWatcher(vmContext)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(next).NotTo(BeIdenticalTo(w))
+	next.mu.Lock()
+	g.Expect(next.objects).To(HaveKey(vm.Reference()))
+	next.mu.Unlock()
+}
+
+func TestWatcherHandle(t *testing.T) {
+	g := NewWithT(t)
+	vmContext, events := newWatcherTestContext(t)
+
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	watchVM(vmContext, vm.Reference())
+	w, err := getVMWatcher(vmContext)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// Watching an object again is a no-op.
+	watchVM(vmContext, vm.Reference())
+	w.mu.Lock()
+	filter, ok := w.objects[vm.Reference()]
+	g.Expect(ok).To(BeTrue())
+	g.Expect(w.filters).To(HaveLen(1))
+	w.mu.Unlock()
+
+	handle := func(kind types.ObjectUpdateKind) {
+		go w.handle(vmContext, types.PropertyFilterUpdate{
+			Filter: filter,
+			ObjectSet: []types.ObjectUpdate{{
+				Kind: kind,
+				Obj:  vm.Reference(),
+				ChangeSet: []types.PropertyChange{
+					{Name: "runtime.powerState", Op: types.PropertyChangeOpAssign, Val: types.VirtualMachinePowerStatePoweredOff},
+				},
+			}},
+		})
+	}
+	isWatched := func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		_, ok := w.objects[vm.Reference()]
+		return ok
+	}
+
+	// The initial values of the properties do not trigger a reconcile.
+	handle(types.ObjectUpdateKindEnter)
+	g.Consistently(events, time.Second).ShouldNot(Receive())
+
+	// A change of the properties triggers a reconcile.
+	handle(types.ObjectUpdateKindModify)
+	g.Eventually(events, 10*time.Second).Should(Receive())
+	g.Expect(isWatched()).To(BeTrue())
+
+	// The destruction of the VM triggers a reconcile, and the VM is not
+	// watched anymore.
+	handle(types.ObjectUpdateKindLeave)
+	g.Eventually(events, 10*time.Second).Should(Receive())
+	g.Eventually(isWatched).Should(BeFalse())
+}
@@ -18,7 +18,11 @@ package session
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/url"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,23 +32,58 @@ import (
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/session/keepalive"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vapi/tags"
 	"github.com/vmware/govmomi/vim25"
 	"github.com/vmware/govmomi/vim25/methods"
 	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha4"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/constants"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
 )
 
-var sessionCache = map[string]Session{}
+var sessionCache = map[string]*cachedSession{}
 var sessionMU sync.Mutex
 
+// cachedSession is a session of the cache along with the data used to evict
+// it.
+type cachedSession struct {
+	Session
+
+	lastUsed time.Time
+	// users is the number of long-lived users holding the session, which is
+	// never evicted while held.
+	users int
+}
+
 // Session is a vSphere session with a configured Finder.
 type Session struct {
 	*govmomi.Client
 	Finder     *find.Finder
 	datacenter *object.Datacenter
+
+	// key is the key of the session in the cache.
+	key string
+
+	// rest is the session of the vSphere Automation REST API, which serves
+	// the tagging and content library APIs. It is shared by the copies of a
+	// cached session and only logged in once it is first used.
+	rest *restSession
+}
+
+// restSession is a lazily authenticated session of the vSphere Automation
+// REST API.
+type restSession struct {
+	vimClient *vim25.Client
+	userinfo  *url.Userinfo
+	logger    logr.Logger
+
+	mu     sync.Mutex
+	client *rest.Client
 }
 
 type Feature struct {
@@ -99,22 +138,38 @@ func (p *Params) WithFeatures(feature Feature) *Params {
 
 // GetOrCreate gets a cached session or creates a new one if one does not
 // already exist.
+// Sessions are cached by server, datacenter, thumbprint and credentials, so
+// that a session is not reused once the credentials of its user change.
+// Cached sessions which have not been used for DefaultSessionIdleTimeout, and
+// are not held by any user, are logged out and evicted.
 func GetOrCreate(ctx context.Context, params *Params) (*Session, error) {
 	logger := ctrl.LoggerFrom(ctx).WithName("session")
 	sessionMU.Lock()
 	defer sessionMU.Unlock()
-
-	sessionKey := params.server + params.userinfo.Username() + params.datacenter
-	if session, ok := sessionCache[sessionKey]; ok {
-		// if keepalive is enabled we depend upon roundtripper to reestablish the connection
-		// and remove the key if it could not
-		if params.feature.EnableKeepAlive {
-			return &session, nil
-		}
-		if ok, _ := session.SessionManager.SessionIsActive(ctx); ok {
-			logger.V(2).Info("found active cached vSphere client session", "server", params.server, "datacenter", params.datacenter)
-			return &session, nil
+	defer func() {
+		metrics.ActiveSessions.Set(float64(len(sessionCache)))
+	}()
+
+	now := time.Now()
+	sessionKey := params.key()
+	for key, cached := range sessionCache {
+		// Sessions of outdated credentials are evicted once idle, as they
+		// may still be used by other clusters.
+		if key == sessionKey || cached.users > 0 || now.Sub(cached.lastUsed) <= constants.DefaultSessionIdleTimeout {
+			continue
 		}
+		logger.V(2).Info("evicting idle vSphere client session", "server", cached.URL().Host)
+		delete(sessionCache, key)
+		go cached.logout(logger)
+	}
+
+	if cached, ok := sessionCache[sessionKey]; ok {
+		// Expired sessions are re-authenticated by the client when a request
+		// fails, so that a cached session is always usable.
+		logger.V(2).Info("found cached vSphere client session", "server", params.server, "datacenter", params.datacenter)
+		cached.lastUsed = now
+		session := cached.Session
+		return &session, nil
 	}
 
 	soapURL, err := soap.ParseURL(params.server)
@@ -126,12 +181,18 @@ func GetOrCreate(ctx context.Context, params *Params) (*Session, error) {
 	}
 
 	soapURL.User = params.userinfo
-	client, err := newClient(ctx, logger, sessionKey, soapURL, params.thumbprint, params.feature)
+	session := Session{
+		key: sessionKey,
+		rest: &restSession{
+			userinfo: params.userinfo,
+			logger:   logger,
+		},
+	}
+	session.Client, err = newClient(ctx, logger, soapURL, params.thumbprint, params.feature, session.rest.relogin)
 	if err != nil {
 		return nil, err
 	}
-
-	session := Session{Client: client}
+	session.rest.vimClient = session.Client.Client
 	session.UserAgent = v1alpha4.GroupVersion.String()
 
 	// Assign the finder to the session.
@@ -140,24 +201,68 @@ func GetOrCreate(ctx context.Context, params *Params) (*Session, error) {
 	// Assign the datacenter if one was specified.
 	dc, err := session.Finder.DatacenterOrDefault(ctx, params.datacenter)
 	if err != nil {
+		session.logout(logger)
 		return nil, errors.Wrapf(err, "unable to find datacenter %q", params.datacenter)
 	}
 	session.datacenter = dc
 	session.Finder.SetDatacenter(dc)
 
 	// Cache the session.
-	sessionCache[sessionKey] = session
+	sessionCache[sessionKey] = &cachedSession{
+		Session:  session,
+		lastUsed: now,
+	}
 
 	logger.V(2).Info("cached vSphere client session", "server", params.server, "datacenter", params.datacenter)
 
 	return &session, nil
 }
 
-func newClient(ctx context.Context, logger logr.Logger, sessionKey string, url *url.URL, thumprint string, feature Feature) (*govmomi.Client, error) {
-	insecure := thumprint == ""
+// key returns the key of the session in the cache. The password is hashed,
+// so that it is not kept in memory in plain text as part of the key.
+func (p *Params) key() string {
+	password, _ := p.userinfo.Password()
+	credentials := sha256.Sum256([]byte(p.userinfo.Username() + ":" + password))
+	return strings.Join([]string{p.server, p.datacenter, p.userinfo.Username(), p.thumbprint, hex.EncodeToString(credentials[:])}, "#")
+}
+
+// Hold prevents the session from being evicted from the cache while idle,
+// until the returned function is called. Long-lived users of a session hold
+// it, as they do not get the session again before each use.
+func (s *Session) Hold() (release func()) {
+	sessionMU.Lock()
+	defer sessionMU.Unlock()
+
+	cached, ok := sessionCache[s.key]
+	if !ok || cached.Client != s.Client {
+		// The session was evicted already.
+		return func() {}
+	}
+	cached.users++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			sessionMU.Lock()
+			defer sessionMU.Unlock()
+			cached.users--
+			cached.lastUsed = time.Now()
+		})
+	}
+}
+
+func newClient(
+	ctx context.Context,
+	logger logr.Logger,
+	url *url.URL,
+	thumbprint string,
+	feature Feature,
+	onLogin func(context.Context) error) (*govmomi.Client, error) {
+
+	insecure := thumbprint == ""
 	soapClient := soap.NewClient(url, insecure)
 	if !insecure {
-		soapClient.SetThumbprint(url.Host, thumprint)
+		soapClient.SetThumbprint(url.Host, thumbprint)
 	}
 
 	vimClient, err := vim25.NewClient(ctx, soapClient)
@@ -172,21 +277,29 @@ func newClient(ctx context.Context, logger logr.Logger, sessionKey string, url *
 
 	if feature.EnableKeepAlive {
 		vimClient.RoundTripper = session.KeepAliveHandler(vimClient.RoundTripper, feature.KeepAliveDuration, func(tripper soap.RoundTripper) error {
-			// we tried implementing
-			// c.Login here but the client once logged out
-			// keeps errong in invalid username or password
-			// we tried with cached username and password in session still the error persisted
-			// hence we just clear the cache and expect the client to
-			// be recreated in next GetOrCreate call
+			// A failed keep alive is not fatal: if the session expired in
+			// the meantime, the next request re-authenticates.
 			_, err := methods.GetCurrentTime(ctx, tripper)
 			if err != nil {
 				logger.Error(err, "failed to keep alive govmomi client")
-				clearCache(sessionKey)
 			}
 			return err
 		})
 	}
 
+	// Re-authenticate transparently when the session expires, e.g. after a
+	// restart of vCenter.
+	vimClient.RoundTripper = &reloginRoundTripper{
+		RoundTripper: vimClient.RoundTripper,
+		login: func(ctx context.Context) error {
+			logger.V(2).Info("re-authenticating expired vSphere client session", "server", url.Host)
+			if err := c.Login(ctx, url.User); err != nil {
+				return err
+			}
+			return onLogin(ctx)
+		},
+	}
+
 	if err := c.Login(ctx, url.User); err != nil {
 		return nil, err
 	}
@@ -194,10 +307,183 @@ func newClient(ctx context.Context, logger logr.Logger, sessionKey string, url *
 	return c, nil
 }
 
-func clearCache(sessionKey string) {
-	sessionMU.Lock()
-	defer sessionMU.Unlock()
-	delete(sessionCache, sessionKey)
+// logout terminates the session on the server. Requests sent after the
+// session is logged out fail instead of logging in again.
+func (s *Session) logout(logger logr.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if rt, ok := s.Client.Client.RoundTripper.(*reloginRoundTripper); ok {
+		rt.close()
+	}
+
+	s.rest.logout(ctx)
+	if err := s.Client.Logout(ctx); err != nil {
+		logger.Error(err, "unable to logout vSphere client session", "server", s.URL().Host)
+	}
+}
+
+// RestClient returns the client of the vSphere Automation REST API, which
+// serves the tagging and content library APIs, logging in on first use. The
+// REST API is only available when connected to vCenter.
+func (s *Session) RestClient(ctx context.Context) (*rest.Client, error) {
+	if !s.IsVC() {
+		return nil, errors.Errorf("the REST API of %q is only available on vCenter", s.URL().Host)
+	}
+	return s.rest.get(ctx)
+}
+
+// TagManager returns a manager of the vSphere tags and tag categories,
+// logging in to the REST API on first use. Tagging is only available when
+// connected to vCenter.
+func (s *Session) TagManager(ctx context.Context) (*tags.Manager, error) {
+	c, err := s.RestClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tags.NewManager(c), nil
+}
+
+func (rs *restSession) get(ctx context.Context) (*rest.Client, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.client != nil {
+		return rs.client, nil
+	}
+
+	c := rest.NewClient(rs.vimClient)
+	// The REST session expires independently of the vSphere API session, so
+	// it is kept alive for as long as the vSphere session is cached.
+	c.Transport = keepalive.NewHandlerREST(c, 0, func() error {
+		rs.keepAlive(c)
+		return nil
+	})
+	if err := c.Login(ctx, rs.userinfo); err != nil {
+		return nil, errors.Wrapf(err, "unable to login to the REST endpoint of %q", rs.vimClient.URL().Host)
+	}
+	rs.client = c
+	return c, nil
+}
+
+// keepAlive checks that the REST session is still authenticated, and logs in
+// again if it expired in the meantime.
+func (rs *restSession) keepAlive(c *rest.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	current, err := c.Session(ctx)
+	if err == nil && current != nil {
+		return
+	}
+	if err := rs.relogin(ctx); err != nil {
+		rs.logger.Error(err, "failed to keep alive REST session", "server", rs.vimClient.URL().Host)
+	}
+}
+
+// relogin logs in to the REST API again, if the session was logged in at
+// all.
+func (rs *restSession) relogin(ctx context.Context) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.client == nil {
+		return nil
+	}
+	return rs.client.Login(ctx, rs.userinfo)
+}
+
+func (rs *restSession) logout(ctx context.Context) {
+	rs.mu.Lock()
+	c := rs.client
+	rs.client = nil
+	rs.mu.Unlock()
+
+	if c == nil {
+		return
+	}
+	// Logging out also stops keeping the session alive, which waits for a
+	// pending keep alive to complete.
+	if err := c.Logout(ctx); err != nil {
+		rs.logger.Error(err, "unable to logout of the REST endpoint", "server", rs.vimClient.URL().Host)
+	}
+}
+
+// reloginKey is the key of the context value marking the requests sent to
+// log in again, which must not log in themselves.
+type reloginKey struct{}
+
+// reloginRoundTripper logs in again and retries a request which failed
+// because the session is not authenticated anymore.
+type reloginRoundTripper struct {
+	soap.RoundTripper
+	login func(context.Context) error
+
+	mu sync.Mutex
+	// generation is incremented on every login, so that concurrent requests
+	// failing because of the same expired session log in only once.
+	generation int
+	// closed is set once the session is logged out on purpose.
+	closed bool
+}
+
+func (rt *reloginRoundTripper) close() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.closed = true
+}
+
+// RoundTrip implements soap.RoundTripper.
+func (rt *reloginRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	// The login is sent through this round tripper while the lock is held.
+	if ctx.Value(reloginKey{}) != nil {
+		return rt.RoundTripper.RoundTrip(ctx, req, res)
+	}
+
+	rt.mu.Lock()
+	generation := rt.generation
+	rt.mu.Unlock()
+
+	err := rt.RoundTripper.RoundTrip(ctx, req, res)
+	if !isNotAuthenticated(err) {
+		return err
+	}
+
+	if err := rt.relogin(ctx, generation); err != nil {
+		return errors.Wrap(err, "unable to re-authenticate vSphere client session")
+	}
+
+	// The fault of the failed request must be cleared from the response, as
+	// the response of the retry is decoded into the same value.
+	v := reflect.ValueOf(res).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return rt.RoundTripper.RoundTrip(ctx, req, res)
+}
+
+func (rt *reloginRoundTripper) relogin(ctx context.Context, generation int) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.closed {
+		return errors.New("session was logged out")
+	}
+	if rt.generation != generation {
+		// Another request logged in since this request was sent.
+		return nil
+	}
+	if err := rt.login(context.WithValue(ctx, reloginKey{}, true)); err != nil {
+		return err
+	}
+	rt.generation++
+	return nil
+}
+
+func isNotAuthenticated(err error) bool {
+	if err == nil || !soap.IsSoapFault(err) {
+		return false
+	}
+	_, ok := soap.ToSoapFault(err).VimFault().(types.NotAuthenticated)
+	return ok
 }
 
 // FindByBIOSUUID finds an object by its BIOS UUID.
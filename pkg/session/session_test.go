@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package session
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/simulator"
+	_ "github.com/vmware/govmomi/vapi/simulator"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/constants"
+)
+
+func TestParamsKey(t *testing.T) {
+	g := NewWithT(t)
+
+	params := NewParams().WithServer("vcenter").WithDatacenter("dc").WithUserInfo("user", "pass")
+	rotated := NewParams().WithServer("vcenter").WithDatacenter("dc").WithUserInfo("user", "rotated")
+	thumbprint := NewParams().WithServer("vcenter").WithDatacenter("dc").WithUserInfo("user", "pass").WithThumbprint("AA:BB")
+
+	g.Expect(params.key()).NotTo(Equal(rotated.key()))
+	g.Expect(params.key()).NotTo(Equal(thumbprint.key()))
+	g.Expect(params.key()).NotTo(ContainSubstring("pass"))
+}
+
+func TestGetOrCreate(t *testing.T) {
+	g := NewWithT(t)
+
+	model := simulator.VPX()
+	defer model.Remove()
+	g.Expect(model.Create()).To(Succeed())
+	model.Service.TLS = new(tls.Config)
+	model.Service.RegisterEndpoints = true
+
+	s := model.Service.NewServer()
+	defer s.Close()
+	pass, _ := s.URL.User.Password()
+
+	ctx := context.Background()
+	params := NewParams().
+		WithServer(s.URL.Host).
+		WithUserInfo(s.URL.User.Username(), pass)
+
+	session, err := GetOrCreate(ctx, params)
+	g.Expect(err).NotTo(HaveOccurred())
+	// The REST API is only logged in to once it is used.
+	g.Expect(session.rest.client).To(BeNil())
+
+	cached, err := GetOrCreate(ctx, params)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cached.Client).To(BeIdenticalTo(session.Client))
+
+	restClient, err := session.RestClient(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	cachedRestClient, err := cached.RestClient(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cachedRestClient).To(BeIdenticalTo(restClient))
+	restSession, err := restClient.Session(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(restSession).NotTo(BeNil())
+
+	// Requests which fail because the session expired are retried after
+	// logging in again.
+	g.Expect(session.SessionManager.Logout(ctx)).To(Succeed())
+	_, err = session.FindByInstanceUUID(ctx, "00000000-0000-0000-0000-000000000000")
+	g.Expect(err).NotTo(HaveOccurred())
+	userSession, err := session.SessionManager.UserSession(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(userSession).NotTo(BeNil())
+}
+
+func TestEviction(t *testing.T) {
+	g := NewWithT(t)
+
+	model := simulator.VPX()
+	defer model.Remove()
+	g.Expect(model.Create()).To(Succeed())
+	model.Service.TLS = new(tls.Config)
+
+	s := model.Service.NewServer()
+	defer s.Close()
+	pass, _ := s.URL.User.Password()
+
+	ctx := context.Background()
+	params := NewParams().
+		WithServer(s.URL.Host).
+		WithUserInfo(s.URL.User.Username(), pass)
+	rotated := NewParams().
+		WithServer(s.URL.Host).
+		WithUserInfo(s.URL.User.Username(), "rotated")
+
+	isCached := func(params *Params) bool {
+		sessionMU.Lock()
+		defer sessionMU.Unlock()
+		_, ok := sessionCache[params.key()]
+		return ok
+	}
+	setIdle := func(params *Params) {
+		sessionMU.Lock()
+		defer sessionMU.Unlock()
+		sessionCache[params.key()].lastUsed = time.Now().Add(-2 * constants.DefaultSessionIdleTimeout)
+	}
+
+	session, err := GetOrCreate(ctx, params)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// A session is not evicted by a session of other credentials of the
+	// same user, which may be used by another cluster.
+	_, err = GetOrCreate(ctx, rotated)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isCached(params)).To(BeTrue())
+
+	// A held session is not evicted while idle.
+	release := session.Hold()
+	setIdle(params)
+	_, err = GetOrCreate(ctx, rotated)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isCached(params)).To(BeTrue())
+
+	// Releasing a session marks it as used.
+	release()
+	release()
+	_, err = GetOrCreate(ctx, rotated)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isCached(params)).To(BeTrue())
+
+	setIdle(params)
+	_, err = GetOrCreate(ctx, rotated)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isCached(params)).To(BeFalse())
+}
@@ -78,6 +78,56 @@ network:
         {{- end }}
       {{- end }}
     {{- end }}
+  {{- if .Bonds }}
+  bonds:
+    {{- range .Bonds }}
+    {{ .Name }}:
+      interfaces:
+      {{- range .Interfaces }}
+      - {{ ifaceID . }}
+      {{- end }}
+      {{- if or .Mode .LACPRate .MIIMonitorInterval .TransmitHashPolicy }}
+      parameters:
+        {{- if .Mode }}
+        mode: "{{ .Mode }}"
+        {{- end }}
+        {{- if .LACPRate }}
+        lacp-rate: "{{ .LACPRate }}"
+        {{- end }}
+        {{- if .MIIMonitorInterval }}
+        mii-monitor-interval: {{ .MIIMonitorInterval }}
+        {{- end }}
+        {{- if .TransmitHashPolicy }}
+        transmit-hash-policy: "{{ .TransmitHashPolicy }}"
+        {{- end }}
+      {{- end }}
+      {{- template "interface" .NetworkInterfaceSpec }}
+    {{- end }}
+  {{- end }}
+  {{- if .VLANs }}
+  vlans:
+    {{- range .VLANs }}
+    {{ .Name }}:
+      id: {{ .ID }}
+      link: {{ ifaceID .Link }}
+      {{- template "interface" .NetworkInterfaceSpec }}
+    {{- end }}
+  {{- end }}
+  {{- if .Bridges }}
+  bridges:
+    {{- range .Bridges }}
+    {{ .Name }}:
+      interfaces:
+      {{- range .Interfaces }}
+      - {{ ifaceID . }}
+      {{- end }}
+      {{- if .STP }}
+      parameters:
+        stp: {{ .STP }}
+      {{- end }}
+      {{- template "interface" .NetworkInterfaceSpec }}
+    {{- end }}
+  {{- end }}
   {{- if .Routes }}
   routes:
   {{- range .Routes }}
@@ -87,3 +137,153 @@ network:
   {{- end }}
   {{- end }}
 `
+
+// interfaceFormat renders the network configuration of a bond, a VLAN or a
+// bridge in the cloud-init metadata.
+const interfaceFormat = `
+{{- define "interface" }}
+      {{- if or .DHCP4 .DHCP6 }}
+      dhcp4: {{ .DHCP4 }}
+      dhcp6: {{ .DHCP6 }}
+      {{- end }}
+      {{- if .IPAddrs }}
+      addresses:
+      {{- range .IPAddrs }}
+      - "{{ . }}"
+      {{- end }}
+      {{- end }}
+      {{- if .Gateway4 }}
+      gateway4: "{{ .Gateway4 }}"
+      {{- end }}
+      {{- if .Gateway6 }}
+      gateway6: "{{ .Gateway6 }}"
+      {{- end }}
+      {{- if .MTU }}
+      mtu: {{ .MTU }}
+      {{- end }}
+      {{- if .Routes }}
+      routes:
+      {{- range .Routes }}
+      - to: "{{ .To }}"
+        via: "{{ .Via }}"
+        metric: {{ .Metric }}
+      {{- end }}
+      {{- end }}
+      {{- if or .Nameservers .SearchDomains }}
+      nameservers:
+        {{- if .Nameservers }}
+        addresses:
+        {{- range .Nameservers }}
+        - "{{ . }}"
+        {{- end }}
+        {{- end }}
+        {{- if .SearchDomains }}
+        search:
+        {{- range .SearchDomains }}
+        - "{{ . }}"
+        {{- end }}
+        {{- end }}
+      {{- end }}
+{{- end }}
+`
+
+// linkFormat is the systemd-networkd link file which names a network
+// device of an Ignition machine.
+const linkFormat = `[Match]
+MACAddress={{ .Device.MACAddr }}
+
+[Link]
+Name={{ .Name }}
+WakeOnLan=magic
+`
+
+// networkFormat is the systemd-networkd network file which configures a
+// network device of an Ignition machine.
+const networkFormat = `[Match]
+MACAddress={{ .Device.MACAddr }}
+
+[Network]
+{{- if and .Device.DHCP4 .Device.DHCP6 }}
+DHCP=yes
+{{- else if .Device.DHCP4 }}
+DHCP=ipv4
+{{- else if .Device.DHCP6 }}
+DHCP=ipv6
+{{- end }}
+{{- range .Device.IPAddrs }}
+Address={{ . }}
+{{- end }}
+{{- if .Device.Gateway4 }}
+Gateway={{ .Device.Gateway4 }}
+{{- end }}
+{{- if .Device.Gateway6 }}
+Gateway={{ .Device.Gateway6 }}
+{{- end }}
+{{- range .Device.Nameservers }}
+DNS={{ . }}
+{{- end }}
+{{- if .Device.SearchDomains }}
+Domains={{ join .Device.SearchDomains " " }}
+{{- end }}
+{{- if .Device.MTU }}
+
+[Link]
+MTUBytes={{ .Device.MTU }}
+{{- end }}
+{{- range .Routes }}
+
+[Route]
+Destination={{ .To }}
+Gateway={{ .Via }}
+Metric={{ .Metric }}
+{{- end }}
+`
+
+// windowsMetadataFormat is the metadata of a Windows VM, read by
+// cloudbase-init.
+const windowsMetadataFormat = `
+instance-id: "{{ .Hostname }}"
+local-hostname: "{{ .Hostname }}"
+network:
+  version: 1
+  config:
+  {{- range .Devices }}
+  - type: physical
+    name: "{{ .Name }}"
+    mac_address: "{{ .MACAddr }}"
+    {{- if .MTU }}
+    mtu: {{ .MTU }}
+    {{- end }}
+    subnets:
+    {{- range .Subnets }}
+    - type: {{ .Type }}
+      {{- if .Address }}
+      address: "{{ .Address }}"
+      {{- end }}
+      {{- if .Gateway }}
+      gateway: "{{ .Gateway }}"
+      {{- end }}
+      {{- if .Nameservers }}
+      dns_nameservers:
+      {{- range .Nameservers }}
+      - "{{ . }}"
+      {{- end }}
+      {{- end }}
+      {{- if .SearchDomains }}
+      dns_search:
+      {{- range .SearchDomains }}
+      - "{{ . }}"
+      {{- end }}
+      {{- end }}
+      {{- if .Routes }}
+      routes:
+      {{- range .Routes }}
+      - network: "{{ .Network }}"
+        netmask: "{{ .Netmask }}"
+        gateway: "{{ .Gateway }}"
+        metric: {{ .Metric }}
+      {{- end }}
+      {{- end }}
+    {{- end }}
+  {{- end }}
+`
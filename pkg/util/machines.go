@@ -19,8 +19,14 @@ package util
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"net"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/pkg/errors"
@@ -136,16 +142,23 @@ func IsControlPlaneMachine(machine metav1.Object) bool {
 	return ok
 }
 
+// IsWindowsMachine returns true if the provided VSphereMachine runs
+// Windows.
+func IsWindowsMachine(machine *infrav1.VSphereMachine) bool {
+	return machine.Spec.OS == infrav1.Windows
+}
+
 // GetMachineMetadata returns the cloud-init metadata as a base-64 encoded
-// string for a given VSphereMachine.
+// string for a given VSphereMachine. The metadata of a Windows VSphereMachine
+// is in the format read by cloudbase-init.
 func GetMachineMetadata(hostname string, vsphereVM infrav1.VSphereVM, networkStatuses ...infrav1.NetworkStatus) ([]byte, error) {
-	// Create a copy of the devices and add their MAC addresses from a network status.
-	devices := make([]infrav1.NetworkDeviceSpec, integer.IntMax(len(vsphereVM.Spec.Network.Devices), len(networkStatuses)))
+	devices := getMachineNetworkDevices(vsphereVM, networkStatuses)
+	if vsphereVM.Spec.OS == infrav1.Windows {
+		return getWindowsMachineMetadata(hostname, vsphereVM, devices)
+	}
 
 	var waitForIPv4, waitForIPv6 bool
 	for i := range vsphereVM.Spec.Network.Devices {
-		vsphereVM.Spec.Network.Devices[i].DeepCopyInto(&devices[i])
-
 		if waitForIPv4 && waitForIPv6 {
 			// break early as we already wait for ipv4 and ipv6
 			continue
@@ -170,10 +183,17 @@ func GetMachineMetadata(hostname string, vsphereVM infrav1.VSphereVM, networkSta
 			waitForIPv6 = true
 		}
 	}
+	for _, iface := range vsphereVM.Spec.Network.VirtualInterfaces() {
+		v4, v6 := ipFamilies(iface)
+		waitForIPv4 = waitForIPv4 || v4
+		waitForIPv6 = waitForIPv6 || v6
+	}
 
-	// Add the MAC Address to the network device
-	for i, status := range networkStatuses {
-		devices[i].MACAddr = status.MACAddr
+	// The netplan IDs of the network devices are referenced by the bonds,
+	// the VLANs and the bridges, while the IDs of those are their names.
+	ifaceIDs := map[string]string{}
+	for i := range vsphereVM.Spec.Network.Devices {
+		ifaceIDs[vsphereVM.Spec.Network.DeviceName(i)] = fmt.Sprintf("id%d", i)
 	}
 
 	buf := &bytes.Buffer{}
@@ -182,16 +202,29 @@ func GetMachineMetadata(hostname string, vsphereVM infrav1.VSphereVM, networkSta
 			"nameservers": func(spec infrav1.NetworkDeviceSpec) bool {
 				return len(spec.Nameservers) > 0 || len(spec.SearchDomains) > 0
 			},
+			"ifaceID": func(name string) string {
+				if id, ok := ifaceIDs[name]; ok {
+					return id
+				}
+				return name
+			},
 		}).Parse(metadataFormat))
+	template.Must(tpl.Parse(interfaceFormat))
 	if err := tpl.Execute(buf, struct {
 		Hostname    string
 		Devices     []infrav1.NetworkDeviceSpec
+		Bonds       []infrav1.NetworkBondSpec
+		VLANs       []infrav1.NetworkVLANSpec
+		Bridges     []infrav1.NetworkBridgeSpec
 		Routes      []infrav1.NetworkRouteSpec
 		WaitForIPv4 bool
 		WaitForIPv6 bool
 	}{
 		Hostname:    hostname, // note that hostname determines the Kubernetes node name
 		Devices:     devices,
+		Bonds:       vsphereVM.Spec.Network.Bonds,
+		VLANs:       vsphereVM.Spec.Network.VLANs,
+		Bridges:     vsphereVM.Spec.Network.Bridges,
 		Routes:      vsphereVM.Spec.Network.Routes,
 		WaitForIPv4: waitForIPv4,
 		WaitForIPv6: waitForIPv6,
@@ -204,6 +237,312 @@ func GetMachineMetadata(hostname string, vsphereVM infrav1.VSphereVM, networkSta
 	return buf.Bytes(), nil
 }
 
+// windowsNetworkDevice is a network device in the format of the version 1
+// network config read by cloudbase-init.
+type windowsNetworkDevice struct {
+	Name    string
+	MACAddr string
+	MTU     *int64
+	Subnets []windowsSubnet
+}
+
+type windowsSubnet struct {
+	Type          string
+	Address       string
+	Gateway       string
+	Nameservers   []string
+	SearchDomains []string
+	Routes        []windowsRoute
+}
+
+type windowsRoute struct {
+	Network string
+	Netmask string
+	Gateway string
+	Metric  int32
+}
+
+// getWindowsMachineMetadata returns the metadata of a Windows VSphereVM. The
+// network is configured with the version 1 network config, as cloudbase-init
+// does not support netplan.
+func getWindowsMachineMetadata(hostname string, vsphereVM infrav1.VSphereVM, devices []infrav1.NetworkDeviceSpec) ([]byte, error) {
+	if network := vsphereVM.Spec.Network; len(network.Bonds) > 0 || len(network.VLANs) > 0 || len(network.Bridges) > 0 {
+		return nil, errors.Errorf("bonds, VLANs and bridges of vsphereVM %s/%s are not supported on Windows", vsphereVM.Namespace, vsphereVM.Name)
+	}
+
+	windowsDevices := make([]windowsNetworkDevice, 0, len(devices))
+	for i, device := range devices {
+		name := device.DeviceName
+		if name == "" {
+			name = fmt.Sprintf("eth%d", i)
+		}
+		windowsDevice := windowsNetworkDevice{
+			Name:    name,
+			MACAddr: device.MACAddr,
+			MTU:     device.MTU,
+		}
+
+		if device.DHCP4 {
+			windowsDevice.Subnets = append(windowsDevice.Subnets, windowsSubnet{Type: "dhcp4"})
+		}
+		if device.DHCP6 {
+			windowsDevice.Subnets = append(windowsDevice.Subnets, windowsSubnet{Type: "dhcp6"})
+		}
+		var hasGateway4, hasGateway6 bool
+		for _, addr := range device.IPAddrs {
+			ip, _, err := net.ParseCIDR(addr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid ip address %q of vsphereVM %s/%s", addr, vsphereVM.Namespace, vsphereVM.Name)
+			}
+			// The default gateways are configured with the first address
+			// of their family.
+			subnet := windowsSubnet{Type: "static", Address: addr}
+			if ip.To4() == nil {
+				subnet.Type = "static6"
+				if !hasGateway6 {
+					subnet.Gateway, hasGateway6 = device.Gateway6, true
+				}
+			} else if !hasGateway4 {
+				subnet.Gateway, hasGateway4 = device.Gateway4, true
+			}
+			windowsDevice.Subnets = append(windowsDevice.Subnets, subnet)
+		}
+		if len(windowsDevice.Subnets) == 0 {
+			windowsDevice.Subnets = append(windowsDevice.Subnets, windowsSubnet{Type: "manual"})
+		}
+
+		// The nameservers are configured with the first subnet which is not
+		// configured by DHCPv6, and the routes with the first subnet of
+		// their address family. The routes of the network are configured
+		// with the first device, like with cloud-init.
+		if len(device.Nameservers) > 0 || len(device.SearchDomains) > 0 {
+			subnet := findWindowsSubnet(windowsDevice.Subnets, func(subnet windowsSubnet) bool {
+				return subnet.Type != "dhcp6"
+			})
+			if subnet == nil {
+				return nil, errors.Errorf("nameservers of device %s of vsphereVM %s/%s require a static address or DHCPv4", name, vsphereVM.Namespace, vsphereVM.Name)
+			}
+			subnet.Nameservers = device.Nameservers
+			subnet.SearchDomains = device.SearchDomains
+		}
+		routes := device.Routes
+		if i == 0 {
+			routes = append(routes, vsphereVM.Spec.Network.Routes...)
+		}
+		for _, route := range routes {
+			windowsRoute, err := getWindowsRoute(route)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid route of vsphereVM %s/%s", vsphereVM.Namespace, vsphereVM.Name)
+			}
+			ipv6 := net.ParseIP(windowsRoute.Network).To4() == nil
+			subnet := findWindowsSubnet(windowsDevice.Subnets, func(subnet windowsSubnet) bool {
+				switch subnet.Type {
+				case "manual":
+					return true
+				case "dhcp6", "static6":
+					return ipv6
+				default:
+					return !ipv6
+				}
+			})
+			if subnet == nil {
+				return nil, errors.Errorf("route to %s of vsphereVM %s/%s requires an address of its family on device %s", route.To, vsphereVM.Namespace, vsphereVM.Name, name)
+			}
+			subnet.Routes = append(subnet.Routes, windowsRoute)
+		}
+
+		windowsDevices = append(windowsDevices, windowsDevice)
+	}
+
+	buf := &bytes.Buffer{}
+	tpl := template.Must(template.New("t").Parse(windowsMetadataFormat))
+	if err := tpl.Execute(buf, struct {
+		Hostname string
+		Devices  []windowsNetworkDevice
+	}{
+		Hostname: hostname,
+		Devices:  windowsDevices,
+	}); err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"error getting cloudbase-init metadata for vsphereVM %s/%s/%s",
+			vsphereVM.Namespace, vsphereVM.ClusterName, vsphereVM.Name)
+	}
+	return buf.Bytes(), nil
+}
+
+// findWindowsSubnet returns the first subnet matching the predicate, or nil.
+func findWindowsSubnet(subnets []windowsSubnet, match func(windowsSubnet) bool) *windowsSubnet {
+	for i := range subnets {
+		if match(subnets[i]) {
+			return &subnets[i]
+		}
+	}
+	return nil
+}
+
+// getWindowsRoute returns the route with its destination split into a
+// network and a netmask. A destination without a prefix is a host route.
+func getWindowsRoute(route infrav1.NetworkRouteSpec) (windowsRoute, error) {
+	to := route.To
+	if !strings.Contains(to, "/") {
+		ip := net.ParseIP(to)
+		if ip == nil {
+			return windowsRoute{}, errors.Errorf("invalid route destination %q", route.To)
+		}
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		to = fmt.Sprintf("%s/%d", to, bits)
+	}
+	_, ipNet, err := net.ParseCIDR(to)
+	if err != nil {
+		return windowsRoute{}, errors.Wrapf(err, "invalid route destination %q", route.To)
+	}
+
+	netmask := net.IP(ipNet.Mask).String()
+	if ipNet.IP.To4() == nil {
+		ones, _ := ipNet.Mask.Size()
+		netmask = strconv.Itoa(ones)
+	}
+	return windowsRoute{
+		Network: ipNet.IP.String(),
+		Netmask: netmask,
+		Gateway: route.Via,
+		Metric:  route.Metric,
+	}, nil
+}
+
+// GetMachineIgnitionConfig returns the Ignition config of a VSphereVM, which
+// is the Ignition config of its bootstrap data extended with the files
+// configuring its hostname and its network with systemd-networkd.
+func GetMachineIgnitionConfig(hostname string, vsphereVM infrav1.VSphereVM, bootstrapData []byte, networkStatuses ...infrav1.NetworkStatus) ([]byte, error) {
+	config := map[string]interface{}{}
+	if err := json.Unmarshal(bootstrapData, &config); err != nil {
+		return nil, errors.Wrapf(err, "error parsing Ignition config of vsphereVM %s/%s", vsphereVM.Namespace, vsphereVM.Name)
+	}
+	ignition, _ := config["ignition"].(map[string]interface{})
+	version, _ := ignition["version"].(string)
+	if !strings.HasPrefix(version, "2.") && !strings.HasPrefix(version, "3.") {
+		return nil, errors.Errorf("unsupported Ignition config version %q of vsphereVM %s/%s", version, vsphereVM.Namespace, vsphereVM.Name)
+	}
+
+	if network := vsphereVM.Spec.Network; len(network.Bonds) > 0 || len(network.VLANs) > 0 || len(network.Bridges) > 0 {
+		return nil, errors.Errorf("bonds, VLANs and bridges of vsphereVM %s/%s are not supported with Ignition", vsphereVM.Namespace, vsphereVM.Name)
+	}
+
+	files := map[string]string{"/etc/hostname": hostname + "\n"}
+	linkTpl := template.Must(template.New("link").Parse(linkFormat))
+	networkTpl := template.Must(template.New("network").Funcs(template.FuncMap{"join": strings.Join}).Parse(networkFormat))
+	for i, device := range getMachineNetworkDevices(vsphereVM, networkStatuses) {
+		name := device.DeviceName
+		if name == "" {
+			name = fmt.Sprintf("eth%d", i)
+		}
+		// The routes of the network are configured with the first device,
+		// like with cloud-init.
+		routes := device.Routes
+		if i == 0 {
+			routes = append(routes, vsphereVM.Spec.Network.Routes...)
+		}
+		data := struct {
+			Name   string
+			Device infrav1.NetworkDeviceSpec
+			Routes []infrav1.NetworkRouteSpec
+		}{
+			Name:   name,
+			Device: device,
+			Routes: routes,
+		}
+
+		for tpl, path := range map[*template.Template]string{
+			linkTpl:    fmt.Sprintf("/etc/systemd/network/10-capv-id%d.link", i),
+			networkTpl: fmt.Sprintf("/etc/systemd/network/10-capv-id%d.network", i),
+		} {
+			buf := &bytes.Buffer{}
+			if err := tpl.Execute(buf, data); err != nil {
+				return nil, errors.Wrapf(err, "error rendering %s for vsphereVM %s/%s", path, vsphereVM.Namespace, vsphereVM.Name)
+			}
+			files[path] = buf.String()
+		}
+	}
+
+	storage, _ := config["storage"].(map[string]interface{})
+	if storage == nil {
+		storage = map[string]interface{}{}
+		config["storage"] = storage
+	}
+	existingFiles, _ := storage["files"].([]interface{})
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// Ignition rejects configs with several files of the same path, so the
+	// files of the bootstrap data are replaced by the files of the VM.
+	mergedFiles := make([]interface{}, 0, len(existingFiles)+len(paths))
+	for _, existingFile := range existingFiles {
+		if file, ok := existingFile.(map[string]interface{}); ok {
+			if path, _ := file["path"].(string); files[path] != "" {
+				continue
+			}
+		}
+		mergedFiles = append(mergedFiles, existingFile)
+	}
+	for _, path := range paths {
+		file := map[string]interface{}{
+			"path": path,
+			"mode": 0644,
+			"contents": map[string]interface{}{
+				"source": "data:;base64," + base64.StdEncoding.EncodeToString([]byte(files[path])),
+			},
+		}
+		// The schemas of the files differ between the versions of the spec.
+		if strings.HasPrefix(version, "2.") {
+			file["filesystem"] = "root"
+		} else {
+			file["overwrite"] = true
+		}
+		mergedFiles = append(mergedFiles, file)
+	}
+	storage["files"] = mergedFiles
+
+	return json.Marshal(config)
+}
+
+// ipFamilies returns whether the interface is configured with IPv4 and IPv6
+// addresses, either static or from DHCP.
+func ipFamilies(iface infrav1.NetworkInterfaceSpec) (v4, v6 bool) {
+	v4, v6 = iface.DHCP4, iface.DHCP6
+	for _, ipStr := range iface.IPAddrs {
+		ip, _, err := net.ParseCIDR(ipStr)
+		if err != nil {
+			continue
+		}
+		if ip.To4() == nil {
+			v6 = true
+		} else {
+			v4 = true
+		}
+	}
+	return v4, v6
+}
+
+// getMachineNetworkDevices returns a copy of the network devices of the
+// VSphereVM with the MAC addresses of the network statuses.
+func getMachineNetworkDevices(vsphereVM infrav1.VSphereVM, networkStatuses []infrav1.NetworkStatus) []infrav1.NetworkDeviceSpec {
+	devices := make([]infrav1.NetworkDeviceSpec, integer.IntMax(len(vsphereVM.Spec.Network.Devices), len(networkStatuses)))
+	for i := range vsphereVM.Spec.Network.Devices {
+		vsphereVM.Spec.Network.Devices[i].DeepCopyInto(&devices[i])
+	}
+	for i, status := range networkStatuses {
+		devices[i].MACAddr = status.MACAddr
+	}
+	return devices
+}
+
 const (
 	// ProviderIDPrefix is the string data prefixed to a BIOS UUID in order
 	// to build a provider ID.
@@ -17,6 +17,9 @@ limitations under the License.
 package util_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/onsi/gomega"
@@ -636,6 +639,139 @@ network:
       wakeonlan: true
       dhcp4: false
       dhcp6: true
+`,
+		},
+		{
+			name: "bond-vlan",
+			machine: &infrav1.VSphereVM{
+				Spec: infrav1.VSphereVMSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+						Network: infrav1.NetworkSpec{
+							Devices: []infrav1.NetworkDeviceSpec{
+								{
+									NetworkName: "network1",
+									MACAddr:     "00:00:00:00:00",
+								},
+								{
+									NetworkName: "network1",
+									MACAddr:     "00:00:00:00:01",
+								},
+							},
+							Bonds: []infrav1.NetworkBondSpec{
+								{
+									Name:       "bond0",
+									Interfaces: []string{"eth0", "eth1"},
+									Mode:       "802.3ad",
+									LACPRate:   "fast",
+								},
+							},
+							VLANs: []infrav1.NetworkVLANSpec{
+								{
+									Name: "bond0.100",
+									ID:   100,
+									Link: "bond0",
+									NetworkInterfaceSpec: infrav1.NetworkInterfaceSpec{
+										IPAddrs:     []string{"192.168.4.21/24"},
+										Gateway4:    "192.168.4.1",
+										Nameservers: []string{"1.1.1.1"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expected: `
+instance-id: "test-vm"
+local-hostname: "test-vm"
+wait-on-network:
+  ipv4: true
+  ipv6: false
+network:
+  version: 2
+  ethernets:
+    id0:
+      match:
+        macaddress: "00:00:00:00:00"
+      set-name: "eth0"
+      wakeonlan: true
+    id1:
+      match:
+        macaddress: "00:00:00:00:01"
+      set-name: "eth1"
+      wakeonlan: true
+  bonds:
+    bond0:
+      interfaces:
+      - id0
+      - id1
+      parameters:
+        mode: "802.3ad"
+        lacp-rate: "fast"
+  vlans:
+    bond0.100:
+      id: 100
+      link: bond0
+      addresses:
+      - "192.168.4.21/24"
+      gateway4: "192.168.4.1"
+      nameservers:
+        addresses:
+        - "1.1.1.1"
+`,
+		},
+		{
+			name: "windows-static4+dhcp6+static-routes",
+			machine: &infrav1.VSphereVM{
+				Spec: infrav1.VSphereVMSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+						OS: infrav1.Windows,
+						Network: infrav1.NetworkSpec{
+							Devices: []infrav1.NetworkDeviceSpec{
+								{
+									NetworkName: "network1",
+									MACAddr:     "00:00:00:00:00",
+									DHCP6:       true,
+									IPAddrs:     []string{"192.168.4.21/24"},
+									Gateway4:    "192.168.4.1",
+									Nameservers: []string{"1.1.1.1"},
+									Routes: []infrav1.NetworkRouteSpec{
+										{To: "10.0.0.0/8", Via: "192.168.4.254", Metric: 3},
+									},
+								},
+							},
+							Routes: []infrav1.NetworkRouteSpec{
+								{To: "172.16.1.1", Via: "192.168.4.253", Metric: 5},
+							},
+						},
+					},
+				},
+			},
+			expected: `
+instance-id: "test-vm"
+local-hostname: "test-vm"
+network:
+  version: 1
+  config:
+  - type: physical
+    name: "eth0"
+    mac_address: "00:00:00:00:00"
+    subnets:
+    - type: dhcp6
+    - type: static
+      address: "192.168.4.21/24"
+      gateway: "192.168.4.1"
+      dns_nameservers:
+      - "1.1.1.1"
+      routes:
+      - network: "10.0.0.0"
+        netmask: "255.0.0.0"
+        gateway: "192.168.4.254"
+        metric: 3
+      - network: "172.16.1.1"
+        netmask: "255.255.255.255"
+        gateway: "192.168.4.253"
+        metric: 5
 `,
 		},
 	}
@@ -657,6 +793,124 @@ network:
 	}
 }
 
+func Test_GetMachineIgnitionConfig(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	vsphereVM := infrav1.VSphereVM{
+		Spec: infrav1.VSphereVMSpec{
+			VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+				Network: infrav1.NetworkSpec{
+					Devices: []infrav1.NetworkDeviceSpec{
+						{
+							NetworkName:   "network1",
+							IPAddrs:       []string{"192.168.4.21/24"},
+							Gateway4:      "192.168.4.1",
+							Nameservers:   []string{"1.1.1.1"},
+							SearchDomains: []string{"vmware.ci", "capv.io"},
+						},
+					},
+					Routes: []infrav1.NetworkRouteSpec{
+						{To: "10.0.0.0/8", Via: "192.168.4.254", Metric: 3},
+					},
+				},
+			},
+		},
+	}
+	networkStatuses := []infrav1.NetworkStatus{{MACAddr: "00:00:00:00:00"}}
+
+	testCases := []struct {
+		name          string
+		bootstrapData string
+		expectedFile  map[string]interface{}
+		expectedErr   bool
+	}{
+		{
+			name:          "spec v3",
+			bootstrapData: `{"ignition":{"version":"3.1.0"},"storage":{"files":[{"path":"/etc/kubeadm.yml"}]}}`,
+			expectedFile:  map[string]interface{}{"overwrite": true},
+		},
+		{
+			name:          "spec v3 with a file of the VM",
+			bootstrapData: `{"ignition":{"version":"3.1.0"},"storage":{"files":[{"path":"/etc/hostname","contents":{"source":"data:,localhost"}}]}}`,
+			expectedFile:  map[string]interface{}{"overwrite": true},
+		},
+		{
+			name:          "spec v2",
+			bootstrapData: `{"ignition":{"version":"2.3.0"}}`,
+			expectedFile:  map[string]interface{}{"filesystem": "root"},
+		},
+		{
+			name:          "unsupported version",
+			bootstrapData: `{"ignition":{"version":"1.0.0"}}`,
+			expectedErr:   true,
+		},
+		{
+			name:          "not an Ignition config",
+			bootstrapData: "#cloud-config",
+			expectedErr:   true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actVal, err := util.GetMachineIgnitionConfig("test-vm", vsphereVM, []byte(tc.bootstrapData), networkStatuses...)
+			if tc.expectedErr {
+				g.Expect(err).To(gomega.HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+
+			var config struct {
+				Storage struct {
+					Files []map[string]interface{} `json:"files"`
+				} `json:"storage"`
+			}
+			g.Expect(json.Unmarshal(actVal, &config)).To(gomega.Succeed())
+
+			files := map[string]string{}
+			paths := map[string]bool{}
+			for _, file := range config.Storage.Files {
+				path := file["path"].(string)
+				g.Expect(paths).NotTo(gomega.HaveKey(path), "duplicate file")
+				paths[path] = true
+				contents, ok := file["contents"].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for k, v := range tc.expectedFile {
+					g.Expect(file).To(gomega.HaveKeyWithValue(k, v), path)
+				}
+				source := strings.TrimPrefix(contents["source"].(string), "data:;base64,")
+				data, err := base64.StdEncoding.DecodeString(source)
+				g.Expect(err).NotTo(gomega.HaveOccurred())
+				files[path] = string(data)
+			}
+			g.Expect(files).To(gomega.HaveKeyWithValue("/etc/hostname", "test-vm\n"))
+			g.Expect(files).To(gomega.HaveKeyWithValue("/etc/systemd/network/10-capv-id0.link", `[Match]
+MACAddress=00:00:00:00:00
+
+[Link]
+Name=eth0
+WakeOnLan=magic
+`))
+			g.Expect(files).To(gomega.HaveKeyWithValue("/etc/systemd/network/10-capv-id0.network", `[Match]
+MACAddress=00:00:00:00:00
+
+[Network]
+Address=192.168.4.21/24
+Gateway=192.168.4.1
+DNS=1.1.1.1
+Domains=vmware.ci capv.io
+
+[Route]
+Destination=10.0.0.0/8
+Gateway=192.168.4.254
+Metric=3
+`))
+		})
+	}
+}
+
 func TestConvertProviderIDToUUID(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 